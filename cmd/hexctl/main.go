@@ -0,0 +1,430 @@
+// Command hexctl is an admin tool for inspecting and editing the hex map, either through the web server's HTTP API or
+// directly against mongo through the persistence package. With --driver sqlite or postgres, --mongo takes the SQLite
+// file or Postgres connection string instead.
+//
+//	hexctl [--api URL | --mongo URL [--db name] [--collection name] [--driver d] [--timeout d]] [--json] <command> [args]
+//
+// Commands:
+//
+//	get x.y.z                                 show a single loc
+//	put x.y.z --status=s                      insert or update a loc
+//	rm x.y.z                                  delete a loc
+//	ls [--near x.y.z --radius n]              list locs, optionally only those within radius of a loc
+//	grid build --shape hex|rect --radius n    build a grid and print it, or store it with --save
+//	export [--file f] [--format f]            write every loc as jsonl, csv or hexjson
+//	import [--file f] [--format f] [--policy p] [--dry-run]
+//	                                          read locs and store them, skipping, overwriting or failing on duplicates
+//	render [--format ascii|svg] [--layout pointy|flat] [--size n] [--radius n] [--file f]
+//	                                          draw the stored map, or a fresh hex grid of --radius
+//	migrate [--dry-run]                       apply pending schema migrations, with --mongo only
+//	indexes [--ensure]                        report missing and extra indexes, creating the missing ones with
+//	                                          --ensure, with --mongo only
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+
+	"webstuff/mapio"
+	per "webstuff/persistence"
+	"webstuff/persistence/migrations"
+	"webstuff/render"
+	"webstuff/types"
+)
+
+const (
+	defaultAPI        string = "http://localhost:3210"
+	defaultDbName     string = "testDB"
+	defaultCollection string = "testCollection"
+)
+
+// cli carries the resolved store and output settings into each command
+type cli struct {
+	store locStore
+	out   printer
+	in    io.Reader
+}
+
+type command func(c *cli, args []string) error
+
+var commands = map[string]command{
+	"get":     (*cli).get,
+	"put":     (*cli).put,
+	"rm":      (*cli).rm,
+	"ls":      (*cli).ls,
+	"grid":    (*cli).grid,
+	"export":  (*cli).export,
+	"import":  (*cli).importLocs,
+	"render":  (*cli).render,
+	"migrate": (*cli).migrate,
+	"indexes": (*cli).indexes,
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "hexctl: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("hexctl", flag.ContinueOnError)
+	apiURL := fs.String("api", defaultAPI, "base URL of the web server")
+	mongoURL := fs.String("mongo", "", "talk to mongo directly at this URL instead of the web server")
+	dbName := fs.String("db", defaultDbName, "mongo DB name, with --mongo")
+	collection := fs.String("collection", defaultCollection, "mongo collection name, with --mongo")
+	driver := fs.String("driver", per.DriverOfficial, "storage driver, official, mgo, sqlite or postgres, with --mongo")
+	timeout := fs.Duration("timeout", per.DefaultReadTimeout, "limit on each mongo read and write, with --mongo")
+	jsonMode := fs.Bool("json", false, "print JSON instead of a table")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("missing command")
+	}
+
+	c := &cli{
+		out: printer{out: stdout, jsonMode: *jsonMode},
+		in:  stdin,
+	}
+	if *mongoURL != "" {
+		logger := log.New(os.Stderr, "hexctl: ", log.Ldate|log.Ltime)
+		cfg := per.Config{Driver: *driver, URL: *mongoURL, DBName: *dbName, ReadTimeout: *timeout, WriteTimeout: *timeout}
+		mdb, err := per.Open(cfg, logger)
+		if err != nil {
+			return err
+		}
+		c.store = &mongoStore{
+			ctx:        context.Background(),
+			mongoDB:    mdb,
+			writer:     per.NewAudited(mdb).As("hexctl"),
+			collection: *collection,
+		}
+	} else {
+		c.store = newHTTPStore(*apiURL)
+	}
+	return c.dispatch(fs.Args())
+}
+
+func (c *cli) dispatch(args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+	return cmd(c, args[1:])
+}
+
+func (c *cli) get(args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	id, err := parseWithLoc(fs, args)
+	if err != nil {
+		return err
+	}
+	loc, err := c.store.Get(id)
+	if err != nil {
+		return err
+	}
+	return c.out.Loc(loc)
+}
+
+func (c *cli) put(args []string) error {
+	fs := flag.NewFlagSet("put", flag.ContinueOnError)
+	status := fs.String("status", "new", "status to store on the loc")
+	id, err := parseWithLoc(fs, args)
+	if err != nil {
+		return err
+	}
+	loc, _ := types.LocFromString(id)
+	loc.Status = *status
+	if err = c.store.Put(loc); err != nil {
+		return err
+	}
+	return c.out.Loc(loc)
+}
+
+func (c *cli) rm(args []string) error {
+	fs := flag.NewFlagSet("rm", flag.ContinueOnError)
+	id, err := parseWithLoc(fs, args)
+	if err != nil {
+		return err
+	}
+	if err = c.store.Remove(id); err != nil {
+		return err
+	}
+	return c.out.Message("%s deleted", id)
+}
+
+func (c *cli) ls(args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ContinueOnError)
+	near := fs.String("near", "", "only list locs near this x.y.z")
+	radius := fs.Int("radius", 1, "distance from --near to include")
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return err
+	}
+	locs, err := c.store.List()
+	if err != nil {
+		return err
+	}
+	if *near == "" {
+		sortLocs(locs)
+		return c.out.Locs(locs)
+	}
+	center, err := types.LocFromString(*near)
+	if err != nil {
+		return err
+	}
+	return c.out.Locs(nearby(locs, center, *radius))
+}
+
+func (c *cli) grid(args []string) error {
+	if len(args) == 0 || args[0] != "build" {
+		return fmt.Errorf("usage: grid build --shape hex|rect --radius n [--save]")
+	}
+	fs := flag.NewFlagSet("grid build", flag.ContinueOnError)
+	shape := fs.String("shape", "hex", "grid shape: hex or rect")
+	radius := fs.Int("radius", 10, "distance from the center to the edge of the grid")
+	save := fs.Bool("save", false, "store every loc of the grid instead of printing it")
+	if _, err := parseInterspersed(fs, args[1:]); err != nil {
+		return err
+	}
+	g := types.Grid{}
+	switch *shape {
+	case "hex":
+		g.BuildHex(*radius)
+	case "rect":
+		g.Build(*radius*2, *radius*2)
+	default:
+		return fmt.Errorf("unknown grid shape: %s", *shape)
+	}
+	if !*save {
+		return c.out.Locs(g.Locs())
+	}
+	for _, loc := range g.Locs() {
+		if err := c.store.Put(loc); err != nil {
+			return fmt.Errorf("storing %s: %s", loc.GetID(), err)
+		}
+	}
+	return c.out.Message("stored %d locs", g.Len())
+}
+
+func (c *cli) export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	file := fs.String("file", "", "write to this file instead of stdout")
+	format := fs.String("format", mapio.FormatJSONL, "jsonl, csv or hexjson")
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return err
+	}
+	locs, err := c.store.List()
+	if err != nil {
+		return err
+	}
+	sortLocs(locs)
+	w := c.out.out
+	if *file != "" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return mapio.Export(w, *format, locs)
+}
+
+func (c *cli) importLocs(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	file := fs.String("file", "", "read from this file instead of stdin")
+	format := fs.String("format", mapio.FormatJSONL, "jsonl, csv or hexjson")
+	policyName := fs.String("policy", string(mapio.PolicyFail), "what to do with locs that already exist: skip, overwrite or fail")
+	dryRun := fs.Bool("dry-run", false, "validate and report without writing")
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return err
+	}
+	policy, err := mapio.ParsePolicy(*policyName)
+	if err != nil {
+		return err
+	}
+	r := c.in
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	locs, err := mapio.Decode(r, *format)
+	if err != nil {
+		return err
+	}
+	report, err := mapio.Import(storeTarget{c.store}, locs, mapio.Options{Policy: policy, DryRun: *dryRun})
+	if err != nil {
+		if len(report.Conflicts) > 0 {
+			return fmt.Errorf("%s: %v", err, report.Conflicts)
+		}
+		return err
+	}
+	verb := "imported"
+	if report.DryRun {
+		verb = "would import"
+	}
+	return c.out.Message("%s %d locs: %d inserted, %d updated, %d skipped",
+		verb, len(locs), report.Inserted, report.Updated, report.Skipped)
+}
+
+func (c *cli) render(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	format := fs.String("format", "ascii", "ascii or svg")
+	layout := fs.String("layout", string(types.PointyTop), "svg hex orientation: pointy or flat")
+	size := fs.Float64("size", render.DefaultSize, "svg hex size, center to corner")
+	labels := fs.Bool("labels", false, "label each svg hex with its id")
+	radius := fs.Int("radius", -1, "draw a fresh hex grid of this radius instead of the stored map")
+	file := fs.String("file", "", "write to this file instead of stdout")
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return err
+	}
+	orientation, err := types.ParseOrientation(*layout)
+	if err != nil {
+		return err
+	}
+	g := types.Grid{}
+	if *radius >= 0 {
+		g.BuildHex(*radius)
+	} else {
+		locs, err := c.store.List()
+		if err != nil {
+			return err
+		}
+		g = types.GridFromLocs(locs)
+	}
+	w := c.out.out
+	if *file != "" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	switch *format {
+	case "ascii":
+		_, err = io.WriteString(w, render.ASCII(&g, nil))
+		return err
+	case "svg":
+		return render.SVG(w, &g, render.Options{Orientation: orientation, Size: *size, Labels: *labels})
+	}
+	return fmt.Errorf("unknown render format: %s", *format)
+}
+
+func (c *cli) migrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report how many locs each migration would change without writing")
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return err
+	}
+	ms, ok := c.store.(*mongoStore)
+	if !ok {
+		return fmt.Errorf("migrate talks to mongo directly and needs --mongo")
+	}
+	colls, err := per.LocCollections(ms.ctx, ms.mongoDB, ms.collection)
+	if err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+	results, err := migrations.NewRunner(ms.mongoDB, fmt.Sprintf("hexctl@%s:%d", host, os.Getpid())).Run(ms.ctx, colls, *dryRun)
+	if printErr := c.out.Migrations(results); printErr != nil {
+		return printErr
+	}
+	return err
+}
+
+func (c *cli) indexes(args []string) error {
+	fs := flag.NewFlagSet("indexes", flag.ContinueOnError)
+	ensure := fs.Bool("ensure", false, "create missing indexes before reporting")
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return err
+	}
+	ms, ok := c.store.(*mongoStore)
+	if !ok {
+		return fmt.Errorf("indexes talks to mongo directly and needs --mongo")
+	}
+	ix, ok := ms.mongoDB.(per.Indexer)
+	if !ok {
+		return fmt.Errorf("this store can't manage indexes")
+	}
+	colls, err := per.LocCollections(ms.ctx, ms.mongoDB, ms.collection)
+	if err != nil {
+		return err
+	}
+	plan := per.DefaultIndexPlan(colls...)
+	var reports []per.IndexReport
+	if *ensure {
+		reports, err = per.EnsureIndexPlan(ms.ctx, ix, plan)
+	} else {
+		reports, err = per.CheckIndexPlan(ms.ctx, ix, plan)
+	}
+	if printErr := c.out.Indexes(reports); printErr != nil {
+		return printErr
+	}
+	return err
+}
+
+// parseInterspersed parses flags that may appear before or after positional args, returning the positional args
+func parseInterspersed(fs *flag.FlagSet, args []string) (positional []string, err error) {
+	for {
+		if err = fs.Parse(args); err != nil {
+			return
+		}
+		if fs.NArg() == 0 {
+			return
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// parseWithLoc parses flags around exactly one x.y.z positional arg and returns it
+func parseWithLoc(fs *flag.FlagSet, args []string) (string, error) {
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return "", err
+	}
+	if len(positional) != 1 {
+		return "", fmt.Errorf("%s expects a single x.y.z argument", fs.Name())
+	}
+	loc, err := types.LocFromString(positional[0])
+	if err != nil {
+		return "", err
+	}
+	return loc.GetID(), nil
+}
+
+// nearby returns the locs within radius of center, closest first
+func nearby(locs []types.Loc, center types.Loc, radius int) []types.Loc {
+	result := []types.Loc{}
+	for _, loc := range locs {
+		if center.DistanceFrom(loc) <= radius {
+			result = append(result, loc)
+		}
+	}
+	sortLocs(result)
+	sort.SliceStable(result, func(i, j int) bool {
+		return center.DistanceFrom(result[i]) < center.DistanceFrom(result[j])
+	})
+	return result
+}
+
+// sortLocs orders locs by x then y so output is stable between runs
+func sortLocs(locs []types.Loc) {
+	sort.Slice(locs, func(i, j int) bool {
+		if locs[i].X != locs[j].X {
+			return locs[i].X < locs[j].X
+		}
+		return locs[i].Y < locs[j].Y
+	})
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	per "webstuff/persistence"
+	"webstuff/persistence/fake"
+	"webstuff/types"
+)
+
+func TestCommands(t *testing.T) {
+	t.Run("Put then get", func(t *testing.T) {
+		c, out, _ := NewCliWithMemStore()
+		err := c.dispatch([]string{"put", "1.-1.0", "--status=claimed"})
+		require.NoErrorf(t, err, "Didn't want an error on put. Got: %s", err)
+		out.Reset()
+
+		err = c.dispatch([]string{"get", "1.-1.0"})
+		require.NoErrorf(t, err, "Didn't want an error on get. Got: %s", err)
+		require.Contains(t, out.String(), "claimed")
+	})
+	t.Run("Get missing", func(t *testing.T) {
+		c, _, _ := NewCliWithMemStore()
+		err := c.dispatch([]string{"get", "1.-1.0"})
+		require.Error(t, err, "Missing loc should surface the store error")
+	})
+	t.Run("Bad loc string", func(t *testing.T) {
+		c, _, _ := NewCliWithMemStore()
+		err := c.dispatch([]string{"rm", "1,2,3"})
+		require.Error(t, err, "Malformed loc should be rejected before hitting the store")
+		require.Contains(t, err.Error(), "x.y.z")
+	})
+	t.Run("Unknown command", func(t *testing.T) {
+		c, _, _ := NewCliWithMemStore()
+		err := c.dispatch([]string{"frobnicate"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unknown command")
+	})
+	t.Run("Grid build saves", func(t *testing.T) {
+		c, out, store := NewCliWithMemStore()
+		err := c.dispatch([]string{"grid", "build", "--shape", "hex", "--radius", "2", "--save"})
+		require.NoErrorf(t, err, "Didn't want an error on grid build. Got: %s", err)
+		require.Len(t, store.locs, 19)
+		require.Contains(t, out.String(), "stored 19 locs")
+	})
+	t.Run("Ls near", func(t *testing.T) {
+		c, out, _ := NewCliWithMemStore()
+		c.out.jsonMode = true
+		require.NoError(t, c.dispatch([]string{"grid", "build", "--radius", "3", "--save"}))
+		out.Reset()
+
+		err := c.dispatch([]string{"ls", "--near", "3.-3.0", "--radius", "1"})
+		require.NoErrorf(t, err, "Didn't want an error on ls. Got: %s", err)
+		require.Equal(t, 4, strings.Count(out.String(), `"id"`), "Corner hex should have 3 neighbors inside the grid")
+		require.True(t, strings.Index(out.String(), `"3.-3.0"`) < strings.Index(out.String(), `"2.-2.0"`), "Closest loc should list first")
+	})
+	t.Run("Export then import", func(t *testing.T) {
+		c, out, _ := NewCliWithMemStore()
+		require.NoError(t, c.dispatch([]string{"grid", "build", "--radius", "1", "--save"}))
+		out.Reset()
+		require.NoError(t, c.dispatch([]string{"export"}))
+		exported := out.String()
+		require.Equal(t, 7, strings.Count(exported, "\n"))
+
+		c2, out2, store2 := NewCliWithMemStore()
+		c2.in = strings.NewReader(exported)
+		err := c2.dispatch([]string{"import"})
+		require.NoErrorf(t, err, "Didn't want an error on import. Got: %s", err)
+		require.Len(t, store2.locs, 7)
+		require.Contains(t, out2.String(), "imported 7 locs: 7 inserted")
+	})
+	t.Run("Import duplicates", func(t *testing.T) {
+		c, out, store := NewCliWithMemStore()
+		require.NoError(t, c.dispatch([]string{"put", "0.0.0", "--status=claimed"}))
+		input := "id,x,y,z,status\n0.0.0,0,0,0,new\n1.-1.0,1,-1,0,new\n"
+
+		c.in = strings.NewReader(input)
+		err := c.dispatch([]string{"import", "--format=csv"})
+		require.Error(t, err, "Default policy should fail on duplicates")
+		require.Contains(t, err.Error(), "0.0.0")
+		require.Len(t, store.locs, 1)
+
+		c.in = strings.NewReader(input)
+		out.Reset()
+		require.NoError(t, c.dispatch([]string{"import", "--format=csv", "--policy=skip", "--dry-run"}))
+		require.Contains(t, out.String(), "would import 2 locs: 1 inserted, 0 updated, 1 skipped")
+		require.Len(t, store.locs, 1)
+
+		c.in = strings.NewReader(input)
+		require.NoError(t, c.dispatch([]string{"import", "--format=csv", "--policy=overwrite"}))
+		require.Equal(t, "new", store.locs["0.0.0"].Status)
+		require.Len(t, store.locs, 2)
+	})
+	t.Run("Migrate needs mongo", func(t *testing.T) {
+		c, _, _ := NewCliWithMemStore()
+		err := c.dispatch([]string{"migrate", "--dry-run"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "--mongo")
+	})
+	t.Run("Indexes need mongo", func(t *testing.T) {
+		c, _, _ := NewCliWithMemStore()
+		err := c.dispatch([]string{"indexes"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "--mongo")
+	})
+	t.Run("Unknown driver", func(t *testing.T) {
+		err := run([]string{"--mongo", "localhost:27017", "--driver", "nope", "ls"}, strings.NewReader(""), &bytes.Buffer{})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unknown mongo driver")
+	})
+	t.Run("SQLite driver", func(t *testing.T) {
+		db := filepath.Join(t.TempDir(), "hexes.db")
+		err := run([]string{"--mongo", db, "--driver", "sqlite", "put", "1.-1.0", "--status=claimed"}, strings.NewReader(""), &bytes.Buffer{})
+		require.NoErrorf(t, err, "Didn't want an error on put. Got: %s", err)
+		out := &bytes.Buffer{}
+		require.NoError(t, run([]string{"--mongo", db, "--driver", "sqlite", "get", "1.-1.0"}, strings.NewReader(""), out))
+		require.Contains(t, out.String(), "claimed")
+	})
+	t.Run("Render", func(t *testing.T) {
+		c, out, _ := NewCliWithMemStore()
+		require.NoError(t, c.dispatch([]string{"put", "0.0.0", "--status=water"}))
+		out.Reset()
+		require.NoError(t, c.dispatch([]string{"render"}))
+		require.Equal(t, "~\n", out.String())
+
+		out.Reset()
+		require.NoError(t, c.dispatch([]string{"render", "--format=svg", "--radius=2", "--layout=flat"}))
+		require.Equal(t, 19, strings.Count(out.String(), "<polygon"))
+
+		err := c.dispatch([]string{"render", "--format=png"})
+		require.Error(t, err)
+	})
+}
+
+func TestHTTPStore(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/loc/1.2.3":
+			loc, _ := types.LocFromString("1.2.3")
+			w.Write(loc.JSONForm())
+		case r.Method == http.MethodGet && r.URL.Path == "/locs":
+			w.Write([]byte(`[{"id":"0.0.0","x":0,"y":0,"z":0,"status":"new"}]`))
+		case r.Method == http.MethodPut && r.URL.Query().Get("status") == "claimed":
+			fmt.Fprintf(w, "Updated: %s", strings.TrimPrefix(r.URL.Path, "/loc/"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "%s doesn't exist in DB", strings.TrimPrefix(r.URL.Path, "/loc/"))
+		}
+	}))
+	defer server.Close()
+	hs := newHTTPStore(server.URL + "/")
+
+	t.Run("Get", func(t *testing.T) {
+		loc, err := hs.Get("1.2.3")
+		require.NoErrorf(t, err, "Didn't want an error on get. Got: %s", err)
+		require.Equal(t, 2, loc.Y)
+	})
+	t.Run("List", func(t *testing.T) {
+		locs, err := hs.List()
+		require.NoErrorf(t, err, "Didn't want an error on list. Got: %s", err)
+		require.Len(t, locs, 1)
+	})
+	t.Run("Put", func(t *testing.T) {
+		loc, _ := types.LocFromString("1.2.3")
+		loc.Status = "claimed"
+		require.NoError(t, hs.Put(loc))
+	})
+	t.Run("Not found", func(t *testing.T) {
+		err := hs.Remove("4.5.6")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "404")
+	})
+}
+
+func TestMongoStore(t *testing.T) {
+	newStore := func() (*fake.Store, *mongoStore) {
+		store := fake.New()
+		return store, &mongoStore{ctx: context.Background(), mongoDB: store, writer: per.NewAudited(store).As("hexctl"), collection: "locs"}
+	}
+
+	t.Run("Put inserts then updates", func(t *testing.T) {
+		store, ms := newStore()
+		loc, _ := types.LocFromString("1.-1.0")
+		loc.Status = "claimed"
+		require.NoError(t, ms.Put(loc))
+		loc.Status = "water"
+		require.NoError(t, ms.Put(loc))
+
+		require.Len(t, store.Calls("WriteCollection"), 1)
+		require.Len(t, store.Calls("UpdateCollection"), 1)
+		got, err := ms.Get("1.-1.0")
+		require.NoError(t, err)
+		require.Equal(t, "water", got.Status)
+	})
+	t.Run("Put keeps properties", func(t *testing.T) {
+		store, ms := newStore()
+		stored, _ := types.LocFromString("1.-1.0")
+		stored.Properties = &types.Properties{Terrain: "forest"}
+		store.Seed("locs", stored)
+		loc, _ := types.LocFromString("1.-1.0")
+		loc.Status = "claimed"
+		require.NoError(t, ms.Put(loc))
+
+		got, err := ms.Get("1.-1.0")
+		require.NoError(t, err)
+		require.Equal(t, "claimed", got.Status)
+		require.Equal(t, stored.Properties, got.Properties, "Properties should survive a put")
+	})
+	t.Run("Put returns fetch errors", func(t *testing.T) {
+		store, ms := newStore()
+		store.OnFetch("1.-1.0").Fail(per.ErrUnreachable)
+		loc, _ := types.LocFromString("1.-1.0")
+
+		err := ms.Put(loc)
+		require.ErrorIs(t, err, per.ErrUnreachable)
+		require.Empty(t, store.Calls("WriteCollection", "UpdateCollection"), "Nothing should be written when the fetch failed")
+	})
+	t.Run("Writes are audited", func(t *testing.T) {
+		_, ms := newStore()
+		loc, _ := types.LocFromString("1.-1.0")
+		require.NoError(t, ms.Put(loc))
+		require.NoError(t, ms.Remove(loc.GetID()))
+
+		events, err := ms.writer.(*per.Audited).History(context.Background(), "locs", loc.GetID())
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		require.Equal(t, []string{"hexctl", "hexctl"}, []string{events[0].Actor, events[1].Actor})
+		require.Equal(t, []string{per.OpInsert, per.OpDelete}, []string{events[0].Op, events[1].Op})
+	})
+}
+
+/*** Helper functions ***/
+
+// memStore is an in-memory locStore for exercising commands without a server or mongo
+type memStore struct {
+	locs map[string]types.Loc
+}
+
+func (ms *memStore) Get(id string) (types.Loc, error) {
+	loc, ok := ms.locs[id]
+	if !ok {
+		return loc, fmt.Errorf("not found")
+	}
+	return loc, nil
+}
+
+func (ms *memStore) Put(loc types.Loc) error {
+	ms.locs[loc.GetID()] = loc
+	return nil
+}
+
+func (ms *memStore) Remove(id string) error {
+	if _, ok := ms.locs[id]; !ok {
+		return fmt.Errorf("not found")
+	}
+	delete(ms.locs, id)
+	return nil
+}
+
+func (ms *memStore) List() ([]types.Loc, error) {
+	result := []types.Loc{}
+	for _, loc := range ms.locs {
+		result = append(result, loc)
+	}
+	return result, nil
+}
+
+func NewCliWithMemStore() (*cli, *bytes.Buffer, *memStore) {
+	out := &bytes.Buffer{}
+	store := &memStore{locs: map[string]types.Loc{}}
+	c := &cli{
+		store: store,
+		out:   printer{out: out},
+		in:    strings.NewReader(""),
+	}
+	return c, out, store
+}
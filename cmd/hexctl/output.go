@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	per "webstuff/persistence"
+	"webstuff/persistence/migrations"
+	"webstuff/types"
+)
+
+// printer writes locs either as an aligned table or as indented JSON
+type printer struct {
+	out      io.Writer
+	jsonMode bool
+}
+
+// Loc prints a single loc
+func (p printer) Loc(loc types.Loc) error {
+	if p.jsonMode {
+		return p.json(loc)
+	}
+	return p.Locs([]types.Loc{loc})
+}
+
+// Locs prints a list of locs, one row per loc
+func (p printer) Locs(locs []types.Loc) error {
+	if p.jsonMode {
+		if locs == nil {
+			locs = []types.Loc{}
+		}
+		return p.json(locs)
+	}
+	tw := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "ID\tX\tY\tZ\tSTATUS\t")
+	for _, loc := range locs {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t\n", loc.ID, loc.X, loc.Y, loc.Z, loc.Status)
+	}
+	return tw.Flush()
+}
+
+// Migrations prints one row per migration and collection, saying whether it was applied, skipped or only tried
+func (p printer) Migrations(results []migrations.Result) error {
+	if p.jsonMode {
+		return p.json(results)
+	}
+	tw := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "COLLECTION\tVERSION\tNAME\tCHANGED\tSTATE\t")
+	for _, r := range results {
+		state := "applied"
+		switch {
+		case r.Skipped:
+			state = "skipped"
+		case r.DryRun:
+			state = "dry run"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%s\t\n", r.Collection, r.Version, r.Name, r.Changed, state)
+	}
+	return tw.Flush()
+}
+
+// Indexes prints one row per index of each report, saying whether it is present, missing or extra
+func (p printer) Indexes(reports []per.IndexReport) error {
+	if p.jsonMode {
+		return p.json(reports)
+	}
+	tw := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "COLLECTION\tINDEX\tUNIQUE\tSTATE\t")
+	for _, r := range reports {
+		states := []string{"present", "missing", "extra"}
+		for i, specs := range [][]per.IndexSpec{r.Present, r.Missing, r.Extra} {
+			for _, spec := range specs {
+				fmt.Fprintf(tw, "%s\t%s\t%t\t%s\t\n", r.Collection, spec.Name(), spec.Unique, states[i])
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+// Message prints a one line confirmation, wrapped in an object when in JSON mode
+func (p printer) Message(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if p.jsonMode {
+		return p.json(map[string]string{"result": msg})
+	}
+	_, err := fmt.Fprintln(p.out, msg)
+	return err
+}
+
+func (p printer) json(v interface{}) error {
+	enc := json.NewEncoder(p.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	per "webstuff/persistence"
+	"webstuff/types"
+)
+
+// locStore is the set of map operations hexctl needs, independent of whether they go over HTTP or straight to mongo
+type locStore interface {
+	Get(id string) (types.Loc, error)
+	Put(loc types.Loc) error
+	Remove(id string) error
+	List() ([]types.Loc, error)
+}
+
+// httpStore talks to a running server through its loc routes
+type httpStore struct {
+	baseURL string
+	client  *http.Client
+}
+
+func newHTTPStore(baseURL string) *httpStore {
+	return &httpStore{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  http.DefaultClient,
+	}
+}
+
+// Get fetches a single loc via GET /loc/:xyz
+func (hs *httpStore) Get(id string) (types.Loc, error) {
+	body, err := hs.do(http.MethodGet, "/loc/"+id)
+	if err != nil {
+		return types.Loc{}, err
+	}
+	return types.LocFromJSON(body)
+}
+
+// Put upserts the loc and its status via PUT /loc/:xyz
+func (hs *httpStore) Put(loc types.Loc) error {
+	_, err := hs.do(http.MethodPut, "/loc/"+loc.GetID()+"?status="+url.QueryEscape(loc.Status))
+	return err
+}
+
+// Remove deletes a single loc via DELETE /loc/:xyz
+func (hs *httpStore) Remove(id string) error {
+	_, err := hs.do(http.MethodDelete, "/loc/"+id)
+	return err
+}
+
+// List fetches every loc via GET /locs
+func (hs *httpStore) List() ([]types.Loc, error) {
+	body, err := hs.do(http.MethodGet, "/locs")
+	if err != nil {
+		return nil, err
+	}
+	result := []types.Loc{}
+	err = json.Unmarshal(body, &result)
+	return result, err
+}
+
+func (hs *httpStore) do(method string, path string) ([]byte, error) {
+	req, err := http.NewRequest(method, hs.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := hs.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: %d %s", method, path, resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+// mongoStore goes directly to mongo through the persistence layer, with ctx bounding every call. Writes go through
+// writer, which records them in the audit log like the server's own writes.
+type mongoStore struct {
+	ctx        context.Context
+	mongoDB    per.MongoAbstraction
+	writer     per.MongoAbstraction
+	collection string
+}
+
+// Get fetches a single loc from the collection
+func (ms *mongoStore) Get(id string) (types.Loc, error) {
+	return ms.mongoDB.FetchFromCollection(ms.ctx, ms.collection, id)
+}
+
+// Put patches the loc onto the stored one if there is one, otherwise inserts it. Errors other than not found are
+// returned as they are, so an unreachable store doesn't turn into an insert.
+func (ms *mongoStore) Put(loc types.Loc) error {
+	stored, err := ms.mongoDB.FetchFromCollection(ms.ctx, ms.collection, loc.GetID())
+	if per.IsNotFound(err) {
+		return ms.writer.WriteCollection(ms.ctx, ms.collection, loc)
+	}
+	if err != nil {
+		return err
+	}
+	return ms.writer.UpdateCollection(ms.ctx, ms.collection, stored.Patched(loc))
+}
+
+// Remove deletes a single loc from the collection
+func (ms *mongoStore) Remove(id string) error {
+	return ms.writer.DeleteFromCollection(ms.ctx, ms.collection, id)
+}
+
+// List fetches every loc in the collection
+func (ms *mongoStore) List() ([]types.Loc, error) {
+	return ms.mongoDB.FetchAllFromCollection(ms.ctx, ms.collection)
+}
+
+// storeTarget adapts a locStore to a mapio import Target
+type storeTarget struct {
+	store locStore
+}
+
+func (st storeTarget) List() ([]types.Loc, error) { return st.store.List() }
+func (st storeTarget) Insert(loc types.Loc) error { return st.store.Put(loc) }
+func (st storeTarget) Update(loc types.Loc) error { return st.store.Put(loc) }
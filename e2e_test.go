@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"webstuff/persistence/fake"
+)
+
+// The e2e tests drive the router from NewServer over real HTTP, so a route that isn't registered or a middleware
+// that isn't attached shows up as a wrong status. Each scenario runs on a fresh fake store and its transcript of
+// requests and responses is compared with testdata/e2e/<scenario>.golden. After an intended change of responses,
+// rewrite the golden files with
+//
+//	go test -run TestE2E -update
+//
+// and review their diff.
+var update = flag.Bool("update", false, "rewrite the e2e golden files with the responses received")
+
+// step is one request of an e2e scenario
+type step struct {
+	method string
+	path   string
+	body   string
+	header map[string]string
+}
+
+// scenario is a series of requests made against one server. setup runs once the server is built, so expectations
+// it adds to the store don't answer the startup calls.
+type scenario struct {
+	name  string
+	setup func(store *fake.Store)
+	steps []step
+}
+
+var scenarios = []scenario{
+	{
+		name: "locs",
+		steps: []step{
+			{method: http.MethodPost, path: "/loc/0.0.0"},
+			{method: http.MethodPost, path: "/loc/0.0.0"},
+			{method: http.MethodGet, path: "/loc/0.0.0"},
+			{method: http.MethodPut, path: "/loc/0.0.0?status=claimed"},
+			{method: http.MethodPut, path: "/loc/a:1,-1"},
+			{method: http.MethodGet, path: "/locs"},
+			{method: http.MethodGet, path: "/export?format=csv"},
+			{method: http.MethodDelete, path: "/loc/0.0.0"},
+			{method: http.MethodGet, path: "/loc/0.0.0"},
+			{method: http.MethodDelete, path: "/loc/0.0.0"},
+		},
+	},
+	{
+		name: "history",
+		steps: []step{
+			{method: http.MethodPost, path: "/loc/1.-1.0", header: map[string]string{actorHeader: "alice"}},
+			{method: http.MethodPut, path: "/loc/1.-1.0?status=claimed", header: map[string]string{actorHeader: "bob"}},
+			{method: http.MethodDelete, path: "/loc/1.-1.0"},
+			{method: http.MethodGet, path: "/loc/1.-1.0/history"},
+		},
+	},
+	{
+		name: "edits",
+		steps: []step{
+			{method: http.MethodPost, path: "/loc/4.-4.0", header: map[string]string{editSessionHeader: "s1"}},
+			{method: http.MethodPost, path: "/edits/undo", header: map[string]string{editSessionHeader: "s1"}},
+			{method: http.MethodGet, path: "/loc/4.-4.0"},
+			{method: http.MethodPost, path: "/edits/redo", header: map[string]string{editSessionHeader: "s1"}},
+			{method: http.MethodGet, path: "/loc/4.-4.0"},
+			{method: http.MethodPost, path: "/edits/undo"},
+		},
+	},
+	{
+		name: "worlds",
+		steps: []step{
+			{method: http.MethodPost, path: "/worlds/north"},
+			{method: http.MethodPost, path: "/worlds/north"},
+			{method: http.MethodGet, path: "/worlds"},
+			{method: http.MethodPost, path: "/worlds/north/loc/1.-1.0"},
+			{method: http.MethodGet, path: "/worlds/north/locs"},
+			{method: http.MethodGet, path: "/locs"},
+			{method: http.MethodDelete, path: "/worlds/north/loc/1.-1.0"},
+			{method: http.MethodDelete, path: "/worlds/north"},
+			{method: http.MethodGet, path: "/worlds/north/locs"},
+		},
+	},
+	{
+		name: "grids",
+		steps: []step{
+			{method: http.MethodPost, path: "/grids?name=arena&radius=1"},
+			{method: http.MethodPost, path: "/grids?name=arena&radius=1"},
+			{method: http.MethodGet, path: "/grids/arena/render.svg?size=10"},
+			{method: http.MethodGet, path: "/hexat?x=17&y=1&size=10"},
+		},
+	},
+	{
+		name: "units",
+		steps: []step{
+			{method: http.MethodPost, path: "/loc/0.0.0"},
+			{method: http.MethodPost, path: "/loc/1.-1.0"},
+			{method: http.MethodPost, path: "/units", body: `{"id": "scout", "owner": "red", "position": "0.0.0", "movePoints": 3, "hp": 10}`},
+			{method: http.MethodPost, path: "/units/scout/move?to=1.-1.0"},
+			{method: http.MethodGet, path: "/loc/1.-1.0/units"},
+			{method: http.MethodPost, path: "/units/scout/move?to=5.-5.0"},
+		},
+	},
+	{
+		name: "errors",
+		steps: []step{
+			{method: http.MethodGet, path: "/loc/o:3"},
+			{method: http.MethodGet, path: "/nowhere"},
+			{method: http.MethodDelete, path: "/locs"},
+			{method: http.MethodGet, path: "/worlds/south/locs"},
+		},
+	},
+	{
+		name: "unavailable",
+		setup: func(store *fake.Store) {
+			store.OnConnect().Fail(errors.New("no reachable servers"))
+		},
+		steps: []step{
+			{method: http.MethodGet, path: "/loc/0.0.0"},
+			{method: http.MethodDelete, path: "/loc/0.0.0"},
+			{method: http.MethodGet, path: "/locs"},
+		},
+	},
+}
+
+func TestE2E(t *testing.T) {
+	for _, sc := range scenarios {
+		t.Run(sc.name, func(t *testing.T) {
+			got := runScenario(t, sc)
+			golden := filepath.Join("testdata", "e2e", sc.name+".golden")
+			if *update {
+				require.NoError(t, ioutil.WriteFile(golden, got, 0644))
+			}
+			want, err := ioutil.ReadFile(golden)
+			require.NoErrorf(t, err, "Missing golden file. Run with -update to create it")
+			require.Equal(t, string(want), string(got))
+		})
+	}
+}
+
+// runScenario makes the scenario's requests against a new server and returns the transcript of what was sent and
+// received
+func runScenario(t *testing.T, sc scenario) []byte {
+	store := fake.New()
+	srv := httptest.NewServer(NewServer(ServerConfig{}, store))
+	defer srv.Close()
+	if sc.setup != nil {
+		sc.setup(store)
+	}
+
+	transcript := &bytes.Buffer{}
+	for _, s := range sc.steps {
+		req, err := http.NewRequest(s.method, srv.URL+s.path, strings.NewReader(s.body))
+		require.NoError(t, err)
+		for name, value := range s.header {
+			req.Header.Set(name, value)
+		}
+		resp, err := srv.Client().Do(req)
+		require.NoErrorf(t, err, "Didn't want an error on %s %s. Got: %s", s.method, s.path, err)
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+
+		fmt.Fprintf(transcript, "%s %s\n", s.method, s.path)
+		for name, value := range s.header {
+			fmt.Fprintf(transcript, "%s: %s\n", name, value)
+		}
+		fmt.Fprintf(transcript, "-> %d %s\n%s\n\n", resp.StatusCode, resp.Header.Get("Content-Type"), scrub(body))
+	}
+	return transcript.Bytes()
+}
+
+var (
+	timestampPattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})`)
+	// sequencePattern matches audit sequence numbers, which are taken from the clock, in event IDs and seq fields, along
+	// with the random instance that ends an event ID
+	sequencePattern = regexp.MustCompile(`("seq":|/)\d{13,}(-[0-9a-f]{8})?`)
+)
+
+// scrub replaces the parts of a response that change from run to run
+func scrub(body []byte) []byte {
+	body = bytes.TrimRight(body, "\n")
+	body = timestampPattern.ReplaceAll(body, []byte("<time>"))
+	return sequencePattern.ReplaceAll(body, []byte("${1}<seq>"))
+}
@@ -0,0 +1,257 @@
+// Package game runs turn based games on a types.Grid. Every player queues one action per turn, and the turn resolves
+// once all players have submitted or the turn times out.
+package game
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"webstuff/types"
+)
+
+// ActionKind names what an action does
+type ActionKind string
+
+// Supported actions
+const (
+	Move  ActionKind = "move"
+	Claim ActionKind = "claim"
+	Pass  ActionKind = "pass"
+)
+
+// Claimed is the Loc.Status given to a loc once a player claims it
+const Claimed = "claimed"
+
+// blocking are the Loc.Status values and terrain types players can't move onto or claim
+var blocking = map[string]bool{
+	"wall":     true,
+	"water":    true,
+	"mountain": true,
+	"blocked":  true,
+}
+
+// Errors for submissions that are refused outright, as opposed to actions that break the rules
+var (
+	ErrUnknownPlayer    = errors.New("player is not in this game")
+	ErrAlreadySubmitted = errors.New("player already submitted an action this turn")
+)
+
+// Action is one player's move for a turn. Target is the loc ID the action applies to and is unused by Pass.
+type Action struct {
+	Player string     `json:"player" bson:"player"`
+	Kind   ActionKind `json:"kind" bson:"kind"`
+	Target string     `json:"target,omitempty" bson:"target,omitempty"`
+}
+
+// Player is a participant and the loc ID they stand on
+type Player struct {
+	ID       string `json:"id" bson:"id"`
+	Position string `json:"position" bson:"position"`
+}
+
+// Result records how an action fared when its turn resolved. Error is empty for actions that were applied.
+type Result struct {
+	Action Action `json:"action" bson:"action"`
+	Error  string `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+// Session is a game in progress. Players are listed in turn order: the queued actions of a turn are applied starting
+// with player Turn mod len(Players), so the first mover rotates each turn.
+type Session struct {
+	ID          string
+	Players     []Player
+	Turn        int
+	TurnTimeout time.Duration
+	Deadline    time.Time
+	Grid        types.Grid
+	LastResults []Result
+	// Version is the stored version the session was loaded or last saved at, 0 until it is stored
+	Version int
+	owners  map[types.CubeKey]string
+	queue   []Action
+}
+
+// NewSession starts a game on turn 0. Every player must start on a distinct loc of the grid. A TurnTimeout of 0 means
+// turns only end when every player has submitted.
+func NewSession(id string, players []Player, grid types.Grid, timeout time.Duration, now time.Time) (*Session, error) {
+	if len(players) == 0 {
+		return nil, fmt.Errorf("a game needs at least one player")
+	}
+	s := &Session{ID: id, TurnTimeout: timeout, Grid: grid, owners: map[types.CubeKey]string{}}
+	seen := map[string]bool{}
+	for _, p := range players {
+		if p.ID == "" || seen[p.ID] {
+			return nil, fmt.Errorf("player IDs must be unique and not empty. Got: %q", p.ID)
+		}
+		seen[p.ID] = true
+		loc, ok := grid.Lookup(p.Position)
+		if !ok {
+			return nil, fmt.Errorf("player %s starts at %s, which is not on the map", p.ID, p.Position)
+		}
+		if other := s.occupant(loc); other != "" {
+			return nil, fmt.Errorf("players %s and %s both start at %s", other, p.ID, loc.ID)
+		}
+		s.Players = append(s.Players, Player{ID: p.ID, Position: loc.ID})
+	}
+	s.startTurn(now)
+	return s, nil
+}
+
+// Submit queues the player's action for the current turn. Actions that can't be applied to the current grid are
+// rejected. Once every player has submitted, the turn resolves immediately.
+func (s *Session) Submit(action Action, now time.Time) error {
+	if s.player(action.Player) == nil {
+		return ErrUnknownPlayer
+	}
+	if s.Submitted(action.Player) {
+		return ErrAlreadySubmitted
+	}
+	if err := s.validate(action); err != nil {
+		return err
+	}
+	s.queue = append(s.queue, action)
+	if len(s.queue) == len(s.Players) {
+		s.advance(now)
+	}
+	return nil
+}
+
+// Tick ends the current turn if its deadline has passed, treating players that didn't submit as passing. It reports
+// whether the turn advanced.
+func (s *Session) Tick(now time.Time) bool {
+	if s.Deadline.IsZero() || now.Before(s.Deadline) {
+		return false
+	}
+	s.advance(now)
+	return true
+}
+
+// Submitted reports whether the player has queued an action this turn
+func (s *Session) Submitted(playerID string) bool {
+	for _, a := range s.queue {
+		if a.Player == playerID {
+			return true
+		}
+	}
+	return false
+}
+
+// Owner returns the ID of the player that claimed the loc, or "" if it is unclaimed
+func (s *Session) Owner(loc types.Loc) string {
+	return s.owners[loc.Key()]
+}
+
+// advance applies the queued actions in turn order, then starts the next turn. Each action is validated again, since
+// an earlier action in the same turn may have taken its target.
+func (s *Session) advance(now time.Time) {
+	byPlayer := map[string]Action{}
+	for _, a := range s.queue {
+		byPlayer[a.Player] = a
+	}
+	s.LastResults = nil
+	for i := range s.Players {
+		p := s.Players[(s.Turn+i)%len(s.Players)]
+		action, ok := byPlayer[p.ID]
+		if !ok {
+			action = Action{Player: p.ID, Kind: Pass}
+		}
+		result := Result{Action: action}
+		if err := s.apply(action); err != nil {
+			result.Error = err.Error()
+		}
+		s.LastResults = append(s.LastResults, result)
+	}
+	s.Turn++
+	s.startTurn(now)
+}
+
+func (s *Session) startTurn(now time.Time) {
+	s.queue = nil
+	s.Deadline = time.Time{}
+	if s.TurnTimeout > 0 {
+		s.Deadline = now.Add(s.TurnTimeout)
+	}
+}
+
+func (s *Session) apply(action Action) error {
+	if err := s.validate(action); err != nil {
+		return err
+	}
+	loc, _ := s.Grid.Lookup(action.Target)
+	switch action.Kind {
+	case Move:
+		s.player(action.Player).Position = loc.ID
+	case Claim:
+		loc.Status = Claimed
+		s.Grid.Put(loc)
+		s.owners[loc.Key()] = action.Player
+	}
+	return nil
+}
+
+// validate checks the action against the current grid. Moves go to an adjacent, open and unoccupied loc. Claims take
+// an open, unclaimed loc the player is on or next to.
+func (s *Session) validate(action Action) error {
+	if action.Kind == Pass {
+		return nil
+	}
+	if action.Kind != Move && action.Kind != Claim {
+		return fmt.Errorf("unknown action kind %q", action.Kind)
+	}
+	target, ok := s.Grid.Lookup(action.Target)
+	if !ok {
+		return fmt.Errorf("target %s is not on the map", action.Target)
+	}
+	if what := blockedBy(target); what != "" {
+		return fmt.Errorf("target %s is %s", target.ID, what)
+	}
+	from, _ := s.Grid.Lookup(s.player(action.Player).Position)
+	distance := from.DistanceFrom(target)
+	if action.Kind == Move {
+		if distance != 1 {
+			return fmt.Errorf("can only move to an adjacent loc, but %s is %d away", target.ID, distance)
+		}
+		if other := s.occupant(target); other != "" {
+			return fmt.Errorf("target %s is occupied by %s", target.ID, other)
+		}
+		return nil
+	}
+	if distance > 1 {
+		return fmt.Errorf("can only claim a loc at or next to the player, but %s is %d away", target.ID, distance)
+	}
+	if target.Status == Claimed {
+		return fmt.Errorf("target %s is already claimed by %s", target.ID, s.Owner(target))
+	}
+	return nil
+}
+
+// blockedBy returns the status or terrain that keeps players off the loc, or "" if nothing does
+func blockedBy(loc types.Loc) string {
+	if blocking[loc.Status] {
+		return loc.Status
+	}
+	if terrain := loc.Properties.TerrainName(); blocking[terrain] {
+		return terrain
+	}
+	return ""
+}
+
+func (s *Session) player(id string) *Player {
+	for i := range s.Players {
+		if s.Players[i].ID == id {
+			return &s.Players[i]
+		}
+	}
+	return nil
+}
+
+// occupant returns the ID of the player standing on the loc, or ""
+func (s *Session) occupant(loc types.Loc) string {
+	for _, p := range s.Players {
+		if p.Position == loc.ID {
+			return p.ID
+		}
+	}
+	return ""
+}
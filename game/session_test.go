@@ -0,0 +1,123 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"webstuff/types"
+)
+
+var start = time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestSession starts a two player game on a radius 3 hex map with a 30 second turn timeout
+func newTestSession(t *testing.T) *Session {
+	g := types.Grid{}
+	g.BuildHex(3)
+	players := []Player{{ID: "red", Position: "-1.1.0"}, {ID: "blue", Position: "1.-1.0"}}
+	s, err := NewSession("g1", players, g, 30*time.Second, start)
+	require.NoError(t, err)
+	return s
+}
+
+func TestNewSession(t *testing.T) {
+	s := newTestSession(t)
+	require.Equal(t, 0, s.Turn)
+	require.Equal(t, start.Add(30*time.Second), s.Deadline)
+
+	g := types.Grid{}
+	g.BuildHex(1)
+	var cases = map[string][]Player{
+		"No players":   {},
+		"Off the map":  {{ID: "red", Position: "5.-5.0"}},
+		"Duplicate ID": {{ID: "red", Position: "0.0.0"}, {ID: "red", Position: "1.-1.0"}},
+		"Shared start": {{ID: "red", Position: "0.0.0"}, {ID: "blue", Position: "0.0.0"}},
+		"Empty ID":     {{ID: "", Position: "0.0.0"}},
+	}
+	for name, players := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewSession("g1", players, g, 0, start)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	t.Run("Refused submissions", func(t *testing.T) {
+		s := newTestSession(t)
+		require.Equal(t, ErrUnknownPlayer, s.Submit(Action{Player: "green", Kind: Pass}, start))
+		require.NoError(t, s.Submit(Action{Player: "red", Kind: Pass}, start))
+		require.Equal(t, ErrAlreadySubmitted, s.Submit(Action{Player: "red", Kind: Pass}, start))
+	})
+	t.Run("Invalid actions", func(t *testing.T) {
+		s := newTestSession(t)
+		s.Grid.Put(types.Loc{ID: "-2.2.0", X: -2, Y: 2, Z: 0, Status: "water"})
+		s.Grid.Put(types.Loc{ID: "-1.2.-1", X: -1, Y: 2, Z: -1, Status: types.DefaultStatus, Properties: &types.Properties{Terrain: "mountain"}})
+		var cases = map[string]Action{
+			"Unknown kind":  {Player: "red", Kind: "teleport", Target: "-1.0.1"},
+			"Off the map":   {Player: "red", Kind: Move, Target: "-4.4.0"},
+			"Too far":       {Player: "red", Kind: Move, Target: "1.1.-2"},
+			"Blocked":       {Player: "red", Kind: Move, Target: "-2.2.0"},
+			"Terrain":       {Player: "red", Kind: Move, Target: "-1.2.-1"},
+			"Occupied":      {Player: "red", Kind: Move, Target: "0.0.0"},
+			"Claim too far": {Player: "red", Kind: Claim, Target: "1.0.-1"},
+			"Claim blocked": {Player: "red", Kind: Claim, Target: "-2.2.0"},
+		}
+		s.Players[1].Position = "0.0.0"
+		for name, action := range cases {
+			t.Run(name, func(t *testing.T) {
+				require.Error(t, s.Submit(action, start))
+				require.False(t, s.Submitted("red"))
+			})
+		}
+	})
+	t.Run("All submitted advances the turn", func(t *testing.T) {
+		s := newTestSession(t)
+		require.NoError(t, s.Submit(Action{Player: "red", Kind: Move, Target: "-1.0.1"}, start))
+		require.Equal(t, 0, s.Turn, "Turn waits for every player")
+		later := start.Add(5 * time.Second)
+		require.NoError(t, s.Submit(Action{Player: "blue", Kind: Claim, Target: "1.-1.0"}, later))
+		require.Equal(t, 1, s.Turn)
+		require.Equal(t, later.Add(30*time.Second), s.Deadline, "Next turn gets a fresh deadline")
+		require.Equal(t, "-1.0.1", s.Players[0].Position)
+		claimed, _ := s.Grid.Lookup("1.-1.0")
+		require.Equal(t, Claimed, claimed.Status)
+		require.Equal(t, "blue", s.Owner(claimed))
+		require.Len(t, s.LastResults, 2)
+		require.False(t, s.Submitted("red"), "Queue should be empty for the new turn")
+	})
+	t.Run("Conflicts resolve in turn order", func(t *testing.T) {
+		s := newTestSession(t)
+		// both players move onto 0.0.0. Red is first on turn 0, blue on turn 1.
+		require.NoError(t, s.Submit(Action{Player: "blue", Kind: Move, Target: "0.0.0"}, start))
+		require.NoError(t, s.Submit(Action{Player: "red", Kind: Move, Target: "0.0.0"}, start))
+		require.Equal(t, "0.0.0", s.Players[0].Position, "Red moves first on turn 0")
+		require.Equal(t, "1.-1.0", s.Players[1].Position)
+		require.Equal(t, "red", s.LastResults[0].Action.Player)
+		require.Empty(t, s.LastResults[0].Error)
+		require.Contains(t, s.LastResults[1].Error, "occupied")
+
+		require.NoError(t, s.Submit(Action{Player: "red", Kind: Claim, Target: "1.0.-1"}, start))
+		require.NoError(t, s.Submit(Action{Player: "blue", Kind: Claim, Target: "1.0.-1"}, start))
+		require.Equal(t, "blue", s.LastResults[0].Action.Player, "Blue moves first on turn 1")
+		claimed, _ := s.Grid.Lookup("1.0.-1")
+		require.Equal(t, "blue", s.Owner(claimed))
+		require.Contains(t, s.LastResults[1].Error, "already claimed")
+	})
+}
+
+func TestTick(t *testing.T) {
+	s := newTestSession(t)
+	require.NoError(t, s.Submit(Action{Player: "red", Kind: Move, Target: "-1.0.1"}, start))
+	require.False(t, s.Tick(start.Add(29*time.Second)), "Turn should not end before the deadline")
+	require.True(t, s.Tick(start.Add(30*time.Second)))
+	require.Equal(t, 1, s.Turn)
+	require.Equal(t, "-1.0.1", s.Players[0].Position)
+	require.Equal(t, Action{Player: "blue", Kind: Pass}, s.LastResults[1].Action, "Missing players pass")
+
+	g := types.Grid{}
+	g.BuildHex(1)
+	untimed, err := NewSession("g2", []Player{{ID: "red", Position: "0.0.0"}}, g, 0, start)
+	require.NoError(t, err)
+	require.False(t, untimed.Tick(start.Add(24*time.Hour)), "Games without a timeout never tick")
+}
@@ -0,0 +1,135 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	per "webstuff/persistence"
+	"webstuff/types"
+)
+
+// Collection is where sessions are stored
+const Collection = "games"
+
+// ErrStale is returned by Save when the stored game changed after the session was loaded
+var ErrStale = errors.New("game was changed by another request")
+
+// Holding records which player claimed a loc
+type Holding struct {
+	Loc    string `json:"loc" bson:"loc"`
+	Player string `json:"player" bson:"player"`
+}
+
+// State is the stored and served form of a Session. Pending actions are persisted but never served, so players can't
+// see what the others queued this turn; Submitted lists who has already acted instead.
+type State struct {
+	ID          string      `json:"id" bson:"_id"`
+	Version     int         `json:"version" bson:"version"`
+	Players     []Player    `json:"players" bson:"players"`
+	Turn        int         `json:"turn" bson:"turn"`
+	TurnSeconds int         `json:"turnSeconds" bson:"turnSeconds"`
+	Deadline    *time.Time  `json:"deadline,omitempty" bson:"deadline,omitempty"`
+	Locs        []types.Loc `json:"locs" bson:"locs"`
+	Claims      []Holding   `json:"claims" bson:"claims"`
+	LastResults []Result    `json:"lastResults" bson:"lastResults"`
+	Pending     []Action    `json:"-" bson:"pending"`
+	Submitted   []string    `json:"submitted" bson:"-"`
+}
+
+// State captures the session for storage or for a response
+func (s *Session) State() State {
+	result := State{
+		ID:          s.ID,
+		Version:     s.Version,
+		Players:     s.Players,
+		Turn:        s.Turn,
+		TurnSeconds: int(s.TurnTimeout / time.Second),
+		Locs:        s.Grid.Locs(),
+		Claims:      []Holding{},
+		LastResults: s.LastResults,
+		Pending:     s.queue,
+		Submitted:   []string{},
+	}
+	if !s.Deadline.IsZero() {
+		deadline := s.Deadline
+		result.Deadline = &deadline
+	}
+	for _, loc := range result.Locs {
+		if owner := s.Owner(loc); owner != "" {
+			result.Claims = append(result.Claims, Holding{Loc: loc.ID, Player: owner})
+		}
+	}
+	for _, a := range s.queue {
+		result.Submitted = append(result.Submitted, a.Player)
+	}
+	return result
+}
+
+// FromState rebuilds a session from its stored form
+func FromState(st State) (*Session, error) {
+	s := &Session{
+		ID:          st.ID,
+		Version:     st.Version,
+		Players:     st.Players,
+		Turn:        st.Turn,
+		TurnTimeout: time.Duration(st.TurnSeconds) * time.Second,
+		Grid:        types.GridFromLocs(st.Locs),
+		LastResults: st.LastResults,
+		owners:      map[types.CubeKey]string{},
+		queue:       st.Pending,
+	}
+	if st.Deadline != nil {
+		s.Deadline = *st.Deadline
+	}
+	for _, c := range st.Claims {
+		key, err := types.KeyFromString(c.Loc)
+		if err != nil {
+			return nil, fmt.Errorf("bad claim in game %s: %s", st.ID, err)
+		}
+		s.owners[key] = c.Player
+	}
+	return s, nil
+}
+
+// Create stores a new session at version 1, failing with persistence.ErrDuplicate if the ID is taken
+func Create(ctx context.Context, mdb per.DocumentStore, s *Session) error {
+	st := s.State()
+	st.Version = 1
+	if err := mdb.InsertDocument(ctx, Collection, s.ID, st); err != nil {
+		return err
+	}
+	s.Version = st.Version
+	return nil
+}
+
+// Save stores the session under the next version, as long as the stored game is still at the version the session was
+// loaded at. Otherwise nothing is written and ErrStale is returned, so concurrent requests can't overwrite each other.
+func Save(ctx context.Context, mdb per.DocumentStore, s *Session) error {
+	st := s.State()
+	st.Version = s.Version + 1
+	// games stored before versioning have no version field, which only matches nil
+	var current interface{} = s.Version
+	if s.Version == 0 {
+		current = nil
+	}
+	err := mdb.ReplaceDocumentIf(ctx, Collection, s.ID, map[string]interface{}{"version": current}, st)
+	if per.IsNotFound(err) {
+		return ErrStale
+	}
+	if err != nil {
+		return err
+	}
+	s.Version = st.Version
+	return nil
+}
+
+// Load fetches the session with the specified ID
+func Load(ctx context.Context, mdb per.DocumentStore, id string) (*Session, error) {
+	var st State
+	if err := mdb.FetchDocument(ctx, Collection, id, &st); err != nil {
+		return nil, err
+	}
+	return FromState(st)
+}
@@ -0,0 +1,134 @@
+package game
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	per "webstuff/persistence"
+)
+
+// memDocs is a DocumentStore that keeps the last State saved under each ID
+type memDocs struct {
+	docs map[string]State
+	fail bool
+}
+
+func (md *memDocs) SaveDocument(ctx context.Context, coll string, id string, doc interface{}) error {
+	if md.fail {
+		return fmt.Errorf("save failed")
+	}
+	md.docs[coll+"/"+id] = doc.(State)
+	return nil
+}
+
+func (md *memDocs) FetchDocument(ctx context.Context, coll string, id string, result interface{}) error {
+	st, ok := md.docs[coll+"/"+id]
+	if !ok {
+		return per.ErrNotFound
+	}
+	*result.(*State) = st
+	return nil
+}
+
+func (md *memDocs) FindDocuments(ctx context.Context, coll string, filter map[string]interface{}, result interface{}) error {
+	return fmt.Errorf("not supported")
+}
+
+func (md *memDocs) InsertDocument(ctx context.Context, coll string, id string, doc interface{}) error {
+	if _, ok := md.docs[coll+"/"+id]; ok {
+		return fmt.Errorf("%w: %s", per.ErrDuplicate, id)
+	}
+	return md.SaveDocument(ctx, coll, id, doc)
+}
+
+// ReplaceDocumentIf only understands a match on version, where nil stands for a State stored before versioning
+func (md *memDocs) ReplaceDocumentIf(ctx context.Context, coll string, id string, match map[string]interface{}, doc interface{}) error {
+	st, ok := md.docs[coll+"/"+id]
+	if !ok {
+		return per.ErrNotFound
+	}
+	if want, _ := match["version"].(int); want != st.Version {
+		return per.ErrNotFound
+	}
+	return md.SaveDocument(ctx, coll, id, doc)
+}
+
+func (md *memDocs) DeleteDocument(ctx context.Context, coll string, id string) error {
+	delete(md.docs, coll+"/"+id)
+	return nil
+}
+
+func (md *memDocs) DeleteDocumentIf(ctx context.Context, coll string, id string, match map[string]interface{}) error {
+	return fmt.Errorf("not supported")
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	s := newTestSession(t)
+	require.NoError(t, s.Submit(Action{Player: "red", Kind: Claim, Target: "-1.1.0"}, start))
+	require.NoError(t, s.Submit(Action{Player: "blue", Kind: Pass}, start))
+	require.NoError(t, s.Submit(Action{Player: "blue", Kind: Move, Target: "2.-2.0"}, start))
+
+	st := s.State()
+	require.Equal(t, []Holding{{Loc: "-1.1.0", Player: "red"}}, st.Claims)
+	require.Equal(t, []string{"blue"}, st.Submitted)
+	require.Len(t, st.Pending, 1)
+	require.Len(t, st.Locs, s.Grid.Len())
+
+	restored, err := FromState(st)
+	require.NoError(t, err)
+	require.Equal(t, s.Turn, restored.Turn)
+	require.Equal(t, s.Deadline, restored.Deadline)
+	require.Equal(t, s.TurnTimeout, restored.TurnTimeout)
+	require.True(t, restored.Submitted("blue"), "Pending actions should survive")
+	claimed, _ := restored.Grid.Lookup("-1.1.0")
+	require.Equal(t, "red", restored.Owner(claimed))
+	require.Equal(t, Claimed, claimed.Status)
+
+	st.Claims = []Holding{{Loc: "bogus", Player: "red"}}
+	_, err = FromState(st)
+	require.Error(t, err)
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	ctx := context.Background()
+	store := &memDocs{docs: map[string]State{}}
+	s := newTestSession(t)
+	require.NoError(t, Create(ctx, store, s))
+	require.Contains(t, store.docs, Collection+"/g1")
+	require.Equal(t, 1, s.Version)
+	require.True(t, per.IsDuplicate(Create(ctx, store, newTestSession(t))), "Creating a taken ID should fail")
+
+	loaded, err := Load(ctx, store, "g1")
+	require.NoError(t, err)
+	require.Equal(t, s.Players, loaded.Players)
+	require.Equal(t, 1, loaded.Version)
+
+	_, err = Load(ctx, store, "nope")
+	require.Error(t, err)
+	store.fail = true
+	require.Error(t, Save(ctx, store, s))
+	require.Equal(t, time.Duration(30*time.Second), loaded.TurnTimeout)
+}
+
+func TestSaveConflict(t *testing.T) {
+	ctx := context.Background()
+	store := &memDocs{docs: map[string]State{}}
+	require.NoError(t, Create(ctx, store, newTestSession(t)))
+	first, err := Load(ctx, store, "g1")
+	require.NoError(t, err)
+	second, err := Load(ctx, store, "g1")
+	require.NoError(t, err)
+
+	require.NoError(t, first.Submit(Action{Player: "red", Kind: Pass}, start))
+	require.NoError(t, Save(ctx, store, first))
+	require.Equal(t, 2, first.Version)
+	require.NoError(t, second.Submit(Action{Player: "blue", Kind: Pass}, start))
+	require.Equal(t, ErrStale, Save(ctx, store, second), "A save from a stale session should be refused")
+
+	stored, _ := Load(ctx, store, "g1")
+	require.True(t, stored.Submitted("red"), "The first save should be kept")
+	require.False(t, stored.Submitted("blue"))
+}
@@ -0,0 +1,132 @@
+package mapio
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"webstuff/types"
+)
+
+// Decode reads every loc from r in the named format. Each record is validated; the first bad record aborts the decode
+// with an error that names its position in the input.
+func Decode(r io.Reader, format string) ([]types.Loc, error) {
+	var locs []types.Loc
+	var err error
+	switch format {
+	case FormatJSONL, "":
+		locs, err = decodeJSONL(r)
+	case FormatCSV:
+		locs, err = decodeCSV(r)
+	case FormatHex:
+		locs, err = decodeHex(r)
+	default:
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]int{}
+	for i, loc := range locs {
+		if prev, ok := seen[loc.ID]; ok {
+			return nil, fmt.Errorf("record %d: duplicate of record %d: %s", i+1, prev, loc.ID)
+		}
+		seen[loc.ID] = i + 1
+	}
+	return locs, nil
+}
+
+// validate checks that a decoded loc is self consistent, filling in the ID and status when they are absent
+func validate(loc types.Loc) (types.Loc, error) {
+	expected := loc.StringForm()
+	if loc.ID == "" {
+		loc.ID = expected
+	}
+	if loc.ID != expected {
+		return loc, fmt.Errorf("id %s doesn't match coordinates %s", loc.ID, expected)
+	}
+	if loc.Status == "" {
+		loc.Status = "new"
+	}
+	return loc, nil
+}
+
+func decodeJSONL(r io.Reader) ([]types.Loc, error) {
+	result := []types.Loc{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		loc, err := types.LocFromJSON([]byte(text))
+		if err == nil {
+			loc, err = validate(loc)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		result = append(result, loc)
+	}
+	return result, scanner.Err()
+}
+
+func decodeCSV(r io.Reader) ([]types.Loc, error) {
+	result := []types.Loc{}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(csvHeader)
+	cr.TrimLeadingSpace = true
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && strings.EqualFold(rec[0], csvHeader[0]) {
+			continue
+		}
+		var coords [3]int
+		for i := range coords {
+			if coords[i], err = strconv.Atoi(rec[i+1]); err != nil {
+				return nil, fmt.Errorf("line %d: could not parse %s value as integer. Got: %s", line, csvHeader[i+1], rec[i+1])
+			}
+		}
+		loc := types.Loc{ID: rec[0], X: coords[0], Y: coords[1], Z: coords[2], Status: rec[4]}
+		if loc, err = validate(loc); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		result = append(result, loc)
+	}
+}
+
+func decodeHex(r io.Reader) ([]types.Loc, error) {
+	var doc struct {
+		Type     string       `json:"type"`
+		Features []hexFeature `json:"features"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc.Type != "FeatureCollection" {
+		return nil, fmt.Errorf("expected a FeatureCollection. Got: %q", doc.Type)
+	}
+	result := make([]types.Loc, 0, len(doc.Features))
+	for i, f := range doc.Features {
+		if len(f.Geometry.Coordinates) != 3 {
+			return nil, fmt.Errorf("feature %d: geometry must have x,y,z coordinates", i+1)
+		}
+		c := f.Geometry.Coordinates
+		loc, err := validate(types.Loc{ID: f.ID, X: c[0], Y: c[1], Z: c[2], Status: f.Properties["status"]})
+		if err != nil {
+			return nil, fmt.Errorf("feature %d: %s", i+1, err)
+		}
+		result = append(result, loc)
+	}
+	return result, nil
+}
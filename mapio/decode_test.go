@@ -0,0 +1,51 @@
+package mapio
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	t.Run("CSV without header or status", func(t *testing.T) {
+		result, err := Decode(strings.NewReader(",1,2,-3,\n"), FormatCSV)
+		require.NoErrorf(t, err, "Didn't want an error on decode. Got: %s", err)
+		require.Len(t, result, 1)
+		require.Equal(t, "1.2.-3", result[0].ID, "Missing id should be filled in from coordinates")
+		require.Equal(t, "new", result[0].Status, "Missing status should default to new")
+	})
+	t.Run("CSV non int coords", func(t *testing.T) {
+		_, err := Decode(strings.NewReader("id,x,y,z,status\n1.2.3,1,two,3,new\n"), FormatCSV)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "line 2")
+		require.Contains(t, err.Error(), "integer")
+	})
+	t.Run("Mismatched ID", func(t *testing.T) {
+		_, err := Decode(strings.NewReader(`{"id":"9.9.9","x":1,"y":2,"z":3,"status":"new"}`), FormatJSONL)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "doesn't match")
+	})
+	t.Run("JSONL missing element", func(t *testing.T) {
+		input := `{"id":"0.0.0","x":0,"y":0,"z":0}` + "\n\n" + `{"id":"1.2.3","x":1,"z":3}`
+		_, err := Decode(strings.NewReader(input), FormatJSONL)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "line 3")
+	})
+	t.Run("Duplicate records", func(t *testing.T) {
+		_, err := Decode(strings.NewReader("1.2.3,1,2,3,new\n1.2.3,1,2,3,old\n"), FormatCSV)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "duplicate")
+	})
+	t.Run("Hex wrong document type", func(t *testing.T) {
+		_, err := Decode(strings.NewReader(`{"type":"Feature"}`), FormatHex)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "FeatureCollection")
+	})
+	t.Run("Hex short coordinates", func(t *testing.T) {
+		input := `{"type":"FeatureCollection","features":[{"geometry":{"type":"Hex","coordinates":[1,2]}}]}`
+		_, err := Decode(strings.NewReader(input), FormatHex)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "feature 1")
+	})
+}
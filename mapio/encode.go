@@ -0,0 +1,160 @@
+// Package mapio reads and writes collections of Locs in formats that external tools understand: JSON Lines, CSV and
+// a GeoJSON-like hex feature document.
+package mapio
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"webstuff/types"
+)
+
+// Supported format names, as used in the format query param and hexctl flags
+const (
+	FormatJSONL string = "jsonl"
+	FormatCSV   string = "csv"
+	FormatHex   string = "hexjson"
+)
+
+// csvHeader is the column layout for the CSV format
+var csvHeader = []string{"id", "x", "y", "z", "status"}
+
+// Encoder streams Locs to an underlying writer. Close must be called to terminate formats that need a footer.
+type Encoder interface {
+	Encode(loc types.Loc) error
+	Close() error
+}
+
+// ContentType returns the HTTP content type for the format
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv"
+	case FormatHex:
+		return "application/json"
+	}
+	return "application/x-ndjson"
+}
+
+// NewEncoder returns a streaming encoder for the named format
+func NewEncoder(w io.Writer, format string) (Encoder, error) {
+	switch format {
+	case FormatJSONL, "":
+		return &jsonlEncoder{w: w}, nil
+	case FormatCSV:
+		return &csvEncoder{w: csv.NewWriter(w)}, nil
+	case FormatHex:
+		return &hexEncoder{w: w}, nil
+	}
+	return nil, fmt.Errorf("unknown format: %s", format)
+}
+
+// Export writes every loc to w in the named format
+func Export(w io.Writer, format string, locs []types.Loc) error {
+	enc, err := NewEncoder(w, format)
+	if err != nil {
+		return err
+	}
+	for _, loc := range locs {
+		if err = enc.Encode(loc); err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
+
+// ExportGrid writes every loc of the grid to w in the named format
+func ExportGrid(w io.Writer, format string, g *types.Grid) error {
+	return Export(w, format, g.Locs())
+}
+
+type jsonlEncoder struct {
+	w io.Writer
+}
+
+func (je *jsonlEncoder) Encode(loc types.Loc) error {
+	_, err := fmt.Fprintf(je.w, "%s\n", loc.JSONForm())
+	return err
+}
+
+func (je *jsonlEncoder) Close() error { return nil }
+
+type csvEncoder struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func (ce *csvEncoder) Encode(loc types.Loc) error {
+	if !ce.wroteHeader {
+		if err := ce.w.Write(csvHeader); err != nil {
+			return err
+		}
+		ce.wroteHeader = true
+	}
+	return ce.w.Write([]string{
+		loc.ID,
+		strconv.Itoa(loc.X),
+		strconv.Itoa(loc.Y),
+		strconv.Itoa(loc.Z),
+		loc.Status,
+	})
+}
+
+func (ce *csvEncoder) Close() error {
+	if !ce.wroteHeader {
+		ce.w.Write(csvHeader)
+	}
+	ce.w.Flush()
+	return ce.w.Error()
+}
+
+// hexFeature is a single hex in the feature document. Geometry coordinates are the cube x,y,z.
+type hexFeature struct {
+	Type       string            `json:"type"`
+	ID         string            `json:"id"`
+	Geometry   hexGeometry       `json:"geometry"`
+	Properties map[string]string `json:"properties"`
+}
+
+type hexGeometry struct {
+	Type        string `json:"type"`
+	Coordinates []int  `json:"coordinates"`
+}
+
+// hexEncoder streams a FeatureCollection, writing the opening and closing wrapper around the features
+type hexEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func (he *hexEncoder) Encode(loc types.Loc) error {
+	prefix := ",\n"
+	if he.count == 0 {
+		prefix = `{"type":"FeatureCollection","features":[` + "\n"
+	}
+	f := hexFeature{
+		Type:       "Feature",
+		ID:         loc.ID,
+		Geometry:   hexGeometry{Type: "Hex", Coordinates: []int{loc.X, loc.Y, loc.Z}},
+		Properties: map[string]string{"status": loc.Status},
+	}
+	j, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	he.count++
+	_, err = fmt.Fprintf(he.w, "%s%s", prefix, j)
+	return err
+}
+
+func (he *hexEncoder) Close() error {
+	if he.count == 0 {
+		_, err := io.WriteString(he.w, `{"type":"FeatureCollection","features":[]}`+"\n")
+		return err
+	}
+	_, err := io.WriteString(he.w, "\n]}\n")
+	return err
+}
@@ -0,0 +1,68 @@
+package mapio
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"webstuff/types"
+)
+
+func TestExport(t *testing.T) {
+	locs := []types.Loc{newLoc(0, 0, 0), newLoc(1, -1, 0)}
+
+	t.Run("JSONL", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		err := Export(buf, FormatJSONL, locs)
+		require.NoErrorf(t, err, "Didn't want an error on export. Got: %s", err)
+		expected := `{"id":"0.0.0","x":0,"y":0,"z":0,"status":"new"}` + "\n" +
+			`{"id":"1.-1.0","x":1,"y":-1,"z":0,"status":"new"}` + "\n"
+		require.Equal(t, expected, buf.String())
+	})
+	t.Run("CSV", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		err := Export(buf, FormatCSV, locs)
+		require.NoErrorf(t, err, "Didn't want an error on export. Got: %s", err)
+		require.Equal(t, "id,x,y,z,status\n0.0.0,0,0,0,new\n1.-1.0,1,-1,0,new\n", buf.String())
+	})
+	t.Run("Hex features", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		err := Export(buf, FormatHex, locs)
+		require.NoErrorf(t, err, "Didn't want an error on export. Got: %s", err)
+		require.Contains(t, buf.String(), `"type":"FeatureCollection"`)
+		require.Contains(t, buf.String(), `"geometry":{"type":"Hex","coordinates":[1,-1,0]}`)
+	})
+	t.Run("Empty hex features is valid", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		require.NoError(t, Export(buf, FormatHex, nil))
+		result, err := Decode(buf, FormatHex)
+		require.NoErrorf(t, err, "Empty export should decode. Got: %s", err)
+		require.Len(t, result, 0)
+	})
+	t.Run("Unknown format", func(t *testing.T) {
+		err := Export(&bytes.Buffer{}, "xml", locs)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unknown format")
+	})
+}
+
+func TestRoundTrip(t *testing.T) {
+	g := types.Grid{}
+	g.BuildHex(2)
+	for _, format := range []string{FormatJSONL, FormatCSV, FormatHex} {
+		t.Run(format, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			require.NoError(t, ExportGrid(buf, format, &g))
+			result, err := Decode(buf, format)
+			require.NoErrorf(t, err, "Didn't want an error decoding our own export. Got: %s", err)
+			require.Equal(t, g.Locs(), result)
+		})
+	}
+}
+
+/*** Helper functions ***/
+
+func newLoc(x int, y int, z int) types.Loc {
+	result, _ := types.LocFromCoords(x, y, z)
+	return result
+}
@@ -0,0 +1,125 @@
+package mapio
+
+import (
+	"context"
+	"fmt"
+
+	per "webstuff/persistence"
+	"webstuff/types"
+)
+
+// Policy decides what happens when an imported loc already exists in the target
+type Policy string
+
+// Duplicate policies for Import
+const (
+	PolicySkip      Policy = "skip"
+	PolicyOverwrite Policy = "overwrite"
+	PolicyFail      Policy = "fail"
+)
+
+// ParsePolicy converts a policy name into a Policy, defaulting to PolicyFail when empty
+func ParsePolicy(name string) (Policy, error) {
+	switch p := Policy(name); p {
+	case PolicySkip, PolicyOverwrite, PolicyFail:
+		return p, nil
+	case "":
+		return PolicyFail, nil
+	}
+	return "", fmt.Errorf("unknown duplicate policy: %s", name)
+}
+
+// Target is the store an import writes into
+type Target interface {
+	List() ([]types.Loc, error)
+	Insert(loc types.Loc) error
+	Update(loc types.Loc) error
+}
+
+// Options controls an Import
+type Options struct {
+	Policy Policy
+	DryRun bool
+}
+
+// Report summarizes what an Import did, or with DryRun what it would have done
+type Report struct {
+	Inserted  int      `json:"inserted"`
+	Updated   int      `json:"updated"`
+	Skipped   int      `json:"skipped"`
+	Conflicts []string `json:"conflicts,omitempty"`
+	DryRun    bool     `json:"dryRun"`
+}
+
+// Import writes locs into the target according to the duplicate policy. With PolicyFail every conflict is reported
+// and nothing is written if there is at least one. An overwrite patches the imported loc onto the stored one, so
+// properties and attributes the import format doesn't carry are kept.
+func Import(target Target, locs []types.Loc, opts Options) (report Report, err error) {
+	report.DryRun = opts.DryRun
+	existing, err := target.List()
+	if err != nil {
+		return
+	}
+	stored := make(map[string]types.Loc, len(existing))
+	for _, loc := range existing {
+		stored[loc.GetID()] = loc
+	}
+	for _, loc := range locs {
+		if _, ok := stored[loc.GetID()]; ok {
+			report.Conflicts = append(report.Conflicts, loc.GetID())
+		}
+	}
+	if opts.Policy == PolicyFail && len(report.Conflicts) > 0 {
+		err = fmt.Errorf("%d locs already exist", len(report.Conflicts))
+		return
+	}
+
+	for _, loc := range locs {
+		prev, ok := stored[loc.GetID()]
+		switch {
+		case !ok:
+			if !opts.DryRun {
+				if err = target.Insert(loc); err != nil {
+					err = fmt.Errorf("inserting %s: %w", loc.GetID(), err)
+					return
+				}
+			}
+			report.Inserted++
+		case opts.Policy == PolicyOverwrite:
+			if !opts.DryRun {
+				if err = target.Update(prev.Patched(loc)); err != nil {
+					err = fmt.Errorf("updating %s: %w", loc.GetID(), err)
+					return
+				}
+			}
+			report.Updated++
+		default:
+			report.Skipped++
+		}
+	}
+	return
+}
+
+// collectionTarget adapts a mongo collection to an import Target
+type collectionTarget struct {
+	ctx        context.Context
+	mongoDB    per.MongoAbstraction
+	collection string
+}
+
+// CollectionTarget returns an import Target that writes to the named collection, with ctx bounding every call
+func CollectionTarget(ctx context.Context, mdb per.MongoAbstraction, collection string) Target {
+	return &collectionTarget{ctx: ctx, mongoDB: mdb, collection: collection}
+}
+
+func (ct *collectionTarget) List() ([]types.Loc, error) {
+	return ct.mongoDB.FetchAllFromCollection(ct.ctx, ct.collection)
+}
+
+func (ct *collectionTarget) Insert(loc types.Loc) error {
+	return ct.mongoDB.WriteCollection(ct.ctx, ct.collection, loc)
+}
+
+func (ct *collectionTarget) Update(loc types.Loc) error {
+	return ct.mongoDB.UpdateCollection(ct.ctx, ct.collection, loc)
+}
@@ -0,0 +1,108 @@
+package mapio
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"webstuff/types"
+)
+
+func TestImport(t *testing.T) {
+	incoming := []types.Loc{newLoc(0, 0, 0), newLoc(1, -1, 0), newLoc(2, -2, 0)}
+	incoming[0].Status = "imported"
+
+	t.Run("Skip", func(t *testing.T) {
+		target := NewMemTarget(newLoc(0, 0, 0))
+		report, err := Import(target, incoming, Options{Policy: PolicySkip})
+		require.NoErrorf(t, err, "Didn't want an error on skip import. Got: %s", err)
+		require.Equal(t, Report{Inserted: 2, Skipped: 1, Conflicts: []string{"0.0.0"}}, report)
+		require.Equal(t, "new", target.locs["0.0.0"].Status, "Skipped loc should be left alone")
+	})
+	t.Run("Overwrite", func(t *testing.T) {
+		target := NewMemTarget(newLoc(0, 0, 0))
+		report, err := Import(target, incoming, Options{Policy: PolicyOverwrite})
+		require.NoErrorf(t, err, "Didn't want an error on overwrite import. Got: %s", err)
+		require.Equal(t, 2, report.Inserted)
+		require.Equal(t, 1, report.Updated)
+		require.Equal(t, "imported", target.locs["0.0.0"].Status)
+	})
+	t.Run("Overwrite keeps properties", func(t *testing.T) {
+		stored := newLoc(0, 0, 0)
+		stored.Properties = &types.Properties{Terrain: "forest"}
+		stored.Attributes = map[string]interface{}{"owner": "red"}
+		target := NewMemTarget(stored)
+		_, err := Import(target, incoming, Options{Policy: PolicyOverwrite})
+		require.NoErrorf(t, err, "Didn't want an error on overwrite import. Got: %s", err)
+		require.Equal(t, "imported", target.locs["0.0.0"].Status)
+		require.Equal(t, stored.Properties, target.locs["0.0.0"].Properties, "Properties the import lacks should be kept")
+		require.Equal(t, stored.Attributes, target.locs["0.0.0"].Attributes)
+	})
+	t.Run("Fail writes nothing", func(t *testing.T) {
+		target := NewMemTarget(newLoc(0, 0, 0))
+		report, err := Import(target, incoming, Options{Policy: PolicyFail})
+		require.Error(t, err)
+		require.Equal(t, []string{"0.0.0"}, report.Conflicts)
+		require.Len(t, target.locs, 1)
+	})
+	t.Run("Dry run", func(t *testing.T) {
+		target := NewMemTarget(newLoc(0, 0, 0))
+		report, err := Import(target, incoming, Options{Policy: PolicyOverwrite, DryRun: true})
+		require.NoErrorf(t, err, "Didn't want an error on dry run. Got: %s", err)
+		require.True(t, report.DryRun)
+		require.Equal(t, 2, report.Inserted)
+		require.Equal(t, 1, report.Updated)
+		require.Len(t, target.locs, 1, "Dry run should not write")
+	})
+	t.Run("Store error", func(t *testing.T) {
+		target := NewMemTarget()
+		target.insertErr = fmt.Errorf("mock insert failure")
+		_, err := Import(target, incoming, Options{Policy: PolicySkip})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "mock insert failure")
+	})
+}
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("")
+	require.NoError(t, err)
+	require.Equal(t, PolicyFail, p, "Default policy should be the safe one")
+	_, err = ParsePolicy("clobber")
+	require.Error(t, err)
+}
+
+/*** Helper functions ***/
+
+type memTarget struct {
+	locs      map[string]types.Loc
+	insertErr error
+}
+
+func NewMemTarget(locs ...types.Loc) *memTarget {
+	mt := &memTarget{locs: map[string]types.Loc{}}
+	for _, loc := range locs {
+		mt.locs[loc.GetID()] = loc
+	}
+	return mt
+}
+
+func (mt *memTarget) List() ([]types.Loc, error) {
+	result := []types.Loc{}
+	for _, loc := range mt.locs {
+		result = append(result, loc)
+	}
+	return result, nil
+}
+
+func (mt *memTarget) Insert(loc types.Loc) error {
+	if mt.insertErr != nil {
+		return mt.insertErr
+	}
+	mt.locs[loc.GetID()] = loc
+	return nil
+}
+
+func (mt *memTarget) Update(loc types.Loc) error {
+	mt.locs[loc.GetID()] = loc
+	return nil
+}
@@ -0,0 +1,216 @@
+package persistence
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"webstuff/types"
+)
+
+// EventCollection is where Audited records its events
+const EventCollection = "events"
+
+// Operations recorded in an Event
+const (
+	OpInsert = "insert"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// Event is an immutable record of one write to a loc collection. Before is nil for inserts and After is nil for
+// deletes. Seq orders events, since timestamps are only stored to the millisecond. The ID ends with the instance that
+// recorded the event, so two server instances writing the same loc in the same nanosecond don't clash.
+type Event struct {
+	ID         string     `json:"id" bson:"_id"`
+	Seq        int64      `json:"seq" bson:"seq"`
+	Collection string     `json:"collection" bson:"collection"`
+	LocID      string     `json:"locId" bson:"locId"`
+	Op         string     `json:"op" bson:"op"`
+	Actor      string     `json:"actor" bson:"actor"`
+	At         time.Time  `json:"at" bson:"at"`
+	Before     *types.Loc `json:"before,omitempty" bson:"before,omitempty"`
+	After      *types.Loc `json:"after,omitempty" bson:"after,omitempty"`
+}
+
+// Audited wraps a MongoAbstraction so that every successful WriteCollection, UpdateCollection and
+// DeleteFromCollection also appends an Event to EventCollection. Reads pass straight through.
+type Audited struct {
+	MongoAbstraction
+	actor    string
+	clock    *auditClock
+	observer func(Event)
+	logger   *log.Logger
+}
+
+// auditClock hands out strictly increasing sequence numbers, shared by every actor of an Audited. Instance tells its
+// events apart from those of other Audited DALs, in this process or another one.
+type auditClock struct {
+	mu       sync.Mutex
+	last     int64
+	now      func() time.Time
+	instance string
+}
+
+// NewAudited wraps the DAL, recording events for the actor "anonymous" until As picks another
+func NewAudited(mdb MongoAbstraction) *Audited {
+	return &Audited{
+		MongoAbstraction: mdb,
+		actor:            "anonymous",
+		clock:            &auditClock{now: time.Now, instance: newInstance()},
+		logger:           log.New(os.Stdout, "auditLayer", log.Ldate|log.Ltime),
+	}
+}
+
+// As returns a copy of the DAL that records events for the specified actor
+func (a *Audited) As(actor string) *Audited {
+	result := *a
+	result.actor = actor
+	return &result
+}
+
+// Logging returns a copy of the DAL that logs events it could not record to logger
+func (a *Audited) Logging(logger *log.Logger) *Audited {
+	result := *a
+	result.logger = logger
+	return &result
+}
+
+// Observe returns a copy of the DAL that also passes every recorded event to fn
+func (a *Audited) Observe(fn func(Event)) *Audited {
+	result := *a
+	result.observer = fn
+	return &result
+}
+
+// WriteCollection inserts the loc and records an insert event
+func (a *Audited) WriteCollection(ctx context.Context, coll string, obj types.Loc) error {
+	if err := a.MongoAbstraction.WriteCollection(ctx, coll, obj); err != nil {
+		return err
+	}
+	return a.record(ctx, coll, obj.GetID(), OpInsert, nil, &obj)
+}
+
+// UpdateCollection updates the loc and records an update event holding the loc as it was before
+func (a *Audited) UpdateCollection(ctx context.Context, coll string, obj types.Loc) error {
+	before := a.current(ctx, coll, obj.GetID())
+	if err := a.MongoAbstraction.UpdateCollection(ctx, coll, obj); err != nil {
+		return err
+	}
+	return a.record(ctx, coll, obj.GetID(), OpUpdate, before, &obj)
+}
+
+// DeleteFromCollection removes the loc and records a delete event holding the loc as it was before
+func (a *Audited) DeleteFromCollection(ctx context.Context, coll string, id string) error {
+	before := a.current(ctx, coll, id)
+	if err := a.MongoAbstraction.DeleteFromCollection(ctx, coll, id); err != nil {
+		return err
+	}
+	return a.record(ctx, coll, id, OpDelete, before, nil)
+}
+
+// History returns the events recorded for the loc, oldest first
+func (a *Audited) History(ctx context.Context, coll string, id string) ([]Event, error) {
+	events := []Event{}
+	filter := map[string]interface{}{"collection": coll, "locId": id}
+	if err := a.FindDocuments(ctx, EventCollection, filter, &events); err != nil {
+		return nil, err
+	}
+	sortEvents(events)
+	return events, nil
+}
+
+// StateAt rebuilds the collection as it was at the specified time by replaying its events. Only the events up to then
+// are fetched. Only writes made through Audited are known, so locs written before auditing started are missing from
+// the result.
+func (a *Audited) StateAt(ctx context.Context, coll string, asOf time.Time) ([]types.Loc, error) {
+	events := []Event{}
+	filter := map[string]interface{}{"collection": coll, "at": map[string]interface{}{"$lte": asOf}}
+	if err := a.FindDocuments(ctx, EventCollection, filter, &events); err != nil {
+		return nil, err
+	}
+	sortEvents(events)
+	locs := map[string]types.Loc{}
+	for _, e := range events {
+		if e.After == nil {
+			delete(locs, e.LocID)
+			continue
+		}
+		locs[e.LocID] = *e.After
+	}
+	result := make([]types.Loc, 0, len(locs))
+	for _, loc := range locs {
+		result = append(result, loc)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+// current fetches the loc as it is before a write. It is best effort: a loc that can't be read is recorded as nil.
+func (a *Audited) current(ctx context.Context, coll string, id string) *types.Loc {
+	loc, err := a.FetchFromCollection(ctx, coll, id)
+	if err != nil {
+		return nil
+	}
+	return &loc
+}
+
+// record inserts the event for a write that has already been made. It does so even when ctx is cancelled by then, since
+// the write can't be taken back and must not go unrecorded. Events are never overwritten: an event with the same ID
+// already stored fails the insert. An event that can't be inserted is logged in full rather than returned as an error,
+// since the write succeeded and a caller retrying it would apply it twice.
+func (a *Audited) record(ctx context.Context, coll string, id string, op string, before *types.Loc, after *types.Loc) error {
+	at, seq := a.clock.next()
+	e := Event{
+		ID:         fmt.Sprintf("%s/%s/%d-%s", coll, id, seq, a.clock.instance),
+		Seq:        seq,
+		Collection: coll,
+		LocID:      id,
+		Op:         op,
+		Actor:      a.actor,
+		At:         at,
+		Before:     before,
+		After:      after,
+	}
+	if err := a.InsertDocument(context.WithoutCancel(ctx), EventCollection, e.ID, e); err != nil {
+		body, _ := json.Marshal(e)
+		a.logger.Printf("%s of %s succeeded but its event was not recorded: %s. Event: %s", op, id, err, body)
+	}
+	if a.observer != nil {
+		a.observer(e)
+	}
+	return nil
+}
+
+// next returns the current time, truncated to what mongo stores, and a sequence number above every earlier one
+func (c *auditClock) next() (time.Time, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	at := c.now().UTC().Truncate(time.Millisecond)
+	seq := at.UnixNano()
+	if seq <= c.last {
+		seq = c.last + 1
+	}
+	c.last = seq
+	return at, seq
+}
+
+// newInstance returns a random name for an Audited's events
+func newInstance() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("audit: no randomness for the instance name: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+func sortEvents(events []Event) {
+	sort.Slice(events, func(i, j int) bool { return events[i].Seq < events[j].Seq })
+}
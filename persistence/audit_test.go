@@ -0,0 +1,204 @@
+package persistence
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"webstuff/types"
+)
+
+// memDAL is an in-memory MongoAbstraction holding locs and events, just enough to exercise Audited
+type memDAL struct {
+	locs   map[string]types.Loc
+	events map[string]Event
+	// filters records every FindDocuments filter, most recent last
+	filters []map[string]interface{}
+}
+
+func newMemDAL() *memDAL {
+	return &memDAL{locs: map[string]types.Loc{}, events: map[string]Event{}}
+}
+
+func (md *memDAL) ConnectToMongo(ctx context.Context) error { return nil }
+
+func (md *memDAL) WriteCollection(ctx context.Context, coll string, obj types.Loc) error {
+	if _, ok := md.locs[obj.ID]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicate, obj.ID)
+	}
+	md.locs[obj.ID] = obj
+	return nil
+}
+
+func (md *memDAL) UpdateCollection(ctx context.Context, coll string, obj types.Loc) error {
+	if _, ok := md.locs[obj.ID]; !ok {
+		return ErrNotFound
+	}
+	md.locs[obj.ID] = obj
+	return nil
+}
+
+func (md *memDAL) FetchFromCollection(ctx context.Context, coll string, id string) (types.Loc, error) {
+	loc, ok := md.locs[id]
+	if !ok {
+		return loc, ErrNotFound
+	}
+	return loc, nil
+}
+
+func (md *memDAL) FetchAllFromCollection(ctx context.Context, coll string) ([]types.Loc, error) {
+	return nil, nil
+}
+
+func (md *memDAL) QueryCollection(ctx context.Context, coll string, query LocQuery) ([]types.Loc, error) {
+	return nil, nil
+}
+
+func (md *memDAL) DeleteFromCollection(ctx context.Context, coll string, id string) error {
+	if _, ok := md.locs[id]; !ok {
+		return ErrNotFound
+	}
+	delete(md.locs, id)
+	return nil
+}
+
+func (md *memDAL) DropCollection(ctx context.Context, coll string) error {
+	md.locs = map[string]types.Loc{}
+	return nil
+}
+
+func (md *memDAL) SaveDocument(ctx context.Context, coll string, id string, doc interface{}) error {
+	md.events[id] = doc.(Event)
+	return nil
+}
+
+func (md *memDAL) FetchDocument(ctx context.Context, coll string, id string, result interface{}) error {
+	return fmt.Errorf("not supported")
+}
+
+func (md *memDAL) FindDocuments(ctx context.Context, coll string, filter map[string]interface{}, result interface{}) error {
+	md.filters = append(md.filters, filter)
+	events := result.(*[]Event)
+	for _, e := range md.events {
+		if filter["collection"] != e.Collection || (filter["locId"] != nil && filter["locId"] != e.LocID) {
+			continue
+		}
+		if at, ok := filter["at"].(map[string]interface{}); ok && e.At.After(at["$lte"].(time.Time)) {
+			continue
+		}
+		*events = append(*events, e)
+	}
+	return nil
+}
+
+func (md *memDAL) InsertDocument(ctx context.Context, coll string, id string, doc interface{}) error {
+	if _, ok := md.events[id]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicate, id)
+	}
+	return md.SaveDocument(ctx, coll, id, doc)
+}
+
+func (md *memDAL) ReplaceDocumentIf(ctx context.Context, coll string, id string, match map[string]interface{}, doc interface{}) error {
+	return fmt.Errorf("not supported")
+}
+
+func (md *memDAL) DeleteDocument(ctx context.Context, coll string, id string) error {
+	delete(md.events, id)
+	return nil
+}
+
+func (md *memDAL) DeleteDocumentIf(ctx context.Context, coll string, id string, match map[string]interface{}) error {
+	return fmt.Errorf("not supported")
+}
+
+func TestAudited(t *testing.T) {
+	ctx := context.Background()
+	md := newMemDAL()
+	audited := NewAudited(md)
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	audited.clock.now = func() time.Time { return now }
+	loc, _ := types.LocFromString("1.-1.0")
+
+	var observed []string
+	observer := func(e Event) { observed = append(observed, e.Op) }
+	require.NoError(t, audited.As("alice").Observe(observer).WriteCollection(ctx, "arena", loc))
+	now = now.Add(time.Minute)
+	claimed := loc
+	claimed.Status = "claimed"
+	require.NoError(t, audited.As("bob").UpdateCollection(ctx, "arena", claimed))
+	now = now.Add(time.Minute)
+	require.NoError(t, audited.DeleteFromCollection(ctx, "arena", loc.ID))
+
+	t.Run("Observe", func(t *testing.T) {
+		require.Equal(t, []string{OpInsert}, observed, "Only the observing copy should report events")
+	})
+	t.Run("History", func(t *testing.T) {
+		events, err := audited.History(ctx, "arena", loc.ID)
+		require.NoError(t, err)
+		require.Len(t, events, 3)
+		require.Equal(t, []string{OpInsert, OpUpdate, OpDelete}, []string{events[0].Op, events[1].Op, events[2].Op})
+		require.Equal(t, []string{"alice", "bob", "anonymous"}, []string{events[0].Actor, events[1].Actor, events[2].Actor})
+		require.Nil(t, events[0].Before)
+		require.Equal(t, "new", events[1].Before.Status)
+		require.Equal(t, "claimed", events[1].After.Status)
+		require.Equal(t, "claimed", events[2].Before.Status)
+		require.Nil(t, events[2].After)
+		require.True(t, events[0].Seq < events[1].Seq && events[1].Seq < events[2].Seq)
+	})
+	t.Run("Failed writes are not recorded", func(t *testing.T) {
+		require.Error(t, audited.UpdateCollection(ctx, "arena", loc), "Loc was deleted, so the update fails")
+		events, _ := audited.History(ctx, "arena", loc.ID)
+		require.Len(t, events, 3)
+	})
+	t.Run("State at", func(t *testing.T) {
+		start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+		state, err := audited.StateAt(ctx, "arena", start.Add(-time.Second))
+		require.NoError(t, err)
+		require.Len(t, state, 0, "Nothing existed before the first write")
+
+		state, err = audited.StateAt(ctx, "arena", start.Add(90*time.Second))
+		require.NoError(t, err)
+		require.Equal(t, []types.Loc{claimed}, state)
+		filter := md.filters[len(md.filters)-1]
+		require.Equal(t, map[string]interface{}{"$lte": start.Add(90 * time.Second)}, filter["at"], "Later events are left out by the query")
+
+		state, err = audited.StateAt(ctx, "arena", start.Add(time.Hour))
+		require.NoError(t, err)
+		require.Len(t, state, 0, "Loc was deleted by then")
+	})
+	t.Run("Two instances at the same time", func(t *testing.T) {
+		other := NewAudited(md)
+		other.clock.now = audited.clock.now
+		audited.clock.last, other.clock.last = 0, 0
+		require.NoError(t, audited.WriteCollection(ctx, "race", loc))
+		require.NoError(t, other.UpdateCollection(ctx, "race", claimed), "Same seq from another instance should get its own ID")
+		events, _ := audited.History(ctx, "race", loc.ID)
+		require.Len(t, events, 2)
+	})
+	t.Run("Events are not overwritten", func(t *testing.T) {
+		clash := NewAudited(md)
+		clash.clock.now = audited.clock.now
+		clash.clock.instance = audited.clock.instance
+		audited.clock.last = 0
+		var logged bytes.Buffer
+		err := clash.Logging(log.New(&logged, "", 0)).DeleteFromCollection(ctx, "race", loc.ID)
+		require.NoError(t, err, "The delete was made, so it should not fail for want of its event")
+		require.Contains(t, logged.String(), "not recorded", "An event with the same ID is already stored")
+		require.Contains(t, logged.String(), `"op":"delete"`, "The lost event should be logged in full")
+		id := fmt.Sprintf("race/%s/%d-%s", loc.ID, now.UnixNano(), audited.clock.instance)
+		require.Equal(t, OpInsert, md.events[id].Op, "The stored event should be kept")
+	})
+}
+
+func TestAuditClock(t *testing.T) {
+	fixed := time.Date(2020, 1, 1, 12, 0, 0, 123456789, time.UTC)
+	c := &auditClock{now: func() time.Time { return fixed }}
+	at, first := c.next()
+	require.Equal(t, fixed.Truncate(time.Millisecond), at)
+	_, second := c.next()
+	require.Equal(t, first+1, second, "Sequence should increase even when the clock doesn't")
+}
@@ -0,0 +1,90 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Drivers that Open can build a Backend on
+const (
+	// DriverOfficial is the official mongo driver. It is the default.
+	DriverOfficial = "official"
+	// DriverMgo is the unmaintained mgo driver, kept while deployments move off it
+	DriverMgo = "mgo"
+)
+
+// Typed errors returned by every Backend, whatever the driver underneath. Backends may wrap them with detail, so test
+// with errors.Is, IsNotFound or IsDuplicate.
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrDuplicate   = errors.New("duplicate key")
+	ErrUnreachable = errors.New("mongo unreachable")
+)
+
+// IsNotFound reports whether an error from the DAL means the target document or collection doesn't exist
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// IsDuplicate reports whether an error from the DAL means a document with the same ID or unique key already exists
+func IsDuplicate(err error) bool {
+	return errors.Is(err, ErrDuplicate)
+}
+
+// Config holds the connection settings of a Backend. Each timeout bounds a single call on top of whatever deadline
+// the caller's context carries; zero means the default.
+type Config struct {
+	Driver       string
+	URL          string
+	DBName       string
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+}
+
+// withDefaults fills in whatever the config leaves empty
+func (cfg Config) withDefaults() Config {
+	if cfg.Driver == "" {
+		cfg.Driver = DriverOfficial
+	}
+	if cfg.DBName == "" {
+		cfg.DBName = DefaultDbName
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = DefaultTimeout
+	}
+	if cfg.ReadTimeout <= 0 {
+		cfg.ReadTimeout = DefaultReadTimeout
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = DefaultWriteTimeout
+	}
+	return cfg
+}
+
+// Backend is a complete DAL: locs and documents, indexes and range fetches. Every driver implements it.
+type Backend interface {
+	MongoAbstraction
+	Indexer
+	RangeFetcher
+}
+
+// Open returns a Backend on the driver the config selects. It does not connect; that happens on first use.
+func Open(cfg Config, logger *log.Logger) (Backend, error) {
+	cfg = cfg.withDefaults()
+	switch cfg.Driver {
+	case DriverOfficial:
+		return NewDriverSession(cfg, logger), nil
+	case DriverMgo:
+		return NewMongoSessionFromConfig(cfg, logger), nil
+	case DriverSQLite, DriverPostgres:
+		ss, err := NewSQLSession(cfg, logger)
+		if err != nil {
+			return nil, err
+		}
+		return ss, nil
+	}
+	return nil, fmt.Errorf("unknown mongo driver: %q", cfg.Driver)
+}
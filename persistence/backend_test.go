@@ -0,0 +1,45 @@
+package persistence
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpen(t *testing.T) {
+	t.Run("Default driver", func(t *testing.T) {
+		b, err := Open(Config{URL: "localhost:27017"}, nil)
+		require.NoError(t, err)
+		require.IsType(t, &DriverSession{}, b)
+	})
+	t.Run("Mgo", func(t *testing.T) {
+		b, err := Open(Config{Driver: DriverMgo, URL: "localhost:27017"}, nil)
+		require.NoError(t, err)
+		require.IsType(t, &MongoSession{}, b)
+	})
+	t.Run("Unknown driver", func(t *testing.T) {
+		_, err := Open(Config{Driver: "nope"}, nil)
+		require.Error(t, err)
+	})
+}
+
+func TestConfigDefaults(t *testing.T) {
+	cfg := Config{URL: "testURL", ReadTimeout: time.Second}.withDefaults()
+	require.Equal(t, Config{
+		Driver:       DriverOfficial,
+		URL:          "testURL",
+		DBName:       DefaultDbName,
+		DialTimeout:  DefaultTimeout,
+		ReadTimeout:  time.Second,
+		WriteTimeout: DefaultWriteTimeout,
+	}, cfg)
+}
+
+func TestTypedErrors(t *testing.T) {
+	require.True(t, IsNotFound(fmt.Errorf("%w: loc 1.2.3", ErrNotFound)), "Wrapped errors should still be recognized")
+	require.True(t, IsDuplicate(fmt.Errorf("%w: loc 1.2.3", ErrDuplicate)))
+	require.False(t, IsNotFound(fmt.Errorf("not found")), "Only the typed error counts")
+	require.False(t, IsDuplicate(ErrNotFound))
+}
@@ -0,0 +1,70 @@
+package persistence
+
+import (
+	"context"
+	"reflect"
+
+	"webstuff/types"
+)
+
+// RangeFetcher is implemented by DALs that can fetch the locs inside a box of x and z values
+type RangeFetcher interface {
+	FetchRangeFromCollection(ctx context.Context, collectionName string, xmin int, xmax int, zmin int, zmax int) ([]types.Loc, error)
+}
+
+// ChunkLoader lazily loads the chunks of a types.ChunkedGrid from a collection. It is read only: a grid on a
+// ChunkLoader keeps changed chunks in memory and never writes them back. Use a ChunkStore to save them.
+type ChunkLoader struct {
+	Fetcher    RangeFetcher
+	Collection string
+}
+
+// LoadChunk fetches the locs inside the chunk's bounds
+func (cl ChunkLoader) LoadChunk(ctx context.Context, key types.ChunkKey) ([]types.Loc, error) {
+	xmin, xmax, zmin, zmax := key.Bounds()
+	return cl.Fetcher.FetchRangeFromCollection(ctx, cl.Collection, xmin, xmax, zmin, zmax)
+}
+
+// ChunkStore loads the chunks of a types.ChunkedGrid from a collection and saves changed chunks back to it, on
+// eviction and on Flush
+type ChunkStore struct {
+	Store      Backend
+	Collection string
+}
+
+// LoadChunk fetches the locs inside the chunk's bounds
+func (cs ChunkStore) LoadChunk(ctx context.Context, key types.ChunkKey) ([]types.Loc, error) {
+	return ChunkLoader{Fetcher: cs.Store, Collection: cs.Collection}.LoadChunk(ctx, key)
+}
+
+// SaveChunk makes the collection's locs inside the chunk's bounds match locs: new locs are written, changed ones
+// updated and the ones no longer in the chunk deleted. Locs that are unchanged are left alone.
+func (cs ChunkStore) SaveChunk(ctx context.Context, key types.ChunkKey, locs []types.Loc) error {
+	stored, err := cs.LoadChunk(ctx, key)
+	if err != nil {
+		return err
+	}
+	before := make(map[string]types.Loc, len(stored))
+	for _, loc := range stored {
+		before[loc.GetID()] = loc
+	}
+	for _, loc := range locs {
+		old, ok := before[loc.GetID()]
+		delete(before, loc.GetID())
+		switch {
+		case !ok:
+			err = cs.Store.WriteCollection(ctx, cs.Collection, loc)
+		case !reflect.DeepEqual(old, loc):
+			err = cs.Store.UpdateCollection(ctx, cs.Collection, loc)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for id := range before {
+		if err := cs.Store.DeleteFromCollection(ctx, cs.Collection, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
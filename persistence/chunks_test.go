@@ -0,0 +1,57 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"webstuff/types"
+)
+
+type rangeRecorder struct {
+	bounds [][4]int
+}
+
+func (rr *rangeRecorder) FetchRangeFromCollection(ctx context.Context, coll string, xmin int, xmax int, zmin int, zmax int) ([]types.Loc, error) {
+	rr.bounds = append(rr.bounds, [4]int{xmin, xmax, zmin, zmax})
+	loc, err := types.LocFromCoords(xmin, -xmin-zmax, zmax)
+	return []types.Loc{loc}, err
+}
+
+func TestChunkLoader(t *testing.T) {
+	rr := &rangeRecorder{}
+	ctx := context.Background()
+	g := types.NewChunkedGrid(ChunkLoader{Fetcher: rr, Collection: "arena"}, 0)
+
+	status, ok, err := g.Status(ctx, -types.ChunkSize, 1, types.ChunkSize-1)
+	require.NoError(t, err)
+	require.True(t, ok, "Loc returned by the fetcher should be in the grid")
+	require.Equal(t, "new", status)
+	require.Equal(t, [][4]int{{-types.ChunkSize, -1, 0, types.ChunkSize - 1}}, rr.bounds)
+
+	_, _, err = g.Status(ctx, -types.ChunkSize+1, 0, types.ChunkSize-1)
+	require.NoError(t, err)
+	require.Len(t, rr.bounds, 1, "Second lookup in the same chunk should not fetch again")
+}
+
+func TestChunkStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := Open(Config{Driver: DriverSQLite, URL: ":memory:"}, nil)
+	require.NoError(t, err)
+	kept, _ := types.LocFromString("0.0.0")
+	gone, _ := types.LocFromString("1.-1.0")
+	require.NoError(t, store.WriteCollection(ctx, "arena", kept))
+	require.NoError(t, store.WriteCollection(ctx, "arena", gone))
+
+	g := types.NewChunkedGrid(ChunkStore{Store: store, Collection: "arena"}, 0)
+	ford, _ := types.LocFromString("2.-2.0")
+	ford.Status = "water"
+	ford.Properties = &types.Properties{Terrain: "water", Tags: []string{"ford"}}
+	require.NoError(t, g.Set(ctx, ford))
+	require.NoError(t, g.Delete(ctx, 1, -1, 0))
+	require.NoError(t, g.Flush(ctx))
+
+	locs, err := store.FetchAllFromCollection(ctx, "arena")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []types.Loc{kept, ford}, locs, "Flush should write new locs and delete removed ones")
+}
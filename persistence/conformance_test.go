@@ -0,0 +1,58 @@
+package persistence_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	per "webstuff/persistence"
+	"webstuff/persistence/persistencetest"
+)
+
+const (
+	testMongoURL = "localhost:27017"
+	testDbName   = "testDB"
+	// testPostgresURL names the environment variable holding a libpq connection string for a scratch Postgres
+	// database. The Postgres run is skipped without it.
+	testPostgresURL = "TEST_POSTGRES_URL"
+)
+
+func TestSQLiteConformance(t *testing.T) {
+	persistencetest.RunConformance(t, func() per.MongoAbstraction {
+		return open(t, per.Config{Driver: per.DriverSQLite, URL: ":memory:"})
+	})
+}
+
+func TestPostgresConformance(t *testing.T) {
+	url := os.Getenv(testPostgresURL)
+	if url == "" {
+		t.Skipf("Set %s to run against Postgres", testPostgresURL)
+	}
+	persistencetest.RunConformance(t, func() per.MongoAbstraction {
+		return open(t, per.Config{Driver: per.DriverPostgres, URL: url})
+	})
+}
+
+// TestMongoConformance runs on both mongo drivers. Unlike TestMongoSessionSuite it is skipped rather than failed when
+// mongo can't be reached, since the other backends already cover the suite.
+func TestMongoConformance(t *testing.T) {
+	probe := open(t, per.Config{URL: testMongoURL, DBName: testDbName, DialTimeout: time.Second})
+	if err := probe.ConnectToMongo(context.Background()); err != nil {
+		t.Skipf("Mongo is not available at %s: %s", testMongoURL, err)
+	}
+	for _, driver := range []string{per.DriverMgo, per.DriverOfficial} {
+		t.Run(driver, func(t *testing.T) {
+			persistencetest.RunConformance(t, func() per.MongoAbstraction {
+				return open(t, per.Config{Driver: driver, URL: testMongoURL, DBName: testDbName})
+			})
+		})
+	}
+}
+
+func open(t *testing.T, cfg per.Config) per.Backend {
+	b, err := per.Open(cfg, nil)
+	require.NoError(t, err)
+	return b
+}
@@ -0,0 +1,334 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+	"webstuff/types"
+)
+
+// DriverSession is a Mongo DAL built on the official driver. The driver keeps its own connection pool and reconnects
+// on its own, so once a session has connected it keeps its client.
+type DriverSession struct {
+	mu     sync.Mutex
+	client *mongo.Client
+	db     *mongo.Database
+	cfg    Config
+	logger *log.Logger
+}
+
+// NewDriverSession creates a DriverSession, filling in defaults for whatever the config leaves empty
+func NewDriverSession(cfg Config, logger *log.Logger) *DriverSession {
+	if logger == nil {
+		logger = log.New(os.Stdout, "mongoLayer", log.Ldate|log.Ltime)
+	}
+	return &DriverSession{cfg: cfg.withDefaults(), logger: logger}
+}
+
+// ConnectToMongo connects to the configured mongodb instance and checks that it answers, giving up at the dial timeout
+// or the context's deadline, whichever comes first. It does nothing if the session is already connected.
+func (ds *DriverSession) ConnectToMongo(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if ds.client != nil {
+		return nil
+	}
+	uri := ds.cfg.URL
+	if !strings.Contains(uri, "://") {
+		uri = "mongodb://" + uri
+	}
+	opts := options.Client().ApplyURI(uri).
+		SetConnectTimeout(ds.cfg.DialTimeout).
+		SetServerSelectionTimeout(ds.cfg.DialTimeout)
+	client, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrUnreachable, err)
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, ds.cfg.DialTimeout)
+	defer cancel()
+	if err = client.Ping(pingCtx, nil); err != nil {
+		client.Disconnect(context.Background())
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w: %s", ErrUnreachable, err)
+	}
+	ds.client = client
+	ds.db = client.Database(ds.cfg.DBName)
+	return nil
+}
+
+// run performs op bounded by the context and the operation's timeout. The driver stops the op on the server when its
+// context ends. Errors come back as the typed errors of this package where one applies.
+func (ds *DriverSession) run(ctx context.Context, name string, timeout time.Duration, op func(ctx context.Context, db *mongo.Database) error) error {
+	if err := ds.ConnectToMongo(ctx); err != nil {
+		ds.logger.Printf("%s: could not establish mongo connection: %s", name, err)
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := op(ctx, ds.db)
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		return ctxErr
+	}
+	return driverError(err)
+}
+
+// driverError translates the driver's errors into the typed errors of this package. Network errors and failing to
+// select a server both mean mongo can't be reached.
+func driverError(err error) error {
+	var selection topology.ServerSelectionError
+	switch {
+	case err == nil:
+		return nil
+	case err == mongo.ErrNoDocuments:
+		return ErrNotFound
+	case mongo.IsDuplicateKeyError(err):
+		return fmt.Errorf("%w: %s", ErrDuplicate, err)
+	case mongo.IsNetworkError(err), errors.As(err, &selection), err == mongo.ErrClientDisconnected:
+		return fmt.Errorf("%w: %s", ErrUnreachable, err)
+	}
+	return err
+}
+
+// WriteCollection writes the specified loc object to a given collection
+func (ds *DriverSession) WriteCollection(ctx context.Context, coll string, obj types.Loc) error {
+	return ds.run(ctx, "WriteCollection", ds.cfg.WriteTimeout, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection(coll).InsertOne(ctx, obj)
+		return err
+	})
+}
+
+// UpdateCollection replaces the loc with a matching _id in the specified collection
+func (ds *DriverSession) UpdateCollection(ctx context.Context, coll string, obj types.Loc) error {
+	return ds.run(ctx, "UpdateCollection", ds.cfg.WriteTimeout, func(ctx context.Context, db *mongo.Database) error {
+		exists, err := driverCollectionExists(ctx, db, coll)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w: Non-existent collection for update: %s", ErrNotFound, coll)
+		}
+		result, err := db.Collection(coll).ReplaceOne(ctx, bson.M{"_id": obj.GetID()}, obj)
+		if err == nil && result.MatchedCount == 0 {
+			return ErrNotFound
+		}
+		return err
+	})
+}
+
+// FetchFromCollection fetches the Loc by ID from the specified collection
+func (ds *DriverSession) FetchFromCollection(ctx context.Context, coll string, id string) (result types.Loc, err error) {
+	err = ds.run(ctx, "FetchFromCollection", ds.cfg.ReadTimeout, func(ctx context.Context, db *mongo.Database) error {
+		return db.Collection(coll).FindOne(ctx, bson.M{"_id": id}).Decode(&result)
+	})
+	return
+}
+
+// FetchAllFromCollection fetches every Loc in the specified collection
+func (ds *DriverSession) FetchAllFromCollection(ctx context.Context, coll string) ([]types.Loc, error) {
+	return ds.findLocs(ctx, "FetchAllFromCollection", coll, bson.M{})
+}
+
+// QueryCollection fetches every Loc in the specified collection that matches the query
+func (ds *DriverSession) QueryCollection(ctx context.Context, coll string, query LocQuery) ([]types.Loc, error) {
+	return ds.findLocs(ctx, "QueryCollection", coll, query.filter())
+}
+
+// FetchRangeFromCollection fetches every Loc in the specified collection with x and z inside the inclusive bounds
+func (ds *DriverSession) FetchRangeFromCollection(ctx context.Context, coll string, xmin int, xmax int, zmin int, zmax int) ([]types.Loc, error) {
+	filter := bson.M{
+		"x": bson.M{"$gte": xmin, "$lte": xmax},
+		"z": bson.M{"$gte": zmin, "$lte": zmax},
+	}
+	return ds.findLocs(ctx, "FetchRangeFromCollection", coll, filter)
+}
+
+func (ds *DriverSession) findLocs(ctx context.Context, name string, coll string, filter interface{}) ([]types.Loc, error) {
+	result := []types.Loc{}
+	err := ds.run(ctx, name, ds.cfg.ReadTimeout, func(ctx context.Context, db *mongo.Database) error {
+		return findAll(ctx, db.Collection(coll), filter, &result)
+	})
+	if err != nil {
+		return []types.Loc{}, err
+	}
+	return result, nil
+}
+
+func findAll(ctx context.Context, coll *mongo.Collection, filter interface{}, result interface{}) error {
+	cursor, err := coll.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, result)
+}
+
+// DeleteFromCollection removes the Loc by ID from the specified collection
+func (ds *DriverSession) DeleteFromCollection(ctx context.Context, coll string, id string) error {
+	return ds.run(ctx, "DeleteFromCollection", ds.cfg.WriteTimeout, func(ctx context.Context, db *mongo.Database) error {
+		return deleteOne(ctx, db.Collection(coll), id)
+	})
+}
+
+func deleteOne(ctx context.Context, coll *mongo.Collection, id string) error {
+	result, err := coll.DeleteOne(ctx, bson.M{"_id": id})
+	if err == nil && result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+// DropCollection removes the specified collection and everything in it. Dropping a collection that doesn't exist
+// is not an error.
+func (ds *DriverSession) DropCollection(ctx context.Context, coll string) error {
+	return ds.run(ctx, "DropCollection", ds.cfg.WriteTimeout, func(ctx context.Context, db *mongo.Database) error {
+		return db.Collection(coll).Drop(ctx)
+	})
+}
+
+// SaveDocument stores an arbitrary document under the specified ID, replacing any document already there
+func (ds *DriverSession) SaveDocument(ctx context.Context, coll string, id string, doc interface{}) error {
+	return ds.run(ctx, "SaveDocument", ds.cfg.WriteTimeout, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection(coll).ReplaceOne(ctx, bson.M{"_id": id}, doc, options.Replace().SetUpsert(true))
+		return err
+	})
+}
+
+// InsertDocument stores a document, failing with ErrDuplicate if a document with the specified ID already exists.
+// The doc must carry the same ID in its _id field.
+func (ds *DriverSession) InsertDocument(ctx context.Context, coll string, id string, doc interface{}) error {
+	return ds.run(ctx, "InsertDocument", ds.cfg.WriteTimeout, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection(coll).InsertOne(ctx, doc)
+		return err
+	})
+}
+
+// ReplaceDocumentIf replaces the document with the specified ID only while its fields equal the match's values, and
+// fails with ErrNotFound when no document matches
+func (ds *DriverSession) ReplaceDocumentIf(ctx context.Context, coll string, id string, match map[string]interface{}, doc interface{}) error {
+	return ds.run(ctx, "ReplaceDocumentIf", ds.cfg.WriteTimeout, func(ctx context.Context, db *mongo.Database) error {
+		filter := bson.M{"_id": id}
+		for field, value := range match {
+			filter[field] = value
+		}
+		result, err := db.Collection(coll).ReplaceOne(ctx, filter, doc)
+		if err == nil && result.MatchedCount == 0 {
+			return ErrNotFound
+		}
+		return err
+	})
+}
+
+// DeleteDocumentIf removes the document with the specified ID only while its fields equal the match's values, and
+// fails with ErrNotFound when no document matches
+func (ds *DriverSession) DeleteDocumentIf(ctx context.Context, coll string, id string, match map[string]interface{}) error {
+	return ds.run(ctx, "DeleteDocumentIf", ds.cfg.WriteTimeout, func(ctx context.Context, db *mongo.Database) error {
+		filter := bson.M{"_id": id}
+		for field, value := range match {
+			filter[field] = value
+		}
+		result, err := db.Collection(coll).DeleteOne(ctx, filter)
+		if err == nil && result.DeletedCount == 0 {
+			return ErrNotFound
+		}
+		return err
+	})
+}
+
+// FetchDocument fetches the document by ID from the specified collection and unmarshals it into result
+func (ds *DriverSession) FetchDocument(ctx context.Context, coll string, id string, result interface{}) error {
+	return ds.run(ctx, "FetchDocument", ds.cfg.ReadTimeout, func(ctx context.Context, db *mongo.Database) error {
+		return db.Collection(coll).FindOne(ctx, bson.M{"_id": id}).Decode(result)
+	})
+}
+
+// FindDocuments fetches every document in the collection whose fields equal the filter's values and unmarshals them
+// into result, which must be a pointer to a slice
+func (ds *DriverSession) FindDocuments(ctx context.Context, coll string, filter map[string]interface{}, result interface{}) error {
+	return ds.run(ctx, "FindDocuments", ds.cfg.ReadTimeout, func(ctx context.Context, db *mongo.Database) error {
+		return findAll(ctx, db.Collection(coll), bson.M(filter), result)
+	})
+}
+
+// DeleteDocument removes the document by ID from the specified collection
+func (ds *DriverSession) DeleteDocument(ctx context.Context, coll string, id string) error {
+	return ds.run(ctx, "DeleteDocument", ds.cfg.WriteTimeout, func(ctx context.Context, db *mongo.Database) error {
+		return deleteOne(ctx, db.Collection(coll), id)
+	})
+}
+
+// EnsureIndexes creates each of the specified indexes on the collection if it doesn't exist yet
+func (ds *DriverSession) EnsureIndexes(ctx context.Context, coll string, specs []IndexSpec) error {
+	return ds.run(ctx, "EnsureIndexes", ds.cfg.WriteTimeout, func(ctx context.Context, db *mongo.Database) error {
+		for _, spec := range specs {
+			keys := bson.D{}
+			for _, field := range spec.Key {
+				keys = append(keys, bson.E{Key: field, Value: 1})
+			}
+			model := mongo.IndexModel{Keys: keys, Options: options.Index().SetName(spec.Name()).SetUnique(spec.Unique)}
+			if _, err := db.Collection(coll).Indexes().CreateOne(ctx, model); err != nil {
+				return fmt.Errorf("index %s: %s", spec.Name(), err)
+			}
+		}
+		return nil
+	})
+}
+
+// ListIndexes returns the indexes on the collection other than the one on _id. A missing collection has none.
+func (ds *DriverSession) ListIndexes(ctx context.Context, coll string) ([]IndexSpec, error) {
+	result := []IndexSpec{}
+	err := ds.run(ctx, "ListIndexes", ds.cfg.ReadTimeout, func(ctx context.Context, db *mongo.Database) error {
+		exists, err := driverCollectionExists(ctx, db, coll)
+		if err != nil || !exists {
+			return err
+		}
+		var indexes []struct {
+			Name   string `bson:"name"`
+			Key    bson.D `bson:"key"`
+			Unique bool   `bson:"unique"`
+		}
+		cursor, err := db.Collection(coll).Indexes().List(ctx)
+		if err != nil {
+			return err
+		}
+		if err = cursor.All(ctx, &indexes); err != nil {
+			return err
+		}
+		for _, index := range indexes {
+			if index.Name == "_id_" {
+				continue
+			}
+			spec := IndexSpec{Key: []string{}, Unique: index.Unique}
+			for _, field := range index.Key {
+				spec.Key = append(spec.Key, field.Key)
+			}
+			result = append(result, spec)
+		}
+		return nil
+	})
+	if err != nil {
+		return []IndexSpec{}, err
+	}
+	return result, nil
+}
+
+func driverCollectionExists(ctx context.Context, db *mongo.Database, coll string) (bool, error) {
+	names, err := db.ListCollectionNames(ctx, bson.M{"name": coll})
+	return len(names) > 0, err
+}
@@ -0,0 +1,36 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+func TestDriverConnectCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ds := NewDriverSession(Config{URL: "i.am.abad.url:12345", DBName: testDbName}, nil)
+	require.Equal(t, context.Canceled, ds.ConnectToMongo(ctx), "A cancelled context should stop the connect before it starts")
+	_, err := ds.FetchFromCollection(ctx, testCollection, "0.0.0")
+	require.Equal(t, context.Canceled, err)
+}
+
+func TestDriverError(t *testing.T) {
+	require.Nil(t, driverError(nil))
+	require.Equal(t, ErrNotFound, driverError(mongo.ErrNoDocuments))
+	dup := mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "E11000 duplicate key error"}}}
+	require.True(t, IsDuplicate(driverError(dup)))
+	network := mongo.CommandError{Message: "connection reset", Labels: []string{"NetworkError"}}
+	require.ErrorIs(t, driverError(network), ErrUnreachable)
+	selection := topology.ServerSelectionError{Wrapped: errors.New("context deadline exceeded")}
+	require.ErrorIs(t, driverError(selection), ErrUnreachable)
+	require.ErrorIs(t, driverError(fmt.Errorf("find: %w", selection)), ErrUnreachable, "Wrapped selection errors should be caught too")
+	require.ErrorIs(t, driverError(mongo.ErrClientDisconnected), ErrUnreachable)
+	other := errors.New("boom")
+	require.Equal(t, other, driverError(other))
+}
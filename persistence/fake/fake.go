@@ -0,0 +1,686 @@
+// Package fake provides a programmable, in-memory persistence.Backend for tests. Out of the box a Store behaves like a
+// real database that happens to live in memory, and passes the persistencetest conformance suite. Tests then script
+// the calls they care about and assert on the calls that were made:
+//
+//	store := fake.New()
+//	store.OnFetch("1.-1.0").Return(types.Loc{}, per.ErrNotFound)
+//	store.OnConnect().Fail(errors.New("no route to host")).Once()
+//	store.SetLatency(50 * time.Millisecond)
+//	...
+//	require.Len(t, store.Calls("WriteCollection"), 1)
+package fake
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	per "webstuff/persistence"
+	"webstuff/types"
+)
+
+// methods are the names of the Backend methods a Store answers, which is what On and Calls take
+var methods = map[string]bool{
+	"ConnectToMongo":           true,
+	"WriteCollection":          true,
+	"UpdateCollection":         true,
+	"FetchFromCollection":      true,
+	"FetchAllFromCollection":   true,
+	"QueryCollection":          true,
+	"FetchRangeFromCollection": true,
+	"DeleteFromCollection":     true,
+	"DropCollection":           true,
+	"SaveDocument":             true,
+	"InsertDocument":           true,
+	"ReplaceDocumentIf":        true,
+	"FetchDocument":            true,
+	"FindDocuments":            true,
+	"DeleteDocument":           true,
+	"DeleteDocumentIf":         true,
+	"EnsureIndexes":            true,
+	"ListIndexes":              true,
+}
+
+// Call is one recorded call to a Store. Collection and ID are empty for methods that don't take them. Arg holds the
+// remaining argument, if any: the loc, document, query, filter, index specs or, for range fetches, the bounds as
+// [4]int{xmin, xmax, zmin, zmax}.
+type Call struct {
+	Method     string
+	Collection string
+	ID         string
+	Arg        interface{}
+}
+
+// Expectation scripts how a Store answers the calls that match it. An expectation that only delays lets the call go
+// on to the in-memory behaviour afterwards.
+type Expectation struct {
+	method     string
+	id         string
+	collection string
+	loc        types.Loc
+	locs       []types.Loc
+	err        error
+	answered   bool
+	delay      time.Duration
+	once       bool
+	spent      bool
+}
+
+// In narrows the expectation to calls on the specified collection
+func (e *Expectation) In(collection string) *Expectation {
+	e.collection = collection
+	return e
+}
+
+// Return answers a FetchFromCollection with the loc and error
+func (e *Expectation) Return(loc types.Loc, err error) *Expectation {
+	e.loc, e.err, e.answered = loc, err, true
+	return e
+}
+
+// ReturnLocs answers a FetchAllFromCollection, QueryCollection or FetchRangeFromCollection with the locs and error
+func (e *Expectation) ReturnLocs(locs []types.Loc, err error) *Expectation {
+	e.locs, e.err, e.answered = locs, err, true
+	return e
+}
+
+// Fail answers any call with the error alone
+func (e *Expectation) Fail(err error) *Expectation {
+	e.err, e.answered = err, true
+	return e
+}
+
+// Delay holds matching calls for d before they are answered. A call whose context ends first returns its error.
+func (e *Expectation) Delay(d time.Duration) *Expectation {
+	e.delay = d
+	return e
+}
+
+// Once limits the expectation to the first matching call
+func (e *Expectation) Once() *Expectation {
+	e.once = true
+	return e
+}
+
+func (e *Expectation) matches(call Call) bool {
+	return !e.spent && e.method == call.Method &&
+		(e.id == "" || e.id == call.ID) &&
+		(e.collection == "" || e.collection == call.Collection)
+}
+
+// Store is a fake persistence.Backend. It is safe for concurrent use.
+type Store struct {
+	mu           sync.Mutex
+	locs         map[string]map[string]types.Loc
+	documents    map[string]map[string][]byte
+	indexes      map[string][]per.IndexSpec
+	expectations []*Expectation
+	calls        []Call
+	latency      time.Duration
+}
+
+// New returns an empty Store that answers every call from memory
+func New() *Store {
+	return &Store{
+		locs:      map[string]map[string]types.Loc{},
+		documents: map[string]map[string][]byte{},
+		indexes:   map[string][]per.IndexSpec{},
+	}
+}
+
+// On adds an expectation for calls to the named Backend method, narrowed to the ID if one is given. When several
+// expectations match a call, the one added last answers it. On panics on a name that isn't a Backend method.
+func (s *Store) On(method string, id ...string) *Expectation {
+	if !methods[method] {
+		panic(fmt.Sprintf("fake: %q is not a Backend method", method))
+	}
+	e := &Expectation{method: method}
+	if len(id) > 0 {
+		e.id = id[0]
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expectations = append(s.expectations, e)
+	return e
+}
+
+// OnConnect adds an expectation for ConnectToMongo
+func (s *Store) OnConnect() *Expectation {
+	return s.On("ConnectToMongo")
+}
+
+// OnFetch adds an expectation for FetchFromCollection of the loc with the ID
+func (s *Store) OnFetch(id string) *Expectation {
+	return s.On("FetchFromCollection", id)
+}
+
+// OnWrite adds an expectation for WriteCollection of the loc with the ID
+func (s *Store) OnWrite(id string) *Expectation {
+	return s.On("WriteCollection", id)
+}
+
+// OnUpdate adds an expectation for UpdateCollection of the loc with the ID
+func (s *Store) OnUpdate(id string) *Expectation {
+	return s.On("UpdateCollection", id)
+}
+
+// OnDelete adds an expectation for DeleteFromCollection of the loc with the ID
+func (s *Store) OnDelete(id string) *Expectation {
+	return s.On("DeleteFromCollection", id)
+}
+
+// SetLatency holds every call for d before it is answered, on top of any expectation's delay
+func (s *Store) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// Calls returns the calls made so far, oldest first, limited to the named methods if any are given
+func (s *Store) Calls(method ...string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := []Call{}
+	for _, call := range s.calls {
+		if len(method) == 0 || contains(method, call.Method) {
+			result = append(result, call)
+		}
+	}
+	return result
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Seed stores the locs in the collection without recording calls or consulting expectations, replacing any with the
+// same ID
+func (s *Store) Seed(collection string, locs ...types.Loc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	coll := s.collection(collection)
+	for _, loc := range locs {
+		coll[loc.GetID()] = loc
+	}
+}
+
+// Locs returns the locs stored in the collection in ID order, without recording a call
+func (s *Store) Locs(collection string) []types.Loc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedLocs(collection, func(types.Loc) bool { return true })
+}
+
+// begin records the call, finds the expectation that answers it and waits out any latency. It fails if the context
+// is done, as the real sessions do.
+func (s *Store) begin(ctx context.Context, call Call) (*Expectation, error) {
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	var found *Expectation
+	for i := len(s.expectations) - 1; i >= 0; i-- {
+		if s.expectations[i].matches(call) {
+			found = s.expectations[i]
+			found.spent = found.once
+			break
+		}
+	}
+	delay := s.latency
+	s.mu.Unlock()
+
+	if found != nil {
+		delay += found.delay
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return found, nil
+}
+
+// answered reports whether the expectation scripts the answer to its call
+func answered(e *Expectation) bool {
+	return e != nil && e.answered
+}
+
+// ConnectToMongo succeeds unless an expectation says otherwise
+func (s *Store) ConnectToMongo(ctx context.Context) error {
+	e, err := s.begin(ctx, Call{Method: "ConnectToMongo"})
+	if err != nil || answered(e) {
+		return firstError(err, e)
+	}
+	return nil
+}
+
+func firstError(err error, e *Expectation) error {
+	if err != nil {
+		return err
+	}
+	return e.err
+}
+
+// WriteCollection inserts the loc, failing with persistence.ErrDuplicate on a taken ID or, once a unique index on
+// x, y and z has been ensured, on taken coordinates
+func (s *Store) WriteCollection(ctx context.Context, collection string, object types.Loc) error {
+	e, err := s.begin(ctx, Call{Method: "WriteCollection", Collection: collection, ID: object.GetID(), Arg: object})
+	if err != nil || answered(e) {
+		return firstError(err, e)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	coll := s.collection(collection)
+	if _, ok := coll[object.GetID()]; ok {
+		return fmt.Errorf("%w: loc %s", per.ErrDuplicate, object.GetID())
+	}
+	if s.uniqueCoords(collection) {
+		for _, loc := range coll {
+			if loc.X == object.X && loc.Y == object.Y && loc.Z == object.Z {
+				return fmt.Errorf("%w: coordinates of loc %s", per.ErrDuplicate, object.GetID())
+			}
+		}
+	}
+	coll[object.GetID()] = object
+	return nil
+}
+
+func (s *Store) uniqueCoords(collection string) bool {
+	for _, spec := range s.indexes[collection] {
+		if spec.Unique && reflect.DeepEqual(spec.Key, []string{"x", "y", "z"}) {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateCollection replaces the loc, failing with persistence.ErrNotFound if it or its collection doesn't exist
+func (s *Store) UpdateCollection(ctx context.Context, collection string, object types.Loc) error {
+	e, err := s.begin(ctx, Call{Method: "UpdateCollection", Collection: collection, ID: object.GetID(), Arg: object})
+	if err != nil || answered(e) {
+		return firstError(err, e)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	coll, ok := s.locs[collection]
+	if !ok {
+		return fmt.Errorf("%w: Non-existent collection for update: %s", per.ErrNotFound, collection)
+	}
+	if _, ok := coll[object.GetID()]; !ok {
+		return fmt.Errorf("%w: loc %s", per.ErrNotFound, object.GetID())
+	}
+	coll[object.GetID()] = object
+	return nil
+}
+
+// FetchFromCollection returns the loc, or persistence.ErrNotFound
+func (s *Store) FetchFromCollection(ctx context.Context, collection string, id string) (types.Loc, error) {
+	e, err := s.begin(ctx, Call{Method: "FetchFromCollection", Collection: collection, ID: id})
+	if err != nil {
+		return types.Loc{}, err
+	}
+	if answered(e) {
+		return e.loc, e.err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loc, ok := s.locs[collection][id]
+	if !ok {
+		return types.Loc{}, fmt.Errorf("%w: loc %s", per.ErrNotFound, id)
+	}
+	return loc, nil
+}
+
+// FetchAllFromCollection returns every loc in the collection in ID order
+func (s *Store) FetchAllFromCollection(ctx context.Context, collection string) ([]types.Loc, error) {
+	return s.findLocs(ctx, Call{Method: "FetchAllFromCollection", Collection: collection}, func(types.Loc) bool { return true })
+}
+
+// QueryCollection returns the locs in the collection that match the query, in ID order
+func (s *Store) QueryCollection(ctx context.Context, collection string, query per.LocQuery) ([]types.Loc, error) {
+	return s.findLocs(ctx, Call{Method: "QueryCollection", Collection: collection, Arg: query}, query.Matches)
+}
+
+// FetchRangeFromCollection returns the locs in the collection with x and z inside the inclusive bounds, in ID order
+func (s *Store) FetchRangeFromCollection(ctx context.Context, collection string, xmin int, xmax int, zmin int, zmax int) ([]types.Loc, error) {
+	call := Call{Method: "FetchRangeFromCollection", Collection: collection, Arg: [4]int{xmin, xmax, zmin, zmax}}
+	return s.findLocs(ctx, call, func(loc types.Loc) bool {
+		return loc.X >= xmin && loc.X <= xmax && loc.Z >= zmin && loc.Z <= zmax
+	})
+}
+
+func (s *Store) findLocs(ctx context.Context, call Call, keep func(types.Loc) bool) ([]types.Loc, error) {
+	e, err := s.begin(ctx, call)
+	if err != nil {
+		return []types.Loc{}, err
+	}
+	if answered(e) {
+		return e.locs, e.err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedLocs(call.Collection, keep), nil
+}
+
+func (s *Store) sortedLocs(collection string, keep func(types.Loc) bool) []types.Loc {
+	result := []types.Loc{}
+	for _, loc := range s.locs[collection] {
+		if keep(loc) {
+			result = append(result, loc)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].GetID() < result[j].GetID() })
+	return result
+}
+
+// DeleteFromCollection removes the loc, or fails with persistence.ErrNotFound
+func (s *Store) DeleteFromCollection(ctx context.Context, collection string, id string) error {
+	e, err := s.begin(ctx, Call{Method: "DeleteFromCollection", Collection: collection, ID: id})
+	if err != nil || answered(e) {
+		return firstError(err, e)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.locs[collection][id]; !ok {
+		return fmt.Errorf("%w: loc %s", per.ErrNotFound, id)
+	}
+	delete(s.locs[collection], id)
+	return nil
+}
+
+// DropCollection forgets the collection's locs, documents and indexes. Dropping a missing collection is not an error.
+func (s *Store) DropCollection(ctx context.Context, collection string) error {
+	e, err := s.begin(ctx, Call{Method: "DropCollection", Collection: collection})
+	if err != nil || answered(e) {
+		return firstError(err, e)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.locs, collection)
+	delete(s.documents, collection)
+	delete(s.indexes, collection)
+	return nil
+}
+
+// SaveDocument keeps a BSON copy of the document, replacing any with the same ID
+func (s *Store) SaveDocument(ctx context.Context, collection string, id string, doc interface{}) error {
+	return s.keepDocument(ctx, Call{Method: "SaveDocument", Collection: collection, ID: id, Arg: doc}, true)
+}
+
+// InsertDocument keeps a BSON copy of the document, failing with persistence.ErrDuplicate if the ID is taken
+func (s *Store) InsertDocument(ctx context.Context, collection string, id string, doc interface{}) error {
+	return s.keepDocument(ctx, Call{Method: "InsertDocument", Collection: collection, ID: id, Arg: doc}, false)
+}
+
+func (s *Store) keepDocument(ctx context.Context, call Call, replace bool) error {
+	e, err := s.begin(ctx, call)
+	if err != nil || answered(e) {
+		return firstError(err, e)
+	}
+	data, err := bson.Marshal(call.Arg)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	docs, ok := s.documents[call.Collection]
+	if !ok {
+		docs = map[string][]byte{}
+		s.documents[call.Collection] = docs
+		s.collection(call.Collection)
+	}
+	if _, taken := docs[call.ID]; taken && !replace {
+		return fmt.Errorf("%w: document %s", per.ErrDuplicate, call.ID)
+	}
+	if err := s.checkUnique(call.Collection, call.ID, data); err != nil {
+		return err
+	}
+	docs[call.ID] = data
+	return nil
+}
+
+// checkUnique fails with persistence.ErrDuplicate when another document of the collection has the same values as data
+// for the fields of one of the collection's unique indexes. Documents missing any of the fields are not compared.
+func (s *Store) checkUnique(collection string, id string, data []byte) error {
+	var unique []per.IndexSpec
+	for _, spec := range s.indexes[collection] {
+		if spec.Unique {
+			unique = append(unique, spec)
+		}
+	}
+	if len(unique) == 0 {
+		return nil
+	}
+	fields := bson.M{}
+	if err := bson.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for otherID, otherData := range s.documents[collection] {
+		if otherID == id {
+			continue
+		}
+		other := bson.M{}
+		if err := bson.Unmarshal(otherData, &other); err != nil {
+			return err
+		}
+		for _, spec := range unique {
+			if sameKey(spec, fields, other) {
+				return fmt.Errorf("%w: document %s has the same %s as %s", per.ErrDuplicate, id, spec.Name(), otherID)
+			}
+		}
+	}
+	return nil
+}
+
+// sameKey reports whether both documents have every field of the index, with equal values
+func sameKey(spec per.IndexSpec, fields bson.M, other bson.M) bool {
+	for _, field := range spec.Key {
+		a, ok := fields[field]
+		b, otherOK := other[field]
+		if !ok || !otherOK || !reflect.DeepEqual(a, b) {
+			return false
+		}
+	}
+	return true
+}
+
+// ReplaceDocumentIf replaces the document only while its fields equal the match's values, and fails with
+// persistence.ErrNotFound when no document matches. Call.Arg holds the new document.
+func (s *Store) ReplaceDocumentIf(ctx context.Context, collection string, id string, match map[string]interface{}, doc interface{}) error {
+	e, err := s.begin(ctx, Call{Method: "ReplaceDocumentIf", Collection: collection, ID: id, Arg: doc})
+	if err != nil || answered(e) {
+		return firstError(err, e)
+	}
+	wanted, err := bsonFields(match)
+	if err != nil {
+		return err
+	}
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.documents[collection][id]
+	if !ok {
+		return fmt.Errorf("%w: document %s", per.ErrNotFound, id)
+	}
+	fields := bson.M{}
+	if err := bson.Unmarshal(old, &fields); err != nil {
+		return err
+	}
+	if !per.MatchesFields(fields, wanted) {
+		return fmt.Errorf("%w: document %s does not match", per.ErrNotFound, id)
+	}
+	if err := s.checkUnique(collection, id, data); err != nil {
+		return err
+	}
+	s.documents[collection][id] = data
+	return nil
+}
+
+// FetchDocument unmarshals the document into result, or fails with persistence.ErrNotFound
+func (s *Store) FetchDocument(ctx context.Context, collection string, id string, result interface{}) error {
+	e, err := s.begin(ctx, Call{Method: "FetchDocument", Collection: collection, ID: id})
+	if err != nil || answered(e) {
+		return firstError(err, e)
+	}
+	s.mu.Lock()
+	data, ok := s.documents[collection][id]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: document %s", per.ErrNotFound, id)
+	}
+	return bson.Unmarshal(data, result)
+}
+
+// FindDocuments unmarshals the documents whose fields equal the filter's values into result, a pointer to a slice, in
+// ID order
+func (s *Store) FindDocuments(ctx context.Context, collection string, filter map[string]interface{}, result interface{}) error {
+	e, err := s.begin(ctx, Call{Method: "FindDocuments", Collection: collection, Arg: filter})
+	if err != nil || answered(e) {
+		return firstError(err, e)
+	}
+	wanted, err := bsonFields(filter)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := []string{}
+	for id := range s.documents[collection] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	slice := reflect.ValueOf(result).Elem()
+	slice.Set(reflect.MakeSlice(slice.Type(), 0, len(ids)))
+	for _, id := range ids {
+		data := s.documents[collection][id]
+		fields := bson.M{}
+		if err := bson.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		if !per.MatchesFields(fields, wanted) {
+			continue
+		}
+		item := reflect.New(slice.Type().Elem())
+		if err := bson.Unmarshal(data, item.Interface()); err != nil {
+			return err
+		}
+		slice.Set(reflect.Append(slice, item.Elem()))
+	}
+	return nil
+}
+
+// bsonFields round trips a filter through BSON so its values compare equal to the decoded fields of a document
+func bsonFields(filter map[string]interface{}) (bson.M, error) {
+	wanted := bson.M{}
+	data, err := bson.Marshal(bson.M(filter))
+	if err == nil {
+		err = bson.Unmarshal(data, &wanted)
+	}
+	return wanted, err
+}
+
+// DeleteDocument forgets the document, or fails with persistence.ErrNotFound
+func (s *Store) DeleteDocument(ctx context.Context, collection string, id string) error {
+	e, err := s.begin(ctx, Call{Method: "DeleteDocument", Collection: collection, ID: id})
+	if err != nil || answered(e) {
+		return firstError(err, e)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.documents[collection][id]; !ok {
+		return fmt.Errorf("%w: document %s", per.ErrNotFound, id)
+	}
+	delete(s.documents[collection], id)
+	return nil
+}
+
+// DeleteDocumentIf removes the document only while its fields equal the match's values, and fails with
+// persistence.ErrNotFound when no document matches. Call.Arg holds the match.
+func (s *Store) DeleteDocumentIf(ctx context.Context, collection string, id string, match map[string]interface{}) error {
+	e, err := s.begin(ctx, Call{Method: "DeleteDocumentIf", Collection: collection, ID: id, Arg: match})
+	if err != nil || answered(e) {
+		return firstError(err, e)
+	}
+	wanted, err := bsonFields(match)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.documents[collection][id]
+	if !ok {
+		return fmt.Errorf("%w: document %s", per.ErrNotFound, id)
+	}
+	fields := bson.M{}
+	if err := bson.Unmarshal(old, &fields); err != nil {
+		return err
+	}
+	if !per.MatchesFields(fields, wanted) {
+		return fmt.Errorf("%w: document %s does not match", per.ErrNotFound, id)
+	}
+	delete(s.documents[collection], id)
+	return nil
+}
+
+// EnsureIndexes adds the specs that the collection doesn't have yet. A unique index on x, y and z is enforced by
+// WriteCollection and unique indexes on documents by the document writes; the others only show up in ListIndexes.
+func (s *Store) EnsureIndexes(ctx context.Context, collection string, specs []per.IndexSpec) error {
+	e, err := s.begin(ctx, Call{Method: "EnsureIndexes", Collection: collection, Arg: specs})
+	if err != nil || answered(e) {
+		return firstError(err, e)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.collection(collection)
+	for _, spec := range specs {
+		found := false
+		for _, have := range s.indexes[collection] {
+			found = found || have.Name() == spec.Name()
+		}
+		if !found {
+			s.indexes[collection] = append(s.indexes[collection], spec)
+		}
+	}
+	return nil
+}
+
+// ListIndexes returns the indexes ensured on the collection, in the order they were added
+func (s *Store) ListIndexes(ctx context.Context, collection string) ([]per.IndexSpec, error) {
+	e, err := s.begin(ctx, Call{Method: "ListIndexes", Collection: collection})
+	if err != nil {
+		return []per.IndexSpec{}, err
+	}
+	if answered(e) {
+		return []per.IndexSpec{}, e.err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]per.IndexSpec{}, s.indexes[collection]...), nil
+}
+
+// collection returns the locs of the collection, creating it if it doesn't exist yet. The caller holds the lock.
+func (s *Store) collection(collection string) map[string]types.Loc {
+	coll, ok := s.locs[collection]
+	if !ok {
+		coll = map[string]types.Loc{}
+		s.locs[collection] = coll
+	}
+	return coll
+}
@@ -0,0 +1,96 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	per "webstuff/persistence"
+	"webstuff/persistence/persistencetest"
+	"webstuff/types"
+)
+
+func TestConformance(t *testing.T) {
+	persistencetest.RunConformance(t, func() per.MongoAbstraction { return New() })
+}
+
+func TestExpectations(t *testing.T) {
+	ctx := context.Background()
+	loc, _ := types.LocFromString("1.-1.0")
+
+	t.Run("Return", func(t *testing.T) {
+		store := New()
+		store.OnFetch("1.-1.0").Return(loc, nil)
+		result, err := store.FetchFromCollection(ctx, "locs", "1.-1.0")
+		require.NoError(t, err)
+		require.Equal(t, loc, result, "The scripted loc should be returned without being stored")
+		_, err = store.FetchFromCollection(ctx, "locs", "0.0.0")
+		require.True(t, per.IsNotFound(err), "Other IDs should fall through to the store")
+	})
+	t.Run("Fail once", func(t *testing.T) {
+		store := New()
+		boom := errors.New("boom")
+		store.OnConnect().Fail(boom).Once()
+		require.Equal(t, boom, store.ConnectToMongo(ctx))
+		require.NoError(t, store.ConnectToMongo(ctx), "A spent expectation should no longer answer")
+	})
+	t.Run("Latest wins", func(t *testing.T) {
+		store := New()
+		store.OnWrite("1.-1.0").Fail(errors.New("first"))
+		store.OnWrite("1.-1.0").Fail(per.ErrDuplicate)
+		require.True(t, per.IsDuplicate(store.WriteCollection(ctx, "locs", loc)))
+	})
+	t.Run("In collection", func(t *testing.T) {
+		store := New()
+		store.On("FetchAllFromCollection").In("other").ReturnLocs(nil, errors.New("boom"))
+		locs, err := store.FetchAllFromCollection(ctx, "locs")
+		require.NoError(t, err)
+		require.Len(t, locs, 0)
+		_, err = store.FetchAllFromCollection(ctx, "other")
+		require.Error(t, err)
+	})
+	t.Run("Unknown method", func(t *testing.T) {
+		require.Panics(t, func() { New().On("FetchEverything") })
+	})
+}
+
+func TestCalls(t *testing.T) {
+	ctx := context.Background()
+	store := New()
+	loc, _ := types.LocFromString("1.-1.0")
+	require.NoError(t, store.WriteCollection(ctx, "locs", loc))
+	_, err := store.QueryCollection(ctx, "locs", per.LocQuery{Tag: "road"})
+	require.NoError(t, err)
+
+	require.Equal(t, []Call{
+		{Method: "WriteCollection", Collection: "locs", ID: "1.-1.0", Arg: loc},
+		{Method: "QueryCollection", Collection: "locs", Arg: per.LocQuery{Tag: "road"}},
+	}, store.Calls())
+	require.Len(t, store.Calls("QueryCollection"), 1)
+	require.Len(t, store.Calls("DeleteFromCollection"), 0)
+}
+
+func TestLatency(t *testing.T) {
+	loc, _ := types.LocFromString("1.-1.0")
+
+	t.Run("Delay", func(t *testing.T) {
+		store := New()
+		store.Seed("locs", loc)
+		store.OnFetch("1.-1.0").Delay(20 * time.Millisecond)
+		start := time.Now()
+		result, err := store.FetchFromCollection(context.Background(), "locs", "1.-1.0")
+		require.NoError(t, err)
+		require.Equal(t, loc, result, "A delay alone should still answer from the store")
+		require.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	})
+	t.Run("Deadline", func(t *testing.T) {
+		store := New()
+		store.SetLatency(time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := store.FetchAllFromCollection(ctx, "locs")
+		require.Equal(t, context.DeadlineExceeded, err, "The call should give up with its context")
+	})
+}
@@ -0,0 +1,85 @@
+package persistence
+
+import (
+	"cmp"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// filterOperators are the comparisons a document filter may use in place of a plain value, as in
+// {"at": {"$lte": t}}. Mongo applies them itself; MatchesFields gives them the same meaning for the other stores.
+var filterOperators = map[string]func(order int) bool{
+	"$lt":  func(order int) bool { return order < 0 },
+	"$lte": func(order int) bool { return order <= 0 },
+	"$gt":  func(order int) bool { return order > 0 },
+	"$gte": func(order int) bool { return order >= 0 },
+}
+
+// MatchesFields reports whether the decoded fields of a document pass a filter decoded the same way. Plain values
+// match by equality and a document of filterOperators by comparison. Values of different kinds never match a
+// comparison.
+func MatchesFields(fields bson.M, wanted bson.M) bool {
+	for name, value := range wanted {
+		ops, ok := value.(bson.M)
+		if !ok || !isComparison(ops) {
+			if !reflect.DeepEqual(fields[name], value) {
+				return false
+			}
+			continue
+		}
+		for op, bound := range ops {
+			order, ok := compareValues(fields[name], bound)
+			if !ok || !filterOperators[op](order) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isComparison reports whether every key of the document is one of the filterOperators
+func isComparison(ops bson.M) bool {
+	for op := range ops {
+		if _, ok := filterOperators[op]; !ok {
+			return false
+		}
+	}
+	return len(ops) > 0
+}
+
+// compareValues orders two decoded BSON values of the same kind, returning false when they can't be compared
+func compareValues(a interface{}, b interface{}) (int, bool) {
+	switch av := a.(type) {
+	case primitive.DateTime:
+		if bv, ok := b.(primitive.DateTime); ok {
+			return cmp.Compare(av, bv), true
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv), true
+		}
+	default:
+		af, aok := number(a)
+		bf, bok := number(b)
+		if aok && bok {
+			return cmp.Compare(af, bf), true
+		}
+	}
+	return 0, false
+}
+
+// number converts the numeric BSON types to float64
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,40 @@
+package persistence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMatchesFields(t *testing.T) {
+	at := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	fields, err := bsonFields(map[string]interface{}{"owner": "red", "count": 2, "at": at})
+	require.NoError(t, err)
+	matches := func(filter map[string]interface{}) bool {
+		wanted, err := bsonFields(filter)
+		require.NoError(t, err)
+		return MatchesFields(fields, wanted)
+	}
+	t.Run("Equality", func(t *testing.T) {
+		require.True(t, matches(map[string]interface{}{"owner": "red", "count": 2}))
+		require.False(t, matches(map[string]interface{}{"owner": "blue"}))
+		require.True(t, matches(map[string]interface{}{}), "An empty filter matches everything")
+	})
+	t.Run("Comparison", func(t *testing.T) {
+		require.True(t, matches(map[string]interface{}{"count": map[string]interface{}{"$lte": 2}}))
+		require.False(t, matches(map[string]interface{}{"count": map[string]interface{}{"$lt": 2}}))
+		require.True(t, matches(map[string]interface{}{"count": map[string]interface{}{"$gt": 1.5, "$lt": 3}}))
+		require.True(t, matches(map[string]interface{}{"owner": map[string]interface{}{"$gte": "red"}}))
+		require.True(t, matches(map[string]interface{}{"at": map[string]interface{}{"$lte": at}}))
+		require.False(t, matches(map[string]interface{}{"at": map[string]interface{}{"$gt": at}}))
+	})
+	t.Run("Mismatched kinds", func(t *testing.T) {
+		require.False(t, matches(map[string]interface{}{"count": map[string]interface{}{"$lte": "2"}}))
+		require.False(t, matches(map[string]interface{}{"missing": map[string]interface{}{"$gte": 0}}))
+	})
+	t.Run("Plain documents", func(t *testing.T) {
+		require.False(t, MatchesFields(fields, bson.M{"owner": bson.M{"name": "red"}}), "Only operator keys make a comparison")
+	})
+}
@@ -0,0 +1,157 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// UnitCollection is where units are stored
+const UnitCollection = "units"
+
+// IndexSpec declares one index by the fields it covers, in order, all ascending
+type IndexSpec struct {
+	Key    []string `json:"key"`
+	Unique bool     `json:"unique,omitempty"`
+}
+
+// Name returns the name mongo gives the index by default, such as 'x_1_y_1_z_1'
+func (spec IndexSpec) Name() string {
+	parts := make([]string, len(spec.Key))
+	for i, field := range spec.Key {
+		parts[i] = field + "_1"
+	}
+	return strings.Join(parts, "_")
+}
+
+// IndexPlan declares the indexes each collection should have, keyed by collection name
+type IndexPlan map[string][]IndexSpec
+
+// LocIndexes are declared on every loc collection. The unique coordinate index keeps two documents from claiming the
+// same hex under different IDs, x and z back range queries, and the rest back LocQuery filters.
+var LocIndexes = []IndexSpec{
+	{Key: []string{"x", "y", "z"}, Unique: true},
+	{Key: []string{"x", "z"}},
+	{Key: []string{"status"}},
+	{Key: []string{"properties.terrain"}},
+	{Key: []string{"properties.tags"}},
+}
+
+// UnitIndexes back the lookups of units by where they stand and who owns them. The unique position index keeps two
+// units from standing on the same hex.
+var UnitIndexes = []IndexSpec{
+	{Key: []string{"position"}, Unique: true},
+	{Key: []string{"owner"}},
+}
+
+// EventIndexes back History and StateAt
+var EventIndexes = []IndexSpec{
+	{Key: []string{"collection", "locId"}},
+	{Key: []string{"collection", "at"}},
+}
+
+// DefaultIndexPlan declares LocIndexes on each of the loc collections, along with the unit and event indexes. A
+// world's loc collection brings the UnitIndexes of that world's unit collection with it.
+func DefaultIndexPlan(locColls ...string) IndexPlan {
+	plan := IndexPlan{UnitCollection: UnitIndexes, EventCollection: EventIndexes}
+	for _, coll := range locColls {
+		plan[coll] = LocIndexes
+		if name, ok := strings.CutPrefix(coll, worldPrefix); ok {
+			plan[WorldUnitCollectionName(name)] = UnitIndexes
+		}
+	}
+	return plan
+}
+
+// collections returns the names of the plan's collections in order
+func (plan IndexPlan) collections() []string {
+	colls := make([]string, 0, len(plan))
+	for coll := range plan {
+		colls = append(colls, coll)
+	}
+	sort.Strings(colls)
+	return colls
+}
+
+// Indexer is implemented by DALs that manage indexes. EnsureIndexes must be idempotent.
+type Indexer interface {
+	EnsureIndexes(ctx context.Context, collectionName string, specs []IndexSpec) error
+	ListIndexes(ctx context.Context, collectionName string) ([]IndexSpec, error)
+}
+
+// IndexReport compares the indexes declared for a collection with the ones it has. The _id index is left out.
+type IndexReport struct {
+	Collection string      `json:"collection"`
+	Present    []IndexSpec `json:"present"`
+	Missing    []IndexSpec `json:"missing"`
+	Extra      []IndexSpec `json:"extra"`
+}
+
+// OK reports whether the collection has exactly the declared indexes
+func (r IndexReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Extra) == 0
+}
+
+// CheckIndexes reports how the collection's indexes differ from the specs. An index with a declared name but
+// different options counts as both missing and extra.
+func CheckIndexes(ctx context.Context, ix Indexer, coll string, specs []IndexSpec) (IndexReport, error) {
+	report := IndexReport{Collection: coll, Present: []IndexSpec{}, Missing: []IndexSpec{}, Extra: []IndexSpec{}}
+	actual, err := ix.ListIndexes(ctx, coll)
+	if err != nil {
+		return report, err
+	}
+	byName := map[string]IndexSpec{}
+	for _, spec := range actual {
+		byName[spec.Name()] = spec
+	}
+	declared := map[string]bool{}
+	for _, spec := range specs {
+		declared[spec.Name()] = true
+		found, ok := byName[spec.Name()]
+		if ok && found.Unique == spec.Unique {
+			report.Present = append(report.Present, spec)
+			continue
+		}
+		report.Missing = append(report.Missing, spec)
+		if ok {
+			report.Extra = append(report.Extra, found)
+		}
+	}
+	for _, spec := range actual {
+		if !declared[spec.Name()] {
+			report.Extra = append(report.Extra, spec)
+		}
+	}
+	return report, nil
+}
+
+// EnsureIndexPlan creates whatever indexes of the plan are missing and reports on every collection afterwards, in
+// collection order. Extra indexes are reported but never dropped.
+func EnsureIndexPlan(ctx context.Context, ix Indexer, plan IndexPlan) ([]IndexReport, error) {
+	reports := []IndexReport{}
+	for _, coll := range plan.collections() {
+		if err := ix.EnsureIndexes(ctx, coll, plan[coll]); err != nil {
+			return reports, fmt.Errorf("could not ensure indexes on %s: %s", coll, err)
+		}
+		report, err := CheckIndexes(ctx, ix, coll, plan[coll])
+		if err != nil {
+			return reports, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// CheckIndexPlan reports how each collection of the plan differs from it, without changing anything
+func CheckIndexPlan(ctx context.Context, ix Indexer, plan IndexPlan) ([]IndexReport, error) {
+	reports := []IndexReport{}
+	for _, coll := range plan.collections() {
+		report, err := CheckIndexes(ctx, ix, coll, plan[coll])
+		if err != nil {
+			return reports, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
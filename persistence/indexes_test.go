@@ -0,0 +1,85 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memIndexer keeps the indexes of each collection in memory
+type memIndexer struct {
+	indexes map[string][]IndexSpec
+	fail    bool
+}
+
+func (mi *memIndexer) EnsureIndexes(ctx context.Context, coll string, specs []IndexSpec) error {
+	if mi.fail {
+		return fmt.Errorf("ensure failed")
+	}
+	have := map[string]bool{}
+	for _, spec := range mi.indexes[coll] {
+		have[spec.Name()] = true
+	}
+	for _, spec := range specs {
+		if !have[spec.Name()] {
+			mi.indexes[coll] = append(mi.indexes[coll], spec)
+		}
+	}
+	return nil
+}
+
+func (mi *memIndexer) ListIndexes(ctx context.Context, coll string) ([]IndexSpec, error) {
+	return mi.indexes[coll], nil
+}
+
+func TestIndexSpecName(t *testing.T) {
+	require.Equal(t, "x_1_y_1_z_1", IndexSpec{Key: []string{"x", "y", "z"}}.Name())
+	require.Equal(t, "properties.tags_1", IndexSpec{Key: []string{"properties.tags"}}.Name())
+}
+
+func TestCheckIndexes(t *testing.T) {
+	ctx := context.Background()
+	mi := &memIndexer{indexes: map[string][]IndexSpec{
+		"arena": {
+			{Key: []string{"x", "y", "z"}},
+			{Key: []string{"status"}},
+			{Key: []string{"legacy"}},
+		},
+	}}
+	report, err := CheckIndexes(ctx, mi, "arena", LocIndexes)
+	require.NoError(t, err)
+	require.False(t, report.OK())
+	require.Equal(t, []IndexSpec{{Key: []string{"status"}}}, report.Present)
+	require.Len(t, report.Missing, len(LocIndexes)-1)
+	require.Equal(t, []IndexSpec{{Key: []string{"x", "y", "z"}}, {Key: []string{"legacy"}}}, report.Extra,
+		"A coordinate index that isn't unique should count as extra as well as missing")
+}
+
+func TestEnsureIndexPlan(t *testing.T) {
+	ctx := context.Background()
+	mi := &memIndexer{indexes: map[string][]IndexSpec{}}
+	plan := DefaultIndexPlan("arena", "world_north")
+
+	reports, err := EnsureIndexPlan(ctx, mi, plan)
+	require.NoError(t, err)
+	require.Len(t, reports, 5)
+	require.Equal(t, []string{"arena", EventCollection, UnitCollection, "units_north", "world_north"},
+		[]string{reports[0].Collection, reports[1].Collection, reports[2].Collection, reports[3].Collection, reports[4].Collection})
+	for _, r := range reports {
+		require.Truef(t, r.OK(), "%s should have every declared index", r.Collection)
+	}
+
+	_, err = EnsureIndexPlan(ctx, mi, plan)
+	require.NoError(t, err)
+	require.Len(t, mi.indexes["arena"], len(LocIndexes), "Ensuring twice should add nothing")
+
+	reports, err = CheckIndexPlan(ctx, mi, IndexPlan{"empty": UnitIndexes})
+	require.NoError(t, err)
+	require.Len(t, reports[0].Missing, 2)
+
+	mi.fail = true
+	_, err = EnsureIndexPlan(ctx, mi, plan)
+	require.Error(t, err)
+}
@@ -0,0 +1,267 @@
+// Package migrations upgrades stored locs as types.Loc changes. Each migration has a version and runs once per loc
+// collection. What has been applied is recorded in the _migrations collection, along with the locks that keep two
+// server instances from running the same migration at once.
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	per "webstuff/persistence"
+	"webstuff/types"
+)
+
+// Collection is where applied migrations and migration locks are recorded
+const Collection = "_migrations"
+
+// LockTimeout is how long a lock holds off other instances. The instance holding a lock renews it while the
+// migration runs, so a lock left to expire is assumed to belong to an instance that died mid-migration and is taken
+// over.
+const LockTimeout = 10 * time.Minute
+
+// ErrLocked is returned when another instance holds the lock for a migration
+var ErrLocked = errors.New("migration is locked by another instance")
+
+// Migration upgrades one loc collection. Up returns how many locs it changed or, with dryRun, how many it would change
+// without writing anything.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, mdb per.MongoAbstraction, coll string, dryRun bool) (int, error)
+}
+
+// All lists every migration in version order. New migrations are appended with the next version.
+var All = []Migration{
+	{Version: 1, Name: "backfill status", Up: backfillStatus},
+}
+
+// Record notes that a migration was applied to a collection
+type Record struct {
+	ID         string    `json:"id" bson:"_id"`
+	Collection string    `json:"collection" bson:"collection"`
+	Version    int       `json:"version" bson:"version"`
+	Name       string    `json:"name" bson:"name"`
+	AppliedAt  time.Time `json:"appliedAt" bson:"appliedAt"`
+	Changed    int       `json:"changed" bson:"changed"`
+}
+
+// Result reports what Run did with one migration on one collection
+type Result struct {
+	Collection string `json:"collection"`
+	Version    int    `json:"version"`
+	Name       string `json:"name"`
+	Changed    int    `json:"changed"`
+	Skipped    bool   `json:"skipped"`
+	DryRun     bool   `json:"dryRun"`
+}
+
+// lock is held in Collection while a migration runs. Owner and Expires together tell one holding of the lock from
+// the next, so the lock is only renewed, taken over or released while it is the holding that was read.
+type lock struct {
+	ID      string    `bson:"_id"`
+	Owner   string    `bson:"owner"`
+	Expires time.Time `bson:"expires"`
+}
+
+// match selects the lock only while it is this holding
+func (l lock) match() map[string]interface{} {
+	return map[string]interface{}{"owner": l.Owner, "expires": l.Expires}
+}
+
+// Runner applies migrations for one instance, named by Owner in the locks it takes
+type Runner struct {
+	DB         per.MongoAbstraction
+	Owner      string
+	Migrations []Migration
+	now        func() time.Time
+	renewEvery time.Duration
+}
+
+// NewRunner returns a runner for every migration in All
+func NewRunner(mdb per.MongoAbstraction, owner string) *Runner {
+	return &Runner{DB: mdb, Owner: owner, Migrations: All, now: time.Now}
+}
+
+// Run applies the pending migrations to each collection in version order, stopping at the first failure. With
+// dryRun nothing is written or locked and the results say how many locs each migration would change.
+func (r *Runner) Run(ctx context.Context, colls []string, dryRun bool) ([]Result, error) {
+	results := []Result{}
+	for i, m := range r.Migrations {
+		if i > 0 && m.Version <= r.Migrations[i-1].Version {
+			return results, fmt.Errorf("migration %d (%s) is out of order", m.Version, m.Name)
+		}
+	}
+	for _, coll := range colls {
+		for _, m := range r.Migrations {
+			result := Result{Collection: coll, Version: m.Version, Name: m.Name, DryRun: dryRun}
+			applied, err := r.applied(ctx, coll, m)
+			if err != nil {
+				return results, err
+			}
+			switch {
+			case applied:
+				result.Skipped = true
+			case dryRun:
+				result.Changed, err = m.Up(ctx, r.DB, coll, true)
+			default:
+				result.Changed, result.Skipped, err = r.apply(ctx, coll, m)
+			}
+			if err != nil {
+				return results, fmt.Errorf("migration %d (%s) on %s: %w", m.Version, m.Name, coll, err)
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// apply runs the migration under its lock, renewing the lock until the migration is done. If another instance
+// applied it while this one waited for the lock, it is skipped. If the lock is lost to another instance meanwhile, the
+// migration is cancelled and not recorded.
+func (r *Runner) apply(ctx context.Context, coll string, m Migration) (changed int, skipped bool, err error) {
+	lockID := fmt.Sprintf("lock/%s/%d", coll, m.Version)
+	var l lock
+	if l, err = r.acquire(ctx, lockID); err != nil {
+		return
+	}
+	runCtx, stop := r.hold(ctx, l)
+	if skipped, err = r.applied(runCtx, coll, m); !skipped && err == nil {
+		// loc writes are recorded in the audit log, under the migration actor
+		changed, err = m.Up(runCtx, per.NewAudited(r.DB).As("migration"), coll, false)
+	}
+	l, lost := stop()
+	if lost {
+		return changed, false, fmt.Errorf("%s was taken over by another instance while migrating: %w", lockID, ErrLocked)
+	}
+	// released even when ctx is cancelled, so other instances don't wait out LockTimeout
+	defer r.DB.DeleteDocumentIf(context.WithoutCancel(ctx), Collection, lockID, l.match())
+	if skipped || err != nil {
+		return
+	}
+	rec := Record{
+		ID:         recordID(coll, m.Version),
+		Collection: coll,
+		Version:    m.Version,
+		Name:       m.Name,
+		AppliedAt:  r.now().UTC().Truncate(time.Millisecond),
+		Changed:    changed,
+	}
+	err = r.DB.SaveDocument(ctx, Collection, rec.ID, rec)
+	return
+}
+
+// acquire inserts the lock, taking it over if the instance holding it let it expire. The takeover only replaces the
+// expired holding that was read, so of two instances taking over the same lock only one gets it.
+func (r *Runner) acquire(ctx context.Context, id string) (lock, error) {
+	now := r.now()
+	l := lock{ID: id, Owner: r.Owner, Expires: r.expiry(now)}
+	insertErr := r.DB.InsertDocument(ctx, Collection, id, l)
+	if insertErr == nil || !per.IsDuplicate(insertErr) {
+		return l, insertErr
+	}
+	var held lock
+	if err := r.DB.FetchDocument(ctx, Collection, id, &held); err != nil {
+		if per.IsNotFound(err) {
+			return lock{}, fmt.Errorf("%s changed hands while taking it: %w", id, ErrLocked)
+		}
+		return lock{}, err
+	}
+	if held.Expires.After(now) {
+		return lock{}, fmt.Errorf("%s held by %s until %s: %w", id, held.Owner, held.Expires.Format(time.RFC3339), ErrLocked)
+	}
+	if err := r.DB.ReplaceDocumentIf(ctx, Collection, id, held.match(), l); err != nil {
+		if per.IsNotFound(err) {
+			return lock{}, fmt.Errorf("%s was taken over by another instance: %w", id, ErrLocked)
+		}
+		return lock{}, err
+	}
+	return l, nil
+}
+
+// hold renews the lock in the background until stop is called. Stop returns the lock as last renewed and whether it
+// was lost to another instance, in which case the returned context was cancelled. A renewal that fails for another
+// reason is tried again on the next round, since the lock still holds until it expires.
+func (r *Runner) hold(ctx context.Context, l lock) (context.Context, func() (lock, bool)) {
+	every := r.renewEvery
+	if every <= 0 {
+		every = LockTimeout / 3
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	lost := false
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-runCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			renewed := l
+			renewed.Expires = r.expiry(r.now())
+			// on ctx rather than runCtx, so a renewal that stop interrupts can't be made without l knowing
+			err := r.DB.ReplaceDocumentIf(ctx, Collection, l.ID, l.match(), renewed)
+			switch {
+			case err == nil:
+				l = renewed
+			case per.IsNotFound(err):
+				lost = true
+				cancel()
+				return
+			}
+		}
+	}()
+	return runCtx, func() (lock, bool) {
+		cancel()
+		<-done
+		return l, lost
+	}
+}
+
+// expiry returns when a lock taken or renewed now expires, to the millisecond that mongo stores
+func (r *Runner) expiry(now time.Time) time.Time {
+	return now.Add(LockTimeout).UTC().Truncate(time.Millisecond)
+}
+
+func (r *Runner) applied(ctx context.Context, coll string, m Migration) (bool, error) {
+	var rec Record
+	err := r.DB.FetchDocument(ctx, Collection, recordID(coll, m.Version), &rec)
+	if err == nil {
+		return true, nil
+	}
+	if per.IsNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+func recordID(coll string, version int) string {
+	return fmt.Sprintf("%s/%d", coll, version)
+}
+
+// backfillStatus gives locs stored without a status the default one
+func backfillStatus(ctx context.Context, mdb per.MongoAbstraction, coll string, dryRun bool) (int, error) {
+	locs, err := mdb.FetchAllFromCollection(ctx, coll)
+	if err != nil {
+		return 0, err
+	}
+	changed := 0
+	for _, loc := range locs {
+		if loc.Status != "" {
+			continue
+		}
+		changed++
+		if dryRun {
+			continue
+		}
+		loc.Status = types.DefaultStatus
+		if err = mdb.UpdateCollection(ctx, coll, loc); err != nil {
+			return changed - 1, err
+		}
+	}
+	return changed, nil
+}
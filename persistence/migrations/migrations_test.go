@@ -0,0 +1,292 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+	per "webstuff/persistence"
+	"webstuff/types"
+)
+
+// memDB is an in-memory MongoAbstraction with one loc collection. Documents are kept as BSON, as mongo would, and
+// may be written while a lock is renewed in the background.
+type memDB struct {
+	mu      sync.Mutex
+	locs    map[string]types.Loc
+	docs    map[string][]byte
+	updates int
+}
+
+func newMemDB(locs ...types.Loc) *memDB {
+	md := &memDB{locs: map[string]types.Loc{}, docs: map[string][]byte{}}
+	for _, loc := range locs {
+		md.locs[loc.ID] = loc
+	}
+	return md
+}
+
+func (md *memDB) ConnectToMongo(ctx context.Context) error { return nil }
+
+func (md *memDB) WriteCollection(ctx context.Context, coll string, obj types.Loc) error {
+	md.locs[obj.ID] = obj
+	return nil
+}
+
+func (md *memDB) UpdateCollection(ctx context.Context, coll string, obj types.Loc) error {
+	md.updates++
+	md.locs[obj.ID] = obj
+	return nil
+}
+
+func (md *memDB) FetchFromCollection(ctx context.Context, coll string, id string) (types.Loc, error) {
+	return md.locs[id], nil
+}
+
+func (md *memDB) FetchAllFromCollection(ctx context.Context, coll string) ([]types.Loc, error) {
+	result := []types.Loc{}
+	for _, loc := range md.locs {
+		result = append(result, loc)
+	}
+	return result, nil
+}
+
+func (md *memDB) QueryCollection(ctx context.Context, coll string, query per.LocQuery) ([]types.Loc, error) {
+	return nil, nil
+}
+
+func (md *memDB) DeleteFromCollection(ctx context.Context, coll string, id string) error {
+	delete(md.locs, id)
+	return nil
+}
+
+func (md *memDB) DropCollection(ctx context.Context, coll string) error { return nil }
+
+func (md *memDB) SaveDocument(ctx context.Context, coll string, id string, doc interface{}) error {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	return md.save(coll, id, doc)
+}
+
+func (md *memDB) save(coll string, id string, doc interface{}) error {
+	data, err := bson.Marshal(doc)
+	md.docs[coll+"/"+id] = data
+	return err
+}
+
+func (md *memDB) InsertDocument(ctx context.Context, coll string, id string, doc interface{}) error {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	if _, ok := md.docs[coll+"/"+id]; ok {
+		return fmt.Errorf("%w: %s", per.ErrDuplicate, id)
+	}
+	return md.save(coll, id, doc)
+}
+
+func (md *memDB) ReplaceDocumentIf(ctx context.Context, coll string, id string, match map[string]interface{}, doc interface{}) error {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	if !md.matches(coll, id, match) {
+		return per.ErrNotFound
+	}
+	return md.save(coll, id, doc)
+}
+
+// matches compares the stored document with the match after a round trip through BSON, so times compare as stored
+func (md *memDB) matches(coll string, id string, match map[string]interface{}) bool {
+	data, ok := md.docs[coll+"/"+id]
+	if !ok {
+		return false
+	}
+	stored, wanted := bson.M{}, bson.M{}
+	raw, _ := bson.Marshal(bson.M(match))
+	if bson.Unmarshal(data, &stored) != nil || bson.Unmarshal(raw, &wanted) != nil {
+		return false
+	}
+	for field, value := range wanted {
+		if !reflect.DeepEqual(stored[field], value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (md *memDB) FetchDocument(ctx context.Context, coll string, id string, result interface{}) error {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	data, ok := md.docs[coll+"/"+id]
+	if !ok {
+		return per.ErrNotFound
+	}
+	return bson.Unmarshal(data, result)
+}
+
+func (md *memDB) FindDocuments(ctx context.Context, coll string, filter map[string]interface{}, result interface{}) error {
+	return fmt.Errorf("not supported")
+}
+
+func (md *memDB) DeleteDocument(ctx context.Context, coll string, id string) error {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	delete(md.docs, coll+"/"+id)
+	return nil
+}
+
+func (md *memDB) DeleteDocumentIf(ctx context.Context, coll string, id string, match map[string]interface{}) error {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	if !md.matches(coll, id, match) {
+		return per.ErrNotFound
+	}
+	delete(md.docs, coll+"/"+id)
+	return nil
+}
+
+// racingDB lets another instance act right after a document is fetched
+type racingDB struct {
+	*memDB
+	afterFetch func()
+}
+
+func (rd racingDB) FetchDocument(ctx context.Context, coll string, id string, result interface{}) error {
+	err := rd.memDB.FetchDocument(ctx, coll, id, result)
+	rd.afterFetch()
+	return err
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	blank, _ := types.LocFromString("0.0.0")
+	blank.Status = ""
+	claimed, _ := types.LocFromString("1.-1.0")
+	claimed.Status = "claimed"
+	md := newMemDB(blank, claimed)
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	r := NewRunner(md, "test")
+	r.now = func() time.Time { return now }
+
+	t.Run("Dry run", func(t *testing.T) {
+		results, err := r.Run(ctx, []string{"arena"}, true)
+		require.NoError(t, err)
+		require.Equal(t, []Result{{Collection: "arena", Version: 1, Name: "backfill status", Changed: 1, DryRun: true}}, results)
+		require.Equal(t, "", md.locs["0.0.0"].Status, "Dry run should not write")
+		require.Len(t, md.docs, 0, "Dry run should not record or lock")
+	})
+	t.Run("Apply", func(t *testing.T) {
+		results, err := r.Run(ctx, []string{"arena"}, false)
+		require.NoError(t, err)
+		require.Equal(t, 1, results[0].Changed)
+		require.Equal(t, types.DefaultStatus, md.locs["0.0.0"].Status)
+		require.Equal(t, "claimed", md.locs["1.-1.0"].Status, "Locs with a status should be left alone")
+		require.Contains(t, md.docs, Collection+"/arena/1")
+		require.NotContains(t, md.docs, Collection+"/lock/arena/1", "The lock should be released")
+		var events []string
+		for key := range md.docs {
+			if strings.HasPrefix(key, per.EventCollection+"/arena/0.0.0/") {
+				var e per.Event
+				require.NoError(t, bson.Unmarshal(md.docs[key], &e))
+				events = append(events, e.Actor+" "+e.Op)
+			}
+		}
+		require.Equal(t, []string{"migration update"}, events, "The backfill should be audited")
+	})
+	t.Run("Applied once", func(t *testing.T) {
+		md.updates = 0
+		md.locs["0.0.0"] = blank
+		results, err := r.Run(ctx, []string{"arena"}, false)
+		require.NoError(t, err)
+		require.True(t, results[0].Skipped)
+		require.Equal(t, 0, md.updates)
+	})
+	t.Run("Locked", func(t *testing.T) {
+		require.NoError(t, md.SaveDocument(ctx, Collection, "lock/other/1", lock{ID: "lock/other/1", Owner: "peer", Expires: now.Add(time.Minute)}))
+		_, err := r.Run(ctx, []string{"other"}, false)
+		require.True(t, errors.Is(err, ErrLocked), "A live lock should stop the migration. Got: %v", err)
+		require.Contains(t, err.Error(), "peer")
+	})
+	t.Run("Expired lock", func(t *testing.T) {
+		now = now.Add(time.Hour)
+		results, err := r.Run(ctx, []string{"other"}, false)
+		require.NoError(t, err, "A lock past its expiry should be taken over")
+		require.False(t, results[0].Skipped)
+	})
+	t.Run("Takeover race", func(t *testing.T) {
+		held := lock{ID: "lock/third/1", Owner: "peer", Expires: now.Add(-time.Minute)}
+		require.NoError(t, md.SaveDocument(ctx, Collection, held.ID, held))
+		// another instance takes over the expired lock between this one reading it and taking it over
+		racing := racingDB{memDB: md, afterFetch: func() {
+			md.SaveDocument(ctx, Collection, held.ID, lock{ID: held.ID, Owner: "quick", Expires: now.Add(LockTimeout)})
+		}}
+		_, err := (&Runner{DB: racing, Owner: "test", Migrations: All, now: r.now}).Run(ctx, []string{"third"}, false)
+		require.True(t, errors.Is(err, ErrLocked), "Only one instance should take the lock over. Got: %v", err)
+		var got lock
+		require.NoError(t, md.FetchDocument(ctx, Collection, held.ID, &got))
+		require.Equal(t, "quick", got.Owner)
+	})
+	t.Run("Out of order", func(t *testing.T) {
+		bad := &Runner{DB: md, Migrations: []Migration{All[0], All[0]}, now: time.Now}
+		_, err := bad.Run(ctx, []string{"arena"}, true)
+		require.Error(t, err)
+	})
+}
+
+func TestLockRenewal(t *testing.T) {
+	ctx := context.Background()
+	// running returns a runner whose only migration calls during, on the stored locs, until it returns true or ctx ends
+	running := func(md *memDB, during func() bool) *Runner {
+		r := NewRunner(md, "test")
+		r.renewEvery = 5 * time.Millisecond
+		r.Migrations = []Migration{{Version: 1, Name: "slow", Up: func(ctx context.Context, mdb per.MongoAbstraction, coll string, dryRun bool) (int, error) {
+			for !during() {
+				select {
+				case <-time.After(time.Millisecond):
+				case <-ctx.Done():
+					return 0, ctx.Err()
+				}
+			}
+			return 0, nil
+		}}}
+		return r
+	}
+
+	t.Run("Renewed while running", func(t *testing.T) {
+		md := newMemDB()
+		var first, current lock
+		r := running(md, func() bool {
+			require.NoError(t, md.FetchDocument(ctx, Collection, "lock/arena/1", &current))
+			if first.Owner == "" {
+				first = current
+			}
+			return current.Expires.After(first.Expires)
+		})
+		_, err := r.Run(ctx, []string{"arena"}, false)
+		require.NoError(t, err)
+		require.Equal(t, "test", current.Owner)
+		require.NotContains(t, md.docs, Collection+"/lock/arena/1", "The renewed lock should be released")
+	})
+	t.Run("Lost while running", func(t *testing.T) {
+		md := newMemDB()
+		peer := lock{ID: "lock/arena/1", Owner: "peer", Expires: time.Now().Add(LockTimeout).UTC().Truncate(time.Millisecond)}
+		taken := false
+		r := running(md, func() bool {
+			if !taken {
+				require.NoError(t, md.SaveDocument(ctx, Collection, peer.ID, peer))
+				taken = true
+			}
+			return false
+		})
+		_, err := r.Run(ctx, []string{"arena"}, false)
+		require.True(t, errors.Is(err, ErrLocked), "Losing the lock should stop the migration. Got: %v", err)
+		require.NotContains(t, md.docs, Collection+"/arena/1", "A migration that lost its lock should not be recorded")
+		var got lock
+		require.NoError(t, md.FetchDocument(ctx, Collection, peer.ID, &got))
+		require.Equal(t, "peer", got.Owner, "A lock taken over should be left to its new owner")
+	})
+}
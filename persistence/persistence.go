@@ -1,30 +1,57 @@
 package persistence
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"time"
 	"log"
 	"os"
+	"reflect"
+	"sync"
 	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 	"webstuff/types"
 )
 
 // MongoAbstraction defines the set of DAL functions for accessing this Mongo collection
 type MongoAbstraction interface {
-	ConnectToMongo() error
-	WriteCollection(collectionName string, object types.Loc) error
-	UpdateCollection(collectionName string, object types.Loc) error
-	FetchFromCollection(collectionName string, id string) (types.Loc, error)
-	DeleteFromCollection(collectionName string, id string) error
+	ConnectToMongo(ctx context.Context) error
+	WriteCollection(ctx context.Context, collectionName string, object types.Loc) error
+	UpdateCollection(ctx context.Context, collectionName string, object types.Loc) error
+	FetchFromCollection(ctx context.Context, collectionName string, id string) (types.Loc, error)
+	FetchAllFromCollection(ctx context.Context, collectionName string) ([]types.Loc, error)
+	QueryCollection(ctx context.Context, collectionName string, query LocQuery) ([]types.Loc, error)
+	DeleteFromCollection(ctx context.Context, collectionName string, id string) error
+	DropCollection(ctx context.Context, collectionName string) error
+	DocumentStore
 }
 
-// MongoSession defines an instantiation of a Mongo DAL. The session maintains a connected state to Mongodb.
+// DocumentStore is the part of the DAL that stores documents other than Locs, keyed by ID. Filters and matches name
+// fields that must equal a value, or compare to one through a document of $lt, $lte, $gt or $gte.
+type DocumentStore interface {
+	SaveDocument(ctx context.Context, collectionName string, id string, doc interface{}) error
+	FetchDocument(ctx context.Context, collectionName string, id string, result interface{}) error
+	FindDocuments(ctx context.Context, collectionName string, filter map[string]interface{}, result interface{}) error
+	InsertDocument(ctx context.Context, collectionName string, id string, doc interface{}) error
+	ReplaceDocumentIf(ctx context.Context, collectionName string, id string, match map[string]interface{}, doc interface{}) error
+	DeleteDocument(ctx context.Context, collectionName string, id string) error
+	DeleteDocumentIf(ctx context.Context, collectionName string, id string, match map[string]interface{}) error
+}
+
+// MongoSession defines an instantiation of a Mongo DAL on the mgo driver. The session maintains a connected state to
+// Mongodb. mu guards session and db, which handlers on many goroutines connect through.
 type MongoSession struct {
+	mu				sync.Mutex
 	session			*mgo.Session
 	db				*mgo.Database
 	mongoURL		string
 	dbName			string
 	timeoutSeconds	time.Duration
+	readTimeout		time.Duration
+	writeTimeout	time.Duration
 	logger			*log.Logger
 }
 
@@ -32,97 +59,329 @@ type MongoSession struct {
 const (
 	DefaultDbName  string        = "defaultDB"
 	DefaultTimeout time.Duration = 10 * time.Second
+	DefaultReadTimeout time.Duration = 5 * time.Second
+	DefaultWriteTimeout time.Duration = 5 * time.Second
 )
 
 // NewMongoSession is a factory method to create a fresh MongoSession for a given connection string and DB
 // toDuration should be expressed as a multiple of time.Second
 func NewMongoSession(mongoURL string, dbName string, logger *log.Logger, overrideTo ...int64) *MongoSession {
+	cfg := Config{URL: mongoURL, DBName: dbName}
+	if len(overrideTo) > 0 {
+		cfg.DialTimeout = time.Duration(overrideTo[0]) * time.Second
+	}
+	return NewMongoSessionFromConfig(cfg, logger)
+}
+
+// NewMongoSessionFromConfig creates a fresh MongoSession, filling in defaults for whatever the config leaves empty
+func NewMongoSessionFromConfig(cfg Config, logger *log.Logger) *MongoSession {
+	cfg = cfg.withDefaults()
 	result := &MongoSession{
-		mongoURL:		mongoURL,
-		dbName:			dbName,
-		timeoutSeconds:	DefaultTimeout,
+		mongoURL:		cfg.URL,
+		dbName:			cfg.DBName,
+		timeoutSeconds:	cfg.DialTimeout,
+		readTimeout:	cfg.ReadTimeout,
+		writeTimeout:	cfg.WriteTimeout,
 		logger:			logger,
 	}
-	if result.dbName == "" {
-		result.dbName = DefaultDbName
-	}
 	if result.logger == nil {
 		result.logger = log.New(os.Stdout, "mongoLayer", log.Ldate|log.Ltime)
 	}
-	if len(overrideTo) > 0 {
-		result.timeoutSeconds = time.Duration(overrideTo[0]) * time.Second
-	}
 
 	return result
 }
 
-// ConnectToMongo creates a connection to the specified mongodb instance
-func (ms *MongoSession) ConnectToMongo() (err error) {
-	ms.session, err = mgo.DialWithTimeout(ms.mongoURL, ms.timeoutSeconds)
-	if err != nil {
+// ConnectToMongo creates a connection to the specified mongodb instance. The dial gives up at the dial timeout or the
+// context's deadline, whichever comes first. It does nothing if the session is already connected, and a failed dial
+// leaves the session as it was.
+func (ms *MongoSession) ConnectToMongo(ctx context.Context) (err error) {
+	if err = ctx.Err(); err != nil {
 		return
 	}
-	ms.db = ms.session.DB(ms.dbName)
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.session != nil {
+		return nil
+	}
+	timeout := ms.timeoutSeconds
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+	session, err := mgo.DialWithTimeout(ms.mongoURL, timeout)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrUnreachable, err)
+	}
+	ms.session = session
+	ms.db = session.DB(ms.dbName)
 	return
 }
 
 // CheckAndReconnect ensures that there is an active DB connection to mongo. Attempts to reestablish connection if needed
-func (ms *MongoSession) CheckAndReconnect() (err error) {
-	if ms.db == nil {
-		err = ms.ConnectToMongo()
-	}
-	return
+func (ms *MongoSession) CheckAndReconnect(ctx context.Context) (err error) {
+	return ms.ConnectToMongo(ctx)
 }
 
-// WriteCollection writes the specified loc object to a given collection
-func (ms *MongoSession) WriteCollection(coll string, obj types.Loc) error {
-	if err := ms.CheckAndReconnect(); err != nil {
-		ms.logger.Printf("WriteCollection: could not establish mongo connection: %s", err)
+// copySession returns a copy of the connected session for one operation
+func (ms *MongoSession) copySession() *mgo.Session {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.session.Copy()
+}
+
+// run performs op on its own copy of the session, bounded by the context and the operation's timeout, if any. Its socket
+// timeout is set to the time left, and queries get the same limit as maxTimeMS through limit, so the server stops work
+// the caller has given up on. When the context ends first run returns its error without waiting for op.
+func (ms *MongoSession) run(ctx context.Context, name string, timeout time.Duration, op func(ctx context.Context, db *mgo.Database) error) error {
+	if err := ms.CheckAndReconnect(ctx); err != nil {
+		ms.logger.Printf("%s: could not establish mongo connection: %s", name, err)
 		return err
 	}
-	myCollection := ms.db.C(coll)
-	return myCollection.Insert(obj)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	session := ms.copySession()
+	if deadline, ok := ctx.Deadline(); ok {
+		session.SetSocketTimeout(time.Until(deadline))
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer session.Close()
+		done <- op(ctx, session.DB(ms.dbName))
+	}()
+	select {
+	case err := <-done:
+		return mgoError(err)
+	case <-ctx.Done():
+		ms.logger.Printf("%s: abandoned: %s", name, ctx.Err())
+		return ctx.Err()
+	}
 }
 
-// UpdateCollection updates the loc object in the specified collection with a matching _id element to the passed in object
-func (ms *MongoSession) UpdateCollection(collName string, obj types.Loc) error {
-	if err := ms.CheckAndReconnect(); err != nil {
-		ms.logger.Printf("UpdateCollection: could not establish mongo connection: %s", err)
+// runInto is run for ops that decode into result, which must be a pointer. The op decodes into a value of its own that
+// is copied into result only once the op has finished, so an abandoned op never writes to the caller's memory.
+func (ms *MongoSession) runInto(ctx context.Context, name string, timeout time.Duration, result interface{}, op func(ctx context.Context, db *mgo.Database, into interface{}) error) error {
+	into := reflect.New(reflect.TypeOf(result).Elem())
+	err := ms.run(ctx, name, timeout, func(ctx context.Context, db *mgo.Database) error {
+		return op(ctx, db, into.Interface())
+	})
+	if err != nil {
 		return err
 	}
-	if !ms.collectionExists(collName) {
-		return fmt.Errorf("Non-existent collection for update: %s", collName)
+	reflect.ValueOf(result).Elem().Set(into.Elem())
+	return nil
+}
+
+// limit caps the query's run time on the server at the time left before the context's deadline
+func limit(ctx context.Context, q *mgo.Query) *mgo.Query {
+	if deadline, ok := ctx.Deadline(); ok {
+		q.SetMaxTime(time.Until(deadline))
 	}
-	id := obj.GetID()
-	myCollection := ms.db.C(collName)
-	return myCollection.UpdateId(id, obj)
+	return q
+}
+
+// WriteCollection writes the specified loc object to a given collection
+func (ms *MongoSession) WriteCollection(ctx context.Context, coll string, obj types.Loc) error {
+	return ms.run(ctx, "WriteCollection", ms.writeTimeout, func(ctx context.Context, db *mgo.Database) error {
+		return db.C(coll).Insert(obj)
+	})
+}
+
+// UpdateCollection updates the loc object in the specified collection with a matching _id element to the passed in object
+func (ms *MongoSession) UpdateCollection(ctx context.Context, collName string, obj types.Loc) error {
+	return ms.run(ctx, "UpdateCollection", ms.writeTimeout, func(ctx context.Context, db *mgo.Database) error {
+		if !collectionExists(db, collName) {
+			return fmt.Errorf("%w: Non-existent collection for update: %s", ErrNotFound, collName)
+		}
+		return db.C(collName).UpdateId(obj.GetID(), obj)
+	})
 }
 
 // FetchFromCollection fetches the Loc by ID from the specified collection
-func (ms *MongoSession) FetchFromCollection(coll string, id string) (result types.Loc, err error) {
+func (ms *MongoSession) FetchFromCollection(ctx context.Context, coll string, id string) (result types.Loc, err error) {
 	result = types.Loc{}
-	if err = ms.CheckAndReconnect(); err != nil {
-		ms.logger.Printf("FetchFromCollection: could not establish mongo connection: %s", err)
-		return
+	err = ms.runInto(ctx, "FetchFromCollection", ms.readTimeout, &result, func(ctx context.Context, db *mgo.Database, into interface{}) error {
+		return limit(ctx, db.C(coll).FindId(id)).One(into)
+	})
+	return
+}
+
+// FetchAllFromCollection fetches every Loc in the specified collection
+func (ms *MongoSession) FetchAllFromCollection(ctx context.Context, coll string) (result []types.Loc, err error) {
+	result = []types.Loc{}
+	err = ms.runInto(ctx, "FetchAllFromCollection", ms.readTimeout, &result, func(ctx context.Context, db *mgo.Database, into interface{}) error {
+		return limit(ctx, db.C(coll).Find(nil)).All(into)
+	})
+	return
+}
+
+// QueryCollection fetches every Loc in the specified collection that matches the query
+func (ms *MongoSession) QueryCollection(ctx context.Context, coll string, query LocQuery) (result []types.Loc, err error) {
+	result = []types.Loc{}
+	err = ms.runInto(ctx, "QueryCollection", ms.readTimeout, &result, func(ctx context.Context, db *mgo.Database, into interface{}) error {
+		return limit(ctx, db.C(coll).Find(bson.M(query.filter()))).All(into)
+	})
+	return
+}
+
+// EnsureIndexes creates each of the specified indexes on the collection if it doesn't exist yet
+func (ms *MongoSession) EnsureIndexes(ctx context.Context, coll string, specs []IndexSpec) error {
+	return ms.run(ctx, "EnsureIndexes", ms.writeTimeout, func(ctx context.Context, db *mgo.Database) error {
+		myCollection := db.C(coll)
+		for _, spec := range specs {
+			index := mgo.Index{Key: spec.Key, Unique: spec.Unique, Name: spec.Name(), Background: true}
+			if err := myCollection.EnsureIndex(index); err != nil {
+				return fmt.Errorf("index %s: %s", spec.Name(), err)
+			}
+		}
+		return nil
+	})
+}
+
+// ListIndexes returns the indexes on the collection other than the one on _id. A missing collection has none.
+func (ms *MongoSession) ListIndexes(ctx context.Context, coll string) (result []IndexSpec, err error) {
+	result = []IndexSpec{}
+	err = ms.runInto(ctx, "ListIndexes", ms.readTimeout, &result, func(ctx context.Context, db *mgo.Database, into interface{}) error {
+		specs := into.(*[]IndexSpec)
+		*specs = []IndexSpec{}
+		if !collectionExists(db, coll) {
+			return nil
+		}
+		indexes, err := db.C(coll).Indexes()
+		if err != nil {
+			return err
+		}
+		for _, index := range indexes {
+			if index.Name == "_id_" {
+				continue
+			}
+			*specs = append(*specs, IndexSpec{Key: index.Key, Unique: index.Unique})
+		}
+		return nil
+	})
+	return
+}
+
+// FetchRangeFromCollection fetches every Loc in the specified collection with x and z inside the inclusive bounds
+func (ms *MongoSession) FetchRangeFromCollection(ctx context.Context, coll string, xmin int, xmax int, zmin int, zmax int) (result []types.Loc, err error) {
+	query := bson.M{
+		"x": bson.M{"$gte": xmin, "$lte": xmax},
+		"z": bson.M{"$gte": zmin, "$lte": zmax},
 	}
-	myCollection := ms.db.C(coll)
-	q := myCollection.FindId(id)
-	err = q.One(&result)
+	result = []types.Loc{}
+	err = ms.runInto(ctx, "FetchRangeFromCollection", ms.readTimeout, &result, func(ctx context.Context, db *mgo.Database, into interface{}) error {
+		return limit(ctx, db.C(coll).Find(query)).All(into)
+	})
 	return
 }
 
 // DeleteFromCollection removes the Loc by ID from the specified collection
-func (ms *MongoSession) DeleteFromCollection(coll string, id string) (err error) {
-	if err := ms.CheckAndReconnect(); err != nil {
-		ms.logger.Printf("DeleteFromCollection: could not establish mongo connection: %s", err)
+func (ms *MongoSession) DeleteFromCollection(ctx context.Context, coll string, id string) error {
+	return ms.run(ctx, "DeleteFromCollection", ms.writeTimeout, func(ctx context.Context, db *mgo.Database) error {
+		return db.C(coll).RemoveId(id)
+	})
+}
+
+// DropCollection removes the specified collection and everything in it. Dropping a collection that doesn't exist
+// is not an error.
+func (ms *MongoSession) DropCollection(ctx context.Context, coll string) error {
+	return ms.run(ctx, "DropCollection", ms.writeTimeout, func(ctx context.Context, db *mgo.Database) error {
+		if !collectionExists(db, coll) {
+			return nil
+		}
+		return db.C(coll).DropCollection()
+	})
+}
+
+// SaveDocument stores an arbitrary document under the specified ID, replacing any document already there. It is
+// meant for state that isn't a Loc, such as game sessions.
+func (ms *MongoSession) SaveDocument(ctx context.Context, coll string, id string, doc interface{}) error {
+	return ms.run(ctx, "SaveDocument", ms.writeTimeout, func(ctx context.Context, db *mgo.Database) error {
+		_, err := db.C(coll).UpsertId(id, doc)
 		return err
+	})
+}
+
+// InsertDocument stores a document, failing if a document with the specified ID already exists. The doc must carry the
+// same ID in its _id field. The failure makes it usable as a lock shared between server instances.
+func (ms *MongoSession) InsertDocument(ctx context.Context, coll string, id string, doc interface{}) error {
+	return ms.run(ctx, "InsertDocument", ms.writeTimeout, func(ctx context.Context, db *mgo.Database) error {
+		return db.C(coll).Insert(doc)
+	})
+}
+
+// ReplaceDocumentIf replaces the document with the specified ID only while its fields equal the match's values, and
+// fails with ErrNotFound when no document matches. It makes a compare and swap, e.g. on a version field.
+func (ms *MongoSession) ReplaceDocumentIf(ctx context.Context, coll string, id string, match map[string]interface{}, doc interface{}) error {
+	return ms.run(ctx, "ReplaceDocumentIf", ms.writeTimeout, func(ctx context.Context, db *mgo.Database) error {
+		selector := bson.M{"_id": id}
+		for field, value := range match {
+			selector[field] = value
+		}
+		return db.C(coll).Update(selector, doc)
+	})
+}
+
+// DeleteDocumentIf removes the document with the specified ID only while its fields equal the match's values, and
+// fails with ErrNotFound when no document matches. It releases a lock only while the caller still holds it.
+func (ms *MongoSession) DeleteDocumentIf(ctx context.Context, coll string, id string, match map[string]interface{}) error {
+	return ms.run(ctx, "DeleteDocumentIf", ms.writeTimeout, func(ctx context.Context, db *mgo.Database) error {
+		selector := bson.M{"_id": id}
+		for field, value := range match {
+			selector[field] = value
+		}
+		return db.C(coll).Remove(selector)
+	})
+}
+
+// FetchDocument fetches the document by ID from the specified collection and unmarshals it into result
+func (ms *MongoSession) FetchDocument(ctx context.Context, coll string, id string, result interface{}) error {
+	return ms.runInto(ctx, "FetchDocument", ms.readTimeout, result, func(ctx context.Context, db *mgo.Database, into interface{}) error {
+		return limit(ctx, db.C(coll).FindId(id)).One(into)
+	})
+}
+
+// FindDocuments fetches every document in the collection whose fields equal the filter's values and unmarshals them
+// into result, which must be a pointer to a slice
+func (ms *MongoSession) FindDocuments(ctx context.Context, coll string, filter map[string]interface{}, result interface{}) error {
+	return ms.runInto(ctx, "FindDocuments", ms.readTimeout, result, func(ctx context.Context, db *mgo.Database, into interface{}) error {
+		return limit(ctx, db.C(coll).Find(bson.M(filter))).All(into)
+	})
+}
+
+// DeleteDocument removes the document by ID from the specified collection
+func (ms *MongoSession) DeleteDocument(ctx context.Context, coll string, id string) error {
+	return ms.run(ctx, "DeleteDocument", ms.writeTimeout, func(ctx context.Context, db *mgo.Database) error {
+		return db.C(coll).RemoveId(id)
+	})
+}
+
+// mgoNoServers is the message of the error mgo returns when no server of the cluster answers
+const mgoNoServers = "no reachable servers"
+
+// mgoError translates mgo's errors into the typed errors of this package. mgo reports a dropped connection as EOF or
+// a net error and a cluster it can't reach by message only; all of them mean mongo can't be reached.
+func mgoError(err error) error {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return nil
+	case err == mgo.ErrNotFound:
+		return ErrNotFound
+	case mgo.IsDup(err):
+		return fmt.Errorf("%w: %s", ErrDuplicate, err)
+	case err == io.EOF, errors.As(err, &netErr), err.Error() == mgoNoServers:
+		return fmt.Errorf("%w: %s", ErrUnreachable, err)
 	}
-	myCollection := ms.db.C(coll)
-	return myCollection.RemoveId(id)
+	return err
 }
 
-func (ms *MongoSession) collectionExists(collName string) bool {
-	names, err := ms.db.CollectionNames()
+func collectionExists(db *mgo.Database, collName string) bool {
+	names, err := db.CollectionNames()
 	if err != nil { 
 		return false 
 	}
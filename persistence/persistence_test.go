@@ -1,15 +1,22 @@
 package persistence
 
 import (
+	"context"
 	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"testing"
 	"time"
 	"log"
 	"os"
+	"sync"
 
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 	"webstuff/types"
 )
 
@@ -19,10 +26,12 @@ const (
 	testCollection 	   string = "testCollection"
 )
 
+// MongoSessionSuite runs against a Backend on one driver. Its own setup goes through mgo directly.
 type MongoSessionSuite struct {
 	suite.Suite
 	session *mgo.Session
 	logger *log.Logger
+	driver string
 }
 
 // Runner for the test suite. Ensures that mongo can be reached at the default location or aborts the suite. The suite provides a 
@@ -34,7 +43,36 @@ func TestMongoSessionSuite(t *testing.T) {
 		defer session.Close()
 	}
 	require.NoErrorf(t, err, "Mongo must be available at %s for this suite to function", testMongoURL)
-	suite.Run(t, new(MongoSessionSuite))
+	for _, driver := range []string{DriverMgo, DriverOfficial} {
+		t.Run(driver, func(t *testing.T) {
+			suite.Run(t, &MongoSessionSuite{driver: driver})
+		})
+	}
+}
+
+// newSession opens a Backend on the suite's driver, pointed at the test DB unless cfg says otherwise
+func (m *MongoSessionSuite) newSession(cfg Config) Backend {
+	cfg.Driver = m.driver
+	if cfg.URL == "" {
+		cfg.URL = testMongoURL
+	}
+	if cfg.DBName == "" {
+		cfg.DBName = testDbName
+	}
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = 3 * time.Second
+	}
+	ms, err := Open(cfg, m.logger)
+	m.Require().NoError(err)
+	return ms
+}
+
+// unreachableSession opens a Backend on the suite's driver that can't reach mongo, logging to the returned buffer
+func (m *MongoSessionSuite) unreachableSession() (Backend, *bytes.Buffer) {
+	logBuf := &bytes.Buffer{}
+	ms, err := Open(Config{Driver: m.driver, URL: "yo", DBName: testDbName, DialTimeout: 3 * time.Second}, log.New(logBuf, "persistence_test: ", 0))
+	m.Require().NoError(err)
+	return ms, logBuf
 }
 
 func (m *MongoSessionSuite) SetupSuite() {
@@ -51,34 +89,62 @@ func (m *MongoSessionSuite) TestCtorDefaults() {
 	result := NewMongoSession("testURL","", m.logger)
 	m.EqualValues(DefaultDbName, result.dbName, "DB name should be the default")
 	m.EqualValues(DefaultTimeout, result.timeoutSeconds, "Timeout value should default when not specified")
+	m.EqualValues(DefaultReadTimeout, result.readTimeout, "Read timeout should default when not specified")
+	m.EqualValues(DefaultWriteTimeout, result.writeTimeout, "Write timeout should default when not specified")
+
+	result = NewMongoSessionFromConfig(Config{URL: "testURL", ReadTimeout: time.Second, WriteTimeout: 2 * time.Second}, m.logger)
+	m.EqualValues(time.Second, result.readTimeout)
+	m.EqualValues(2*time.Second, result.writeTimeout)
+}
+
+func (m *MongoSessionSuite) TestContext() {
+	testMS := m.newSession(Config{})
+	require.NoError(m.T(), testMS.ConnectToMongo(context.Background()))
+	m.T().Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := testMS.FetchAllFromCollection(ctx, testCollection)
+		require.Equal(t, context.Canceled, err)
+		require.Equal(t, context.Canceled, testMS.SaveDocument(ctx, testCollection, "game1", bson.M{"_id": "game1"}))
+	})
+	m.T().Run("Deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+		defer cancel()
+		time.Sleep(time.Millisecond)
+		_, err := testMS.FetchFromCollection(ctx, testCollection, "0.0.0")
+		require.Equal(t, context.DeadlineExceeded, err)
+	})
+	m.T().Run("Read timeout", func(t *testing.T) {
+		slow := m.newSession(Config{ReadTimeout: time.Millisecond})
+		require.NoError(t, slow.ConnectToMongo(context.Background()))
+		var result []bson.M
+		err := slow.FindDocuments(context.Background(), testCollection, map[string]interface{}{"$where": "sleep(100) || true"}, &result)
+		require.Error(t, err, "A query running past the read timeout should fail")
+	})
 }
 
 func (m *MongoSessionSuite) TestConnectToMongo() {
-	ms := MongoSession{
-		mongoURL:       testMongoURL,
-		timeoutSeconds: 3 * time.Second,
-	}
-	err := ms.ConnectToMongo()
+	ctx := context.Background()
+	ms := m.newSession(Config{})
+	err := ms.ConnectToMongo(ctx)
 	m.NoError(err, "Sucessful connect throws no error. Instead we got %s", err)
-	m.IsType(MongoSession{}, ms, "Wrong type on connect: %T", ms)
 }
 
 func (m *MongoSessionSuite) TestConnectToMongoNoConnectionThrowsError() {
-	ms := MongoSession{
-		mongoURL:       "i.am.abad.url:12345",
-		timeoutSeconds: 100 * time.Millisecond,
-	}
-	err := ms.ConnectToMongo()
+	ctx := context.Background()
+	ms := m.newSession(Config{URL: "i.am.abad.url:12345", DialTimeout: 100 * time.Millisecond})
+	err := ms.ConnectToMongo(ctx)
 	m.Error(err, "Should return an error when the mongo server can't be found")
-	m.Containsf(err.Error(), "no reachable", "Looking for err message saying it can't find the server. Instead got %s", err)
+	m.Truef(errors.Is(err, ErrUnreachable), "Looking for an error saying it can't find the server. Instead got %s", err)
 }
 
 func (m *MongoSessionSuite) TestWriteCollection() {
+	ctx := context.Background()
 	var err error
 	m.T().Run( "Positive", func(t *testing.T) {
-		testMS := NewMongoSession(testMongoURL, testDbName, m.logger, 3)
+		testMS := m.newSession(Config{})
 		testLoc, _ := types.LocFromCoords(1, 2, 3)
-		err = testMS.WriteCollection(testCollection, testLoc)
+		err = testMS.WriteCollection(ctx, testCollection, testLoc)
 		require.NoError(t, err, "Successful write throws no error. Instead we got %s", err )
 	} )
 	m.T().Run( "DuplicateInsertShouldError", func(t *testing.T) {
@@ -87,8 +153,8 @@ func (m *MongoSessionSuite) TestWriteCollection() {
 		require.NoError(t, err, "Test failed in setup adding to collection. Err: %s", err )
 
 		// write the same loc again
-		testMS := NewMongoSession(testMongoURL, testDbName, m.logger, 3)
-		err = testMS.WriteCollection( testCollection, testLoc )
+		testMS := m.newSession(Config{})
+		err = testMS.WriteCollection(ctx, testCollection, testLoc )
 		require.Error( t, err, "Attempt to insert duplicate ID should throw")
 		require.Contains( t, err.Error(), "duplicate", "Expect error text to mention this" )
 	} )
@@ -96,25 +162,25 @@ func (m *MongoSessionSuite) TestWriteCollection() {
 		testBadCollection := "garbage"
 		ClearMongoCollection(t, m.session, testBadCollection)
 
-		testMS := NewMongoSession(testMongoURL, testDbName, m.logger, 3)
-		err = testMS.WriteCollection(testBadCollection, types.Loc{})
+		testMS := m.newSession(Config{})
+		err = testMS.WriteCollection(ctx, testBadCollection, types.Loc{})
 		require.NoErrorf(t, err, "Writes should create collection on the fly. Got err: %s", err)
 		writeCount,_ := m.session.DB(testDbName).C(testBadCollection).Count()
 		require.True(t, writeCount == 1, "Record should have been written as only entry")
 	} )
 	m.T().Run("Dropped connection", func(t *testing.T){
-		testMS, logBuf := GetMongoSessionWithLogger()
-		testMS.mongoURL = "yo"
+		testMS, logBuf := m.unreachableSession()
 		testLoc, _ := types.LocFromCoords(22, 22, 33)
-		err = testMS.WriteCollection(testCollection, testLoc)
+		err = testMS.WriteCollection(ctx, testCollection, testLoc)
 		require.Error(t, err, "Should get an error if changed to unreachable URL")
-		require.Contains(t, err.Error(), "no reachable servers", "Return value should complain about lack of connectivity")
-		require.Contains(t, logBuf.String(), "no reachable servers", "Log message should complain about lack of connectivity")
+		require.Truef(t, errors.Is(err, ErrUnreachable), "Return value should complain about lack of connectivity. Got: %v", err)
+		require.Contains(t, logBuf.String(), "could not establish mongo connection", "Log message should complain about lack of connectivity")
 		require.Contains(t, logBuf.String(), "WriteCollection", "Log message should inform on source of issue")
 	} )
 }
 
 func (m *MongoSessionSuite) TestDeleteFromCollection() {
+	ctx := context.Background()
 	var err error
 	m.T().Run("Positive", func(t *testing.T) {
 		testID := "1.2.3"
@@ -122,37 +188,37 @@ func (m *MongoSessionSuite) TestDeleteFromCollection() {
 		err = AddToMongoCollection(t, m.session, testCollection, testLoc )
 		require.NoError(t, err, "Test failed in setup adding to collection. Err: %s", err )
 
-		testMS := NewMongoSession(testMongoURL, testDbName, m.logger, 3)
-		err = testMS.DeleteFromCollection(testCollection, testID)
+		testMS := m.newSession(Config{})
+		err = testMS.DeleteFromCollection(ctx, testCollection, testID)
 		require.NoError(t, err, "Successful deletions throw no errors. But this threw: %s", err )
 	} )
 	m.T().Run("Missing ID", func(t *testing.T) {
 		testID := "1.2.3"
 
-		testMS := NewMongoSession(testMongoURL, testDbName, m.logger, 3)
-		err = testMS.DeleteFromCollection(testCollection, testID)
+		testMS := m.newSession(Config{})
+		err = testMS.DeleteFromCollection(ctx, testCollection, testID)
 		require.Error(t, err, "Delete on missing ID should throw error")
 		require.Containsf(t, err.Error(), "not found", "mgo should specify why it threw on missing ID")
 	} )
 	m.T().Run( "CollectionNotExist", func(t *testing.T) {
 		testBadCollection := "garbage"
-		testMS := NewMongoSession(testMongoURL, testDbName, m.logger, 3)
-		err = testMS.DeleteFromCollection(testBadCollection, "matters not")
+		testMS := m.newSession(Config{})
+		err = testMS.DeleteFromCollection(ctx, testBadCollection, "matters not")
 		require.Error(t, err, "Should get error message when attempt to access non-existent collection")
 		require.Contains(t, err.Error(), "not found", "Looking for the not found phrase, but got: %s", err)
 	} )
 	m.T().Run("Dropped connection", func(t *testing.T){
-		testMS, logBuf := GetMongoSessionWithLogger()
-		testMS.mongoURL = "yo"
-		err = testMS.DeleteFromCollection(testCollection, "matters not")
+		testMS, logBuf := m.unreachableSession()
+		err = testMS.DeleteFromCollection(ctx, testCollection, "matters not")
 		require.Error(t, err, "Should get an error if changed to unreachable URL")
-		require.Contains(t, err.Error(), "no reachable servers", "Should complain about lack of connectivity")
-		require.Contains(t, logBuf.String(), "no reachable servers", "Log message should complain about lack of connectivity")
+		require.Truef(t, errors.Is(err, ErrUnreachable), "Should complain about lack of connectivity. Got: %v", err)
+		require.Contains(t, logBuf.String(), "could not establish mongo connection", "Log message should complain about lack of connectivity")
 		require.Contains(t, logBuf.String(), "DeleteFromCollection", "Log message should inform on source of issue")
 	} )
 }
 
 func (m *MongoSessionSuite) TestUpdateCollection() {
+	ctx := context.Background()
 	var err error
 	m.T().Run( "Positive", func(t *testing.T) {
 		testLoc, _ := types.LocFromCoords(11, 2, 13)
@@ -160,16 +226,16 @@ func (m *MongoSessionSuite) TestUpdateCollection() {
 		require.NoError(t, err, "Test failed in setup adding to collection. Err: %s", err)
 
 		testLoc.Status = "changed"
-		testMS := NewMongoSession(testMongoURL, testDbName, m.logger, 3)
-		err = testMS.UpdateCollection(testCollection, testLoc)
+		testMS := m.newSession(Config{})
+		err = testMS.UpdateCollection(ctx, testCollection, testLoc)
 		require.NoError(t, err, "Successful update throws no error. Instead we got %s", err)
 		// TODO: validate changed element in collection
 	} )
 	m.T().Run( "MissingID", func(t *testing.T) {
 		testLoc, _ := types.LocFromCoords(1, 12, 3)
 
-		testMS := NewMongoSession(testMongoURL, testDbName, m.logger, 3)
-		err = testMS.UpdateCollection(testCollection, testLoc)
+		testMS := m.newSession(Config{})
+		err = testMS.UpdateCollection(ctx, testCollection, testLoc)
 		require.Error(t, err, "Missing ID should error on update")
 		require.Contains(t, err.Error(), "not found", "Looking for message about ID missing, but got: %s", err)
 	} )
@@ -178,33 +244,33 @@ func (m *MongoSessionSuite) TestUpdateCollection() {
 		err = m.session.DB(testDbName).C(testBadCollection).DropCollection()
 		require.NoError(t, err, "Test failed in setup dropping test collection. Err: %s", err)
 
-		testMS := NewMongoSession(testMongoURL, testDbName, m.logger, 3)
-		err = testMS.UpdateCollection(testBadCollection, types.Loc{})
+		testMS := m.newSession(Config{})
+		err = testMS.UpdateCollection(ctx, testBadCollection, types.Loc{})
 		require.Error(t, err, "Should get error message when attempt to access non-existent collection")
 		require.Contains(t, err.Error(), "Non-existent collection for update", "Looking for missing collection, but got: %s", err)
 	} )
 	m.T().Run("Dropped connection", func(t *testing.T){
-		testMS, logBuf := GetMongoSessionWithLogger()
-		testMS.mongoURL = "yo"
+		testMS, logBuf := m.unreachableSession()
 		testLoc, _ := types.LocFromCoords(22, 22, 33)
-		err = testMS.UpdateCollection(testCollection, testLoc)
+		err = testMS.UpdateCollection(ctx, testCollection, testLoc)
 		require.Error(t, err, "Should get an error if changed to unreachable URL")
-		require.Contains(t, err.Error(), "no reachable servers", "Should complain about lack of connectivity")
-		require.Contains(t, logBuf.String(), "no reachable servers", "Log message should complain about lack of connectivity")
+		require.Truef(t, errors.Is(err, ErrUnreachable), "Should complain about lack of connectivity. Got: %v", err)
+		require.Contains(t, logBuf.String(), "could not establish mongo connection", "Log message should complain about lack of connectivity")
 		require.Contains(t, logBuf.String(), "UpdateCollection", "Log message should inform on source of issue")
 } )
 }
 
 func (m *MongoSessionSuite) TestFetchFromCollection() {
+	ctx := context.Background()
 	var err error
 	testLoc, _ := types.LocFromCoords(1, 2, 3)
 	err = AddToMongoCollection(m.T(), m.session, testCollection, testLoc)
 	m.NoError(err, "Test failed in setup adding to collection. Err: %s", err)
-		testMS := NewMongoSession(testMongoURL, testDbName, m.logger, 3)
+		testMS := m.newSession(Config{})
 
 	m.T().Run("Positive", func(t *testing.T) {
 		var result types.Loc
-		result, err = testMS.FetchFromCollection(testCollection, testLoc.GetID())
+		result, err = testMS.FetchFromCollection(ctx, testCollection, testLoc.GetID())
 		require.NoError(t, err, "Successful lookup throws no error. Instead we got %s", err )
 		require.NotNil(t, result, "Successful lookup has to actually return something")
 		require.Equal(t, testLoc.ID, result.GetID() )
@@ -212,22 +278,245 @@ func (m *MongoSessionSuite) TestFetchFromCollection() {
 	} )
 	m.T().Run("Missing ID", func(t *testing.T) {
 		unexpectedID := "11.12.-13"
-		_, err = testMS.FetchFromCollection(testCollection, unexpectedID)
+		_, err = testMS.FetchFromCollection(ctx, testCollection, unexpectedID)
 		require.Error(t, err, "Missing id should throw an error")
 		require.Contains(t, err.Error(), "not found", "Message should give a clue. Instead it is %s", err)
 	} )
 	m.T().Run("Dropped connection", func(t *testing.T){
-		testMS, logBuf := GetMongoSessionWithLogger()
-		testMS.mongoURL = "yo"
+		testMS, logBuf := m.unreachableSession()
 		testLoc, _ := types.LocFromCoords(22, 22, 33)
-		_, err = testMS.FetchFromCollection(testCollection, testLoc.GetID())
+		_, err = testMS.FetchFromCollection(ctx, testCollection, testLoc.GetID())
 		require.Error(t, err, "Should get an error if changed to unreachable URL")
-		require.Contains(t, err.Error(), "no reachable servers", "Should complain about lack of connectivity")
-		require.Contains(t, logBuf.String(), "no reachable servers", "Log message should complain about lack of connectivity")
+		require.Truef(t, errors.Is(err, ErrUnreachable), "Should complain about lack of connectivity. Got: %v", err)
+		require.Contains(t, logBuf.String(), "could not establish mongo connection", "Log message should complain about lack of connectivity")
 		require.Contains(t, logBuf.String(), "FetchFromCollection", "Log message should inform on source of issue")
 	} )
 }
 
+func (m *MongoSessionSuite) TestFetchAllFromCollection() {
+	ctx := context.Background()
+	var err error
+	testMS := m.newSession(Config{})
+
+	m.T().Run("Empty", func(t *testing.T) {
+		var result []types.Loc
+		result, err = testMS.FetchAllFromCollection(ctx, testCollection)
+		require.NoError(t, err, "Empty collection throws no error. Instead we got %s", err)
+		require.NotNil(t, result, "Empty collection should still return a slice")
+		require.Len(t, result, 0)
+	} )
+	m.T().Run("Positive", func(t *testing.T) {
+		for _, id := range []string{"1.2.3", "4.5.6", "-7.-8.-9"} {
+			testLoc, _ := types.LocFromString(id)
+			err = AddToMongoCollection(t, m.session, testCollection, testLoc)
+			require.NoError(t, err, "Test failed in setup adding to collection. Err: %s", err)
+		}
+		var result []types.Loc
+		result, err = testMS.FetchAllFromCollection(ctx, testCollection)
+		require.NoError(t, err, "Successful lookup throws no error. Instead we got %s", err)
+		require.Len(t, result, 3)
+	} )
+	m.T().Run("Dropped connection", func(t *testing.T){
+		testMS, logBuf := m.unreachableSession()
+		_, err = testMS.FetchAllFromCollection(ctx, testCollection)
+		require.Error(t, err, "Should get an error if changed to unreachable URL")
+		require.Truef(t, errors.Is(err, ErrUnreachable), "Should complain about lack of connectivity. Got: %v", err)
+		require.Contains(t, logBuf.String(), "FetchAllFromCollection", "Log message should inform on source of issue")
+	} )
+}
+
+func (m *MongoSessionSuite) TestQueryCollection() {
+	ctx := context.Background()
+	testMS := m.newSession(Config{})
+	forest, _ := types.LocFromString("0.0.0")
+	forest.Properties = &types.Properties{Terrain: "plains", Tags: []string{"forest", "road"}}
+	water, _ := types.LocFromString("1.-1.0")
+	water.Properties = &types.Properties{Terrain: "water"}
+	plain, _ := types.LocFromString("2.-2.0")
+	for _, loc := range []types.Loc{forest, water, plain} {
+		require.NoError(m.T(), AddToMongoCollection(m.T(), m.session, testCollection, loc))
+	}
+	require.NoError(m.T(), testMS.EnsureIndexes(ctx, testCollection, LocIndexes))
+
+	var cases = []struct {
+		query    LocQuery
+		expected int
+	}{
+		{LocQuery{}, 3},
+		{LocQuery{Tag: "forest"}, 1},
+		{LocQuery{Terrain: "water"}, 1},
+		{LocQuery{Terrain: "water", Tag: "forest"}, 0},
+		{LocQuery{Status: "new"}, 3},
+	}
+	for _, c := range cases {
+		m.T().Run(fmt.Sprintf("%+v", c.query), func(t *testing.T) {
+			result, err := testMS.QueryCollection(ctx, testCollection, c.query)
+			require.NoError(t, err)
+			require.Len(t, result, c.expected)
+		} )
+	}
+}
+
+func (m *MongoSessionSuite) TestFetchRangeFromCollection() {
+	ctx := context.Background()
+	var err error
+	testMS := m.newSession(Config{})
+
+	m.T().Run("Positive", func(t *testing.T) {
+		for _, id := range []string{"0.0.0", "3.-5.2", "4.-1.-3", "-1.1.0"} {
+			testLoc, _ := types.LocFromString(id)
+			err = AddToMongoCollection(t, m.session, testCollection, testLoc)
+			require.NoError(t, err, "Test failed in setup adding to collection. Err: %s", err)
+		}
+		var result []types.Loc
+		result, err = testMS.FetchRangeFromCollection(ctx, testCollection, 0, 3, 0, 2)
+		require.NoError(t, err, "Successful lookup throws no error. Instead we got %s", err)
+		require.Len(t, result, 2, "Only locs with x in 0..3 and z in 0..2 should be returned")
+	} )
+	m.T().Run("Dropped connection", func(t *testing.T){
+		testMS, logBuf := m.unreachableSession()
+		_, err = testMS.FetchRangeFromCollection(ctx, testCollection, 0, 1, 0, 1)
+		require.Error(t, err, "Should get an error if changed to unreachable URL")
+		require.Contains(t, logBuf.String(), "FetchRangeFromCollection", "Log message should inform on source of issue")
+	} )
+}
+
+func (m *MongoSessionSuite) TestSaveAndFetchDocument() {
+	ctx := context.Background()
+	type doc struct {
+		ID    string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	testMS := m.newSession(Config{})
+
+	m.T().Run("Round trip", func(t *testing.T) {
+		require.NoError(t, testMS.SaveDocument(ctx, testCollection, "game1", doc{"game1", 1}))
+		require.NoError(t, testMS.SaveDocument(ctx, testCollection, "game1", doc{"game1", 2}), "Saving again should replace")
+		var result doc
+		require.NoError(t, testMS.FetchDocument(ctx, testCollection, "game1", &result))
+		require.Equal(t, 2, result.Count)
+	} )
+	m.T().Run("Find", func(t *testing.T) {
+		require.NoError(t, testMS.SaveDocument(ctx, testCollection, "game2", doc{"game2", 2}))
+		require.NoError(t, testMS.SaveDocument(ctx, testCollection, "game3", doc{"game3", 3}))
+		var result []doc
+		require.NoError(t, testMS.FindDocuments(ctx, testCollection, map[string]interface{}{"count": 2}, &result))
+		require.Len(t, result, 2, "game1 and game2 both have a count of 2")
+	} )
+	m.T().Run("Missing", func(t *testing.T) {
+		var result doc
+		err := testMS.FetchDocument(ctx, testCollection, "nope", &result)
+		require.True(t, IsNotFound(err), "Expected ErrNotFound. Got: %v", err)
+	} )
+	m.T().Run("Insert", func(t *testing.T) {
+		require.NoError(t, testMS.InsertDocument(ctx, testCollection, "game4", doc{"game4", 4}))
+		err := testMS.InsertDocument(ctx, testCollection, "game4", doc{"game4", 5})
+		require.True(t, IsDuplicate(err), "Inserting a taken ID should fail as a duplicate")
+	} )
+	m.T().Run("Delete", func(t *testing.T) {
+		require.NoError(t, testMS.DeleteDocument(ctx, testCollection, "game3"))
+		var result doc
+		require.True(t, IsNotFound(testMS.FetchDocument(ctx, testCollection, "game3", &result)))
+		require.True(t, IsNotFound(testMS.DeleteDocument(ctx, testCollection, "game3")))
+	} )
+	m.T().Run("Dropped connection", func(t *testing.T){
+		testMS, logBuf := m.unreachableSession()
+		require.Error(t, testMS.SaveDocument(ctx, testCollection, "game1", doc{}))
+		require.Contains(t, logBuf.String(), "SaveDocument", "Log message should inform on source of issue")
+	} )
+}
+
+func (m *MongoSessionSuite) TestIndexes() {
+	ctx := context.Background()
+	testMS := m.newSession(Config{})
+	loc, _ := types.LocFromString("1.-1.0")
+
+	m.T().Run("Ensure", func(t *testing.T) {
+		require.NoError(t, testMS.WriteCollection(ctx, testCollection, loc))
+		require.NoError(t, testMS.EnsureIndexes(ctx, testCollection, LocIndexes))
+		require.NoError(t, testMS.EnsureIndexes(ctx, testCollection, LocIndexes), "Ensuring again should be a no-op")
+		report, err := CheckIndexes(ctx, testMS, testCollection, LocIndexes)
+		require.NoError(t, err)
+		require.True(t, report.OK(), "Every declared index should exist. Got: %+v", report)
+	} )
+	m.T().Run("Unique coordinates", func(t *testing.T) {
+		clash := loc
+		clash.ID = "a:1,-1"
+		require.Error(t, testMS.WriteCollection(ctx, testCollection, clash), "The same coordinates under another ID should be rejected")
+	} )
+	m.T().Run("Missing collection", func(t *testing.T) {
+		indexes, err := testMS.ListIndexes(ctx, "neverCreated")
+		require.NoError(t, err)
+		require.Len(t, indexes, 0)
+	} )
+	m.T().Run("Dropped connection", func(t *testing.T){
+		testMS, logBuf := m.unreachableSession()
+		require.Error(t, testMS.EnsureIndexes(ctx, testCollection, LocIndexes))
+		require.Contains(t, logBuf.String(), "EnsureIndexes", "Log message should inform on source of issue")
+	} )
+}
+
+func (m *MongoSessionSuite) TestDropCollection() {
+	ctx := context.Background()
+	testMS := m.newSession(Config{})
+	loc, _ := types.LocFromString("1.-1.0")
+
+	m.T().Run("Positive", func(t *testing.T) {
+		require.NoError(t, testMS.WriteCollection(ctx, testCollection, loc))
+		require.NoError(t, testMS.DropCollection(ctx, testCollection))
+		locs, err := testMS.FetchAllFromCollection(ctx, testCollection)
+		require.NoError(t, err)
+		require.Len(t, locs, 0)
+	} )
+	m.T().Run("Missing collection", func(t *testing.T) {
+		require.NoError(t, testMS.DropCollection(ctx, "neverCreated"), "Dropping a missing collection should not fail")
+	} )
+	m.T().Run("Dropped connection", func(t *testing.T){
+		testMS, logBuf := m.unreachableSession()
+		require.Error(t, testMS.DropCollection(ctx, testCollection))
+		require.Contains(t, logBuf.String(), "DropCollection", "Log message should inform on source of issue")
+	} )
+}
+
+func TestConnectToMongoCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ms := NewMongoSession("i.am.abad.url:12345", testDbName, nil)
+	require.Equal(t, context.Canceled, ms.ConnectToMongo(ctx), "A cancelled context should stop the dial before it starts")
+	_, err := ms.FetchFromCollection(ctx, testCollection, "0.0.0")
+	require.Equal(t, context.Canceled, err)
+}
+
+func TestMongoSessionFailedReconnect(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMongoSessionFromConfig(Config{URL: "127.0.0.1:1", DBName: testDbName, DialTimeout: 100 * time.Millisecond}, log.New(&bytes.Buffer{}, "", 0))
+	// a database left over from an earlier connection must not count as connected
+	ms.db = &mgo.Database{Name: testDbName}
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.ErrorIs(t, ms.ConnectToMongo(ctx), ErrUnreachable)
+			_, err := ms.FetchFromCollection(ctx, testCollection, "0.0.0")
+			require.ErrorIs(t, err, ErrUnreachable, "A failed reconnect should be reported, not panic")
+		}()
+	}
+	wg.Wait()
+	require.Nil(t, ms.session, "A failed dial should leave no session behind")
+}
+
+func TestMgoError(t *testing.T) {
+	require.Nil(t, mgoError(nil))
+	require.Equal(t, ErrNotFound, mgoError(mgo.ErrNotFound))
+	require.True(t, IsDuplicate(mgoError(&mgo.LastError{Code: 11000, Err: "E11000 duplicate key error"})))
+	for _, err := range []error{io.EOF, &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}, errors.New("no reachable servers")} {
+		require.ErrorIsf(t, mgoError(err), ErrUnreachable, "%v should mean mongo can't be reached", err)
+	}
+	other := errors.New("boom")
+	require.Equal(t, other, mgoError(other))
+}
+
 /*** Helper functions ***/
 
 
@@ -274,11 +563,3 @@ func AddToMongoCollection(t *testing.T, session *mgo.Session, collName string, o
 	myCollection := session.DB(testDbName).C(collName)
 	return myCollection.Insert(obj)
 }
-
-func GetMongoSessionWithLogger() (ms *MongoSession, logBuf *bytes.Buffer) {
-		logBuf = &bytes.Buffer{}
-		logLabel := "persistence_test: "
-		blog := log.New(logBuf, logLabel, 0)
-		ms = NewMongoSession(testMongoURL, testDbName, blog, 3)
-		return
-}
\ No newline at end of file
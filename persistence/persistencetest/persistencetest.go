@@ -0,0 +1,358 @@
+// Package persistencetest checks that a DAL behaves the way the rest of the code expects of persistence.MongoAbstraction,
+// whatever the database underneath. Each implementation, mocks and fakes included, runs the same conformance suite:
+//
+//	func TestConformance(t *testing.T) {
+//		persistencetest.RunConformance(t, func() per.MongoAbstraction { return newStore() })
+//	}
+package persistencetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	per "webstuff/persistence"
+	"webstuff/types"
+)
+
+// Collection is the loc collection the suite works in. Each test drops it before it starts.
+const Collection = "conformance"
+
+// missingCollection is never written to
+const missingCollection = "neverCreated"
+
+// writers is how many goroutines the concurrency tests run at once
+const writers = 8
+
+// Factory returns the DAL under test. It is called once per test and may return the same store each time, since the
+// suite drops its collection before every test. Range fetches and indexes are checked only if the DAL also implements
+// persistence.RangeFetcher or persistence.Indexer.
+type Factory func() per.MongoAbstraction
+
+// RunConformance runs the conformance suite against the DALs the factory returns
+func RunConformance(t *testing.T, factory Factory) {
+	suite.Run(t, &conformanceSuite{factory: factory})
+}
+
+type conformanceSuite struct {
+	suite.Suite
+	factory Factory
+	store   per.MongoAbstraction
+}
+
+func (s *conformanceSuite) SetupTest() {
+	s.store = s.factory()
+	ctx := context.Background()
+	s.Require().NoError(s.store.ConnectToMongo(ctx))
+	s.Require().NoError(s.store.DropCollection(ctx, Collection))
+}
+
+func (s *conformanceSuite) TestLocs() {
+	ctx := context.Background()
+	loc, _ := types.LocFromString("1.-1.0")
+	loc.Properties = &types.Properties{Terrain: "forest", Tags: []string{"road"}}
+
+	s.T().Run("Insert then fetch", func(t *testing.T) {
+		require.NoError(t, s.store.WriteCollection(ctx, Collection, loc))
+		result, err := s.store.FetchFromCollection(ctx, Collection, loc.GetID())
+		require.NoError(t, err)
+		require.Equal(t, loc.ID, result.ID)
+		require.Equal(t, loc.Properties, result.Properties)
+	})
+	s.T().Run("Duplicate insert", func(t *testing.T) {
+		err := s.store.WriteCollection(ctx, Collection, loc)
+		require.Truef(t, per.IsDuplicate(err), "Writing a taken ID should fail as a duplicate. Got: %v", err)
+	})
+	s.T().Run("Update", func(t *testing.T) {
+		changed := loc
+		changed.Status = "claimed"
+		require.NoError(t, s.store.UpdateCollection(ctx, Collection, changed))
+		result, err := s.store.FetchFromCollection(ctx, Collection, loc.GetID())
+		require.NoError(t, err)
+		require.Equal(t, "claimed", result.Status, "The update should be stored")
+	})
+	s.T().Run("Update missing", func(t *testing.T) {
+		missing, _ := types.LocFromString("5.-5.0")
+		err := s.store.UpdateCollection(ctx, Collection, missing)
+		require.Truef(t, per.IsNotFound(err), "Updating a missing ID should fail as not found. Got: %v", err)
+		err = s.store.UpdateCollection(ctx, missingCollection, missing)
+		require.Truef(t, per.IsNotFound(err), "Updating in a missing collection should fail as not found. Got: %v", err)
+	})
+	s.T().Run("Fetch missing", func(t *testing.T) {
+		_, err := s.store.FetchFromCollection(ctx, Collection, "5.-5.0")
+		require.Truef(t, per.IsNotFound(err), "Fetching a missing ID should fail as not found. Got: %v", err)
+	})
+	s.T().Run("Delete", func(t *testing.T) {
+		require.NoError(t, s.store.DeleteFromCollection(ctx, Collection, loc.GetID()))
+		_, err := s.store.FetchFromCollection(ctx, Collection, loc.GetID())
+		require.True(t, per.IsNotFound(err), "A deleted loc should be gone")
+	})
+	s.T().Run("Delete missing", func(t *testing.T) {
+		err := s.store.DeleteFromCollection(ctx, Collection, loc.GetID())
+		require.Truef(t, per.IsNotFound(err), "Deleting a missing ID should fail as not found. Got: %v", err)
+	})
+	s.T().Run("Fetch all empty", func(t *testing.T) {
+		locs, err := s.store.FetchAllFromCollection(ctx, Collection)
+		require.NoError(t, err)
+		require.NotNil(t, locs, "An empty collection should still return a slice")
+		require.Len(t, locs, 0)
+	})
+}
+
+func (s *conformanceSuite) TestQuery() {
+	ctx := context.Background()
+	forest, _ := types.LocFromString("0.0.0")
+	forest.Properties = &types.Properties{Terrain: "plains", Tags: []string{"forest", "road"}}
+	water, _ := types.LocFromString("1.-1.0")
+	water.Properties = &types.Properties{Terrain: "water"}
+	plain, _ := types.LocFromString("2.-2.0")
+	plain.Status = "claimed"
+	far, _ := types.LocFromString("4.-1.-3")
+	for _, loc := range []types.Loc{forest, water, plain, far} {
+		s.Require().NoError(s.store.WriteCollection(ctx, Collection, loc))
+	}
+
+	var cases = []struct {
+		query    per.LocQuery
+		expected int
+	}{
+		{per.LocQuery{}, 4},
+		{per.LocQuery{Tag: "forest"}, 1},
+		{per.LocQuery{Terrain: "water"}, 1},
+		{per.LocQuery{Terrain: "water", Tag: "forest"}, 0},
+		{per.LocQuery{Status: "new"}, 3},
+		{per.LocQuery{Status: "claimed"}, 1},
+	}
+	for _, c := range cases {
+		s.T().Run(fmt.Sprintf("%+v", c.query), func(t *testing.T) {
+			result, err := s.store.QueryCollection(ctx, Collection, c.query)
+			require.NoError(t, err)
+			require.Len(t, result, c.expected)
+		})
+	}
+	s.T().Run("Range", func(t *testing.T) {
+		rf, ok := s.store.(per.RangeFetcher)
+		if !ok {
+			t.Skip("Not a RangeFetcher")
+		}
+		result, err := rf.FetchRangeFromCollection(ctx, Collection, 0, 3, -2, 0)
+		require.NoError(t, err)
+		require.Len(t, result, 3, "Only locs with x in 0..3 and z in -2..0 should be returned")
+	})
+}
+
+func (s *conformanceSuite) TestDocuments() {
+	ctx := context.Background()
+	type doc struct {
+		ID    string `bson:"_id"`
+		Owner string `bson:"owner"`
+		Count int    `bson:"count"`
+	}
+
+	s.T().Run("Save then fetch", func(t *testing.T) {
+		require.NoError(t, s.store.SaveDocument(ctx, Collection, "game1", doc{"game1", "red", 1}))
+		require.NoError(t, s.store.SaveDocument(ctx, Collection, "game1", doc{"game1", "red", 2}), "Saving again should replace")
+		var result doc
+		require.NoError(t, s.store.FetchDocument(ctx, Collection, "game1", &result))
+		require.Equal(t, doc{"game1", "red", 2}, result)
+	})
+	s.T().Run("Find", func(t *testing.T) {
+		require.NoError(t, s.store.SaveDocument(ctx, Collection, "game2", doc{"game2", "blue", 2}))
+		require.NoError(t, s.store.SaveDocument(ctx, Collection, "game3", doc{"game3", "red", 3}))
+		var result []doc
+		require.NoError(t, s.store.FindDocuments(ctx, Collection, map[string]interface{}{"count": 2}, &result))
+		require.Len(t, result, 2, "game1 and game2 both have a count of 2")
+		require.NoError(t, s.store.FindDocuments(ctx, Collection, map[string]interface{}{"count": map[string]interface{}{"$gt": 2}}, &result))
+		require.Equal(t, []doc{{"game3", "red", 3}}, result)
+		require.NoError(t, s.store.FindDocuments(ctx, Collection, map[string]interface{}{"count": map[string]interface{}{"$lte": 2}}, &result))
+		require.Len(t, result, 2, "Comparisons select a range")
+		require.NoError(t, s.store.FindDocuments(ctx, Collection, map[string]interface{}{"owner": "red", "count": 3}, &result))
+		require.Equal(t, []doc{{"game3", "red", 3}}, result)
+		require.NoError(t, s.store.FindDocuments(ctx, missingCollection, map[string]interface{}{}, &result))
+		require.Len(t, result, 0)
+	})
+	s.T().Run("Duplicate insert", func(t *testing.T) {
+		require.NoError(t, s.store.InsertDocument(ctx, Collection, "game4", doc{"game4", "red", 4}))
+		err := s.store.InsertDocument(ctx, Collection, "game4", doc{"game4", "red", 5})
+		require.Truef(t, per.IsDuplicate(err), "Inserting a taken ID should fail as a duplicate. Got: %v", err)
+	})
+	s.T().Run("Replace if", func(t *testing.T) {
+		require.NoError(t, s.store.InsertDocument(ctx, Collection, "game5", doc{"game5", "red", 1}))
+		require.NoError(t, s.store.ReplaceDocumentIf(ctx, Collection, "game5", map[string]interface{}{"count": 1}, doc{"game5", "blue", 2}))
+		err := s.store.ReplaceDocumentIf(ctx, Collection, "game5", map[string]interface{}{"count": 1}, doc{"game5", "green", 2})
+		require.Truef(t, per.IsNotFound(err), "Replacing a document that no longer matches should fail as not found. Got: %v", err)
+		err = s.store.ReplaceDocumentIf(ctx, Collection, "nope", map[string]interface{}{}, doc{"nope", "red", 1})
+		require.Truef(t, per.IsNotFound(err), "Replacing a missing ID should fail as not found. Got: %v", err)
+		var result doc
+		require.NoError(t, s.store.FetchDocument(ctx, Collection, "game5", &result))
+		require.Equal(t, doc{"game5", "blue", 2}, result)
+	})
+	s.T().Run("Delete if", func(t *testing.T) {
+		require.NoError(t, s.store.InsertDocument(ctx, Collection, "game6", doc{"game6", "red", 1}))
+		err := s.store.DeleteDocumentIf(ctx, Collection, "game6", map[string]interface{}{"owner": "blue"})
+		require.Truef(t, per.IsNotFound(err), "Deleting a document that doesn't match should fail as not found. Got: %v", err)
+		require.NoError(t, s.store.DeleteDocumentIf(ctx, Collection, "game6", map[string]interface{}{"owner": "red", "count": 1}))
+		var result doc
+		require.True(t, per.IsNotFound(s.store.FetchDocument(ctx, Collection, "game6", &result)))
+		err = s.store.DeleteDocumentIf(ctx, Collection, "game6", map[string]interface{}{})
+		require.Truef(t, per.IsNotFound(err), "Deleting a missing ID should fail as not found. Got: %v", err)
+	})
+	s.T().Run("Fetch missing", func(t *testing.T) {
+		var result doc
+		err := s.store.FetchDocument(ctx, Collection, "nope", &result)
+		require.Truef(t, per.IsNotFound(err), "Fetching a missing ID should fail as not found. Got: %v", err)
+	})
+	s.T().Run("Delete missing", func(t *testing.T) {
+		require.NoError(t, s.store.DeleteDocument(ctx, Collection, "game3"))
+		var result doc
+		require.True(t, per.IsNotFound(s.store.FetchDocument(ctx, Collection, "game3", &result)))
+		err := s.store.DeleteDocument(ctx, Collection, "game3")
+		require.Truef(t, per.IsNotFound(err), "Deleting a missing ID should fail as not found. Got: %v", err)
+	})
+}
+
+func (s *conformanceSuite) TestIndexes() {
+	ix, ok := s.store.(per.Indexer)
+	if !ok {
+		s.T().Skip("Not an Indexer")
+	}
+	ctx := context.Background()
+	loc, _ := types.LocFromString("1.-1.0")
+
+	s.T().Run("Ensure", func(t *testing.T) {
+		require.NoError(t, s.store.WriteCollection(ctx, Collection, loc))
+		require.NoError(t, ix.EnsureIndexes(ctx, Collection, per.LocIndexes))
+		require.NoError(t, ix.EnsureIndexes(ctx, Collection, per.LocIndexes), "Ensuring again should be a no-op")
+		report, err := per.CheckIndexes(ctx, ix, Collection, per.LocIndexes)
+		require.NoError(t, err)
+		require.True(t, report.OK(), "Every declared index should exist. Got: %+v", report)
+	})
+	s.T().Run("Unique coordinates", func(t *testing.T) {
+		clash := loc
+		clash.ID = "a:1,-1"
+		err := s.store.WriteCollection(ctx, Collection, clash)
+		require.Truef(t, per.IsDuplicate(err), "The same coordinates under another ID should be rejected. Got: %v", err)
+	})
+	s.T().Run("Unique document field", func(t *testing.T) {
+		type unit struct {
+			ID       string `bson:"_id"`
+			Position string `bson:"position"`
+		}
+		require.NoError(t, ix.EnsureIndexes(ctx, per.UnitCollection, per.UnitIndexes))
+		require.NoError(t, s.store.InsertDocument(ctx, per.UnitCollection, "scout", unit{"scout", "0.0.0"}))
+		err := s.store.InsertDocument(ctx, per.UnitCollection, "knight", unit{"knight", "0.0.0"})
+		require.Truef(t, per.IsDuplicate(err), "A second document with the same position should be rejected. Got: %v", err)
+		require.NoError(t, s.store.InsertDocument(ctx, per.UnitCollection, "knight", unit{"knight", "1.-1.0"}))
+		err = s.store.SaveDocument(ctx, per.UnitCollection, "knight", unit{"knight", "0.0.0"})
+		require.Truef(t, per.IsDuplicate(err), "Moving onto a taken position should be rejected. Got: %v", err)
+		require.NoError(t, s.store.SaveDocument(ctx, per.UnitCollection, "scout", unit{"scout", "2.-2.0"}), "A document keeps its own position")
+	})
+	s.T().Run("Missing collection", func(t *testing.T) {
+		indexes, err := ix.ListIndexes(ctx, missingCollection)
+		require.NoError(t, err)
+		require.Len(t, indexes, 0)
+	})
+}
+
+func (s *conformanceSuite) TestDropCollection() {
+	ctx := context.Background()
+	loc, _ := types.LocFromString("1.-1.0")
+	s.Require().NoError(s.store.WriteCollection(ctx, Collection, loc))
+	s.Require().NoError(s.store.SaveDocument(ctx, Collection, "game1", map[string]interface{}{"_id": "game1"}))
+
+	s.Require().NoError(s.store.DropCollection(ctx, Collection))
+	locs, err := s.store.FetchAllFromCollection(ctx, Collection)
+	s.Require().NoError(err)
+	s.Len(locs, 0)
+	var result map[string]interface{}
+	s.True(per.IsNotFound(s.store.FetchDocument(ctx, Collection, "game1", &result)), "Documents should go with the collection")
+	s.True(per.IsNotFound(s.store.UpdateCollection(ctx, Collection, loc)), "A dropped collection no longer exists")
+	s.NoError(s.store.DropCollection(ctx, missingCollection), "Dropping a missing collection should not fail")
+}
+
+func (s *conformanceSuite) TestCancelled() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.store.FetchAllFromCollection(ctx, Collection)
+	s.Equal(context.Canceled, err)
+	loc, _ := types.LocFromString("1.-1.0")
+	s.Equal(context.Canceled, s.store.WriteCollection(ctx, Collection, loc))
+}
+
+func (s *conformanceSuite) TestConcurrency() {
+	ctx := context.Background()
+
+	s.T().Run("Same ID", func(t *testing.T) {
+		loc, _ := types.LocFromString("0.0.0")
+		errs := runWriters(func(int) error { return s.store.WriteCollection(ctx, Collection, loc) })
+		written := 0
+		for _, err := range errs {
+			if err == nil {
+				written++
+				continue
+			}
+			require.Truef(t, per.IsDuplicate(err), "Losing writers should fail as duplicates. Got: %v", err)
+		}
+		require.Equal(t, 1, written, "Exactly one of the writers should win")
+	})
+	s.T().Run("Different IDs", func(t *testing.T) {
+		errs := runWriters(func(i int) error {
+			loc, _ := types.LocFromCoords(i+1, -i-1, 0)
+			return s.store.WriteCollection(ctx, Collection, loc)
+		})
+		for _, err := range errs {
+			require.NoError(t, err)
+		}
+		locs, err := s.store.FetchAllFromCollection(ctx, Collection)
+		require.NoError(t, err)
+		require.Len(t, locs, writers+1, "Every writer's loc should be stored, along with 0.0.0")
+	})
+	s.T().Run("Same document", func(t *testing.T) {
+		errs := runWriters(func(i int) error {
+			return s.store.InsertDocument(ctx, Collection, "game1", map[string]interface{}{"_id": "game1", "writer": i})
+		})
+		inserted := 0
+		for _, err := range errs {
+			if err == nil {
+				inserted++
+				continue
+			}
+			require.Truef(t, per.IsDuplicate(err), "Losing writers should fail as duplicates. Got: %v", err)
+		}
+		require.Equal(t, 1, inserted, "Exactly one of the writers should win")
+	})
+	s.T().Run("Same version", func(t *testing.T) {
+		require.NoError(t, s.store.InsertDocument(ctx, Collection, "game2", map[string]interface{}{"_id": "game2", "version": 1}))
+		errs := runWriters(func(i int) error {
+			match := map[string]interface{}{"version": 1}
+			return s.store.ReplaceDocumentIf(ctx, Collection, "game2", match, map[string]interface{}{"_id": "game2", "version": 2, "writer": i})
+		})
+		replaced := 0
+		for _, err := range errs {
+			if err == nil {
+				replaced++
+				continue
+			}
+			require.Truef(t, per.IsNotFound(err), "Losing writers should fail as not found. Got: %v", err)
+		}
+		require.Equal(t, 1, replaced, "Exactly one of the writers should win")
+	})
+}
+
+// runWriters calls write from as many goroutines as there are writers at once and returns their errors
+func runWriters(write func(i int) error) []error {
+	errs := make([]error, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = write(i)
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,40 @@
+package persistence
+
+import (
+	"webstuff/types"
+)
+
+// LocQuery filters locs by status and properties. Empty fields match every loc.
+type LocQuery struct {
+	Status  string
+	Terrain string
+	Tag     string
+}
+
+// IsEmpty reports whether the query matches every loc
+func (q LocQuery) IsEmpty() bool {
+	return q == LocQuery{}
+}
+
+// Matches reports whether the loc passes every filter of the query
+func (q LocQuery) Matches(loc types.Loc) bool {
+	return (q.Status == "" || loc.Status == q.Status) &&
+		(q.Terrain == "" || loc.Properties.TerrainName() == q.Terrain) &&
+		(q.Tag == "" || loc.Properties.HasTag(q.Tag))
+}
+
+// filter converts the query to a mongo filter. Matching a single value against the tags array finds locs holding
+// that tag.
+func (q LocQuery) filter() map[string]interface{} {
+	result := map[string]interface{}{}
+	if q.Status != "" {
+		result["status"] = q.Status
+	}
+	if q.Terrain != "" {
+		result["properties.terrain"] = q.Terrain
+	}
+	if q.Tag != "" {
+		result["properties.tags"] = q.Tag
+	}
+	return result
+}
@@ -0,0 +1,27 @@
+package persistence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"webstuff/types"
+)
+
+func TestLocQueryMatches(t *testing.T) {
+	forest, _ := types.LocFromString("0.0.0")
+	forest.Properties = &types.Properties{Terrain: "plains", Tags: []string{"forest", "road"}}
+	bare, _ := types.LocFromString("1.-1.0")
+
+	require.True(t, LocQuery{}.IsEmpty())
+	require.True(t, LocQuery{}.Matches(bare), "Empty query matches everything")
+	require.True(t, LocQuery{Tag: "road"}.Matches(forest))
+	require.True(t, LocQuery{Terrain: "plains", Tag: "forest", Status: "new"}.Matches(forest))
+	require.False(t, LocQuery{Terrain: "water"}.Matches(forest))
+	require.False(t, LocQuery{Tag: "road"}.Matches(bare), "Locs without properties have no tags")
+	require.False(t, LocQuery{Status: "claimed"}.Matches(bare))
+}
+
+func TestLocQueryFilter(t *testing.T) {
+	require.Equal(t, map[string]interface{}{}, LocQuery{}.filter())
+	require.Equal(t, map[string]interface{}{"properties.terrain": "water", "properties.tags": "forest"}, LocQuery{Terrain: "water", Tag: "forest"}.filter())
+}
@@ -0,0 +1,661 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"go.mongodb.org/mongo-driver/bson"
+	"webstuff/types"
+)
+
+// SQL drivers that Open can build a Backend on
+const (
+	// DriverSQLite is an embedded SQLite database for single node deployments. The URL is the path of the database
+	// file, or ':memory:' for a throwaway one.
+	DriverSQLite = "sqlite"
+	// DriverPostgres is a Postgres database. The URL is a libpq connection string.
+	DriverPostgres = "postgres"
+)
+
+// dialect holds what differs between the SQL databases a SQLSession can run on
+type dialect struct {
+	driverName  string
+	blobType    string
+	placeholder func(n int) string
+	isDuplicate func(err error) bool
+}
+
+var dialects = map[string]dialect{
+	DriverSQLite: {
+		driverName:  "sqlite3",
+		blobType:    "BLOB",
+		placeholder: func(n int) string { return "?" },
+		isDuplicate: func(err error) bool {
+			var sqliteErr sqlite3.Error
+			return errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint
+		},
+	},
+	DriverPostgres: {
+		driverName:  "postgres",
+		blobType:    "BYTEA",
+		placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+		isDuplicate: func(err error) bool {
+			var pqErr *pq.Error
+			return errors.As(err, &pqErr) && pqErr.Code == "23505"
+		},
+	},
+}
+
+// sqlSchema creates the tables a SQLSession keeps every collection in. Locs keep their coordinates, status and
+// terrain in indexed columns next to the JSON of the whole loc, so lookups, range fetches and queries don't need to
+// decode it. Other documents are kept as BSON, so they honour the same struct tags as they do in mongo.
+var sqlSchema = []string{
+	`CREATE TABLE IF NOT EXISTS collections (name TEXT PRIMARY KEY)`,
+	`CREATE TABLE IF NOT EXISTS locs (
+		coll TEXT NOT NULL, id TEXT NOT NULL,
+		x INTEGER NOT NULL, y INTEGER NOT NULL, z INTEGER NOT NULL,
+		status TEXT NOT NULL, terrain TEXT NOT NULL, body TEXT NOT NULL,
+		PRIMARY KEY (coll, id))`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS locs_coll_x_y_z ON locs (coll, x, y, z)`,
+	`CREATE INDEX IF NOT EXISTS locs_coll_x_z ON locs (coll, x, z)`,
+	`CREATE INDEX IF NOT EXISTS locs_coll_status ON locs (coll, status)`,
+	`CREATE INDEX IF NOT EXISTS locs_coll_terrain ON locs (coll, terrain)`,
+	`CREATE TABLE IF NOT EXISTS documents (coll TEXT NOT NULL, id TEXT NOT NULL, body {blob} NOT NULL, PRIMARY KEY (coll, id))`,
+	`CREATE TABLE IF NOT EXISTS declared_indexes (coll TEXT NOT NULL, name TEXT NOT NULL, spec TEXT NOT NULL, PRIMARY KEY (coll, name))`,
+}
+
+// SQLSession is a DAL on a SQL database. Collections are rows tagged with the collection name rather than tables of
+// their own, so creating and dropping them needs no DDL. It returns the same typed errors as the mongo sessions.
+type SQLSession struct {
+	mu      sync.Mutex
+	db      *sql.DB
+	dialect dialect
+	cfg     Config
+	logger  *log.Logger
+}
+
+// NewSQLSession creates a SQLSession, filling in defaults for whatever the config leaves empty. The config's driver
+// must be DriverSQLite or DriverPostgres.
+func NewSQLSession(cfg Config, logger *log.Logger) (*SQLSession, error) {
+	cfg = cfg.withDefaults()
+	d, ok := dialects[cfg.Driver]
+	if !ok {
+		return nil, fmt.Errorf("not a SQL driver: %q", cfg.Driver)
+	}
+	if logger == nil {
+		logger = log.New(os.Stdout, "sqlLayer", log.Ldate|log.Ltime)
+	}
+	return &SQLSession{dialect: d, cfg: cfg, logger: logger}, nil
+}
+
+// ConnectToMongo opens the database, checks that it answers and creates the schema if it's missing, giving up at the
+// dial timeout or the context's deadline, whichever comes first. It does nothing if the session is already connected.
+// The name is kept from the mongo sessions so every Backend connects the same way.
+func (ss *SQLSession) ConnectToMongo(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.db != nil {
+		return nil
+	}
+	db, err := sql.Open(ss.dialect.driverName, ss.cfg.URL)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrUnreachable, err)
+	}
+	if ss.cfg.Driver == DriverSQLite {
+		// SQLite takes one writer at a time, and each connection to ':memory:' would get a database of its own
+		db.SetMaxOpenConns(1)
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, ss.cfg.DialTimeout)
+	defer cancel()
+	if err = db.PingContext(dialCtx); err == nil {
+		err = ss.createSchema(dialCtx, db)
+	}
+	if err != nil {
+		db.Close()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w: %s", ErrUnreachable, err)
+	}
+	ss.db = db
+	return nil
+}
+
+func (ss *SQLSession) createSchema(ctx context.Context, db *sql.DB) error {
+	for _, stmt := range sqlSchema {
+		if _, err := db.ExecContext(ctx, strings.ReplaceAll(stmt, "{blob}", ss.dialect.blobType)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the database. The session connects again on its next call.
+func (ss *SQLSession) Close() error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.db == nil {
+		return nil
+	}
+	err := ss.db.Close()
+	ss.db = nil
+	return err
+}
+
+// run performs op bounded by the context and the operation's timeout. Errors come back as the typed errors of this
+// package where one applies.
+func (ss *SQLSession) run(ctx context.Context, name string, timeout time.Duration, op func(ctx context.Context, db *sql.DB) error) error {
+	if err := ss.ConnectToMongo(ctx); err != nil {
+		ss.logger.Printf("%s: could not establish database connection: %s", name, err)
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := op(ctx, ss.db)
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		return ctxErr
+	}
+	return ss.sqlError(err)
+}
+
+// sqlError translates the database's errors into the typed errors of this package
+func (ss *SQLSession) sqlError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case ss.dialect.isDuplicate(err):
+		return fmt.Errorf("%w: %s", ErrDuplicate, err)
+	}
+	return err
+}
+
+// query rewrites the '?' placeholders of a statement into the dialect's own
+func (ss *SQLSession) query(stmt string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range stmt {
+		if r == '?' {
+			n++
+			b.WriteString(ss.dialect.placeholder(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// touch records that the collection exists, as mongo does on the first write to it
+func (ss *SQLSession) touch(ctx context.Context, tx *sql.Tx, coll string) error {
+	_, err := tx.ExecContext(ctx, ss.query(`INSERT INTO collections (name) VALUES (?) ON CONFLICT (name) DO NOTHING`), coll)
+	return err
+}
+
+func (ss *SQLSession) collectionExists(ctx context.Context, db *sql.DB, coll string) (bool, error) {
+	var name string
+	err := db.QueryRowContext(ctx, ss.query(`SELECT name FROM collections WHERE name = ?`), coll).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// inTx runs op in a transaction, committing it if op succeeds
+func inTx(ctx context.Context, db *sql.DB, op func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err = op(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// locColumns returns the loc's column values in the order of the locs table, after coll and id
+func locColumns(obj types.Loc) ([]interface{}, error) {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{obj.X, obj.Y, obj.Z, obj.Status, obj.Properties.TerrainName(), string(body)}, nil
+}
+
+// WriteCollection writes the specified loc object to a given collection
+func (ss *SQLSession) WriteCollection(ctx context.Context, coll string, obj types.Loc) error {
+	columns, err := locColumns(obj)
+	if err != nil {
+		return err
+	}
+	return ss.run(ctx, "WriteCollection", ss.cfg.WriteTimeout, func(ctx context.Context, db *sql.DB) error {
+		return inTx(ctx, db, func(tx *sql.Tx) error {
+			if err := ss.touch(ctx, tx, coll); err != nil {
+				return err
+			}
+			args := append([]interface{}{coll, obj.GetID()}, columns...)
+			_, err := tx.ExecContext(ctx, ss.query(`INSERT INTO locs (coll, id, x, y, z, status, terrain, body) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`), args...)
+			return err
+		})
+	})
+}
+
+// UpdateCollection replaces the loc with a matching ID in the specified collection
+func (ss *SQLSession) UpdateCollection(ctx context.Context, coll string, obj types.Loc) error {
+	columns, err := locColumns(obj)
+	if err != nil {
+		return err
+	}
+	return ss.run(ctx, "UpdateCollection", ss.cfg.WriteTimeout, func(ctx context.Context, db *sql.DB) error {
+		exists, err := ss.collectionExists(ctx, db, coll)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w: Non-existent collection for update: %s", ErrNotFound, coll)
+		}
+		args := append(columns, coll, obj.GetID())
+		result, err := db.ExecContext(ctx, ss.query(`UPDATE locs SET x = ?, y = ?, z = ?, status = ?, terrain = ?, body = ? WHERE coll = ? AND id = ?`), args...)
+		return requireRow(result, err)
+	})
+}
+
+// requireRow fails with ErrNotFound if a statement that succeeded touched no rows
+func requireRow(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+// FetchFromCollection fetches the Loc by ID from the specified collection
+func (ss *SQLSession) FetchFromCollection(ctx context.Context, coll string, id string) (result types.Loc, err error) {
+	err = ss.run(ctx, "FetchFromCollection", ss.cfg.ReadTimeout, func(ctx context.Context, db *sql.DB) error {
+		var body string
+		if err := db.QueryRowContext(ctx, ss.query(`SELECT body FROM locs WHERE coll = ? AND id = ?`), coll, id).Scan(&body); err != nil {
+			return err
+		}
+		return json.Unmarshal([]byte(body), &result)
+	})
+	return
+}
+
+// FetchAllFromCollection fetches every Loc in the specified collection
+func (ss *SQLSession) FetchAllFromCollection(ctx context.Context, coll string) ([]types.Loc, error) {
+	return ss.findLocs(ctx, "FetchAllFromCollection", LocQuery{}, `coll = ?`, coll)
+}
+
+// QueryCollection fetches every Loc in the specified collection that matches the query. Status and terrain are
+// matched on their indexed columns; tags are matched on the decoded locs.
+func (ss *SQLSession) QueryCollection(ctx context.Context, coll string, query LocQuery) ([]types.Loc, error) {
+	where := `coll = ?`
+	args := []interface{}{coll}
+	if query.Status != "" {
+		where += ` AND status = ?`
+		args = append(args, query.Status)
+	}
+	if query.Terrain != "" {
+		where += ` AND terrain = ?`
+		args = append(args, query.Terrain)
+	}
+	return ss.findLocs(ctx, "QueryCollection", query, where, args...)
+}
+
+// FetchRangeFromCollection fetches every Loc in the specified collection with x and z inside the inclusive bounds
+func (ss *SQLSession) FetchRangeFromCollection(ctx context.Context, coll string, xmin int, xmax int, zmin int, zmax int) ([]types.Loc, error) {
+	return ss.findLocs(ctx, "FetchRangeFromCollection", LocQuery{}, `coll = ? AND x BETWEEN ? AND ? AND z BETWEEN ? AND ?`, coll, xmin, xmax, zmin, zmax)
+}
+
+// findLocs fetches the locs matching the where clause, in ID order, and keeps those that also match the query
+func (ss *SQLSession) findLocs(ctx context.Context, name string, query LocQuery, where string, args ...interface{}) ([]types.Loc, error) {
+	result := []types.Loc{}
+	err := ss.run(ctx, name, ss.cfg.ReadTimeout, func(ctx context.Context, db *sql.DB) error {
+		rows, err := db.QueryContext(ctx, ss.query(`SELECT body FROM locs WHERE `+where+` ORDER BY id`), args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var body string
+			if err := rows.Scan(&body); err != nil {
+				return err
+			}
+			var loc types.Loc
+			if err := json.Unmarshal([]byte(body), &loc); err != nil {
+				return err
+			}
+			if query.Matches(loc) {
+				result = append(result, loc)
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return []types.Loc{}, err
+	}
+	return result, nil
+}
+
+// DeleteFromCollection removes the Loc by ID from the specified collection
+func (ss *SQLSession) DeleteFromCollection(ctx context.Context, coll string, id string) error {
+	return ss.run(ctx, "DeleteFromCollection", ss.cfg.WriteTimeout, func(ctx context.Context, db *sql.DB) error {
+		return requireRow(db.ExecContext(ctx, ss.query(`DELETE FROM locs WHERE coll = ? AND id = ?`), coll, id))
+	})
+}
+
+// DropCollection removes the specified collection and everything in it, along with its declared indexes. Dropping a
+// collection that doesn't exist is not an error.
+func (ss *SQLSession) DropCollection(ctx context.Context, coll string) error {
+	return ss.run(ctx, "DropCollection", ss.cfg.WriteTimeout, func(ctx context.Context, db *sql.DB) error {
+		return inTx(ctx, db, func(tx *sql.Tx) error {
+			for _, table := range []string{"locs", "documents", "declared_indexes"} {
+				if _, err := tx.ExecContext(ctx, ss.query(`DELETE FROM `+table+` WHERE coll = ?`), coll); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, ss.query(`DELETE FROM collections WHERE name = ?`), coll)
+			return err
+		})
+	})
+}
+
+// SaveDocument stores an arbitrary document under the specified ID, replacing any document already there
+func (ss *SQLSession) SaveDocument(ctx context.Context, coll string, id string, doc interface{}) error {
+	return ss.putDocument(ctx, "SaveDocument", coll, id, doc,
+		`INSERT INTO documents (coll, id, body) VALUES (?, ?, ?) ON CONFLICT (coll, id) DO UPDATE SET body = excluded.body`)
+}
+
+// InsertDocument stores a document, failing with ErrDuplicate if a document with the specified ID already exists
+func (ss *SQLSession) InsertDocument(ctx context.Context, coll string, id string, doc interface{}) error {
+	return ss.putDocument(ctx, "InsertDocument", coll, id, doc, `INSERT INTO documents (coll, id, body) VALUES (?, ?, ?)`)
+}
+
+func (ss *SQLSession) putDocument(ctx context.Context, name string, coll string, id string, doc interface{}, stmt string) error {
+	body, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return ss.run(ctx, name, ss.cfg.WriteTimeout, func(ctx context.Context, db *sql.DB) error {
+		return inTx(ctx, db, func(tx *sql.Tx) error {
+			if err := ss.touch(ctx, tx, coll); err != nil {
+				return err
+			}
+			if err := ss.checkUnique(ctx, tx, coll, id, body); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, ss.query(stmt), coll, id, body)
+			return err
+		})
+	})
+}
+
+// checkUnique fails with ErrDuplicate when another document of the collection has the same values as body for the
+// fields of one of the collection's unique indexes. Documents missing any of the fields are not compared. The
+// collection's row is locked first, so concurrent writers to the collection check one at a time.
+func (ss *SQLSession) checkUnique(ctx context.Context, tx *sql.Tx, coll string, id string, body []byte) error {
+	if _, err := tx.ExecContext(ctx, ss.query(`UPDATE collections SET name = name WHERE name = ?`), coll); err != nil {
+		return err
+	}
+	var unique []IndexSpec
+	rows, err := tx.QueryContext(ctx, ss.query(`SELECT spec FROM declared_indexes WHERE coll = ?`), coll)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var data string
+		var spec IndexSpec
+		if err = rows.Scan(&data); err == nil {
+			err = json.Unmarshal([]byte(data), &spec)
+		}
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if spec.Unique {
+			unique = append(unique, spec)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(unique) == 0 {
+		return err
+	}
+	fields := bson.M{}
+	if err := bson.Unmarshal(body, &fields); err != nil {
+		return err
+	}
+	others, err := tx.QueryContext(ctx, ss.query(`SELECT id, body FROM documents WHERE coll = ? AND id <> ?`), coll, id)
+	if err != nil {
+		return err
+	}
+	defer others.Close()
+	for others.Next() {
+		var otherID string
+		var otherBody []byte
+		if err := others.Scan(&otherID, &otherBody); err != nil {
+			return err
+		}
+		other := bson.M{}
+		if err := bson.Unmarshal(otherBody, &other); err != nil {
+			return err
+		}
+		for _, spec := range unique {
+			if sameKey(spec, fields, other) {
+				return fmt.Errorf("%w: document %s has the same %s as %s", ErrDuplicate, id, spec.Name(), otherID)
+			}
+		}
+	}
+	return others.Err()
+}
+
+// sameKey reports whether both documents have every field of the index, with equal values
+func sameKey(spec IndexSpec, fields bson.M, other bson.M) bool {
+	for _, field := range spec.Key {
+		a, ok := fields[field]
+		b, otherOK := other[field]
+		if !ok || !otherOK || !reflect.DeepEqual(a, b) {
+			return false
+		}
+	}
+	return true
+}
+
+// ReplaceDocumentIf replaces the document with the specified ID only while its fields equal the match's values, and
+// fails with ErrNotFound when no document matches. The body that was matched is part of the update's where clause,
+// so a document changed in between is not replaced.
+func (ss *SQLSession) ReplaceDocumentIf(ctx context.Context, coll string, id string, match map[string]interface{}, doc interface{}) error {
+	wanted, err := bsonFields(match)
+	if err != nil {
+		return err
+	}
+	body, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return ss.run(ctx, "ReplaceDocumentIf", ss.cfg.WriteTimeout, func(ctx context.Context, db *sql.DB) error {
+		return inTx(ctx, db, func(tx *sql.Tx) error {
+			if err := ss.checkUnique(ctx, tx, coll, id, body); err != nil {
+				return err
+			}
+			var old []byte
+			err := tx.QueryRowContext(ctx, ss.query(`SELECT body FROM documents WHERE coll = ? AND id = ?`), coll, id).Scan(&old)
+			if err != nil {
+				return err
+			}
+			fields := bson.M{}
+			if err := bson.Unmarshal(old, &fields); err != nil {
+				return err
+			}
+			if !MatchesFields(fields, wanted) {
+				return ErrNotFound
+			}
+			return requireRow(tx.ExecContext(ctx, ss.query(`UPDATE documents SET body = ? WHERE coll = ? AND id = ? AND body = ?`), body, coll, id, old))
+		})
+	})
+}
+
+// DeleteDocumentIf removes the document with the specified ID only while its fields equal the match's values, and
+// fails with ErrNotFound when no document matches. Like ReplaceDocumentIf, it only deletes the body that was matched.
+func (ss *SQLSession) DeleteDocumentIf(ctx context.Context, coll string, id string, match map[string]interface{}) error {
+	wanted, err := bsonFields(match)
+	if err != nil {
+		return err
+	}
+	return ss.run(ctx, "DeleteDocumentIf", ss.cfg.WriteTimeout, func(ctx context.Context, db *sql.DB) error {
+		return inTx(ctx, db, func(tx *sql.Tx) error {
+			var old []byte
+			err := tx.QueryRowContext(ctx, ss.query(`SELECT body FROM documents WHERE coll = ? AND id = ?`), coll, id).Scan(&old)
+			if err != nil {
+				return err
+			}
+			fields := bson.M{}
+			if err := bson.Unmarshal(old, &fields); err != nil {
+				return err
+			}
+			if !MatchesFields(fields, wanted) {
+				return ErrNotFound
+			}
+			return requireRow(tx.ExecContext(ctx, ss.query(`DELETE FROM documents WHERE coll = ? AND id = ? AND body = ?`), coll, id, old))
+		})
+	})
+}
+
+// FetchDocument fetches the document by ID from the specified collection and unmarshals it into result
+func (ss *SQLSession) FetchDocument(ctx context.Context, coll string, id string, result interface{}) error {
+	return ss.run(ctx, "FetchDocument", ss.cfg.ReadTimeout, func(ctx context.Context, db *sql.DB) error {
+		var body []byte
+		if err := db.QueryRowContext(ctx, ss.query(`SELECT body FROM documents WHERE coll = ? AND id = ?`), coll, id).Scan(&body); err != nil {
+			return err
+		}
+		return bson.Unmarshal(body, result)
+	})
+}
+
+// FindDocuments fetches every document in the collection whose fields equal the filter's values, in ID order, and
+// unmarshals them into result, which must be a pointer to a slice. The filter is matched on the decoded documents.
+func (ss *SQLSession) FindDocuments(ctx context.Context, coll string, filter map[string]interface{}, result interface{}) error {
+	wanted, err := bsonFields(filter)
+	if err != nil {
+		return err
+	}
+	return ss.run(ctx, "FindDocuments", ss.cfg.ReadTimeout, func(ctx context.Context, db *sql.DB) error {
+		rows, err := db.QueryContext(ctx, ss.query(`SELECT body FROM documents WHERE coll = ? ORDER BY id`), coll)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		slice := reflect.ValueOf(result).Elem()
+		slice.Set(reflect.MakeSlice(slice.Type(), 0, 0))
+		for rows.Next() {
+			var body []byte
+			if err := rows.Scan(&body); err != nil {
+				return err
+			}
+			fields := bson.M{}
+			if err := bson.Unmarshal(body, &fields); err != nil {
+				return err
+			}
+			if !MatchesFields(fields, wanted) {
+				continue
+			}
+			item := reflect.New(slice.Type().Elem())
+			if err := bson.Unmarshal(body, item.Interface()); err != nil {
+				return err
+			}
+			slice.Set(reflect.Append(slice, item.Elem()))
+		}
+		return rows.Err()
+	})
+}
+
+// bsonFields round trips a filter through BSON so its values compare equal to the decoded fields of a document
+func bsonFields(filter map[string]interface{}) (bson.M, error) {
+	wanted := bson.M{}
+	data, err := bson.Marshal(bson.M(filter))
+	if err == nil {
+		err = bson.Unmarshal(data, &wanted)
+	}
+	return wanted, err
+}
+
+// DeleteDocument removes the document by ID from the specified collection
+func (ss *SQLSession) DeleteDocument(ctx context.Context, coll string, id string) error {
+	return ss.run(ctx, "DeleteDocument", ss.cfg.WriteTimeout, func(ctx context.Context, db *sql.DB) error {
+		return requireRow(db.ExecContext(ctx, ss.query(`DELETE FROM documents WHERE coll = ? AND id = ?`), coll, id))
+	})
+}
+
+// EnsureIndexes records the indexes declared on the collection so ListIndexes and CheckIndexes report them. The schema
+// already indexes the loc columns of every collection, and the unique index on coordinates is always enforced, so
+// there is nothing to build. Unique indexes on documents are enforced by scanning the collection on every document
+// write.
+func (ss *SQLSession) EnsureIndexes(ctx context.Context, coll string, specs []IndexSpec) error {
+	return ss.run(ctx, "EnsureIndexes", ss.cfg.WriteTimeout, func(ctx context.Context, db *sql.DB) error {
+		return inTx(ctx, db, func(tx *sql.Tx) error {
+			if err := ss.touch(ctx, tx, coll); err != nil {
+				return err
+			}
+			for _, spec := range specs {
+				data, err := json.Marshal(spec)
+				if err != nil {
+					return err
+				}
+				_, err = tx.ExecContext(ctx, ss.query(`INSERT INTO declared_indexes (coll, name, spec) VALUES (?, ?, ?) ON CONFLICT (coll, name) DO UPDATE SET spec = excluded.spec`),
+					coll, spec.Name(), string(data))
+				if err != nil {
+					return fmt.Errorf("index %s: %s", spec.Name(), err)
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// ListIndexes returns the indexes declared on the collection, in name order. A missing collection has none.
+func (ss *SQLSession) ListIndexes(ctx context.Context, coll string) ([]IndexSpec, error) {
+	result := []IndexSpec{}
+	err := ss.run(ctx, "ListIndexes", ss.cfg.ReadTimeout, func(ctx context.Context, db *sql.DB) error {
+		rows, err := db.QueryContext(ctx, ss.query(`SELECT spec FROM declared_indexes WHERE coll = ? ORDER BY name`), coll)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var data string
+			if err := rows.Scan(&data); err != nil {
+				return err
+			}
+			var spec IndexSpec
+			if err := json.Unmarshal([]byte(data), &spec); err != nil {
+				return err
+			}
+			result = append(result, spec)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return []IndexSpec{}, err
+	}
+	return result, nil
+}
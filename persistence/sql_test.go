@@ -0,0 +1,57 @@
+package persistence
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"webstuff/types"
+)
+
+func TestNewSQLSession(t *testing.T) {
+	_, err := NewSQLSession(Config{Driver: DriverOfficial}, nil)
+	require.Error(t, err, "Only SQL drivers should be accepted")
+
+	b, err := Open(Config{Driver: DriverSQLite, URL: ":memory:"}, nil)
+	require.NoError(t, err)
+	require.IsType(t, &SQLSession{}, b)
+}
+
+func TestSQLiteFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "hexes.db")
+	loc, _ := types.LocFromString("1.-1.0")
+
+	first, _ := NewSQLSession(Config{Driver: DriverSQLite, URL: path}, nil)
+	require.NoError(t, first.WriteCollection(ctx, testCollection, loc))
+	require.NoError(t, first.Close())
+
+	second, _ := NewSQLSession(Config{Driver: DriverSQLite, URL: path}, nil)
+	defer second.Close()
+	result, err := second.FetchFromCollection(ctx, testCollection, loc.GetID())
+	require.NoError(t, err, "Locs should outlive the session that wrote them")
+	require.Equal(t, loc.ID, result.ID)
+}
+
+func TestSQLUnreachable(t *testing.T) {
+	logBuf := &bytes.Buffer{}
+	path := filepath.Join(t.TempDir(), "missing", "hexes.db")
+	ss, _ := NewSQLSession(Config{Driver: DriverSQLite, URL: path}, log.New(logBuf, "sql_test: ", 0))
+
+	_, err := ss.FetchFromCollection(context.Background(), testCollection, "0.0.0")
+	require.Truef(t, errors.Is(err, ErrUnreachable), "A database that can't be opened should be unreachable. Got: %v", err)
+	require.Contains(t, logBuf.String(), "could not establish database connection")
+	require.Contains(t, logBuf.String(), "FetchFromCollection", "Log message should inform on source of issue")
+}
+
+func TestSQLPlaceholders(t *testing.T) {
+	sqlite, _ := NewSQLSession(Config{Driver: DriverSQLite}, nil)
+	postgres, _ := NewSQLSession(Config{Driver: DriverPostgres}, nil)
+	stmt := `SELECT body FROM locs WHERE coll = ? AND id = ?`
+	require.Equal(t, stmt, sqlite.query(stmt))
+	require.Equal(t, `SELECT body FROM locs WHERE coll = $1 AND id = $2`, postgres.query(stmt))
+}
@@ -0,0 +1,127 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// WorldCollection is where the registry of worlds is kept
+const WorldCollection = "worlds"
+
+// worldPrefix starts the name of every world's loc collection, keeping them apart from other collections
+const worldPrefix = "world_"
+
+// worldUnitPrefix starts the name of every world's unit collection. It differs from worldPrefix so that no world's
+// unit collection can be another world's loc collection.
+const worldUnitPrefix = "units_"
+
+// worldNamePattern limits world names to characters that are safe in a collection name
+var worldNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ErrWorldExists is returned by CreateWorld when the name is already taken
+var ErrWorldExists = errors.New("world already exists")
+
+// World is one independent map. Each world keeps its locs in a collection of its own, so concurrent maps don't
+// collide.
+type World struct {
+	Name       string    `json:"name" bson:"_id"`
+	Collection string    `json:"collection" bson:"collection"`
+	CreatedAt  time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// ValidateWorldName checks that the name can be used for a world
+func ValidateWorldName(name string) error {
+	if !worldNamePattern.MatchString(name) {
+		return fmt.Errorf("world name must be 1 to 64 letters, digits, '_' or '-'. Got: %q", name)
+	}
+	return nil
+}
+
+// WorldCollectionName returns the loc collection for the world with the specified name
+func WorldCollectionName(name string) string {
+	return worldPrefix + name
+}
+
+// WorldUnitCollectionName returns the unit collection for the world with the specified name
+func WorldUnitCollectionName(name string) string {
+	return worldUnitPrefix + name
+}
+
+// CreateWorld registers a world and, when the DAL is an Indexer, sets up the LocIndexes on its collection and the
+// UnitIndexes on its unit collection. The world
+// is inserted, so of two requests creating the same world only one succeeds and the other gets ErrWorldExists. If the
+// indexes can't be set up the world is removed again.
+func CreateWorld(ctx context.Context, mdb MongoAbstraction, name string, now time.Time) (World, error) {
+	if err := ValidateWorldName(name); err != nil {
+		return World{}, err
+	}
+	w := World{Name: name, Collection: WorldCollectionName(name), CreatedAt: now.UTC().Truncate(time.Millisecond)}
+	if err := mdb.InsertDocument(ctx, WorldCollection, name, w); err != nil {
+		if IsDuplicate(err) {
+			return World{}, ErrWorldExists
+		}
+		return World{}, err
+	}
+	if ix, ok := mdb.(Indexer); ok {
+		err := ix.EnsureIndexes(ctx, w.Collection, LocIndexes)
+		if err == nil {
+			err = ix.EnsureIndexes(ctx, WorldUnitCollectionName(name), UnitIndexes)
+		}
+		if err != nil {
+			// removed even when ctx is cancelled, so the name isn't left taken by a world without indexes
+			mdb.DeleteDocument(context.WithoutCancel(ctx), WorldCollection, name)
+			return World{}, fmt.Errorf("could not create indexes for world %s: %s", name, err)
+		}
+	}
+	return w, nil
+}
+
+// FetchWorld returns the registered world with the specified name
+func FetchWorld(ctx context.Context, store DocumentStore, name string) (World, error) {
+	var w World
+	err := store.FetchDocument(ctx, WorldCollection, name, &w)
+	return w, err
+}
+
+// ListWorlds returns every registered world ordered by name
+func ListWorlds(ctx context.Context, store DocumentStore) ([]World, error) {
+	worlds := []World{}
+	if err := store.FindDocuments(ctx, WorldCollection, map[string]interface{}{}, &worlds); err != nil {
+		return nil, err
+	}
+	sort.Slice(worlds, func(i, j int) bool { return worlds[i].Name < worlds[j].Name })
+	return worlds, nil
+}
+
+// LocCollections returns the default loc collection followed by the collection of every registered world
+func LocCollections(ctx context.Context, store DocumentStore, defaultCollection string) ([]string, error) {
+	worlds, err := ListWorlds(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+	result := []string{defaultCollection}
+	for _, w := range worlds {
+		result = append(result, w.Collection)
+	}
+	return result, nil
+}
+
+// DeleteWorld drops the world's loc and unit collections and removes it from the registry. Audit events for the world
+// are kept.
+func DeleteWorld(ctx context.Context, mdb MongoAbstraction, name string) error {
+	w, err := FetchWorld(ctx, mdb, name)
+	if err != nil {
+		return err
+	}
+	if err = mdb.DropCollection(ctx, w.Collection); err != nil {
+		return err
+	}
+	if err = mdb.DropCollection(ctx, WorldUnitCollectionName(name)); err != nil {
+		return err
+	}
+	return mdb.DeleteDocument(ctx, WorldCollection, name)
+}
@@ -0,0 +1,118 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// worldDAL keeps worlds in memory and records which collections were indexed and dropped
+type worldDAL struct {
+	*memDAL
+	worlds    map[string]World
+	indexed   []string
+	dropped   []string
+	failIndex bool
+}
+
+func (wd *worldDAL) EnsureIndexes(ctx context.Context, coll string, specs []IndexSpec) error {
+	if wd.failIndex {
+		return fmt.Errorf("index failed")
+	}
+	wd.indexed = append(wd.indexed, coll)
+	return nil
+}
+
+func (wd *worldDAL) ListIndexes(ctx context.Context, coll string) ([]IndexSpec, error) {
+	return nil, nil
+}
+
+func (wd *worldDAL) DropCollection(ctx context.Context, coll string) error {
+	wd.dropped = append(wd.dropped, coll)
+	return nil
+}
+
+func (wd *worldDAL) SaveDocument(ctx context.Context, coll string, id string, doc interface{}) error {
+	wd.worlds[id] = doc.(World)
+	return nil
+}
+
+func (wd *worldDAL) InsertDocument(ctx context.Context, coll string, id string, doc interface{}) error {
+	if _, ok := wd.worlds[id]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicate, id)
+	}
+	return wd.SaveDocument(ctx, coll, id, doc)
+}
+
+func (wd *worldDAL) FetchDocument(ctx context.Context, coll string, id string, result interface{}) error {
+	w, ok := wd.worlds[id]
+	if !ok {
+		return ErrNotFound
+	}
+	*result.(*World) = w
+	return nil
+}
+
+func (wd *worldDAL) FindDocuments(ctx context.Context, coll string, filter map[string]interface{}, result interface{}) error {
+	worlds := result.(*[]World)
+	for _, w := range wd.worlds {
+		*worlds = append(*worlds, w)
+	}
+	return nil
+}
+
+func (wd *worldDAL) DeleteDocument(ctx context.Context, coll string, id string) error {
+	delete(wd.worlds, id)
+	return nil
+}
+
+func TestWorlds(t *testing.T) {
+	ctx := context.Background()
+	wd := &worldDAL{memDAL: newMemDAL(), worlds: map[string]World{}}
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Create", func(t *testing.T) {
+		w, err := CreateWorld(ctx, wd, "north", now)
+		require.NoError(t, err)
+		require.Equal(t, World{Name: "north", Collection: "world_north", CreatedAt: now}, w)
+		require.Equal(t, []string{"world_north", "units_north"}, wd.indexed, "A new world should get its indexes")
+		_, err = CreateWorld(ctx, wd, "south", now)
+		require.NoError(t, err)
+
+		_, err = CreateWorld(ctx, wd, "north", now.Add(time.Hour))
+		require.Equal(t, ErrWorldExists, err)
+		require.Equal(t, now, wd.worlds["north"].CreatedAt, "The existing world should be kept")
+		for _, bad := range []string{"", "a.b", "$where", "x y"} {
+			_, err = CreateWorld(ctx, wd, bad, now)
+			require.Errorf(t, err, "Should reject world name %q", bad)
+		}
+	})
+	t.Run("Index failure", func(t *testing.T) {
+		wd.failIndex = true
+		defer func() { wd.failIndex = false }()
+		_, err := CreateWorld(ctx, wd, "west", now)
+		require.Error(t, err)
+		require.NotContains(t, wd.worlds, "west", "A world without indexes should be removed")
+	})
+	t.Run("List", func(t *testing.T) {
+		worlds, err := ListWorlds(ctx, wd)
+		require.NoError(t, err)
+		require.Len(t, worlds, 2)
+		require.Equal(t, "north", worlds[0].Name, "Worlds should be ordered by name")
+	})
+	t.Run("Collections", func(t *testing.T) {
+		colls, err := LocCollections(ctx, wd, "testCollection")
+		require.NoError(t, err)
+		require.Equal(t, []string{"testCollection", "world_north", "world_south"}, colls)
+	})
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, DeleteWorld(ctx, wd, "north"))
+		require.Equal(t, []string{"world_north", "units_north"}, wd.dropped)
+		_, err := FetchWorld(ctx, wd, "north")
+		require.Error(t, err)
+		require.Error(t, DeleteWorld(ctx, wd, "north"), "Deleting a missing world should fail")
+	})
+}
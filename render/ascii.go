@@ -0,0 +1,84 @@
+// Package render draws a types.Grid, either as ASCII hex art for terminals and debugging or as SVG.
+package render
+
+import (
+	"bytes"
+	"strings"
+
+	"webstuff/types"
+)
+
+// DefaultGlyphs maps Loc.Status, or the terrain of a loc at the default status, to the character drawn for it in ASCII
+// output. Statuses not listed are drawn with their first letter.
+var DefaultGlyphs = map[string]byte{
+	"new":      '.',
+	"":         '.',
+	"water":    '~',
+	"mountain": '^',
+	"wall":     '#',
+}
+
+// ASCII draws the grid as pointy-top hex art, one text row per row of hexes. Rows are offset by half a hex so that
+// each hex sits between its two neighbors in the rows above and below. Holes in the grid are left blank.
+func ASCII(g *types.Grid, glyphs map[string]byte) string {
+	if glyphs == nil {
+		glyphs = DefaultGlyphs
+	}
+	locs := g.Locs()
+	if len(locs) == 0 {
+		return ""
+	}
+	// doubled width coordinates: each row is shifted half a hex, so a hex is 2 columns wide
+	colMin, colMax := asciiCol(locs[0]), asciiCol(locs[0])
+	rowMin, rowMax := locs[0].Z, locs[0].Z
+	for _, loc := range locs {
+		if col := asciiCol(loc); col < colMin {
+			colMin = col
+		} else if col > colMax {
+			colMax = col
+		}
+		if loc.Z < rowMin {
+			rowMin = loc.Z
+		} else if loc.Z > rowMax {
+			rowMax = loc.Z
+		}
+	}
+	rows := make([][]byte, rowMax-rowMin+1)
+	for i := range rows {
+		rows[i] = bytes.Repeat([]byte{' '}, colMax-colMin+1)
+	}
+	for _, loc := range locs {
+		rows[loc.Z-rowMin][asciiCol(loc)-colMin] = glyph(glyphs, appearance(loc))
+	}
+	var b strings.Builder
+	for _, row := range rows {
+		b.Write(bytes.TrimRight(row, " "))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func asciiCol(loc types.Loc) int {
+	return 2*loc.X + loc.Z
+}
+
+// appearance is the key a loc is drawn by: its status, or its terrain while the status is still the default
+func appearance(loc types.Loc) string {
+	if terrain := loc.Properties.TerrainName(); terrain != "" && loc.Status == types.DefaultStatus {
+		return terrain
+	}
+	return loc.Status
+}
+
+// blankGlyph is drawn for an empty status that the glyph map doesn't cover
+const blankGlyph = '.'
+
+func glyph(glyphs map[string]byte, status string) byte {
+	if g, ok := glyphs[status]; ok {
+		return g
+	}
+	if len(status) == 0 {
+		return blankGlyph
+	}
+	return status[0]
+}
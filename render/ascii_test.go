@@ -0,0 +1,47 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"webstuff/types"
+)
+
+func TestASCII(t *testing.T) {
+	t.Run("Hexagon", func(t *testing.T) {
+		g := types.Grid{}
+		g.BuildHex(1)
+		expected := "" +
+			" . .\n" +
+			". . .\n" +
+			" . .\n"
+		require.Equal(t, expected, ASCII(&g, nil))
+	})
+	t.Run("Status glyphs", func(t *testing.T) {
+		water, _ := types.LocFromString("0.0.0")
+		water.Status = "water"
+		claimed, _ := types.LocFromString("1.-1.0")
+		claimed.Status = "claimed"
+		g := types.GridFromLocs([]types.Loc{water, claimed})
+		require.Equal(t, "~ c\n", ASCII(&g, nil))
+	})
+	t.Run("Terrain glyphs", func(t *testing.T) {
+		mountain, _ := types.LocFromString("0.0.0")
+		mountain.Properties = &types.Properties{Terrain: "mountain"}
+		claimed, _ := types.LocFromString("1.-1.0")
+		claimed.Status = "claimed"
+		claimed.Properties = &types.Properties{Terrain: "mountain"}
+		g := types.GridFromLocs([]types.Loc{mountain, claimed})
+		require.Equal(t, "^ c\n", ASCII(&g, nil), "Terrain should show until the status changes")
+	})
+	t.Run("Empty status without a glyph", func(t *testing.T) {
+		bare, _ := types.LocFromString("0.0.0")
+		bare.Status = ""
+		g := types.GridFromLocs([]types.Loc{bare})
+		require.Equal(t, ".\n", ASCII(&g, map[string]byte{"water": '~'}))
+	})
+	t.Run("Empty", func(t *testing.T) {
+		g := types.Grid{}
+		require.Equal(t, "", ASCII(&g, nil))
+	})
+}
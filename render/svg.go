@@ -0,0 +1,96 @@
+package render
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"math"
+	"strings"
+
+	"webstuff/types"
+)
+
+// DefaultSize is the hex size, center to corner, used when Options.Size is not set
+const DefaultSize float64 = 20
+
+// DefaultColors maps Loc.Status, or the terrain of a loc at the default status, to an SVG fill color. Statuses not
+// listed get a stable color derived from their name.
+var DefaultColors = map[string]string{
+	"new":      "#e0e0e0",
+	"claimed":  "#6a9fd8",
+	"water":    "#3b6fb6",
+	"plains":   "#b5d67a",
+	"hills":    "#a68b5b",
+	"mountain": "#7a7a7a",
+	"wall":     "#333333",
+}
+
+// Options controls SVG output. The zero value draws pointy-top hexes of DefaultSize with DefaultColors.
+type Options struct {
+	Orientation types.Orientation
+	Size        float64
+	Colors      map[string]string
+	Labels      bool
+}
+
+// SVG writes the grid to w as an SVG document sized to fit every hex. Statuses, IDs and colors are escaped, since
+// they come from stored locs and the caller's options.
+func SVG(w io.Writer, g *types.Grid, opts Options) error {
+	if opts.Size <= 0 {
+		opts.Size = DefaultSize
+	}
+	if opts.Colors == nil {
+		opts.Colors = DefaultColors
+	}
+	layout := types.Layout{Orientation: opts.Orientation, Size: opts.Size}
+	locs := g.Locs()
+	polys := make([]string, len(locs))
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for i, loc := range locs {
+		points := make([]string, 0, 6)
+		for _, c := range types.Corners(layout, loc) {
+			minX, maxX = math.Min(minX, c.X), math.Max(maxX, c.X)
+			minY, maxY = math.Min(minY, c.Y), math.Max(maxY, c.Y)
+			points = append(points, fmt.Sprintf("%.2f,%.2f", c.X, c.Y))
+		}
+		polys[i] = strings.Join(points, " ")
+	}
+	if len(locs) == 0 {
+		minX, minY, maxX, maxY = 0, 0, 0, 0
+	}
+
+	_, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="%.2f %.2f %.2f %.2f">`+"\n",
+		minX, minY, maxX-minX, maxY-minY)
+	if err != nil {
+		return err
+	}
+	for i, loc := range locs {
+		_, err = fmt.Fprintf(w, `<polygon points="%s" fill="%s" stroke="#000" stroke-width="1"><title>%s %s</title></polygon>`+"\n",
+			polys[i], html.EscapeString(color(opts.Colors, appearance(loc))), html.EscapeString(loc.ID), html.EscapeString(loc.Status))
+		if err != nil {
+			return err
+		}
+		if opts.Labels {
+			c := types.HexToPixel(layout, loc)
+			_, err = fmt.Fprintf(w, `<text x="%.2f" y="%.2f" font-size="%.2f" text-anchor="middle" dominant-baseline="middle">%s</text>`+"\n",
+				c.X, c.Y, opts.Size/3, html.EscapeString(loc.ID))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, err = io.WriteString(w, "</svg>\n")
+	return err
+}
+
+// color looks up the fill color for a status, falling back to a color hashed from the status name
+func color(colors map[string]string, status string) string {
+	if c, ok := colors[status]; ok {
+		return c
+	}
+	h := fnv.New32a()
+	h.Write([]byte(status))
+	return fmt.Sprintf("#%06x", h.Sum32()&0xffffff)
+}
@@ -0,0 +1,69 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"webstuff/types"
+)
+
+func TestSVG(t *testing.T) {
+	g := types.Grid{}
+	g.BuildHex(1)
+
+	t.Run("Pointy", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		err := SVG(buf, &g, Options{Size: 10})
+		require.NoErrorf(t, err, "Didn't want an error on render. Got: %s", err)
+		require.True(t, strings.HasPrefix(buf.String(), "<svg"))
+		require.Equal(t, 7, strings.Count(buf.String(), "<polygon"))
+		require.Contains(t, buf.String(), `viewBox="-25.98 -25.00 51.96 50.00"`, "Pointy radius 1 hexagon is 3 hexes wide and 2.5 hexes tall")
+		require.Contains(t, buf.String(), `fill="#e0e0e0"`)
+	})
+	t.Run("Flat", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		err := SVG(buf, &g, Options{Orientation: types.FlatTop, Size: 10, Labels: true})
+		require.NoErrorf(t, err, "Didn't want an error on render. Got: %s", err)
+		require.Contains(t, buf.String(), `viewBox="-25.00 -25.98 50.00 51.96"`, "Flat layout is the pointy one turned on its side")
+		require.Equal(t, 7, strings.Count(buf.String(), "<text"))
+	})
+	t.Run("Statuses are escaped", func(t *testing.T) {
+		status := `<&>" </title><script>alert(1)</script>`
+		loc, _ := types.LocFromString("0.0.0")
+		loc.Status = status
+		hostile := types.GridFromLocs([]types.Loc{loc})
+		buf := &bytes.Buffer{}
+		require.NoError(t, SVG(buf, &hostile, Options{Colors: map[string]string{status: `"red`}, Labels: true}))
+		require.NotContains(t, buf.String(), "<script>")
+
+		var titles []string
+		decoder := xml.NewDecoder(buf)
+		inTitle := false
+		for {
+			token, err := decoder.Token()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err, "The SVG should be well formed XML")
+			switch tok := token.(type) {
+			case xml.StartElement:
+				inTitle = tok.Name.Local == "title"
+			case xml.CharData:
+				if inTitle {
+					titles = append(titles, string(tok))
+				}
+			case xml.EndElement:
+				inTitle = false
+			}
+		}
+		require.Equal(t, []string{"0.0.0 " + status}, titles, "The status should read back as it was stored")
+	})
+	t.Run("Unknown status gets a stable color", func(t *testing.T) {
+		require.Equal(t, color(DefaultColors, "lava"), color(DefaultColors, "lava"))
+		require.NotEqual(t, color(DefaultColors, "lava"), color(DefaultColors, "ice"))
+	})
+}
@@ -1,68 +1,372 @@
 package main
 
 import (
-	"strings"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"regexp"
+	"sort"
+	"strconv"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"time"
+	"webstuff/game"
+	"webstuff/mapio"
 	per "webstuff/persistence"
+	"webstuff/persistence/migrations"
+	"webstuff/render"
+	"webstuff/snapshot"
+	"webstuff/terrain"
 	"webstuff/types"
 	"log"
 	"os"
 
 	"github.com/labstack/echo"
-	mgo "gopkg.in/mgo.v2"
 )
 
+// gridNamePattern limits grid names, which are used in collection names, to a safe character set
+var gridNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// gridPrefix starts the collection name of every grid, so no grid name reaches the loc, world, event or other
+// collections
+const gridPrefix = "grid_"
+
+// gridCollection returns the collection holding the grid with the specified name
+func gridCollection(name string) string {
+	return gridPrefix + name
+}
+
+// gridsCollection holds a gridRecord for every grid, claiming its name before any loc is written
+const gridsCollection = "grids"
+
+// gridRecord is the document that claims a grid's name
+type gridRecord struct {
+	Name   string `json:"name" bson:"_id"`
+	Seed   int64  `json:"seed" bson:"seed"`
+	Radius int    `json:"radius" bson:"radius"`
+}
+
+// opaqueStatuses are the Loc.Status values and terrain types that block line of sight
+var opaqueStatuses = map[string]bool{
+	"wall":     true,
+	"mountain": true,
+	"blocked":  true,
+}
+
 const (
 	mongoURL      string = "localhost:27017"
 	dbName        string = "testDB"
 	locCollection string = "testCollection"
+	unitCollection string = per.UnitCollection
+	maxFOVRadius  int    = 30
+	maxGridRadius int    = 60
+	undoDepth     int    = 50
+	maxEditSessions int  = 1000
+)
+
+// mongoConfig selects the mongo driver and limits how long each mongo call may take. Handlers pass the request's
+// context, so a client that disconnects or a request deadline cuts a call short sooner. The driver, URL and DB name
+// are only defaults: loadMongoConfig takes them from the environment and the command line.
+var mongoConfig = per.Config{
+	Driver:       per.DriverOfficial,
+	URL:          mongoURL,
+	DBName:       dbName,
+	DialTimeout:  10 * time.Second,
+	ReadTimeout:  5 * time.Second,
+	WriteTimeout: 5 * time.Second,
+}
+
+// Environment variables that override the defaults in mongoConfig. The --mongo-driver, --mongo-url and --mongo-db
+// flags override them in turn.
+const (
+	envMongoDriver = "HEX_MONGO_DRIVER"
+	envMongoURL    = "HEX_MONGO_URL"
+	envMongoDB     = "HEX_MONGO_DB"
 )
 
 func main() {
 	logger := log.New(os.Stdout, "server: ", log.Ldate|log.Ltime)
-	mdb := per.NewMongoSession(mongoURL, dbName, logger, 10)
-	h, err := NewHandler(mdb)
+	cfg, err := loadMongoConfig(os.Args[1:], os.Getenv)
+	if err != nil {
+		logger.Fatalf("Bad mongo settings: %s", err)
+	}
+	mdb, err := per.Open(cfg, logger)
+	if err != nil {
+		logger.Fatalf("Could not set up mongo: %s", err)
+	}
+	e := NewServer(ServerConfig{Logger: logger}, mdb)
+	defer e.Logger.Fatal(e.Start(":3210"))
+}
+
+// loadMongoConfig returns mongoConfig with the driver, URL and DB name taken from the environment, through getenv, and
+// then from the flags in args
+func loadMongoConfig(args []string, getenv func(string) string) (per.Config, error) {
+	cfg := mongoConfig
+	for env, field := range map[string]*string{envMongoDriver: &cfg.Driver, envMongoURL: &cfg.URL, envMongoDB: &cfg.DBName} {
+		if value := getenv(env); value != "" {
+			*field = value
+		}
+	}
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.StringVar(&cfg.Driver, "mongo-driver", cfg.Driver, "storage driver, official, mgo, sqlite or postgres, or set " + envMongoDriver)
+	fs.StringVar(&cfg.URL, "mongo-url", cfg.URL, "mongo URL, or the SQLite file or postgres DSN, or set " + envMongoURL)
+	fs.StringVar(&cfg.DBName, "mongo-db", cfg.DBName, "mongo DB name, or set " + envMongoDB)
+	if err := fs.Parse(args); err != nil {
+		return per.Config{}, err
+	}
+	return cfg, nil
+}
+
+// ServerConfig holds the settings for NewServer
+type ServerConfig struct {
+	// Logger gets the startup messages. They are discarded when it is nil.
+	Logger *log.Logger
+}
+
+// NewServer prepares the store and returns the router serving every route on it. When the store can be reached, its
+// indexes are ensured and pending migrations run first; otherwise the routes answer that mongo is unavailable until
+// it comes back.
+func NewServer(cfg ServerConfig, store per.Backend) *echo.Echo {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = log.New(ioutil.Discard, "", 0)
+	}
+	ctx := context.Background()
+	if err := store.ConnectToMongo(ctx); err != nil {
+		logger.Printf("Could not connect to mongo at startup: %s", err)
+	} else {
+		ensureIndexes(ctx, store, logger)
+		runMigrations(ctx, store, logger)
+	}
+	h, err := NewHandler(store)
 	if err != nil {
 		panic("Couldn't establish a Handler for some reason")
 	}
+	h.audit = h.audit.Logging(logger)
 	e := echo.New()
-	// set routes here I guess
+	h.routes(e)
+	return e
+}
+
+// Handler encapsulates web handling with persistence. Loc writes go through audit so that every change is recorded,
+// and edits keeps the undo and redo stacks of each editing session.
+type Handler struct {
+	mongoDB per.MongoAbstraction
+	audit   *per.Audited
+	edits   *snapshot.Sessions
+}
+
+const (
+	// actorHeader names the request header identifying who is making a change, for the audit log
+	actorHeader = "X-Actor"
+	// editSessionHeader names the request header identifying a map editor's session, for undo and redo
+	editSessionHeader = "X-Edit-Session"
+	// editKey is where recordEdits keeps the edit being built up during a request
+	editKey = "edit"
+	// collectionKey is where inWorld keeps the loc collection of the world named in the request
+	collectionKey = "collection"
+	// unitCollectionKey is where inWorld keeps the unit collection of the world named in the request
+	unitCollectionKey = "unitCollection"
+)
+
+// routes registers every route of the handler on the router
+func (h Handler) routes(e *echo.Echo) {
 	e.GET("/", h.getDefault)
 	e.GET("loc/:xyz", h.getLocXYZ)
-	e.POST("loc/:xyz", h.postLocXYZ)
+	e.POST("loc/:xyz", h.postLocXYZ, h.recordEdits)
+	e.PUT("loc/:xyz", h.putLocXYZ, h.recordEdits)
+	e.DELETE("loc/:xyz", h.deleteLocXYZ, h.recordEdits)
+	e.GET("locs", h.getLocs)
+	e.GET("export", h.getExport)
+	e.POST("import", h.postImport, h.recordEdits)
+	e.POST("grids", h.postGrid)
+	e.GET("grids/:name/render.svg", h.getGridSVG)
+	e.GET("hexat", h.getHexAt)
+	e.GET("fov/:xyz", h.getFOV)
+	e.GET("loc/:xyz/history", h.getLocHistory)
+	e.GET("loc/:xyz/units", h.getLocUnits)
+	e.POST("units", h.postUnit)
+	e.POST("units/:id/move", h.postUnitMove)
+	e.POST("units/:id/refresh", h.postUnitRefresh)
+	e.POST("games/:id", h.postGame)
+	e.POST("games/:id/actions", h.postGameAction)
+	e.GET("games/:id/state", h.getGameState)
+	e.POST("snapshots", h.postSnapshot)
+	e.POST("snapshots/:id/restore", h.postSnapshotRestore, h.recordEdits)
+	e.GET("snapshots/:id/diff", h.getSnapshotDiff)
+	e.POST("edits/undo", h.postUndo)
+	e.POST("edits/redo", h.postRedo)
+	e.GET("worlds", h.getWorlds)
+	e.POST("worlds/:world", h.postWorld)
+	e.DELETE("worlds/:world", h.deleteWorld)
+	// World scoped routes are registered one by one with inWorld attached, not through a group: echo's Group adds
+	// catch-all routes on its prefix that would shadow POST and DELETE worlds/:world
+	e.GET("worlds/:world/loc/:xyz", h.getLocXYZ, h.inWorld)
+	e.POST("worlds/:world/loc/:xyz", h.postLocXYZ, h.inWorld, h.recordEdits)
+	e.PUT("worlds/:world/loc/:xyz", h.putLocXYZ, h.inWorld, h.recordEdits)
+	e.DELETE("worlds/:world/loc/:xyz", h.deleteLocXYZ, h.inWorld, h.recordEdits)
+	e.GET("worlds/:world/loc/:xyz/history", h.getLocHistory, h.inWorld)
+	e.GET("worlds/:world/locs", h.getLocs, h.inWorld)
+	e.GET("worlds/:world/export", h.getExport, h.inWorld)
+	e.POST("worlds/:world/import", h.postImport, h.inWorld, h.recordEdits)
+	e.GET("worlds/:world/fov/:xyz", h.getFOV, h.inWorld)
+	e.GET("worlds/:world/loc/:xyz/units", h.getLocUnits, h.inWorld)
+	e.POST("worlds/:world/units", h.postUnit, h.inWorld)
+	e.POST("worlds/:world/units/:id/move", h.postUnitMove, h.inWorld)
+	e.POST("worlds/:world/units/:id/refresh", h.postUnitRefresh, h.inWorld)
+	e.POST("worlds/:world/snapshots", h.postSnapshot, h.inWorld)
+	e.POST("worlds/:world/snapshots/:id/restore", h.postSnapshotRestore, h.inWorld, h.recordEdits)
+	e.GET("worlds/:world/snapshots/:id/diff", h.getSnapshotDiff, h.inWorld)
+}
 
-	defer e.Logger.Fatal(e.Start(":3210"))
+// ensureIndexes creates any missing indexes of the default plan and logs collections whose indexes still differ from
+// it
+func ensureIndexes(ctx context.Context, mdb per.Backend, logger *log.Logger) {
+	colls, err := per.LocCollections(ctx, mdb, locCollection)
+	if err != nil {
+		logger.Printf("Could not list collections to index: %s", err)
+		return
+	}
+	reports, err := per.EnsureIndexPlan(ctx, mdb, per.DefaultIndexPlan(colls...))
+	if err != nil {
+		logger.Printf("Could not ensure indexes: %s", err)
+	}
+	for _, r := range reports {
+		if len(r.Extra) > 0 {
+			logger.Printf("Collection %s has %d undeclared indexes", r.Collection, len(r.Extra))
+		}
+	}
 }
 
-// Handler encapsulates web handling with persistence
-type Handler struct {
-	mongoDB per.MongoAbstraction
+// runMigrations brings every loc collection up to date. Failures are logged rather than fatal, since another instance
+// may hold the lock and be running the same migrations.
+func runMigrations(ctx context.Context, mdb per.MongoAbstraction, logger *log.Logger) {
+	colls, err := per.LocCollections(ctx, mdb, locCollection)
+	if err != nil {
+		logger.Printf("Could not list collections to migrate: %s", err)
+		return
+	}
+	host, _ := os.Hostname()
+	results, err := migrations.NewRunner(mdb, fmt.Sprintf("%s:%d", host, os.Getpid())).Run(ctx, colls, false)
+	for _, r := range results {
+		if !r.Skipped {
+			logger.Printf("Applied migration %d (%s) to %s: %d locs changed", r.Version, r.Name, r.Collection, r.Changed)
+		}
+	}
+	if err != nil {
+		logger.Printf("Migrations stopped: %s", err)
+	}
 }
 
 // NewHandler returns a route handler instance with the injected mongo layer
 func NewHandler(mdb per.MongoAbstraction) (result Handler, err error) {
 	h := Handler{
 		mongoDB: mdb,
+		audit:   per.NewAudited(mdb),
+		edits:   snapshot.NewSessions(undoDepth, maxEditSessions),
 	}
 	return h, nil
 }
 
+// writer returns the DAL to make loc changes through, recording them for the actor named in the request and, under
+// recordEdits, adding them to the request's edit
+func (h Handler) writer(c echo.Context) per.MongoAbstraction {
+	w := h.audit
+	if actor := c.Request().Header.Get(actorHeader); actor != "" {
+		w = w.As(actor)
+	}
+	if edit, ok := c.Get(editKey).(*snapshot.Edit); ok {
+		w = w.Observe(edit.Record)
+	}
+	return w
+}
+
+// collection returns the loc collection the request works on: the world's collection under inWorld and the default
+// collection otherwise
+func (h Handler) collection(c echo.Context) string {
+	if coll, ok := c.Get(collectionKey).(string); ok {
+		return coll
+	}
+	return locCollection
+}
+
+// units returns the unit collection the request works on: the world's under inWorld and the default otherwise
+func (h Handler) units(c echo.Context) string {
+	if coll, ok := c.Get(unitCollectionKey).(string); ok {
+		return coll
+	}
+	return unitCollection
+}
+
+// inWorld is middleware for world scoped routes. It checks that the world named by the 'world' param exists and
+// points the request at its loc and unit collections.
+func (h Handler) inWorld(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+		name := c.Param("world")
+		if err := per.ValidateWorldName(name); err != nil {
+			return c.HTML(http.StatusBadRequest, "Bad string for param world")
+		}
+		if err := h.mongoDB.ConnectToMongo(ctx); err != nil {
+			return c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		}
+		world, err := per.FetchWorld(ctx, h.mongoDB, name)
+		if err != nil {
+			if isNotFound(err) {
+				return c.HTML(http.StatusNotFound, fmt.Sprintf("World %s doesn't exist in DB", name))
+			}
+			return mongoError(c, "fetch", err)
+		}
+		c.Set(collectionKey, world.Collection)
+		c.Set(unitCollectionKey, per.WorldUnitCollectionName(world.Name))
+		return next(c)
+	}
+}
+
+// recordEdits is middleware for routes that change locs. When the request names an editing session, every change
+// the route makes is pushed onto that session's undo stack as one edit.
+func (h Handler) recordEdits(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		session := c.Request().Header.Get(editSessionHeader)
+		if session == "" {
+			return next(c)
+		}
+		edit := &snapshot.Edit{}
+		c.Set(editKey, edit)
+		err := next(c)
+		if len(edit.Changes) > 0 {
+			h.edits.Stack(session).Push(*edit)
+		}
+		return err
+	}
+}
+
 func (h Handler) getDefault(c echo.Context) error {
 	return c.HTML(http.StatusOK, "<h2>This is the default page - now with format!</h2>")
 }
 
 func (h Handler) getLocXYZ(c echo.Context) (err error) {
-	locID := c.Param("xyz")
+	ctx := c.Request().Context()
 	var loc types.Loc
-	if err = h.mongoDB.ConnectToMongo(); err != nil {
+	if loc, err = types.LocFromString(c.Param("xyz")); err != nil {
+		err = c.HTML(http.StatusBadRequest, "Bad string for param xyz")
+		return
+	}
+	locID := loc.GetID()
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
 		// TODO: do something with the err info from mongo. Log it?
 		err =  c.HTML(http.StatusFailedDependency, "MongoDB not available")
 		return
 	}
-	if loc, err = h.mongoDB.FetchFromCollection(locCollection, locID); err != nil {
-		// TODO: do something with the err info from mongo. Log it?
-		err = c.HTML(http.StatusNotFound, fmt.Sprintf("%s doesn't exist in DB", locID))
+	if loc, err = h.mongoDB.FetchFromCollection(ctx, h.collection(c), locID); err != nil {
+		// only a fetch that found nothing says the loc doesn't exist
+		if isNotFound(err) {
+			err = c.HTML(http.StatusNotFound, fmt.Sprintf("%s doesn't exist in DB", locID))
+		} else {
+			err = mongoError(c, "fetch", err)
+		}
 		return
 	}
 	err = c.HTML(http.StatusOK, string(loc.JSONForm()))
@@ -70,19 +374,24 @@ func (h Handler) getLocXYZ(c echo.Context) (err error) {
 }
 
 func (h Handler) deleteLocXYZ(c echo.Context) (err error) {
-	locID := c.Param("xyz")
-	if err = h.mongoDB.ConnectToMongo(); err != nil {
+	ctx := c.Request().Context()
+	var loc types.Loc
+	if loc, err = types.LocFromString(c.Param("xyz")); err != nil {
+		err = c.HTML(http.StatusBadRequest, "Bad string for param xyz")
+		return
+	}
+	locID := loc.GetID()
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
 		// TODO: do something with the err info from mongo. Log it?
 		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
 		return
 	}
-	if err = h.mongoDB.DeleteFromCollection(locCollection, locID); err != nil {
+	if err = h.writer(c).DeleteFromCollection(ctx, h.collection(c), locID); err != nil {
 		// TODO: do something with the err info from mongo. Log it?
-		// TODO: branch on not found (404) vs other mongo error (424). 
-		if strings.Contains(err.Error(), "not found") {
+		if isNotFound(err) {
 			err = c.HTML(http.StatusNotFound, fmt.Sprintf("%s doesn't exist in DB", locID))
 		} else {
-			err = c.HTML(http.StatusFailedDependency, fmt.Sprintf("Unknown error on Mongo delete: %v", err))
+			err = mongoError(c, "delete", err)
 		}
 		return
 	}
@@ -91,6 +400,7 @@ func (h Handler) deleteLocXYZ(c echo.Context) (err error) {
 }
 
 func (h Handler) postLocXYZ(c echo.Context) (err error) {
+	ctx := c.Request().Context()
 	locString := c.Param("xyz")
 	var loc types.Loc
 	if loc, err = types.LocFromString(locString); err != nil {
@@ -98,20 +408,964 @@ func (h Handler) postLocXYZ(c echo.Context) (err error) {
 		err = c.HTML(http.StatusBadRequest, "Bad string for param xyz")
 		return
 	}
-	if err = h.mongoDB.ConnectToMongo(); err != nil {
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
 		// TODO: do something with the err info from mongo. Log it?
 		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
 		return
 	}
-	if err = h.mongoDB.WriteCollection(locCollection, loc); err != nil {
+	if err = h.writer(c).WriteCollection(ctx, h.collection(c), loc); err != nil {
 		// TODO: do something with the err info from mongo. Log it?
-		if mgo.IsDup(err) {
+		if per.IsDuplicate(err) {
 			err = c.HTML(http.StatusAlreadyReported, fmt.Sprintf("Duplicate insert for xyz: %s", loc.GetID()))
 			return
 		}
-		err = c.HTML(http.StatusFailedDependency, fmt.Sprintf("Unknown error on Mongo insert: %v", err))
+		err = mongoError(c, "insert", err)
+		return
+	}
+	err = c.HTML(http.StatusOK, fmt.Sprintf("Inserted: %s", loc.GetID()))
+	return
+}
+
+// putLocXYZ sets the status of the loc from the 'status' query param, inserting the loc if it is not yet stored. A
+// stored loc keeps its status without the param, and its properties and attributes either way.
+func (h Handler) putLocXYZ(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	locString := c.Param("xyz")
+	var loc types.Loc
+	if loc, err = types.LocFromString(locString); err != nil {
+		err = c.HTML(http.StatusBadRequest, "Bad string for param xyz")
+		return
+	}
+	status := c.QueryParam("status")
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
+		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		return
+	}
+	stored, err := h.mongoDB.FetchFromCollection(ctx, h.collection(c), loc.GetID())
+	if err == nil {
+		if status != "" {
+			stored.Status = status
+		}
+		if err = h.writer(c).UpdateCollection(ctx, h.collection(c), stored); err != nil {
+			err = mongoError(c, "update", err)
+			return
+		}
+		err = c.HTML(http.StatusOK, fmt.Sprintf("Updated: %s", loc.GetID()))
+		return
+	}
+	if !isNotFound(err) {
+		err = mongoError(c, "fetch", err)
+		return
+	}
+	if status != "" {
+		loc.Status = status
+	}
+	if err = h.writer(c).WriteCollection(ctx, h.collection(c), loc); err != nil {
+		err = mongoError(c, "insert", err)
 		return
 	}
 	err = c.HTML(http.StatusOK, fmt.Sprintf("Inserted: %s", loc.GetID()))
 	return
 }
+
+// getLocs returns the locs in the collection as a JSON array. Query params 'terrain', 'tag' and 'status' narrow the
+// result to matching locs. The 'asof' param, an RFC 3339 timestamp, instead replays the audit log to return the
+// collection as it was at that time.
+func (h Handler) getLocs(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	var locs []types.Loc
+	query := per.LocQuery{Terrain: c.QueryParam("terrain"), Tag: c.QueryParam("tag"), Status: c.QueryParam("status")}
+	var asOf time.Time
+	if param := c.QueryParam("asof"); param != "" {
+		if asOf, err = time.Parse(time.RFC3339, param); err != nil {
+			err = c.HTML(http.StatusBadRequest, "Param asof must be an RFC 3339 timestamp")
+			return
+		}
+	}
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
+		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		return
+	}
+	if !asOf.IsZero() {
+		locs, err = h.audit.StateAt(ctx, h.collection(c), asOf)
+	} else if query.IsEmpty() {
+		locs, err = h.mongoDB.FetchAllFromCollection(ctx, h.collection(c))
+	} else {
+		locs, err = h.mongoDB.QueryCollection(ctx, h.collection(c), query)
+	}
+	if err != nil {
+		err = mongoError(c, "fetch", err)
+		return
+	}
+	err = c.JSON(http.StatusOK, locs)
+	return
+}
+
+// getExport streams every loc in the collection in the format named by the 'format' query param
+func (h Handler) getExport(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	format := c.QueryParam("format")
+	var enc mapio.Encoder
+	if enc, err = mapio.NewEncoder(c.Response(), format); err != nil {
+		err = c.HTML(http.StatusBadRequest, err.Error())
+		return
+	}
+	var locs []types.Loc
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
+		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		return
+	}
+	if locs, err = h.mongoDB.FetchAllFromCollection(ctx, h.collection(c)); err != nil {
+		err = mongoError(c, "fetch", err)
+		return
+	}
+	c.Response().Header().Set(echo.HeaderContentType, mapio.ContentType(format))
+	c.Response().WriteHeader(http.StatusOK)
+	for _, loc := range locs {
+		if err = enc.Encode(loc); err != nil {
+			return
+		}
+	}
+	return enc.Close()
+}
+
+// postImport loads locs from the request body in the format named by the 'format' query param. The 'policy' param
+// picks skip, overwrite or fail for locs that already exist and 'dryrun=true' reports without writing.
+func (h Handler) postImport(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	var policy mapio.Policy
+	if policy, err = mapio.ParsePolicy(c.QueryParam("policy")); err != nil {
+		err = c.HTML(http.StatusBadRequest, err.Error())
+		return
+	}
+	var locs []types.Loc
+	if locs, err = mapio.Decode(c.Request().Body, c.QueryParam("format")); err != nil {
+		err = c.HTML(http.StatusBadRequest, fmt.Sprintf("Bad import data: %v", err))
+		return
+	}
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
+		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		return
+	}
+	opts := mapio.Options{Policy: policy, DryRun: c.QueryParam("dryrun") == "true"}
+	report, err := mapio.Import(mapio.CollectionTarget(ctx, h.writer(c), h.collection(c)), locs, opts)
+	if err != nil {
+		status := mongoErrorStatus(err)
+		if len(report.Conflicts) > 0 && policy == mapio.PolicyFail {
+			status = http.StatusConflict
+		}
+		err = c.JSON(status, map[string]interface{}{"error": err.Error(), "report": report})
+		return
+	}
+	err = c.JSON(http.StatusOK, report)
+	return
+}
+
+// gridSummary is the response body for postGrid
+type gridSummary struct {
+	Name    string         `json:"name"`
+	Seed    int64          `json:"seed"`
+	Radius  int            `json:"radius"`
+	Counts  map[string]int `json:"counts"`
+	Terrain map[string]int `json:"terrain,omitempty"`
+}
+
+// postGrid builds a hex grid and stores it under the name in the 'name' query param, in a collection of its own. With 'generate=noise'
+// every loc gets a terrain property from the seeded generator, so the same 'seed' always yields the same map. Each 'spawn'
+// param names a loc, and the map is rejected unless every spawn can reach all the others. The name is claimed with a
+// gridRecord first, so of two requests creating the same grid only one writes locs. If a write fails the locs already
+// written are deleted again and the name is released.
+func (h Handler) postGrid(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	name := c.QueryParam("name")
+	if !gridNamePattern.MatchString(name) {
+		err = c.HTML(http.StatusBadRequest, "Bad string for param name")
+		return
+	}
+	summary := gridSummary{Name: name, Radius: 10, Counts: map[string]int{}, Terrain: map[string]int{}}
+	if r := c.QueryParam("radius"); r != "" {
+		if summary.Radius, err = strconv.Atoi(r); err != nil || summary.Radius < 0 || summary.Radius > maxGridRadius {
+			err = c.HTML(http.StatusBadRequest, fmt.Sprintf("Param radius must be an integer from 0 to %d", maxGridRadius))
+			return
+		}
+	}
+	if s := c.QueryParam("seed"); s != "" {
+		if summary.Seed, err = strconv.ParseInt(s, 10, 64); err != nil {
+			err = c.HTML(http.StatusBadRequest, "Bad value for param seed")
+			return
+		}
+	}
+	grid := types.Grid{}
+	grid.BuildHex(summary.Radius)
+	switch c.QueryParam("generate") {
+	case "":
+	case "noise":
+		if err = (terrain.Generator{Seed: summary.Seed}).Apply(&grid); err != nil {
+			err = c.HTML(http.StatusInternalServerError, err.Error())
+			return
+		}
+	default:
+		err = c.HTML(http.StatusBadRequest, "Param generate must be one of: noise")
+		return
+	}
+	if params := c.QueryParams()["spawn"]; len(params) > 0 {
+		spawns := make([]types.Loc, len(params))
+		for i, param := range params {
+			if spawns[i], err = types.LocFromString(param); err != nil {
+				err = c.HTML(http.StatusBadRequest, "Bad string for param spawn")
+				return
+			}
+		}
+		if err = terrain.ValidateSpawns(&grid, spawns); err != nil {
+			err = c.HTML(http.StatusUnprocessableEntity, fmt.Sprintf("Generated map rejected: %v", err))
+			return
+		}
+	}
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
+		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		return
+	}
+	record := gridRecord{Name: name, Seed: summary.Seed, Radius: summary.Radius}
+	if err = h.mongoDB.InsertDocument(ctx, gridsCollection, name, record); err != nil {
+		if per.IsDuplicate(err) {
+			err = c.HTML(http.StatusConflict, fmt.Sprintf("Grid %s already exists", name))
+			return
+		}
+		err = mongoError(c, "insert", err)
+		return
+	}
+	coll := gridCollection(name)
+	writer := h.writer(c)
+	var written []types.Loc
+	for _, loc := range grid.Locs() {
+		if err = writer.WriteCollection(ctx, coll, loc); err != nil {
+			// take back what this request wrote, so a failed create doesn't leave part of a grid behind. Done even when
+			// ctx is cancelled, and only this request holds the name, so no other create's locs are touched.
+			cleanup := context.WithoutCancel(ctx)
+			for _, w := range written {
+				writer.DeleteFromCollection(cleanup, coll, w.GetID())
+			}
+			h.mongoDB.DeleteDocument(cleanup, gridsCollection, name)
+			if per.IsDuplicate(err) {
+				err = c.HTML(http.StatusConflict, fmt.Sprintf("Grid %s already holds %s", name, loc.GetID()))
+				return
+			}
+			err = mongoError(c, "insert", err)
+			return
+		}
+		written = append(written, loc)
+		summary.Counts[loc.Status]++
+		if terrain := loc.Properties.TerrainName(); terrain != "" {
+			summary.Terrain[terrain]++
+		}
+	}
+	err = c.JSON(http.StatusCreated, summary)
+	return
+}
+
+// getGridSVG renders every loc of the grid named by the 'name' param as SVG. Query params 'layout' (pointy or
+// flat), 'size' and 'labels=true' control the drawing.
+func (h Handler) getGridSVG(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	name := c.Param("name")
+	if !gridNamePattern.MatchString(name) {
+		err = c.HTML(http.StatusBadRequest, "Bad string for param name")
+		return
+	}
+	opts := render.Options{Labels: c.QueryParam("labels") == "true"}
+	if opts.Orientation, err = types.ParseOrientation(c.QueryParam("layout")); err != nil {
+		err = c.HTML(http.StatusBadRequest, err.Error())
+		return
+	}
+	if size := c.QueryParam("size"); size != "" {
+		if opts.Size, err = strconv.ParseFloat(size, 64); err != nil || opts.Size <= 0 {
+			err = c.HTML(http.StatusBadRequest, "Bad value for param size")
+			return
+		}
+	}
+	var locs []types.Loc
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
+		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		return
+	}
+	if locs, err = h.mongoDB.FetchAllFromCollection(ctx, gridCollection(name)); err != nil {
+		err = mongoError(c, "fetch", err)
+		return
+	}
+	if len(locs) == 0 {
+		err = c.HTML(http.StatusNotFound, fmt.Sprintf("Grid %s doesn't exist in DB", name))
+		return
+	}
+	grid := types.GridFromLocs(locs)
+	c.Response().Header().Set(echo.HeaderContentType, "image/svg+xml")
+	c.Response().WriteHeader(http.StatusOK)
+	return render.SVG(c.Response(), &grid, opts)
+}
+
+// hexHit is the response body for getHexAt
+type hexHit struct {
+	Loc     types.Loc      `json:"loc"`
+	Center  types.Point    `json:"center"`
+	Corners [6]types.Point `json:"corners"`
+}
+
+// getHexAt hit-tests the pixel at query params 'x' and 'y' and returns the loc containing it, along with that hex's
+// center and corners. 'layout' (pointy or flat), 'size' and 'ox'/'oy' origin params describe the client's layout.
+func (h Handler) getHexAt(c echo.Context) (err error) {
+	layout := types.Layout{Size: render.DefaultSize}
+	if layout.Orientation, err = types.ParseOrientation(c.QueryParam("layout")); err != nil {
+		err = c.HTML(http.StatusBadRequest, err.Error())
+		return
+	}
+	var px, py float64
+	params := []struct {
+		name     string
+		target   *float64
+		optional bool
+	}{
+		{"x", &px, false},
+		{"y", &py, false},
+		{"size", &layout.Size, true},
+		{"ox", &layout.Origin.X, true},
+		{"oy", &layout.Origin.Y, true},
+	}
+	for _, p := range params {
+		value := c.QueryParam(p.name)
+		if value == "" && p.optional {
+			continue
+		}
+		if *p.target, err = strconv.ParseFloat(value, 64); err != nil {
+			err = c.HTML(http.StatusBadRequest, fmt.Sprintf("Bad value for param %s", p.name))
+			return
+		}
+	}
+	if layout.Size <= 0 {
+		err = c.HTML(http.StatusBadRequest, "Bad value for param size")
+		return
+	}
+	loc := types.PixelToHex(layout, px, py)
+	err = c.JSON(http.StatusOK, hexHit{
+		Loc:     loc,
+		Center:  types.HexToPixel(layout, loc),
+		Corners: types.Corners(layout, loc),
+	})
+	return
+}
+
+// getFOV returns the locs visible from the loc in the xyz param, out to the 'radius' query param, as a JSON array.
+// Stored statuses and terrain listed in opaqueStatuses block the view.
+func (h Handler) getFOV(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	var origin types.Loc
+	if origin, err = types.LocFromString(c.Param("xyz")); err != nil {
+		err = c.HTML(http.StatusBadRequest, "Bad string for param xyz")
+		return
+	}
+	radius := 1
+	if r := c.QueryParam("radius"); r != "" {
+		if radius, err = strconv.Atoi(r); err != nil || radius < 0 || radius > maxFOVRadius {
+			err = c.HTML(http.StatusBadRequest, fmt.Sprintf("Param radius must be an integer from 0 to %d", maxFOVRadius))
+			return
+		}
+	}
+	var locs []types.Loc
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
+		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		return
+	}
+	if locs, err = h.mongoDB.FetchAllFromCollection(ctx, h.collection(c)); err != nil {
+		err = mongoError(c, "fetch", err)
+		return
+	}
+	grid := types.GridFromLocs(locs)
+	if _, ok := grid.Lookup(origin.GetID()); !ok {
+		err = c.HTML(http.StatusNotFound, fmt.Sprintf("%s doesn't exist in DB", origin.GetID()))
+		return
+	}
+	visible := grid.FieldOfView(origin, radius, func(l types.Loc) bool {
+		return opaqueStatuses[l.Status] || opaqueStatuses[l.Properties.TerrainName()]
+	})
+	result := make([]types.Loc, 0, len(visible))
+	for _, loc := range visible {
+		result = append(result, loc)
+	}
+	sortLocs(result)
+	err = c.JSON(http.StatusOK, result)
+	return
+}
+
+// getLocHistory returns every recorded change to the loc from the 'xyz' param, oldest first
+func (h Handler) getLocHistory(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	var loc types.Loc
+	if loc, err = types.LocFromString(c.Param("xyz")); err != nil {
+		err = c.HTML(http.StatusBadRequest, "Bad string for param xyz")
+		return
+	}
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
+		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		return
+	}
+	var events []per.Event
+	if events, err = h.audit.History(ctx, h.collection(c), loc.GetID()); err != nil {
+		err = mongoError(c, "fetch", err)
+		return
+	}
+	err = c.JSON(http.StatusOK, events)
+	return
+}
+
+// getLocUnits returns the units standing on the loc from the 'xyz' param
+func (h Handler) getLocUnits(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	var loc types.Loc
+	if loc, err = types.LocFromString(c.Param("xyz")); err != nil {
+		err = c.HTML(http.StatusBadRequest, "Bad string for param xyz")
+		return
+	}
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
+		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		return
+	}
+	var units []types.Unit
+	if units, err = h.unitsAt(ctx, h.units(c), loc); err != nil {
+		err = mongoError(c, "fetch", err)
+		return
+	}
+	err = c.JSON(http.StatusOK, units)
+	return
+}
+
+// postUnit places the unit in the JSON body on its position, which must be a stored loc without a unit on it
+func (h Handler) postUnit(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	var body []byte
+	if body, err = ioutil.ReadAll(c.Request().Body); err != nil {
+		err = c.HTML(http.StatusBadRequest, fmt.Sprintf("Bad unit data: %v", err))
+		return
+	}
+	var unit types.Unit
+	if unit, err = types.UnitFromJSON(body); err != nil {
+		err = c.HTML(http.StatusBadRequest, fmt.Sprintf("Bad unit data: %v", err))
+		return
+	}
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
+		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		return
+	}
+	loc, _ := types.LocFromString(unit.Position)
+	var ok bool
+	if ok, err = h.checkUnitTarget(c, unit, loc); !ok {
+		return
+	}
+	// the unique position index catches a unit placed on the same hex since the check
+	if err = h.mongoDB.InsertDocument(ctx, h.units(c), unit.ID, unit); err != nil {
+		if per.IsDuplicate(err) {
+			err = c.HTML(http.StatusConflict, fmt.Sprintf("Unit %s already exists or %s is occupied", unit.ID, unit.Position))
+			return
+		}
+		err = mongoError(c, "insert", err)
+		return
+	}
+	err = c.JSON(http.StatusCreated, unit)
+	return
+}
+
+// postUnitMove moves the unit named by the 'id' param to the loc in the 'to' query param. The move costs the
+// distance travelled from the unit's movement budget.
+func (h Handler) postUnitMove(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	var target types.Loc
+	if target, err = types.LocFromString(c.QueryParam("to")); err != nil {
+		err = c.HTML(http.StatusBadRequest, "Bad string for param to")
+		return
+	}
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
+		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		return
+	}
+	var unit types.Unit
+	if err = h.mongoDB.FetchDocument(ctx, h.units(c), id, &unit); err != nil {
+		if isNotFound(err) {
+			err = c.HTML(http.StatusNotFound, fmt.Sprintf("Unit %s doesn't exist in DB", id))
+			return
+		}
+		err = mongoError(c, "fetch", err)
+		return
+	}
+	var ok bool
+	if ok, err = h.checkUnitTarget(c, unit, target); !ok {
+		return
+	}
+	if err = unit.MoveTo(target); err != nil {
+		err = c.HTML(http.StatusUnprocessableEntity, fmt.Sprintf("Invalid move: %v", err))
+		return
+	}
+	if err = h.mongoDB.SaveDocument(ctx, h.units(c), unit.ID, unit); err != nil {
+		if per.IsDuplicate(err) {
+			err = c.HTML(http.StatusConflict, fmt.Sprintf("%s is occupied", target.StringForm()))
+			return
+		}
+		err = mongoError(c, "save", err)
+		return
+	}
+	err = c.JSON(http.StatusOK, unit)
+	return
+}
+
+// postUnitRefresh restores the full movement budget of the unit named by the 'id' param, for the start of its turn
+func (h Handler) postUnitRefresh(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
+		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		return
+	}
+	var unit types.Unit
+	if err = h.mongoDB.FetchDocument(ctx, h.units(c), id, &unit); err != nil {
+		if isNotFound(err) {
+			err = c.HTML(http.StatusNotFound, fmt.Sprintf("Unit %s doesn't exist in DB", id))
+			return
+		}
+		err = mongoError(c, "fetch", err)
+		return
+	}
+	unit.Refresh()
+	if err = h.mongoDB.SaveDocument(ctx, h.units(c), unit.ID, unit); err != nil {
+		err = mongoError(c, "save", err)
+		return
+	}
+	err = c.JSON(http.StatusOK, unit)
+	return
+}
+
+// checkUnitTarget makes sure the loc a unit is placed on or moved to is stored and holds no other unit. On failure it
+// writes the error response and returns false, with err holding any error from writing that response.
+func (h Handler) checkUnitTarget(c echo.Context, unit types.Unit, target types.Loc) (ok bool, err error) {
+	ctx := c.Request().Context()
+	if _, err = h.mongoDB.FetchFromCollection(ctx, h.collection(c), target.StringForm()); err != nil {
+		if isNotFound(err) {
+			err = c.HTML(http.StatusNotFound, fmt.Sprintf("%s doesn't exist in DB", target.StringForm()))
+			return
+		}
+		err = mongoError(c, "fetch", err)
+		return
+	}
+	var units []types.Unit
+	if units, err = h.unitsAt(ctx, h.units(c), target); err != nil {
+		err = mongoError(c, "fetch", err)
+		return
+	}
+	for _, other := range units {
+		if other.ID != unit.ID {
+			err = c.HTML(http.StatusConflict, fmt.Sprintf("%s is occupied by unit %s", target.StringForm(), other.ID))
+			return
+		}
+	}
+	return true, nil
+}
+
+// unitsAt fetches the units in the collection that stand on the loc
+func (h Handler) unitsAt(ctx context.Context, coll string, loc types.Loc) (units []types.Unit, err error) {
+	units = []types.Unit{}
+	err = h.mongoDB.FindDocuments(ctx, coll, map[string]interface{}{"position": loc.StringForm()}, &units)
+	return
+}
+
+// newGame is the request body for postGame
+type newGame struct {
+	Players     []game.Player `json:"players"`
+	Radius      int           `json:"radius"`
+	Seed        int64         `json:"seed"`
+	Generate    string        `json:"generate"`
+	TurnSeconds int           `json:"turnSeconds"`
+}
+
+// postGame starts a game with the ID from the 'id' param on a freshly built hex map. The JSON body lists the players
+// with their starting locs, the map 'radius', optional 'generate' and 'seed' as for postGrid, and 'turnSeconds'.
+func (h Handler) postGame(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	if !gridNamePattern.MatchString(id) {
+		err = c.HTML(http.StatusBadRequest, "Bad string for param id")
+		return
+	}
+	req := newGame{Radius: 10}
+	if err = json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		err = c.HTML(http.StatusBadRequest, fmt.Sprintf("Bad game data: %v", err))
+		return
+	}
+	if req.Radius < 0 || req.Radius > maxGridRadius || req.TurnSeconds < 0 {
+		err = c.HTML(http.StatusBadRequest, fmt.Sprintf("Game radius must be from 0 to %d and turnSeconds not negative", maxGridRadius))
+		return
+	}
+	grid := types.Grid{}
+	grid.BuildHex(req.Radius)
+	switch req.Generate {
+	case "":
+	case "noise":
+		if err = (terrain.Generator{Seed: req.Seed}).Apply(&grid); err != nil {
+			err = c.HTML(http.StatusInternalServerError, err.Error())
+			return
+		}
+	default:
+		err = c.HTML(http.StatusBadRequest, "Game generate must be one of: noise")
+		return
+	}
+	var session *game.Session
+	if session, err = game.NewSession(id, req.Players, grid, time.Duration(req.TurnSeconds)*time.Second, time.Now()); err != nil {
+		err = c.HTML(http.StatusBadRequest, err.Error())
+		return
+	}
+	spawns := make([]types.Loc, len(session.Players))
+	for i, p := range session.Players {
+		spawns[i], _ = grid.Lookup(p.Position)
+	}
+	if err = terrain.ValidateSpawns(&grid, spawns); err != nil {
+		err = c.HTML(http.StatusUnprocessableEntity, fmt.Sprintf("Game map rejected: %v", err))
+		return
+	}
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
+		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		return
+	}
+	if err = game.Create(ctx, h.mongoDB, session); err != nil {
+		if per.IsDuplicate(err) {
+			err = c.HTML(http.StatusConflict, fmt.Sprintf("Game %s already exists", id))
+			return
+		}
+		err = mongoError(c, "insert", err)
+		return
+	}
+	err = c.JSON(http.StatusCreated, session.State())
+	return
+}
+
+// postGameAction queues the action in the JSON body for the game named by the 'id' param. The response is the game
+// state, which shows the next turn if this action was the last one outstanding.
+func (h Handler) postGameAction(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	var action game.Action
+	if err = json.NewDecoder(c.Request().Body).Decode(&action); err != nil {
+		err = c.HTML(http.StatusBadRequest, fmt.Sprintf("Bad action data: %v", err))
+		return
+	}
+	var session *game.Session
+	if session, err = h.fetchGame(c); session == nil {
+		return
+	}
+	now := time.Now()
+	advanced := session.Tick(now)
+	if submitErr := session.Submit(action, now); submitErr != nil {
+		// a turn that ran out stays over whether or not the action is accepted. If another request saved first, it
+		// saw the same deadline and advanced the turn too.
+		if advanced {
+			if err = game.Save(ctx, h.mongoDB, session); err != nil && err != game.ErrStale {
+				err = mongoError(c, "save", err)
+				return
+			}
+		}
+		switch submitErr {
+		case game.ErrUnknownPlayer:
+			err = c.HTML(http.StatusForbidden, submitErr.Error())
+		case game.ErrAlreadySubmitted:
+			err = c.HTML(http.StatusConflict, submitErr.Error())
+		default:
+			err = c.HTML(http.StatusUnprocessableEntity, fmt.Sprintf("Invalid action: %v", submitErr))
+		}
+		return
+	}
+	if err = game.Save(ctx, h.mongoDB, session); err != nil {
+		if err == game.ErrStale {
+			err = c.HTML(http.StatusConflict, fmt.Sprintf("Game %s was changed by another request, try again", session.ID))
+			return
+		}
+		err = mongoError(c, "save", err)
+		return
+	}
+	err = c.JSON(http.StatusAccepted, session.State())
+	return
+}
+
+// getGameState returns the state of the game named by the 'id' param, first ending the turn if it has timed out
+func (h Handler) getGameState(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	var session *game.Session
+	if session, err = h.fetchGame(c); session == nil {
+		return
+	}
+	if session.Tick(time.Now()) {
+		if err = game.Save(ctx, h.mongoDB, session); err != nil {
+			if err == game.ErrStale {
+				err = c.HTML(http.StatusConflict, fmt.Sprintf("Game %s was changed by another request, try again", session.ID))
+				return
+			}
+			err = mongoError(c, "save", err)
+			return
+		}
+	}
+	err = c.JSON(http.StatusOK, session.State())
+	return
+}
+
+// fetchGame loads the game named by the 'id' param. On failure it writes the error response and returns a nil
+// session, with err holding any error from writing that response.
+func (h Handler) fetchGame(c echo.Context) (session *game.Session, err error) {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	if !gridNamePattern.MatchString(id) {
+		err = c.HTML(http.StatusBadRequest, "Bad string for param id")
+		return
+	}
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
+		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		return
+	}
+	if session, err = game.Load(ctx, h.mongoDB, id); err != nil {
+		if isNotFound(err) {
+			err = c.HTML(http.StatusNotFound, fmt.Sprintf("Game %s doesn't exist in DB", id))
+			return
+		}
+		err = mongoError(c, "fetch", err)
+	}
+	return
+}
+
+// getWorlds lists every world
+func (h Handler) getWorlds(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
+		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		return
+	}
+	var worlds []per.World
+	if worlds, err = per.ListWorlds(ctx, h.mongoDB); err != nil {
+		err = mongoError(c, "fetch", err)
+		return
+	}
+	err = c.JSON(http.StatusOK, worlds)
+	return
+}
+
+// postWorld creates the world named by the 'world' param, with an empty collection of its own
+func (h Handler) postWorld(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	name := c.Param("world")
+	if err = per.ValidateWorldName(name); err != nil {
+		err = c.HTML(http.StatusBadRequest, "Bad string for param world")
+		return
+	}
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
+		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		return
+	}
+	var world per.World
+	if world, err = per.CreateWorld(ctx, h.mongoDB, name, time.Now()); err != nil {
+		if err == per.ErrWorldExists {
+			err = c.HTML(http.StatusConflict, fmt.Sprintf("World %s already exists", name))
+			return
+		}
+		err = mongoError(c, "save", err)
+		return
+	}
+	err = c.JSON(http.StatusCreated, world)
+	return
+}
+
+// deleteWorld removes the world named by the 'world' param along with every loc in it
+func (h Handler) deleteWorld(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	name := c.Param("world")
+	if err = per.ValidateWorldName(name); err != nil {
+		err = c.HTML(http.StatusBadRequest, "Bad string for param world")
+		return
+	}
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
+		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		return
+	}
+	if err = per.DeleteWorld(ctx, h.mongoDB, name); err != nil {
+		if isNotFound(err) {
+			err = c.HTML(http.StatusNotFound, fmt.Sprintf("World %s doesn't exist in DB", name))
+			return
+		}
+		err = mongoError(c, "delete", err)
+		return
+	}
+	err = c.HTML(http.StatusOK, fmt.Sprintf("World %s deleted from DB", name))
+	return
+}
+
+// snapshotSummary is the response body for postSnapshot
+type snapshotSummary struct {
+	ID         string    `json:"id"`
+	Collection string    `json:"collection"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Count      int       `json:"count"`
+}
+
+// postSnapshot copies every loc into a snapshot named by the 'id' query param. Names can't be reused.
+func (h Handler) postSnapshot(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	id := c.QueryParam("id")
+	if !gridNamePattern.MatchString(id) {
+		err = c.HTML(http.StatusBadRequest, "Bad string for param id")
+		return
+	}
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
+		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		return
+	}
+	var snap snapshot.Snapshot
+	if snap, err = snapshot.Take(ctx, h.mongoDB, id, h.collection(c), time.Now()); err != nil {
+		if per.IsDuplicate(err) {
+			err = c.HTML(http.StatusConflict, fmt.Sprintf("Snapshot %s already exists", id))
+			return
+		}
+		err = mongoError(c, "insert", err)
+		return
+	}
+	err = c.JSON(http.StatusCreated, snapshotSummary{ID: snap.ID, Collection: snap.Collection, CreatedAt: snap.CreatedAt, Count: len(snap.Locs)})
+	return
+}
+
+// postSnapshotRestore writes the snapshot named by the 'id' param back over the collection and returns the diff it
+// applied. The restore is one edit, so an editing session can undo it. A loc written by another request while the
+// restore runs makes it a conflict, with nothing restored.
+func (h Handler) postSnapshotRestore(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	var snap snapshot.Snapshot
+	if snap, err = h.fetchSnapshot(c, c.Param("id")); snap.ID == "" {
+		return
+	}
+	var diff snapshot.Diff
+	if diff, err = snapshot.Restore(ctx, h.writer(c), snap); err != nil {
+		if errors.Is(err, snapshot.ErrConflict) {
+			err = c.HTML(http.StatusConflict, fmt.Sprintf("Could not restore snapshot %s: %v", snap.ID, err))
+			return
+		}
+		err = mongoError(c, "restore", err)
+		return
+	}
+	err = c.JSON(http.StatusOK, diff)
+	return
+}
+
+// getSnapshotDiff returns the diff from the snapshot named by the 'id' param to the one named by the 'to' query
+// param, or to the collection as it is now when 'to' is missing
+func (h Handler) getSnapshotDiff(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	var from, to snapshot.Snapshot
+	if from, err = h.fetchSnapshot(c, c.Param("id")); from.ID == "" {
+		return
+	}
+	if other := c.QueryParam("to"); other != "" {
+		if to, err = h.fetchSnapshot(c, other); to.ID == "" {
+			return
+		}
+	} else if to.Locs, err = h.mongoDB.FetchAllFromCollection(ctx, from.Collection); err != nil {
+		err = mongoError(c, "fetch", err)
+		return
+	}
+	err = c.JSON(http.StatusOK, snapshot.Compare(from.Locs, to.Locs))
+	return
+}
+
+// fetchSnapshot loads the snapshot with the specified ID. A snapshot of another collection than the request's is
+// treated as missing, so world scoped routes only reach their own world's snapshots. On failure it writes the error
+// response and returns a snapshot with no ID, with err holding any error from writing that response.
+func (h Handler) fetchSnapshot(c echo.Context, id string) (snap snapshot.Snapshot, err error) {
+	ctx := c.Request().Context()
+	if !gridNamePattern.MatchString(id) {
+		err = c.HTML(http.StatusBadRequest, "Bad string for param id")
+		return
+	}
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
+		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		return
+	}
+	if snap, err = snapshot.Load(ctx, h.mongoDB, id); err == nil && snap.Collection != h.collection(c) {
+		err = per.ErrNotFound
+	}
+	if err != nil {
+		snap = snapshot.Snapshot{}
+		if isNotFound(err) {
+			err = c.HTML(http.StatusNotFound, fmt.Sprintf("Snapshot %s doesn't exist in DB", id))
+			return
+		}
+		err = mongoError(c, "fetch", err)
+	}
+	return
+}
+
+// postUndo reverts the latest edit of the session named by the X-Edit-Session header and returns the changes made. An
+// edit whose locs were written since, by this session or another, is a conflict and is left in place.
+func (h Handler) postUndo(c echo.Context) error {
+	return h.stepEdits(c, (*snapshot.Stack).Undo)
+}
+
+// postRedo reapplies the latest undone edit of the session named by the X-Edit-Session header
+func (h Handler) postRedo(c echo.Context) error {
+	return h.stepEdits(c, (*snapshot.Stack).Redo)
+}
+
+func (h Handler) stepEdits(c echo.Context, step func(*snapshot.Stack, func(snapshot.Edit) error) (snapshot.Edit, error)) (err error) {
+	ctx := c.Request().Context()
+	session := c.Request().Header.Get(editSessionHeader)
+	if session == "" {
+		err = c.HTML(http.StatusBadRequest, fmt.Sprintf("Missing header %s", editSessionHeader))
+		return
+	}
+	if err = h.mongoDB.ConnectToMongo(ctx); err != nil {
+		err = c.HTML(http.StatusFailedDependency, "MongoDB not available")
+		return
+	}
+	w := h.writer(c)
+	var edit snapshot.Edit
+	edit, err = step(h.edits.Stack(session), func(e snapshot.Edit) error {
+		return snapshot.Apply(ctx, w, e.Collection, e.Changes)
+	})
+	switch {
+	case err == nil:
+		err = c.JSON(http.StatusOK, edit)
+	case err == snapshot.ErrNothingToUndo, err == snapshot.ErrNothingToRedo, errors.Is(err, snapshot.ErrConflict):
+		err = c.HTML(http.StatusConflict, err.Error())
+	default:
+		err = mongoError(c, "write", err)
+	}
+	return
+}
+
+// sortLocs orders locs by x then y so responses are stable between calls
+func sortLocs(locs []types.Loc) {
+	sort.Slice(locs, func(i, j int) bool {
+		if locs[i].X != locs[j].X {
+			return locs[i].X < locs[j].X
+		}
+		return locs[i].Y < locs[j].Y
+	})
+}
+
+// mongoErrorStatus maps a failed store operation to its response code: 504 when the request ran out of time waiting on
+// the store and 424 for anything else
+func mongoErrorStatus(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusFailedDependency
+}
+
+// mongoError writes the response for a failed store operation, with op naming the operation in the message
+func mongoError(c echo.Context, op string, err error) error {
+	status := mongoErrorStatus(err)
+	if status == http.StatusGatewayTimeout {
+		return c.HTML(status, fmt.Sprintf("Timed out on Mongo %s: %v", op, err))
+	}
+	return c.HTML(status, fmt.Sprintf("Unknown error on Mongo %s: %v", op, err))
+}
+
+// isNotFound reports whether a mongo error means the target document or collection doesn't exist
+func isNotFound(err error) bool {
+	return per.IsNotFound(err)
+}
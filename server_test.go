@@ -1,31 +1,48 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
 	"net/http"
 	"github.com/labstack/echo"
 	"fmt"
 	"testing"
+	"time"
 	"net/http/httptest"
+	"strings"
 	"github.com/stretchr/testify/require"
+	per "webstuff/persistence"
+	"webstuff/game"
+	"webstuff/persistence/fake"
+	"webstuff/snapshot"
 	"webstuff/types"
 )
 
 func TestWebServesSomething(t* testing.T) {
-	t.Skip()
+	srv := httptest.NewServer(NewServer(ServerConfig{}, fake.New()))
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL + "/")
+	require.NoErrorf(t, err, "Didn't want an error getting the default page. Got: %s", err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	require.Equalf(t, http.StatusOK, resp.StatusCode, "HTTP response should be success")
+	require.Contains(t, string(body), "default page")
 }
 
-func TestGetLocXYZ(t *testing.T) {
-	// Base setup is handler w/mock context and param for xyz. Each case must:
-	//   - get context with target and param value
-	//   - set mock mode flags
-	expectedID := "5.6.7"
-	expectedBody := "set me"
-	mock, handler := NewHandlerWithMockMongo(t)
+// Every case below builds its own handler on a fresh fake store, so the cases can run alone or in any order. The
+// store starts with the default locs from NewHandlerWithFake; a case seeds anything else it needs and scripts the
+// failures it tests with expectations on the store.
 
+func TestGetLocXYZ(t *testing.T) {
 	t.Run("Positive", func(t *testing.T){
-		expectedID = "5.6.7"
+		store, handler := NewHandlerWithFake(t)
+		expectedID := "5.6.7"
 		expectedLoc, _ := types.LocFromString(expectedID)
-		expectedBody = string(expectedLoc.JSONForm())
+		store.Seed(locCollection, expectedLoc)
+		expectedBody := string(expectedLoc.JSONForm())
 		ctx, rec := GetNewEchoContext(echo.GET, "/loc/" + expectedID, "xyz", expectedID )
 
 		err := handler.getLocXYZ(ctx)
@@ -33,10 +50,32 @@ func TestGetLocXYZ(t *testing.T) {
 		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
 		require.Equal(t, expectedBody, rec.Body.String())
 	})
+	t.Run("Alternate coords", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		expectedLoc, _ := types.LocFromString("1.-5.4")
+		store.Seed(locCollection, expectedLoc)
+		expectedBody := string(expectedLoc.JSONForm())
+		ctx, rec := GetNewEchoContext(echo.GET, "/loc/o:3,4", "xyz", "o:3,4" )
+
+		err := handler.getLocXYZ(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on offset coords test. Got: %s", err)
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Equal(t, expectedBody, rec.Body.String(), "Offset coords should be converted to the x.y.z loc")
+	})
+	t.Run("Bad Loc string", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/loc/o:3", "xyz", "o:3" )
+
+		err := handler.getLocXYZ(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on bad loc test. Got: %s", err)
+		require.Equalf(t, http.StatusBadRequest, rec.Code, "HTTP response should be bad request for malformed Loc string")
+		require.Equal(t, "Bad string for param xyz", rec.Body.String())
+		require.Empty(t, store.Calls(), "A bad param should not reach mongo")
+	})
 	t.Run("Missing ID", func(t *testing.T){
-		expectedID = "15.16.17"
-		expectedBody = fmt.Sprintf("%s doesn't exist in DB", expectedID)
-		mock.queryMode = "fail"
+		_, handler := NewHandlerWithFake(t)
+		expectedID := "15.16.17"
+		expectedBody := fmt.Sprintf("%s doesn't exist in DB", expectedID)
 		ctx, rec := GetNewEchoContext(echo.GET, "/loc/" + expectedID, "xyz", expectedID )
 
 		err := handler.getLocXYZ(ctx)
@@ -44,39 +83,73 @@ func TestGetLocXYZ(t *testing.T) {
 		require.Equalf(t, http.StatusNotFound, rec.Code, "HTTP response should be not found")
 		require.Equal(t, expectedBody, rec.Body.String())
 	})
+	t.Run("Cancelled request", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/loc/0.0.0", "xyz", "0.0.0" )
+		reqCtx, cancel := context.WithCancel(context.Background())
+		cancel()
+		ctx.SetRequest(ctx.Request().WithContext(reqCtx))
+
+		err := handler.getLocXYZ(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on cancelled test. Got: %s", err)
+		require.Equalf(t, http.StatusFailedDependency, rec.Code, "A request whose client has gone should not reach mongo")
+		require.Empty(t, store.Calls("FetchFromCollection"))
+	})
+	t.Run("Slow Mongo", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		store.OnFetch("0.0.0").Delay(time.Second)
+		ctx, rec := GetNewEchoContext(echo.GET, "/loc/0.0.0", "xyz", "0.0.0" )
+		reqCtx, cancel := context.WithTimeout(context.Background(), 10 * time.Millisecond)
+		defer cancel()
+		ctx.SetRequest(ctx.Request().WithContext(reqCtx))
+
+		err := handler.getLocXYZ(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on slow mongo test. Got: %s", err)
+		require.Equalf(t, http.StatusGatewayTimeout, rec.Code, "A fetch that outlives the request is not a missing loc")
+		require.Contains(t, rec.Body.String(), "Timed out")
+		require.Len(t, store.Calls("FetchFromCollection"), 1, "The fetch should have been made")
+	})
+	t.Run("Other Mongo error", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		store.OnFetch("0.0.0").Fail(per.ErrUnreachable)
+		ctx, rec := GetNewEchoContext(echo.GET, "/loc/0.0.0", "xyz", "0.0.0" )
+
+		err := handler.getLocXYZ(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on other mongo error test. Got: %s", err)
+		require.Equalf(t, http.StatusFailedDependency, rec.Code, "A fetch that failed is not a missing loc")
+	})
 	t.Run("No Mongo", func(t *testing.T){
-		expectedBody := fmt.Sprintf("MongoDB not available")
-		mock.connectMode = "no connect"
-		ctx, rec := GetNewEchoContext(echo.GET, "/loc/" + expectedID, "xyz", expectedID )
+		store, handler := NewHandlerWithFake(t)
+		store.OnConnect().Fail(errors.New("mocked connection failure"))
+		ctx, rec := GetNewEchoContext(echo.GET, "/loc/0.0.0", "xyz", "0.0.0" )
 
 		err := handler.getLocXYZ(ctx)
 		require.NoErrorf(t, err, "Didn't want an error on no mongo test. Got: %s", err)
 		require.Equalf(t, http.StatusFailedDependency, rec.Code, "HTTP response should be failed dependency")
-		require.Equal(t, expectedBody, rec.Body.String())
+		require.Equal(t, "MongoDB not available", rec.Body.String())
 	})
 }
 
 func TestPostLocXYZ(t *testing.T) {
-	// Base setup is handler w/mock context and param for xyz. Each case must:
-	//   - get context with target and param value
-	//   - set mock mode flags
 	expectedID := "5.6.7"
-	expectedBody := "set me"
-	mock, handler := NewHandlerWithMockMongo(t)
 
 	t.Run("Positive", func(t *testing.T){
-		mock.connectMode = "positive"
-		mock.writeMode = "positive"
+		store, handler := NewHandlerWithFake(t)
 		ctx, rec := GetNewEchoContext(echo.POST, "/loc/" + expectedID, "xyz", expectedID )
 
 		err := handler.postLocXYZ(ctx)
 		require.NoErrorf(t, err, "Didn't want an error on positive test. Got: %s", err)
 		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		writes := store.Calls("WriteCollection")
+		require.Len(t, writes, 1)
+		require.Equal(t, locCollection, writes[0].Collection)
+		require.Equal(t, expectedID, writes[0].ID)
 	})
 	t.Run("Duplicate ID", func(t *testing.T){
-		expectedBody = fmt.Sprintf("Duplicate insert for xyz: %s", expectedID)
-		mock.connectMode = "positive"
-		mock.writeMode = "duplicate"
+		store, handler := NewHandlerWithFake(t)
+		loc, _ := types.LocFromString(expectedID)
+		store.Seed(locCollection, loc)
+		expectedBody := fmt.Sprintf("Duplicate insert for xyz: %s", expectedID)
 		ctx, rec := GetNewEchoContext(echo.POST, "/loc/" + expectedID, "xyz", expectedID )
 
 		err := handler.postLocXYZ(ctx)
@@ -85,22 +158,19 @@ func TestPostLocXYZ(t *testing.T) {
 		require.Equal(t, expectedBody, rec.Body.String())
 	})
 	t.Run("Bad Loc string", func(t *testing.T){
-		expectedBody = fmt.Sprintf("Bad string for param xyz")
+		_, handler := NewHandlerWithFake(t)
 		badID := "a.7.tty"
-		mock.connectMode = "positive"
-		mock.writeMode = "positive"
 		ctx, rec := GetNewEchoContext(echo.POST, "/loc/" + badID, "xyz", badID )
 
 		err := handler.postLocXYZ(ctx)
 		require.NoErrorf(t, err, "Didn't want an error on bad loc test. Got: %s", err)
 		require.Equalf(t, http.StatusBadRequest, rec.Code, "HTTP response should be bad request for malformed Loc string")
-		require.Equal(t, expectedBody, rec.Body.String())
+		require.Equal(t, "Bad string for param xyz", rec.Body.String())
 	})
 	t.Run("Other Mongo error", func(t *testing.T){
-		mockErrorMsg := "Mock error on write"
-		expectedBody = fmt.Sprintf("Unknown error on Mongo insert: %s", mockErrorMsg)
-		mock.connectMode = "positive"
-		mock.writeMode = "fail"
+		store, handler := NewHandlerWithFake(t)
+		store.OnWrite(expectedID).Fail(errors.New("Mock error on write"))
+		expectedBody := "Unknown error on Mongo insert: Mock error on write"
 		ctx, rec := GetNewEchoContext(echo.POST, "/loc/" + expectedID, "xyz", expectedID )
 
 		err := handler.postLocXYZ(ctx)
@@ -109,63 +179,69 @@ func TestPostLocXYZ(t *testing.T) {
 		require.Equal(t, expectedBody, rec.Body.String())
 	})
 	t.Run("No Mongo", func(t *testing.T){
-		expectedBody := fmt.Sprintf("MongoDB not available")
-		mock.connectMode = "no connect"
+		store, handler := NewHandlerWithFake(t)
+		store.OnConnect().Fail(errors.New("mocked connection failure"))
 		ctx, rec := GetNewEchoContext(echo.POST, "/loc/" + expectedID, "xyz", expectedID )
 
 		err := handler.postLocXYZ(ctx)
 		require.NoErrorf(t, err, "Didn't want an error on no mongo test. Got: %s", err)
 		require.Equalf(t, http.StatusFailedDependency, rec.Code, "HTTP response should be failed dependency")
-		require.Equal(t, expectedBody, rec.Body.String())
+		require.Equal(t, "MongoDB not available", rec.Body.String())
+		require.Empty(t, store.Calls("WriteCollection"))
 	})
 }
 
 func TestDeleteLocXYZ(t *testing.T) {
-	// Base setup is handler w/mock context and param for xyz. Each case must:
-	//   - get context with target and param value
-	//   - set mock mode flags
 	expectedID := "5.6.7"
-	expectedBody := "set me"
-	mock, handler := NewHandlerWithMockMongo(t)
 
 	t.Run("Positive", func(t *testing.T){
-		expectedID := "5.6.7"
-		expectedBody = fmt.Sprintf("%s deleted from DB", expectedID)
-		mock.connectMode = "positive"
-		mock.writeMode = "positive"
+		store, handler := NewHandlerWithFake(t)
+		loc, _ := types.LocFromString(expectedID)
+		store.Seed(locCollection, loc)
+		expectedBody := fmt.Sprintf("%s deleted from DB", expectedID)
 		ctx, rec := GetNewEchoContext(echo.DELETE, "/loc/" + expectedID, "xyz", expectedID )
 
 		err := handler.deleteLocXYZ(ctx)
 		require.NoErrorf(t, err, "Didn't want an error on positive test. Got: %s", err)
 		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
 		require.Equalf(t, expectedBody, rec.Body.String(), "Wanted the loc confirmation on delete. Got %s", rec.Body)
+		require.Len(t, store.Locs(locCollection), 3, "Only the deleted loc should be gone")
+	})
+	t.Run("Alternate coords", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		loc, _ := types.LocFromString("2.-1.-1")
+		store.Seed(locCollection, loc)
+		ctx, rec := GetNewEchoContext(echo.DELETE, "/loc/a:2,-1", "xyz", "a:2,-1" )
+
+		err := handler.deleteLocXYZ(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on axial coords test. Got: %s", err)
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Equal(t, "2.-1.-1 deleted from DB", rec.Body.String(), "Axial coords should be converted to the x.y.z loc")
 	})
 	t.Run("Missing ID", func(t *testing.T){
-		expectedID = "15.16.17"
-		expectedBody = fmt.Sprintf("%s doesn't exist in DB", expectedID)
-		mock.writeMode = "missing"
-		ctx, rec := GetNewEchoContext(echo.DELETE, "/loc/" + expectedID, "xyz", expectedID )
+		_, handler := NewHandlerWithFake(t)
+		missingID := "15.16.17"
+		ctx, rec := GetNewEchoContext(echo.DELETE, "/loc/" + missingID, "xyz", missingID )
 
 		err := handler.deleteLocXYZ(ctx)
 		require.NoErrorf(t, err, "Didn't want an error on not found test. Got: %s", err)
 		require.Equalf(t, http.StatusNotFound, rec.Code, "HTTP response should be not found")
-		require.Equal(t, expectedBody, rec.Body.String())
+		require.Equal(t, fmt.Sprintf("%s doesn't exist in DB", missingID), rec.Body.String())
 	})
 	t.Run("No Mongo", func(t *testing.T){
-		expectedBody = "MongoDB not available"
-		mock.connectMode = "no connect"
+		store, handler := NewHandlerWithFake(t)
+		store.OnConnect().Fail(errors.New("mocked connection failure"))
 		ctx, rec := GetNewEchoContext(echo.DELETE, "/loc/" + expectedID, "xyz", expectedID )
 
 		err := handler.deleteLocXYZ(ctx)
 		require.NoErrorf(t, err, "Didn't want an error on no mongo test. Got: %s", err)
 		require.Equalf(t, http.StatusFailedDependency, rec.Code, "HTTP response should be failed dependency")
-		require.Equal(t, expectedBody, rec.Body.String())
+		require.Equal(t, "MongoDB not available", rec.Body.String())
 	})
 	t.Run("Other Mongo error", func(t *testing.T){
-		mockErrorMsg := "Mock error on delete"
-		expectedBody = fmt.Sprintf("Unknown error on Mongo delete: %s", mockErrorMsg)
-		mock.connectMode = "positive"
-		mock.writeMode = "fail"
+		store, handler := NewHandlerWithFake(t)
+		store.OnDelete(expectedID).Fail(errors.New("Mock error on delete"))
+		expectedBody := "Unknown error on Mongo delete: Mock error on delete"
 		ctx, rec := GetNewEchoContext(echo.DELETE, "/loc/" + expectedID, "xyz", expectedID )
 
 		err := handler.deleteLocXYZ(ctx)
@@ -176,23 +252,1187 @@ func TestDeleteLocXYZ(t *testing.T) {
 
 }
 
+func TestPutLocXYZ(t *testing.T) {
+	expectedID := "5.6.7"
+
+	t.Run("Positive", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		loc, _ := types.LocFromString(expectedID)
+		store.Seed(locCollection, loc)
+		ctx, rec := GetNewEchoContext(echo.PUT, "/loc/" + expectedID + "?status=claimed", "xyz", expectedID )
 
-/*** Helper functions ***/
+		err := handler.putLocXYZ(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on positive test. Got: %s", err)
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Equal(t, fmt.Sprintf("Updated: %s", expectedID), rec.Body.String())
+		updated, err := store.FetchFromCollection(context.Background(), locCollection, expectedID)
+		require.NoError(t, err)
+		require.Equal(t, "claimed", updated.Status)
+	})
+	t.Run("Missing ID", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.PUT, "/loc/" + expectedID, "xyz", expectedID )
+
+		err := handler.putLocXYZ(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on insert test. Got: %s", err)
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Equal(t, fmt.Sprintf("Inserted: %s", expectedID), rec.Body.String(), "A missing loc should be inserted")
+		require.Len(t, store.Calls("FetchFromCollection", "WriteCollection"), 2)
+	})
+	t.Run("Properties survive", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		loc, _ := types.LocFromString(expectedID)
+		loc.Status = "claimed"
+		loc.Properties = &types.Properties{Terrain: "forest", Tags: []string{"road"}}
+		loc.Attributes = map[string]interface{}{"owner": "red"}
+		store.Seed(locCollection, loc)
+		ctx, rec := GetNewEchoContext(echo.PUT, "/loc/" + expectedID, "xyz", expectedID )
+
+		err := handler.putLocXYZ(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on properties test. Got: %s", err)
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		updated, err := store.FetchFromCollection(context.Background(), locCollection, expectedID)
+		require.NoError(t, err)
+		require.Equal(t, "claimed", updated.Status, "A put without a status should keep the stored one")
+		require.Equal(t, loc.Properties, updated.Properties)
+		require.Equal(t, "red", updated.Attributes["owner"])
+	})
+	t.Run("Bad Loc string", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		badID := "a.7.tty"
+		ctx, rec := GetNewEchoContext(echo.PUT, "/loc/" + badID, "xyz", badID )
+
+		err := handler.putLocXYZ(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on bad loc test. Got: %s", err)
+		require.Equalf(t, http.StatusBadRequest, rec.Code, "HTTP response should be bad request for malformed Loc string")
+		require.Equal(t, "Bad string for param xyz", rec.Body.String())
+	})
+	t.Run("Other Mongo error", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		loc, _ := types.LocFromString(expectedID)
+		store.Seed(locCollection, loc)
+		store.OnUpdate(expectedID).Fail(errors.New("Mock error on update"))
+		ctx, rec := GetNewEchoContext(echo.PUT, "/loc/" + expectedID, "xyz", expectedID )
+
+		err := handler.putLocXYZ(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on other mongo error test. Got: %s", err)
+		require.Equalf(t, http.StatusFailedDependency, rec.Code, "HTTP response should be failed dependency")
+		require.Equal(t, "Unknown error on Mongo update: Mock error on update", rec.Body.String())
+	})
+	t.Run("Event not recorded", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		loc, _ := types.LocFromString(expectedID)
+		store.Seed(locCollection, loc)
+		store.On("InsertDocument").In(per.EventCollection).Fail(errors.New("Mock error on insert document"))
+		ctx, rec := GetNewEchoContext(echo.PUT, "/loc/" + expectedID + "?status=claimed", "xyz", expectedID )
+
+		err := handler.putLocXYZ(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on unrecorded event test. Got: %s", err)
+		require.Equalf(t, http.StatusOK, rec.Code, "A write that was made should succeed even when its event is lost")
+		updated, err := store.FetchFromCollection(context.Background(), locCollection, expectedID)
+		require.NoError(t, err)
+		require.Equal(t, "claimed", updated.Status)
+	})
+	t.Run("Slow Mongo", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		loc, _ := types.LocFromString(expectedID)
+		store.Seed(locCollection, loc)
+		store.OnUpdate(expectedID).Delay(time.Second)
+		ctx, rec := GetNewEchoContext(echo.PUT, "/loc/" + expectedID + "?status=claimed", "xyz", expectedID )
+		reqCtx, cancel := context.WithTimeout(context.Background(), 10 * time.Millisecond)
+		defer cancel()
+		ctx.SetRequest(ctx.Request().WithContext(reqCtx))
+
+		err := handler.putLocXYZ(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on slow mongo test. Got: %s", err)
+		require.Equalf(t, http.StatusGatewayTimeout, rec.Code, "An update that outlives the request should time out")
+		require.Contains(t, rec.Body.String(), "Timed out on Mongo update")
+	})
+	t.Run("No Mongo", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		store.OnConnect().Fail(errors.New("mocked connection failure"))
+		ctx, rec := GetNewEchoContext(echo.PUT, "/loc/" + expectedID, "xyz", expectedID )
+
+		err := handler.putLocXYZ(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on no mongo test. Got: %s", err)
+		require.Equalf(t, http.StatusFailedDependency, rec.Code, "HTTP response should be failed dependency")
+		require.Equal(t, "MongoDB not available", rec.Body.String())
+	})
+}
+
+func TestGetLocs(t *testing.T) {
+	t.Run("Positive", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/locs", "", "" )
+
+		err := handler.getLocs(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on positive test. Got: %s", err)
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Contains(t, rec.Body.String(), `"id":"1.-1.0"`)
+	})
+	t.Run("Filtered", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/locs?tag=forest", "", "" )
+
+		err := handler.getLocs(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on tag test. Got: %s", err)
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Equal(t, 1, strings.Count(rec.Body.String(), `"id"`))
+		require.Contains(t, rec.Body.String(), `"tags":["forest","road"]`)
+
+		ctx, rec = GetNewEchoContext(echo.GET, "/locs?terrain=water", "", "" )
+		require.NoError(t, handler.getLocs(ctx))
+		require.Contains(t, rec.Body.String(), `"id":"1.-1.0"`)
+		require.Equal(t, 1, strings.Count(rec.Body.String(), `"id"`))
+
+		ctx, rec = GetNewEchoContext(echo.GET, "/locs?terrain=water&tag=forest", "", "" )
+		require.NoError(t, handler.getLocs(ctx))
+		require.Equal(t, "[]\n", rec.Body.String())
+	})
+	t.Run("Filtered Mongo error", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		store.On("QueryCollection").Fail(errors.New("Mock error on query"))
+		ctx, rec := GetNewEchoContext(echo.GET, "/locs?tag=forest", "", "" )
+
+		require.NoError(t, handler.getLocs(ctx))
+		require.Equal(t, "Unknown error on Mongo fetch: Mock error on query", rec.Body.String())
+	})
+	t.Run("Other Mongo error", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		store.On("FetchAllFromCollection").Fail(errors.New("Mock error on get all"))
+		ctx, rec := GetNewEchoContext(echo.GET, "/locs", "", "" )
+
+		err := handler.getLocs(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on other mongo error test. Got: %s", err)
+		require.Equalf(t, http.StatusFailedDependency, rec.Code, "HTTP response should be failed dependency")
+		require.Equal(t, "Unknown error on Mongo fetch: Mock error on get all", rec.Body.String())
+	})
+}
+
+func TestGetExport(t *testing.T) {
+	t.Run("CSV", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/export?format=csv", "", "" )
+
+		err := handler.getExport(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on positive test. Got: %s", err)
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Equal(t, "text/csv", rec.Header().Get(echo.HeaderContentType))
+		require.Equal(t, "id,x,y,z,status\n0.0.0,0,0,0,new\n1.-1.0,1,-1,0,new\n3.-3.0,3,-3,0,new\n", rec.Body.String())
+	})
+	t.Run("Unknown format", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/export?format=xml", "", "" )
+
+		err := handler.getExport(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on bad format test. Got: %s", err)
+		require.Equalf(t, http.StatusBadRequest, rec.Code, "HTTP response should be bad request for unknown format")
+	})
+	t.Run("Other Mongo error", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		store.On("FetchAllFromCollection").Fail(errors.New("Mock error on get all"))
+		ctx, rec := GetNewEchoContext(echo.GET, "/export", "", "" )
+
+		err := handler.getExport(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on other mongo error test. Got: %s", err)
+		require.Equalf(t, http.StatusFailedDependency, rec.Code, "HTTP response should be failed dependency")
+	})
+}
+
+func TestPostImport(t *testing.T) {
+	// 0.0.0 is one of the default locs, 2.-2.0 is new
+	body := "0.0.0,0,0,0,new\n2.-2.0,2,-2,0,new\n"
+
+	t.Run("Skip", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContextWithBody(echo.POST, "/import?format=csv&policy=skip", body)
+
+		err := handler.postImport(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on positive test. Got: %s", err)
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Contains(t, rec.Body.String(), `"inserted":1`)
+		require.Contains(t, rec.Body.String(), `"skipped":1`)
+		require.Len(t, store.Locs(locCollection), 4)
+	})
+	t.Run("Fail on duplicate", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContextWithBody(echo.POST, "/import?format=csv", body)
+
+		err := handler.postImport(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on conflict test. Got: %s", err)
+		require.Equalf(t, http.StatusConflict, rec.Code, "HTTP response should be conflict when the default policy trips")
+		require.Contains(t, rec.Body.String(), `"conflicts":["0.0.0"]`)
+	})
+	t.Run("Bad data", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContextWithBody(echo.POST, "/import?format=csv", "a,b,c,d,e\n")
+
+		err := handler.postImport(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on bad data test. Got: %s", err)
+		require.Equalf(t, http.StatusBadRequest, rec.Code, "HTTP response should be bad request for invalid records")
+	})
+	t.Run("Bad policy", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContextWithBody(echo.POST, "/import?policy=clobber", body)
+
+		err := handler.postImport(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on bad policy test. Got: %s", err)
+		require.Equalf(t, http.StatusBadRequest, rec.Code, "HTTP response should be bad request for unknown policy")
+	})
+	t.Run("No Mongo", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		store.OnConnect().Fail(errors.New("mocked connection failure"))
+		ctx, rec := GetNewEchoContextWithBody(echo.POST, "/import?format=csv", body)
+
+		err := handler.postImport(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on no mongo test. Got: %s", err)
+		require.Equalf(t, http.StatusFailedDependency, rec.Code, "HTTP response should be failed dependency")
+	})
+}
+
+func TestGetGridSVG(t *testing.T) {
+	// withGrid returns a handler holding the grid arena, a copy of the default locs
+	withGrid := func(t *testing.T) (*fake.Store, *Handler) {
+		store, handler := NewHandlerWithFake(t)
+		store.Seed(gridCollection("arena"), store.Locs(locCollection)...)
+		return store, handler
+	}
+
+	t.Run("Positive", func(t *testing.T){
+		_, handler := withGrid(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/grids/arena/render.svg?layout=flat", "name", "arena" )
+
+		err := handler.getGridSVG(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on positive test. Got: %s", err)
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Equal(t, "image/svg+xml", rec.Header().Get(echo.HeaderContentType))
+		require.Equal(t, 3, strings.Count(rec.Body.String(), "<polygon"))
+	})
+	t.Run("Bad name", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/grids/x/render.svg", "name", "$where" )
+
+		err := handler.getGridSVG(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on bad name test. Got: %s", err)
+		require.Equalf(t, http.StatusBadRequest, rec.Code, "HTTP response should be bad request for unsafe names")
+	})
+	t.Run("Bad size", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/grids/arena/render.svg?size=-4", "name", "arena" )
+
+		err := handler.getGridSVG(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on bad size test. Got: %s", err)
+		require.Equalf(t, http.StatusBadRequest, rec.Code, "HTTP response should be bad request for negative size")
+	})
+	t.Run("Only grids", func(t *testing.T){
+		_, handler := withGrid(t)
+		for _, name := range []string{locCollection, per.EventCollection, per.WorldCollection} {
+			ctx, rec := GetNewEchoContext(echo.GET, "/grids/" + name + "/render.svg", "name", name )
+
+			require.NoError(t, handler.getGridSVG(ctx))
+			require.Equalf(t, http.StatusNotFound, rec.Code, "%s is not a grid", name)
+		}
+	})
+	t.Run("Other Mongo error", func(t *testing.T){
+		store, handler := withGrid(t)
+		store.On("FetchAllFromCollection").Fail(errors.New("Mock error on get all"))
+		ctx, rec := GetNewEchoContext(echo.GET, "/grids/arena/render.svg", "name", "arena" )
+
+		err := handler.getGridSVG(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on other mongo error test. Got: %s", err)
+		require.Equalf(t, http.StatusFailedDependency, rec.Code, "HTTP response should be failed dependency")
+	})
+}
+
+func TestGetHexAt(t *testing.T) {
+	t.Run("Pointy", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/hexat?x=17&y=1&size=10", "", "" )
+
+		err := handler.getHexAt(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on positive test. Got: %s", err)
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Contains(t, rec.Body.String(), `"loc":{"id":"1.-1.0"`)
+	})
+	t.Run("Flat with origin", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/hexat?x=100&y=67&size=10&layout=flat&ox=100&oy=50", "", "" )
+
+		err := handler.getHexAt(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on positive test. Got: %s", err)
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Contains(t, rec.Body.String(), `"loc":{"id":"0.-1.1"`)
+	})
+	t.Run("Missing coordinate", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/hexat?x=17", "", "" )
+
+		err := handler.getHexAt(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on bad param test. Got: %s", err)
+		require.Equalf(t, http.StatusBadRequest, rec.Code, "HTTP response should be bad request when y is missing")
+		require.Equal(t, "Bad value for param y", rec.Body.String())
+	})
+	t.Run("Bad layout", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/hexat?x=1&y=1&layout=round", "", "" )
+
+		err := handler.getHexAt(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on bad layout test. Got: %s", err)
+		require.Equalf(t, http.StatusBadRequest, rec.Code, "HTTP response should be bad request for unknown layout")
+	})
+}
+
+func TestGetFOV(t *testing.T) {
+	// the default locs are 0.0.0, 1.-1.0 and 3.-3.0
+	t.Run("Positive", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/fov/0.0.0?radius=1", "xyz", "0.0.0" )
+
+		err := handler.getFOV(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on positive test. Got: %s", err)
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Equal(t, 2, strings.Count(rec.Body.String(), `"id"`), "Radius 1 should only reach the adjacent stored loc")
+	})
+	t.Run("Wider radius", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/fov/0.0.0?radius=3", "xyz", "0.0.0" )
+
+		err := handler.getFOV(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on positive test. Got: %s", err)
+		require.Equal(t, 3, strings.Count(rec.Body.String(), `"id"`))
+	})
+	t.Run("Origin not stored", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/fov/5.-5.0", "xyz", "5.-5.0" )
+
+		err := handler.getFOV(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on not found test. Got: %s", err)
+		require.Equalf(t, http.StatusNotFound, rec.Code, "HTTP response should be not found")
+	})
+	t.Run("Bad radius", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/fov/0.0.0?radius=500", "xyz", "0.0.0" )
+
+		err := handler.getFOV(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on bad radius test. Got: %s", err)
+		require.Equalf(t, http.StatusBadRequest, rec.Code, "HTTP response should be bad request for a huge radius")
+	})
+	t.Run("No Mongo", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		store.OnConnect().Fail(errors.New("mocked connection failure"))
+		ctx, rec := GetNewEchoContext(echo.GET, "/fov/0.0.0", "xyz", "0.0.0" )
+
+		err := handler.getFOV(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on no mongo test. Got: %s", err)
+		require.Equalf(t, http.StatusFailedDependency, rec.Code, "HTTP response should be failed dependency")
+	})
+}
+
+func TestPostGrid(t *testing.T) {
+	postGrid := func(handler *Handler, target string) *httptest.ResponseRecorder {
+		ctx, rec := GetNewEchoContext(echo.POST, target, "", "" )
+		require.NoError(t, handler.postGrid(ctx))
+		return rec
+	}
+
+	t.Run("Plain", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		rec := postGrid(handler, "/grids?name=arena&radius=2")
+
+		require.Equalf(t, http.StatusCreated, rec.Code, "HTTP response should be created")
+		require.Contains(t, rec.Body.String(), `"counts":{"new":19}`)
+		require.Len(t, store.Locs(gridCollection("arena")), 19)
+	})
+	t.Run("Noise is repeatable", func(t *testing.T){
+		_, first := NewHandlerWithFake(t)
+		_, second := NewHandlerWithFake(t)
+		firstRec := postGrid(first, "/grids?name=arena&generate=noise&seed=123")
+		secondRec := postGrid(second, "/grids?name=arena&generate=noise&seed=123")
+
+		require.Equalf(t, http.StatusCreated, firstRec.Code, "HTTP response should be created")
+		var summary gridSummary
+		require.NoError(t, json.Unmarshal(firstRec.Body.Bytes(), &summary))
+		require.Equal(t, map[string]int{types.DefaultStatus: 331}, summary.Counts, "Generating terrain should leave the status alone")
+		total := 0
+		for _, n := range summary.Terrain {
+			total += n
+		}
+		require.Equal(t, 331, total, "Every loc should get a terrain type")
+		require.Equal(t, firstRec.Body.String(), secondRec.Body.String())
+	})
+	t.Run("Generated terrain can be queried", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		rec := postGrid(handler, "/grids?name=arena&generate=noise&seed=123")
+		require.Equalf(t, http.StatusCreated, rec.Code, "HTTP response should be created")
+		var summary gridSummary
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &summary))
+		require.NotZero(t, summary.Terrain["water"], "A radius 10 map should have some water")
+
+		water, err := store.QueryCollection(context.Background(), gridCollection("arena"), per.LocQuery{Terrain: "water"})
+		require.NoError(t, err)
+		require.Len(t, water, summary.Terrain["water"])
+		for _, loc := range water {
+			require.Equal(t, "water", loc.Properties.TerrainName())
+			require.Equal(t, types.DefaultStatus, loc.Status)
+		}
+	})
+	t.Run("Bad params", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		for _, target := range []string{
+			"/grids?radius=2",
+			"/grids?name=arena&radius=-1",
+			"/grids?name=arena&seed=abc",
+			"/grids?name=arena&generate=perlin",
+		} {
+			rec := postGrid(handler, target)
+			require.Equalf(t, http.StatusBadRequest, rec.Code, "HTTP response should be bad request for %s", target)
+		}
+		require.Empty(t, store.Calls(), "Bad params should not reach mongo")
+	})
+	t.Run("Spawns", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		rec := postGrid(handler, "/grids?name=arena&radius=3&spawn=-3.0.3&spawn=3.0.-3")
+		require.Equalf(t, http.StatusCreated, rec.Code, "Open map should pass spawn validation")
+
+		rec = postGrid(handler, "/grids?name=other&radius=3&spawn=-3.0.3&spawn=9.0.-9")
+		require.Equalf(t, http.StatusUnprocessableEntity, rec.Code, "Spawn off the map should be rejected")
+		require.Contains(t, rec.Body.String(), "not on the map")
+
+		rec = postGrid(handler, "/grids?name=other&spawn=0.0")
+		require.Equalf(t, http.StatusBadRequest, rec.Code, "Malformed spawn should be bad request")
+	})
+	t.Run("Duplicate", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		require.Equal(t, http.StatusCreated, postGrid(handler, "/grids?name=arena&radius=1").Code)
+		rec := postGrid(handler, "/grids?name=arena&radius=1")
+
+		require.Equalf(t, http.StatusConflict, rec.Code, "HTTP response should be conflict when the grid already exists")
+		require.Len(t, store.Calls("WriteCollection"), 7, "An existing grid should be caught before writing")
+	})
+	t.Run("Concurrent creates", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		// hold the locs of whichever request claims the name, so the other arrives while the grid is half written
+		store.On("WriteCollection").In(gridCollection("arena")).Delay(time.Millisecond)
+		codes := make(chan int, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				codes <- postGrid(handler, "/grids?name=arena&radius=1").Code
+			}()
+		}
+		got := []int{<-codes, <-codes}
+
+		require.ElementsMatch(t, []int{http.StatusCreated, http.StatusConflict}, got, "Only one request should create the grid")
+		require.Len(t, store.Locs(gridCollection("arena")), 7)
+	})
+	t.Run("Grid without a record", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		loc, _ := types.LocFromString("0.0.0")
+		store.Seed(gridCollection("arena"), loc)
+		rec := postGrid(handler, "/grids?name=arena&radius=1")
+
+		require.Equalf(t, http.StatusConflict, rec.Code, "HTTP response should be conflict when the collection already holds locs")
+		require.Len(t, store.Locs(gridCollection("arena")), 1, "Only the locs this request wrote should be taken back")
+	})
+	t.Run("Other collections are out of reach", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		for _, name := range []string{locCollection, per.EventCollection, per.UnitCollection} {
+			rec := postGrid(handler, "/grids?radius=1&name=" + name)
+			require.Equalf(t, http.StatusCreated, rec.Code, "Grid %s should get a collection of its own", name)
+			require.Len(t, store.Locs(gridCollection(name)), 7)
+		}
+		require.Len(t, store.Locs(locCollection), 3, "The default locs should be left alone")
+	})
+	t.Run("Partial failure", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		store.On("WriteCollection", "1.-1.0").In(gridCollection("arena")).Fail(errors.New("Mock error on write collection")).Once()
+		rec := postGrid(handler, "/grids?name=arena&radius=1")
+
+		require.Equalf(t, http.StatusFailedDependency, rec.Code, "HTTP response should be failed dependency")
+		require.Empty(t, store.Locs(gridCollection("arena")), "The locs written before the failure should be taken back")
+		require.Equalf(t, http.StatusCreated, postGrid(handler, "/grids?name=arena&radius=1").Code, "A failed create should release the name")
+	})
+	t.Run("Other Mongo error", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		store.On("InsertDocument").In(gridsCollection).Fail(errors.New("Mock error on insert document"))
+		rec := postGrid(handler, "/grids?name=arena&radius=1")
+
+		require.Equalf(t, http.StatusFailedDependency, rec.Code, "HTTP response should be failed dependency")
+		require.Empty(t, store.Calls("WriteCollection"), "Nothing should be written when the grid can't be checked")
+	})
+}
+
+func TestLocHistory(t *testing.T) {
+	// withHistory returns a handler that has seen 2.-2.0 inserted by alice and then deleted anonymously
+	withHistory := func(t *testing.T) (*fake.Store, *Handler) {
+		store, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.POST, "/loc/2.-2.0", "xyz", "2.-2.0" )
+		ctx.Request().Header.Set(actorHeader, "alice")
+		require.NoError(t, handler.postLocXYZ(ctx))
+		require.Equal(t, http.StatusOK, rec.Code)
+		ctx, rec = GetNewEchoContext(echo.DELETE, "/loc/2.-2.0", "xyz", "2.-2.0" )
+		require.NoError(t, handler.deleteLocXYZ(ctx))
+		require.Equal(t, http.StatusOK, rec.Code)
+		return store, handler
+	}
+
+	t.Run("Positive", func(t *testing.T){
+		_, handler := withHistory(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/loc/2.-2.0/history", "xyz", "2.-2.0" )
+
+		err := handler.getLocHistory(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on positive test. Got: %s", err)
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		body := rec.Body.String()
+		require.Contains(t, body, `"op":"insert"`)
+		require.Contains(t, body, `"actor":"alice"`)
+		require.Contains(t, body, `"op":"delete"`)
+		require.Contains(t, body, `"actor":"anonymous"`)
+		require.True(t, strings.Index(body, "insert") < strings.Index(body, "delete"), "Events should be oldest first")
+	})
+	t.Run("State as of now", func(t *testing.T){
+		_, handler := withHistory(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/locs?asof=2999-01-01T00:00:00Z", "", "" )
+
+		require.NoError(t, handler.getLocs(ctx))
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Equal(t, "[]\n", rec.Body.String(), "The only loc with history was deleted")
+	})
+	t.Run("Bad asof", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/locs?asof=yesterday", "", "" )
+
+		require.NoError(t, handler.getLocs(ctx))
+		require.Equalf(t, http.StatusBadRequest, rec.Code, "HTTP response should be bad request")
+	})
+	t.Run("Bad Loc string", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/loc/1.-1/history", "xyz", "1.-1" )
+
+		require.NoError(t, handler.getLocHistory(ctx))
+		require.Equalf(t, http.StatusBadRequest, rec.Code, "HTTP response should be bad request")
+	})
+	t.Run("Other Mongo error", func(t *testing.T){
+		store, handler := withHistory(t)
+		store.On("FindDocuments").In(per.EventCollection).Fail(errors.New("Mock error on find documents"))
+		ctx, rec := GetNewEchoContext(echo.GET, "/loc/2.-2.0/history", "xyz", "2.-2.0" )
+
+		require.NoError(t, handler.getLocHistory(ctx))
+		require.Equalf(t, http.StatusFailedDependency, rec.Code, "HTTP response should be failed dependency")
+	})
+}
+
+func TestUnits(t *testing.T) {
+	// withUnits returns a handler on a radius 3 map with the scout standing on 0.0.0
+	withUnits := func(t *testing.T) (*fake.Store, *Handler) {
+		store, handler := NewHandlerWithFake(t)
+		grid := types.Grid{}
+		grid.BuildHex(3)
+		store.Seed(locCollection, grid.Locs()...)
+		require.NoError(t, store.EnsureIndexes(context.Background(), unitCollection, per.UnitIndexes))
+		scout := types.Unit{ID: "scout", Owner: "red", Position: "0.0.0", MovePoints: 3, MovesLeft: 3, HP: 10}
+		require.NoError(t, store.SaveDocument(context.Background(), unitCollection, scout.ID, scout))
+		return store, handler
+	}
+	createUnit := func(handler *Handler, body string) *httptest.ResponseRecorder {
+		ctx, rec := GetNewEchoContextWithBody(echo.POST, "/units", body)
+		require.NoError(t, handler.postUnit(ctx))
+		return rec
+	}
+	moveUnit := func(handler *Handler, id string, to string) *httptest.ResponseRecorder {
+		ctx, rec := GetNewEchoContext(echo.POST, "/units/" + id + "/move?to=" + to, "id", id)
+		require.NoError(t, handler.postUnitMove(ctx))
+		return rec
+	}
+	refreshUnit := func(handler *Handler, id string) *httptest.ResponseRecorder {
+		ctx, rec := GetNewEchoContext(echo.POST, "/units/" + id + "/refresh", "id", id)
+		require.NoError(t, handler.postUnitRefresh(ctx))
+		return rec
+	}
+
+	t.Run("Create", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		rec := createUnit(handler, `{"id": "scout", "owner": "red", "position": "0.0.0", "movePoints": 3, "hp": 10}`)
+		require.Equalf(t, http.StatusCreated, rec.Code, "HTTP response should be created. Body: %s", rec.Body.String())
+		require.Contains(t, rec.Body.String(), `"movesLeft":3`)
+		require.Len(t, store.Calls("InsertDocument"), 1)
+	})
+	t.Run("Create rejects", func(t *testing.T){
+		_, handler := withUnits(t)
+		require.Equal(t, http.StatusConflict, createUnit(handler, `{"id": "scout", "position": "1.-1.0", "movePoints": 3}`).Code, "Duplicate ID")
+		require.Equal(t, http.StatusConflict, createUnit(handler, `{"id": "tank", "position": "0.0.0", "movePoints": 1}`).Code, "Occupied hex")
+		require.Equal(t, http.StatusBadRequest, createUnit(handler, `{"id": "tank", "position": "0.0", "movePoints": 1}`).Code, "Bad position")
+		require.Equal(t, http.StatusNotFound, createUnit(handler, `{"id": "tank", "position": "9.-9.0", "movePoints": 1}`).Code, "Loc not stored")
+	})
+	t.Run("Concurrent creates on one hex", func(t *testing.T){
+		store, handler := withUnits(t)
+		// hold the inserts so that both requests pass the occupancy check before either unit is stored
+		store.On("InsertDocument").In(unitCollection).Delay(50 * time.Millisecond)
+		codes := make(chan int, 2)
+		for _, id := range []string{"tank", "knight"} {
+			go func(id string) {
+				codes <- createUnit(handler, `{"id": "` + id + `", "position": "1.-1.0", "movePoints": 1}`).Code
+			}(id)
+		}
+		got := []int{<-codes, <-codes}
+
+		require.ElementsMatch(t, []int{http.StatusCreated, http.StatusConflict}, got, "Only one unit should get the hex")
+		ctx, rec := GetNewEchoContext(echo.GET, "/loc/1.-1.0/units", "xyz", "1.-1.0")
+		require.NoError(t, handler.getLocUnits(ctx))
+		var units []types.Unit
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &units))
+		require.Len(t, units, 1)
+	})
+	t.Run("Insert fails", func(t *testing.T){
+		store, handler := withUnits(t)
+		store.On("InsertDocument").In(unitCollection).Fail(errors.New("Mock error on insert document"))
+		rec := createUnit(handler, `{"id": "tank", "position": "1.-1.0", "movePoints": 1}`)
+
+		require.Equalf(t, http.StatusFailedDependency, rec.Code, "HTTP response should be failed dependency")
+	})
+	t.Run("Units on a loc", func(t *testing.T){
+		_, handler := withUnits(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/loc/0.0.0/units", "xyz", "0.0.0")
+
+		err := handler.getLocUnits(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on positive test. Got: %s", err)
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Contains(t, rec.Body.String(), `"id":"scout"`)
+
+		ctx, rec = GetNewEchoContext(echo.GET, "/loc/1.-1.0/units", "xyz", "1.-1.0")
+		require.NoError(t, handler.getLocUnits(ctx))
+		require.Equal(t, "[]\n", rec.Body.String(), "Empty hex should have no units")
+	})
+	t.Run("Move", func(t *testing.T){
+		_, handler := withUnits(t)
+		rec := moveUnit(handler, "scout", "2.-1.-1")
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success. Body: %s", rec.Body.String())
+		require.Contains(t, rec.Body.String(), `"position":"2.-1.-1"`)
+		require.Contains(t, rec.Body.String(), `"movesLeft":1`)
+	})
+	t.Run("Move rejects", func(t *testing.T){
+		_, handler := withUnits(t)
+		require.Equal(t, http.StatusOK, moveUnit(handler, "scout", "2.-1.-1").Code, "Spend two of the three move points")
+		require.Equal(t, http.StatusUnprocessableEntity, moveUnit(handler, "scout", "-1.1.0").Code, "Beyond the movement budget")
+		require.Equal(t, http.StatusCreated, createUnit(handler, `{"id": "tank", "position": "3.-2.-1", "movePoints": 1}`).Code)
+		require.Equal(t, http.StatusConflict, moveUnit(handler, "scout", "3.-2.-1").Code, "Occupied hex")
+		require.Equal(t, http.StatusNotFound, moveUnit(handler, "ghost", "0.0.0").Code, "Missing unit")
+		require.Equal(t, http.StatusBadRequest, moveUnit(handler, "scout", "nowhere").Code, "Bad target")
+	})
+	t.Run("Refresh", func(t *testing.T){
+		_, handler := withUnits(t)
+		require.Equal(t, http.StatusOK, moveUnit(handler, "scout", "2.-1.-1").Code, "Spend two of the three move points")
+		require.Equal(t, http.StatusUnprocessableEntity, moveUnit(handler, "scout", "-1.1.0").Code, "Beyond the movement budget")
+
+		rec := refreshUnit(handler, "scout")
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success. Body: %s", rec.Body.String())
+		require.Contains(t, rec.Body.String(), `"movesLeft":3`)
+		rec = moveUnit(handler, "scout", "-1.1.0")
+		require.Equalf(t, http.StatusOK, rec.Code, "A refreshed unit should move its full budget. Body: %s", rec.Body.String())
+		require.Contains(t, rec.Body.String(), `"movesLeft":0`)
+		require.Equal(t, http.StatusNotFound, refreshUnit(handler, "ghost").Code, "Missing unit")
+	})
+	t.Run("No Mongo", func(t *testing.T){
+		store, handler := withUnits(t)
+		store.OnConnect().Fail(errors.New("mocked connection failure"))
+		rec := moveUnit(handler, "scout", "1.-1.0")
+		require.Equalf(t, http.StatusFailedDependency, rec.Code, "HTTP response should be failed dependency")
+	})
+}
+
+func TestGames(t *testing.T) {
+	newGame := `{"radius": 2, "players": [{"id": "red", "position": "-1.1.0"}, {"id": "blue", "position": "1.-1.0"}]}`
+	postGame := func(handler *Handler, id string, body string) *httptest.ResponseRecorder {
+		ctx, rec := GetNewEchoContextWithBody(echo.POST, "/games/" + id, body)
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(id)
+		require.NoError(t, handler.postGame(ctx))
+		return rec
+	}
+	postAction := func(handler *Handler, body string) *httptest.ResponseRecorder {
+		ctx, rec := GetNewEchoContextWithBody(echo.POST, "/games/g1/actions", body)
+		ctx.SetParamNames("id")
+		ctx.SetParamValues("g1")
+		require.NoError(t, handler.postGameAction(ctx))
+		return rec
+	}
+	// withGame returns a handler with game g1 created from newGame
+	withGame := func(t *testing.T) (*fake.Store, *Handler) {
+		store, handler := NewHandlerWithFake(t)
+		require.Equal(t, http.StatusCreated, postGame(handler, "g1", newGame).Code)
+		return store, handler
+	}
+
+	t.Run("Create", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		rec := postGame(handler, "g1", newGame)
+
+		require.Equalf(t, http.StatusCreated, rec.Code, "HTTP response should be created. Body: %s", rec.Body.String())
+		require.Contains(t, rec.Body.String(), `"turn":0`)
+	})
+	t.Run("Create duplicate", func(t *testing.T){
+		_, handler := withGame(t)
+		rec := postGame(handler, "g1", newGame)
+
+		require.Equalf(t, http.StatusConflict, rec.Code, "HTTP response should be conflict")
+	})
+	t.Run("Create with bad players", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		rec := postGame(handler, "g2", `{"radius": 2, "players": [{"id": "red", "position": "9.-9.0"}]}`)
+
+		require.Equalf(t, http.StatusBadRequest, rec.Code, "HTTP response should be bad request")
+	})
+	t.Run("Actions", func(t *testing.T){
+		_, handler := withGame(t)
+		rec := postAction(handler, `{"player": "red", "kind": "move", "target": "-1.0.1"}`)
+		require.Equalf(t, http.StatusAccepted, rec.Code, "HTTP response should be accepted. Body: %s", rec.Body.String())
+		require.Contains(t, rec.Body.String(), `"submitted":["red"]`)
+		require.NotContains(t, rec.Body.String(), `"target"`, "Queued actions should not be revealed")
+
+		require.Equal(t, http.StatusConflict, postAction(handler, `{"player": "red", "kind": "pass"}`).Code)
+		require.Equal(t, http.StatusForbidden, postAction(handler, `{"player": "green", "kind": "pass"}`).Code)
+		require.Equal(t, http.StatusUnprocessableEntity, postAction(handler, `{"player": "blue", "kind": "move", "target": "-2.2.0"}`).Code)
+		require.Equal(t, http.StatusUnprocessableEntity, postAction(handler, `{"player": "blue", "kind": "move", "target": "-1.1.0"}`).Code)
+		require.Equal(t, http.StatusBadRequest, postAction(handler, `{"player": `).Code)
+
+		rec = postAction(handler, `{"player": "blue", "kind": "claim", "target": "1.-1.0"}`)
+		require.Equal(t, http.StatusAccepted, rec.Code)
+		require.Contains(t, rec.Body.String(), `"turn":1`, "Last submission should advance the turn")
+		require.Contains(t, rec.Body.String(), `{"loc":"1.-1.0","player":"blue"}`)
+	})
+	t.Run("State", func(t *testing.T){
+		_, handler := withGame(t)
+		require.Equal(t, http.StatusAccepted, postAction(handler, `{"player": "red", "kind": "move", "target": "-1.0.1"}`).Code)
+		require.Equal(t, http.StatusAccepted, postAction(handler, `{"player": "blue", "kind": "pass"}`).Code)
+		ctx, rec := GetNewEchoContext(echo.GET, "/games/g1/state", "id", "g1")
+
+		err := handler.getGameState(ctx)
+		require.NoErrorf(t, err, "Didn't want an error on positive test. Got: %s", err)
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Contains(t, rec.Body.String(), `{"id":"red","position":"-1.0.1"}`)
+	})
+	t.Run("Missing game", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/games/nope/state", "id", "nope")
+
+		require.NoError(t, handler.getGameState(ctx))
+		require.Equalf(t, http.StatusNotFound, rec.Code, "HTTP response should be not found")
+	})
+	t.Run("Save fails", func(t *testing.T){
+		store, handler := withGame(t)
+		store.On("ReplaceDocumentIf", "g1").Fail(errors.New("Mock error on replace document"))
+		rec := postAction(handler, `{"player": "red", "kind": "pass"}`)
+
+		require.Equalf(t, http.StatusFailedDependency, rec.Code, "HTTP response should be failed dependency")
+	})
+	t.Run("Concurrent actions", func(t *testing.T){
+		store, handler := withGame(t)
+		// hold the saves so that both requests load the game before either saves it
+		store.On("ReplaceDocumentIf", "g1").Delay(50 * time.Millisecond)
+		codes := make(chan int, 2)
+		for _, player := range []string{"red", "blue"} {
+			go func(player string) {
+				ctx, rec := GetNewEchoContextWithBody(echo.POST, "/games/g1/actions", `{"player": "` + player + `", "kind": "pass"}`)
+				ctx.SetParamNames("id")
+				ctx.SetParamValues("g1")
+				handler.postGameAction(ctx)
+				codes <- rec.Code
+			}(player)
+		}
+		got := []int{<-codes, <-codes}
+
+		require.ElementsMatch(t, []int{http.StatusAccepted, http.StatusConflict}, got, "The second save should be refused, not lost")
+		session, err := game.Load(context.Background(), store, "g1")
+		require.NoError(t, err)
+		require.Equal(t, 2, session.Version)
+		require.Equal(t, 1, len(session.State().Submitted), "Only the accepted action should be queued")
+	})
+	t.Run("Expired turn is kept when the action is refused", func(t *testing.T){
+		store, handler := withGame(t)
+		ctx := context.Background()
+		session, err := game.Load(ctx, store, "g1")
+		require.NoError(t, err)
+		session.Deadline = time.Now().Add(-time.Minute)
+		require.NoError(t, game.Save(ctx, store, session))
+
+		require.Equal(t, http.StatusForbidden, postAction(handler, `{"player": "green", "kind": "pass"}`).Code)
+		session, err = game.Load(ctx, store, "g1")
+		require.NoError(t, err)
+		require.Equalf(t, 1, session.Turn, "The turn that ran out should be saved even though the action was refused")
+	})
+	t.Run("No Mongo", func(t *testing.T){
+		store, handler := withGame(t)
+		store.OnConnect().Fail(errors.New("mocked connection failure"))
+		ctx, rec := GetNewEchoContext(echo.GET, "/games/g1/state", "id", "g1")
+
+		require.NoError(t, handler.getGameState(ctx))
+		require.Equalf(t, http.StatusFailedDependency, rec.Code, "HTTP response should be failed dependency")
+	})
+}
+
+func TestSnapshots(t *testing.T) {
+	claimed, _ := types.LocFromString("0.0.0")
+	claimed.Status = "claimed"
+	added, _ := types.LocFromString("2.-2.0")
+	edited := snapshot.Snapshot{ID: "edited", Collection: locCollection, Locs: []types.Loc{claimed, added}}
+	postSnapshot := func(handler *Handler, id string) *httptest.ResponseRecorder {
+		ctx, rec := GetNewEchoContext(echo.POST, "/snapshots?id=" + id, "", "")
+		require.NoError(t, handler.postSnapshot(ctx))
+		return rec
+	}
+	// withSnapshots returns a handler holding the edited snapshot and, taken from the default locs, the base one
+	withSnapshots := func(t *testing.T) (*fake.Store, *Handler) {
+		store, handler := NewHandlerWithFake(t)
+		require.NoError(t, store.SaveDocument(context.Background(), snapshot.Collection, edited.ID, edited))
+		require.Equal(t, http.StatusCreated, postSnapshot(handler, "base").Code)
+		return store, handler
+	}
+
+	t.Run("Create", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		rec := postSnapshot(handler, "base")
+
+		require.Equalf(t, http.StatusCreated, rec.Code, "HTTP response should be created")
+		require.Contains(t, rec.Body.String(), `"count":3`)
+	})
+	t.Run("Create duplicate", func(t *testing.T){
+		_, handler := withSnapshots(t)
+		rec := postSnapshot(handler, "base")
+
+		require.Equalf(t, http.StatusConflict, rec.Code, "HTTP response should be conflict")
+	})
+	t.Run("Diff", func(t *testing.T){
+		_, handler := withSnapshots(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/snapshots/base/diff?to=edited", "id", "base")
+
+		require.NoError(t, handler.getSnapshotDiff(ctx))
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		var diff snapshot.Diff
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &diff))
+		require.Equal(t, []types.Loc{added}, diff.Added)
+		require.Len(t, diff.Removed, 2)
+		require.Len(t, diff.Changed, 1)
+		require.Equal(t, "claimed", diff.Changed[0].After.Status)
+	})
+	t.Run("Diff against current", func(t *testing.T){
+		_, handler := withSnapshots(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/snapshots/base/diff", "id", "base")
+
+		require.NoError(t, handler.getSnapshotDiff(ctx))
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Equal(t, `{"added":[],"removed":[],"changed":[]}`+"\n", rec.Body.String())
+	})
+	t.Run("Restore and undo", func(t *testing.T){
+		store, handler := withSnapshots(t)
+		ctx, rec := GetNewEchoContext(echo.POST, "/snapshots/edited/restore", "id", "edited")
+		ctx.Request().Header.Set(editSessionHeader, "s1")
+
+		require.NoError(t, handler.recordEdits(handler.postSnapshotRestore)(ctx))
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Contains(t, rec.Body.String(), `"2.-2.0"`)
+		require.Equal(t, []types.Loc{claimed, added}, store.Locs(locCollection), "The collection should match the snapshot")
+		undo, _ := handler.edits.Stack("s1").Depth()
+		require.Equal(t, 1, undo, "The restore should be one edit")
+
+		ctx, rec = GetNewEchoContext(echo.POST, "/edits/undo", "", "")
+		ctx.Request().Header.Set(editSessionHeader, "s1")
+		require.NoError(t, handler.postUndo(ctx))
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Contains(t, rec.Body.String(), `"changes"`)
+		require.Len(t, store.Locs(locCollection), 3, "Undo should bring back the default locs")
+
+		ctx, rec = GetNewEchoContext(echo.POST, "/edits/undo", "", "")
+		ctx.Request().Header.Set(editSessionHeader, "s1")
+		require.NoError(t, handler.postUndo(ctx))
+		require.Equalf(t, http.StatusConflict, rec.Code, "Nothing should be left to undo")
+
+		ctx, rec = GetNewEchoContext(echo.POST, "/edits/redo", "", "")
+		ctx.Request().Header.Set(editSessionHeader, "s1")
+		require.NoError(t, handler.postRedo(ctx))
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+	})
+	t.Run("Loc edits", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.POST, "/loc/4.-4.0", "xyz", "4.-4.0")
+		ctx.Request().Header.Set(editSessionHeader, "s2")
+		require.NoError(t, handler.recordEdits(handler.postLocXYZ)(ctx))
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
 
-func NewHandlerWithMockMongo(t *testing.T) (*MockMongoSession, *Handler) {
-	mock := &MockMongoSession{
-		connectMode: "positive",
-		queryMode: "positive",
+		ctx, rec = GetNewEchoContext(echo.POST, "/edits/undo", "", "")
+		ctx.Request().Header.Set(editSessionHeader, "s2")
+		require.NoError(t, handler.postUndo(ctx))
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Contains(t, rec.Body.String(), `"before":{"id":"4.-4.0"`, "Undoing an insert should remove the loc")
+		require.NotContains(t, rec.Body.String(), `"after"`)
+		require.Len(t, store.Calls("DeleteFromCollection"), 1)
+	})
+	t.Run("Undo after another write", func(t *testing.T){
+		store, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.POST, "/loc/4.-4.0", "xyz", "4.-4.0")
+		ctx.Request().Header.Set(editSessionHeader, "s3")
+		require.NoError(t, handler.recordEdits(handler.postLocXYZ)(ctx))
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		changed, _ := types.LocFromString("4.-4.0")
+		changed.Status = "claimed"
+		require.NoError(t, store.UpdateCollection(context.Background(), locCollection, changed))
+
+		ctx, rec = GetNewEchoContext(echo.POST, "/edits/undo", "", "")
+		ctx.Request().Header.Set(editSessionHeader, "s3")
+		require.NoError(t, handler.postUndo(ctx))
+		require.Equalf(t, http.StatusConflict, rec.Code, "Undo should not revert another write")
+		require.Empty(t, store.Calls("DeleteFromCollection"))
+		undo, _ := handler.edits.Stack("s3").Depth()
+		require.Equal(t, 1, undo, "The edit should stay undoable")
+	})
+	t.Run("Missing session", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.POST, "/edits/undo", "", "")
+
+		require.NoError(t, handler.postUndo(ctx))
+		require.Equalf(t, http.StatusBadRequest, rec.Code, "HTTP response should be bad request")
+	})
+	t.Run("Missing snapshot", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.POST, "/snapshots/nope/restore", "id", "nope")
+
+		require.NoError(t, handler.postSnapshotRestore(ctx))
+		require.Equalf(t, http.StatusNotFound, rec.Code, "HTTP response should be not found")
+	})
+	t.Run("Bad id", func(t *testing.T){
+		_, handler := withSnapshots(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/snapshots/base/diff?to=a.b", "id", "base")
+
+		require.NoError(t, handler.getSnapshotDiff(ctx))
+		require.Equalf(t, http.StatusBadRequest, rec.Code, "HTTP response should be bad request")
+	})
+	t.Run("Other Mongo error", func(t *testing.T){
+		store, handler := withSnapshots(t)
+		for _, method := range []string{"WriteCollection", "UpdateCollection", "DeleteFromCollection"} {
+			store.On(method).Fail(errors.New("Mock error on " + method))
+		}
+		ctx, rec := GetNewEchoContext(echo.POST, "/snapshots/edited/restore", "id", "edited")
+
+		require.NoError(t, handler.postSnapshotRestore(ctx))
+		require.Equalf(t, http.StatusFailedDependency, rec.Code, "HTTP response should be failed dependency")
+	})
+}
+
+func TestLoadMongoConfig(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(name string) string { return vars[name] }
 	}
-	handler, err := NewHandler(mock)
+
+	t.Run("Defaults", func(t *testing.T){
+		cfg, err := loadMongoConfig(nil, env(nil))
+		require.NoError(t, err)
+		require.Equal(t, mongoConfig, cfg)
+	})
+	t.Run("Environment", func(t *testing.T){
+		cfg, err := loadMongoConfig(nil, env(map[string]string{envMongoDriver: per.DriverMgo, envMongoURL: "db.example:27017", envMongoDB: "hexes"}))
+		require.NoError(t, err)
+		require.Equal(t, per.DriverMgo, cfg.Driver)
+		require.Equal(t, "db.example:27017", cfg.URL)
+		require.Equal(t, "hexes", cfg.DBName)
+		require.Equal(t, mongoConfig.ReadTimeout, cfg.ReadTimeout, "Timeouts should keep their defaults")
+	})
+	t.Run("Flags over environment", func(t *testing.T){
+		args := []string{"--mongo-driver", "sqlite", "--mongo-url", "/tmp/hexes.db"}
+		cfg, err := loadMongoConfig(args, env(map[string]string{envMongoDriver: per.DriverMgo, envMongoDB: "hexes"}))
+		require.NoError(t, err)
+		require.Equal(t, "sqlite", cfg.Driver)
+		require.Equal(t, "/tmp/hexes.db", cfg.URL)
+		require.Equal(t, "hexes", cfg.DBName, "Settings without a flag should come from the environment")
+	})
+	t.Run("Bad flag", func(t *testing.T){
+		_, err := loadMongoConfig([]string{"--mongo-port", "1"}, env(nil))
+		require.Error(t, err)
+	})
+}
+
+func TestWorlds(t *testing.T) {
+	postWorld := func(handler *Handler, name string) *httptest.ResponseRecorder {
+		ctx, rec := GetNewEchoContext(echo.POST, "/worlds/" + name, "world", name)
+		require.NoError(t, handler.postWorld(ctx))
+		return rec
+	}
+	// withWorld returns a handler with the world north created
+	withWorld := func(t *testing.T) (*fake.Store, *Handler) {
+		store, handler := NewHandlerWithFake(t)
+		require.Equal(t, http.StatusCreated, postWorld(handler, "north").Code)
+		return store, handler
+	}
+
+	t.Run("Create", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		rec := postWorld(handler, "north")
+
+		require.Equalf(t, http.StatusCreated, rec.Code, "HTTP response should be created")
+		require.Contains(t, rec.Body.String(), `"collection":"world_north"`)
+	})
+	t.Run("Create duplicate", func(t *testing.T){
+		_, handler := withWorld(t)
+		rec := postWorld(handler, "north")
+
+		require.Equalf(t, http.StatusConflict, rec.Code, "HTTP response should be conflict")
+	})
+	t.Run("Bad name", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		rec := postWorld(handler, "a.b")
+
+		require.Equalf(t, http.StatusBadRequest, rec.Code, "HTTP response should be bad request")
+	})
+	t.Run("List", func(t *testing.T){
+		_, handler := withWorld(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/worlds", "", "")
+
+		require.NoError(t, handler.getWorlds(ctx))
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Contains(t, rec.Body.String(), `"name":"north"`)
+	})
+	t.Run("Scoped loc writes", func(t *testing.T){
+		store, handler := withWorld(t)
+		ctx, rec := GetNewEchoContext(echo.POST, "/worlds/north/loc/1.-1.0", "", "")
+		ctx.SetParamNames("world", "xyz")
+		ctx.SetParamValues("north", "1.-1.0")
+		require.NoError(t, handler.inWorld(handler.postLocXYZ)(ctx))
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Len(t, store.Locs("world_north"), 1, "The write should go to the world's collection")
+
+		ctx, rec = GetNewEchoContext(echo.GET, "/worlds/north/loc/1.-1.0/history", "", "")
+		ctx.SetParamNames("world", "xyz")
+		ctx.SetParamValues("north", "1.-1.0")
+		require.NoError(t, handler.inWorld(handler.getLocHistory)(ctx))
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		require.Contains(t, rec.Body.String(), `"collection":"world_north"`, "The write should be recorded against the world's collection")
+
+		ctx, rec = GetNewEchoContext(echo.GET, "/loc/1.-1.0/history", "xyz", "1.-1.0")
+		require.NoError(t, handler.getLocHistory(ctx))
+		require.Equal(t, "[]\n", rec.Body.String(), "The default collection should be untouched")
+	})
+	t.Run("Unknown world", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/worlds/south/locs", "world", "south")
+
+		require.NoError(t, handler.inWorld(handler.getLocs)(ctx))
+		require.Equalf(t, http.StatusNotFound, rec.Code, "HTTP response should be not found")
+	})
+	t.Run("Bad world", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		ctx, rec := GetNewEchoContext(echo.GET, "/worlds/a.b/locs", "world", "a.b")
+
+		require.NoError(t, handler.inWorld(handler.getLocs)(ctx))
+		require.Equalf(t, http.StatusBadRequest, rec.Code, "HTTP response should be bad request")
+	})
+	t.Run("Delete", func(t *testing.T){
+		store, handler := withWorld(t)
+		ctx, rec := GetNewEchoContext(echo.DELETE, "/worlds/north", "world", "north")
+		require.NoError(t, handler.deleteWorld(ctx))
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success")
+		drops := store.Calls("DropCollection")
+		require.Len(t, drops, 2)
+		require.Equal(t, "world_north", drops[0].Collection)
+		require.Equal(t, "units_north", drops[1].Collection, "The world's units should go with it")
+
+		ctx, rec = GetNewEchoContext(echo.DELETE, "/worlds/north", "world", "north")
+		require.NoError(t, handler.deleteWorld(ctx))
+		require.Equalf(t, http.StatusNotFound, rec.Code, "HTTP response should be not found")
+	})
+	t.Run("Routed", func(t *testing.T){
+		_, handler := NewHandlerWithFake(t)
+		e := echo.New()
+		handler.routes(e)
+		serve := func(method string, target string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+			return rec
+		}
+
+		rec := serve(echo.POST, "/worlds/south")
+		require.Equalf(t, http.StatusCreated, rec.Code, "Creating a world through the router should be reachable")
+		rec = serve(echo.GET, "/worlds/south/locs")
+		require.Equalf(t, http.StatusOK, rec.Code, "World scoped routes should resolve the world")
+		rec = serve(echo.DELETE, "/worlds/south")
+		require.Equalf(t, http.StatusOK, rec.Code, "Deleting a world through the router should be reachable")
+		rec = serve(echo.GET, "/worlds/south/locs")
+		require.Equalf(t, http.StatusNotFound, rec.Code, "A deleted world should be gone")
+	})
+	t.Run("Scoped units", func(t *testing.T){
+		store, handler := withWorld(t)
+		grid := types.Grid{}
+		grid.BuildHex(1)
+		store.Seed("world_north", grid.Locs()...)
+		e := echo.New()
+		handler.routes(e)
+		serve := func(method string, target string, body string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+			return rec
+		}
+
+		scout := `{"id": "scout", "owner": "red", "position": "0.0.0", "movePoints": 3, "hp": 10}`
+		require.Equal(t, http.StatusCreated, serve(echo.POST, "/units", scout).Code)
+		rec := serve(echo.POST, "/worlds/north/units", scout)
+		require.Equalf(t, http.StatusCreated, rec.Code, "The world should keep units apart from the default ones. Body: %s", rec.Body.String())
+		rec = serve(echo.POST, "/worlds/north/units", `{"id": "tank", "position": "3.-3.0", "movePoints": 1}`)
+		require.Equalf(t, http.StatusNotFound, rec.Code, "A loc only stored outside the world should not take a unit")
+
+		rec = serve(echo.POST, "/worlds/north/units/scout/move?to=1.-1.0", "")
+		require.Equalf(t, http.StatusOK, rec.Code, "HTTP response should be success. Body: %s", rec.Body.String())
+		require.Equal(t, http.StatusOK, serve(echo.POST, "/worlds/north/units/scout/refresh", "").Code)
+		require.Contains(t, serve(echo.GET, "/worlds/north/loc/1.-1.0/units", "").Body.String(), `"id":"scout"`)
+		require.Contains(t, serve(echo.GET, "/loc/0.0.0/units", "").Body.String(), `"id":"scout"`, "The default scout should not have moved")
+	})
+	t.Run("Scoped snapshots", func(t *testing.T){
+		store, handler := withWorld(t)
+		loc, _ := types.LocFromString("0.0.0")
+		store.Seed("world_north", loc)
+		e := echo.New()
+		handler.routes(e)
+		serve := func(method string, target string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+			return rec
+		}
+
+		rec := serve(echo.POST, "/worlds/north/snapshots?id=s1")
+		require.Equalf(t, http.StatusCreated, rec.Code, "HTTP response should be created. Body: %s", rec.Body.String())
+		require.Contains(t, rec.Body.String(), `"collection":"world_north"`)
+		require.Equal(t, http.StatusOK, serve(echo.GET, "/worlds/north/snapshots/s1/diff").Code)
+		require.Equal(t, http.StatusOK, serve(echo.POST, "/worlds/north/snapshots/s1/restore").Code)
+		require.Equal(t, http.StatusNotFound, serve(echo.GET, "/snapshots/s1/diff").Code, "A world's snapshot should not be reached from outside the world")
+		require.Equal(t, http.StatusNotFound, serve(echo.POST, "/snapshots/s1/restore").Code)
+	})
+	t.Run("Other Mongo error", func(t *testing.T){
+		store, handler := withWorld(t)
+		store.On("FindDocuments").In(per.WorldCollection).Fail(errors.New("Mock error on find documents"))
+		ctx, rec := GetNewEchoContext(echo.GET, "/worlds", "", "")
+
+		require.NoError(t, handler.getWorlds(ctx))
+		require.Equalf(t, http.StatusFailedDependency, rec.Code, "HTTP response should be failed dependency")
+	})
+}
+
+/*** Helper functions ***/
+
+// NewHandlerWithFake returns a handler on a fresh fake store holding the default locs: 0.0.0 is plains tagged forest
+// and road, 1.-1.0 is water and 3.-3.0 has no properties
+func NewHandlerWithFake(t *testing.T) (*fake.Store, *Handler) {
+	forest, _ := types.LocFromString("0.0.0")
+	forest.Properties = &types.Properties{Terrain: "plains", Tags: []string{"forest", "road"}}
+	water, _ := types.LocFromString("1.-1.0")
+	water.Properties = &types.Properties{Terrain: "water"}
+	bare, _ := types.LocFromString("3.-3.0")
+	store := fake.New()
+	store.Seed(locCollection, forest, water, bare)
+
+	handler, err := NewHandler(store)
 	require.NoErrorf(t, err, "Issue with handler construction: %s", err)
 	require.NotNil(t, handler)
-	return mock, &handler
+	return store, &handler
 }
 
 // GetNewEchoContext is a helper method to aggregate common things into a single EchoContext for use in testing
 // web requests.
-// The method param must be one of the known echo constants (ie - GET, PUT, UPDATE, etc) 
+// The method param must be one of the known echo constants (ie - GET, PUT, UPDATE, etc)
 // It currently only supports a single param and value.
 func GetNewEchoContext(method string, target string, pname string, pvalue string) (ctx echo.Context, rec *httptest.ResponseRecorder) {
 	req := httptest.NewRequest(method, target, nil)
@@ -203,3 +1443,10 @@ func GetNewEchoContext(method string, target string, pname string, pvalue string
 	return
 }
 
+// GetNewEchoContextWithBody is like GetNewEchoContext, but for routes without params that read the request body
+func GetNewEchoContextWithBody(method string, target string, body string) (ctx echo.Context, rec *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec = httptest.NewRecorder()
+	ctx = echo.New().NewContext(req, rec)
+	return
+}
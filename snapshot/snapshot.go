@@ -0,0 +1,206 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	per "webstuff/persistence"
+	"webstuff/types"
+)
+
+// Collection is where snapshots are stored
+const Collection = "snapshots"
+
+// ErrConflict is returned by Apply when a loc no longer matches the Before of its change, because something else wrote
+// it since the change was worked out
+var ErrConflict = errors.New("loc was changed by another write")
+
+// Snapshot is a named copy of every loc in a collection at one moment
+type Snapshot struct {
+	ID         string      `json:"id" bson:"_id"`
+	Collection string      `json:"collection" bson:"collection"`
+	CreatedAt  time.Time   `json:"createdAt" bson:"createdAt"`
+	Locs       []types.Loc `json:"locs" bson:"locs"`
+}
+
+// Change is one loc as it was before and after a write. Before is nil when the loc was added and After is nil when
+// it was removed.
+type Change struct {
+	Before *types.Loc `json:"before,omitempty" bson:"before,omitempty"`
+	After  *types.Loc `json:"after,omitempty" bson:"after,omitempty"`
+}
+
+// Diff lists what it takes to turn one set of locs into another, each list ordered by loc ID
+type Diff struct {
+	Added   []types.Loc `json:"added"`
+	Removed []types.Loc `json:"removed"`
+	Changed []Change    `json:"changed"`
+}
+
+// Take copies the current state of the collection into a snapshot with the specified ID and stores it. A snapshot
+// with that ID already stored is a per.ErrDuplicate: snapshots are never overwritten.
+func Take(ctx context.Context, mdb per.MongoAbstraction, id string, coll string, now time.Time) (Snapshot, error) {
+	locs, err := mdb.FetchAllFromCollection(ctx, coll)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	sortByID(locs)
+	s := Snapshot{ID: id, Collection: coll, CreatedAt: now.UTC().Truncate(time.Millisecond), Locs: locs}
+	if err = mdb.InsertDocument(ctx, Collection, id, s); err != nil {
+		return Snapshot{}, err
+	}
+	return s, nil
+}
+
+// Load fetches the snapshot with the specified ID
+func Load(ctx context.Context, store per.DocumentStore, id string) (Snapshot, error) {
+	var s Snapshot
+	err := store.FetchDocument(ctx, Collection, id, &s)
+	return s, err
+}
+
+// Restore writes the snapshot back to its collection, changing only the locs that differ from it. The returned Diff
+// is what was applied.
+func Restore(ctx context.Context, mdb per.MongoAbstraction, s Snapshot) (Diff, error) {
+	current, err := mdb.FetchAllFromCollection(ctx, s.Collection)
+	if err != nil {
+		return Diff{}, err
+	}
+	diff := Compare(current, s.Locs)
+	return diff, Apply(ctx, mdb, s.Collection, diff.Changes())
+}
+
+// Compare returns the Diff from the locs in 'from' to the locs in 'to'. Locs are matched by ID and count as changed
+// when their JSON forms differ.
+func Compare(from []types.Loc, to []types.Loc) Diff {
+	diff := Diff{Added: []types.Loc{}, Removed: []types.Loc{}, Changed: []Change{}}
+	before := map[string]types.Loc{}
+	for _, loc := range from {
+		before[loc.ID] = loc
+	}
+	seen := map[string]bool{}
+	for _, loc := range to {
+		seen[loc.ID] = true
+		old, ok := before[loc.ID]
+		if !ok {
+			diff.Added = append(diff.Added, loc)
+			continue
+		}
+		if !bytes.Equal(old.JSONForm(), loc.JSONForm()) {
+			after := loc
+			diff.Changed = append(diff.Changed, Change{Before: &old, After: &after})
+		}
+	}
+	for _, loc := range from {
+		if !seen[loc.ID] {
+			diff.Removed = append(diff.Removed, loc)
+		}
+	}
+	sortByID(diff.Added)
+	sortByID(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].After.ID < diff.Changed[j].After.ID })
+	return diff
+}
+
+// IsEmpty reports whether the diff has nothing to apply
+func (d Diff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Changes flattens the diff into the writes that apply it
+func (d Diff) Changes() []Change {
+	result := make([]Change, 0, len(d.Added)+len(d.Removed)+len(d.Changed))
+	for i := range d.Removed {
+		result = append(result, Change{Before: &d.Removed[i]})
+	}
+	for i := range d.Added {
+		result = append(result, Change{After: &d.Added[i]})
+	}
+	return append(result, d.Changed...)
+}
+
+// Apply makes each change to the collection in order: an insert for an added loc, a delete for a removed one and
+// an update otherwise. Every loc is first checked against the Before of its change and, if one differs, nothing is
+// written and the error is an ErrConflict. On a failed write the changes already made are taken back, so the
+// collection is left as it was unless that fails too.
+func Apply(ctx context.Context, mdb per.MongoAbstraction, coll string, changes []Change) error {
+	if err := check(ctx, mdb, coll, changes); err != nil {
+		return err
+	}
+	for i, c := range changes {
+		if err := c.write(ctx, mdb, coll); err != nil {
+			err = fmt.Errorf("could not apply change to %s: %s", c.locID(), err)
+			// taken back even when ctx is cancelled, since the changes made so far are already stored
+			undo := context.WithoutCancel(ctx)
+			for j := i - 1; j >= 0; j-- {
+				back := Change{Before: changes[j].After, After: changes[j].Before}
+				if undoErr := back.write(undo, mdb, coll); undoErr != nil {
+					return fmt.Errorf("%s, and taking back the change to %s failed: %s", err, back.locID(), undoErr)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// check makes sure that each loc is as the Before of its change says, following earlier changes to the same loc
+func check(ctx context.Context, mdb per.MongoAbstraction, coll string, changes []Change) error {
+	expected := map[string]*types.Loc{}
+	for _, c := range changes {
+		if c.Before == nil && c.After == nil {
+			continue
+		}
+		id := c.locID()
+		current, seen := expected[id]
+		if !seen {
+			loc, err := mdb.FetchFromCollection(ctx, coll, id)
+			switch {
+			case err == nil:
+				current = &loc
+			case !per.IsNotFound(err):
+				return fmt.Errorf("could not check %s: %s", id, err)
+			}
+		}
+		if !sameLoc(current, c.Before) {
+			return fmt.Errorf("%s: %w", id, ErrConflict)
+		}
+		expected[id] = c.After
+	}
+	return nil
+}
+
+func (c Change) write(ctx context.Context, mdb per.MongoAbstraction, coll string) error {
+	switch {
+	case c.Before == nil && c.After == nil:
+		return nil
+	case c.Before == nil:
+		return mdb.WriteCollection(ctx, coll, *c.After)
+	case c.After == nil:
+		return mdb.DeleteFromCollection(ctx, coll, c.Before.ID)
+	default:
+		return mdb.UpdateCollection(ctx, coll, *c.After)
+	}
+}
+
+func sameLoc(a *types.Loc, b *types.Loc) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return bytes.Equal(a.JSONForm(), b.JSONForm())
+}
+
+func (c Change) locID() string {
+	if c.After != nil {
+		return c.After.ID
+	}
+	return c.Before.ID
+}
+
+func sortByID(locs []types.Loc) {
+	sort.Slice(locs, func(i, j int) bool { return locs[i].ID < locs[j].ID })
+}
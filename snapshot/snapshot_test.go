@@ -0,0 +1,223 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	per "webstuff/persistence"
+	"webstuff/types"
+)
+
+// memStore is an in-memory MongoAbstraction for a single loc collection, plus documents keyed by collection and ID
+type memStore struct {
+	locs map[string]types.Loc
+	docs map[string]interface{}
+}
+
+func newMemStore(ids ...string) *memStore {
+	ms := &memStore{locs: map[string]types.Loc{}, docs: map[string]interface{}{}}
+	for _, id := range ids {
+		loc, _ := types.LocFromString(id)
+		ms.locs[loc.ID] = loc
+	}
+	return ms
+}
+
+func (ms *memStore) ConnectToMongo(ctx context.Context) error { return nil }
+
+func (ms *memStore) WriteCollection(ctx context.Context, coll string, obj types.Loc) error {
+	if _, ok := ms.locs[obj.ID]; ok {
+		return fmt.Errorf("%w: %s", per.ErrDuplicate, obj.ID)
+	}
+	ms.locs[obj.ID] = obj
+	return nil
+}
+
+func (ms *memStore) UpdateCollection(ctx context.Context, coll string, obj types.Loc) error {
+	if _, ok := ms.locs[obj.ID]; !ok {
+		return per.ErrNotFound
+	}
+	ms.locs[obj.ID] = obj
+	return nil
+}
+
+func (ms *memStore) FetchFromCollection(ctx context.Context, coll string, id string) (types.Loc, error) {
+	loc, ok := ms.locs[id]
+	if !ok {
+		return loc, per.ErrNotFound
+	}
+	return loc, nil
+}
+
+func (ms *memStore) FetchAllFromCollection(ctx context.Context, coll string) ([]types.Loc, error) {
+	result := []types.Loc{}
+	for _, loc := range ms.locs {
+		result = append(result, loc)
+	}
+	return result, nil
+}
+
+func (ms *memStore) QueryCollection(ctx context.Context, coll string, query per.LocQuery) ([]types.Loc, error) {
+	return nil, nil
+}
+
+func (ms *memStore) DeleteFromCollection(ctx context.Context, coll string, id string) error {
+	if _, ok := ms.locs[id]; !ok {
+		return per.ErrNotFound
+	}
+	delete(ms.locs, id)
+	return nil
+}
+
+func (ms *memStore) DropCollection(ctx context.Context, coll string) error {
+	ms.locs = map[string]types.Loc{}
+	return nil
+}
+
+func (ms *memStore) SaveDocument(ctx context.Context, coll string, id string, doc interface{}) error {
+	ms.docs[coll+"/"+id] = doc
+	return nil
+}
+
+func (ms *memStore) FetchDocument(ctx context.Context, coll string, id string, result interface{}) error {
+	doc, ok := ms.docs[coll+"/"+id]
+	if !ok {
+		return per.ErrNotFound
+	}
+	*result.(*Snapshot) = doc.(Snapshot)
+	return nil
+}
+
+func (ms *memStore) FindDocuments(ctx context.Context, coll string, filter map[string]interface{}, result interface{}) error {
+	return fmt.Errorf("not supported")
+}
+
+func (ms *memStore) InsertDocument(ctx context.Context, coll string, id string, doc interface{}) error {
+	if _, ok := ms.docs[coll+"/"+id]; ok {
+		return fmt.Errorf("%w: %s", per.ErrDuplicate, id)
+	}
+	return ms.SaveDocument(ctx, coll, id, doc)
+}
+
+func (ms *memStore) ReplaceDocumentIf(ctx context.Context, coll string, id string, match map[string]interface{}, doc interface{}) error {
+	return fmt.Errorf("not supported")
+}
+
+func (ms *memStore) DeleteDocument(ctx context.Context, coll string, id string) error {
+	delete(ms.docs, coll+"/"+id)
+	return nil
+}
+
+func (ms *memStore) DeleteDocumentIf(ctx context.Context, coll string, id string, match map[string]interface{}) error {
+	return fmt.Errorf("not supported")
+}
+
+func TestTakeAndRestore(t *testing.T) {
+	ctx := context.Background()
+	ms := newMemStore("1.-1.0", "0.0.0")
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	taken, err := Take(ctx, ms, "before", "arena", now)
+	require.NoError(t, err)
+	require.Equal(t, "0.0.0", taken.Locs[0].ID, "Locs should be ordered by ID")
+
+	loaded, err := Load(ctx, ms, "before")
+	require.NoError(t, err)
+	require.Equal(t, taken, loaded)
+	_, err = Load(ctx, ms, "missing")
+	require.Error(t, err)
+
+	claimed := ms.locs["0.0.0"]
+	claimed.Status = "claimed"
+	ms.locs["0.0.0"] = claimed
+	delete(ms.locs, "1.-1.0")
+	added, _ := types.LocFromString("2.-2.0")
+	ms.locs[added.ID] = added
+
+	diff, err := Restore(ctx, ms, loaded)
+	require.NoError(t, err)
+	require.Equal(t, []types.Loc{added}, diff.Removed)
+	require.Len(t, diff.Added, 1)
+	require.Len(t, diff.Changed, 1)
+	require.Equal(t, "claimed", diff.Changed[0].Before.Status)
+
+	current, _ := ms.FetchAllFromCollection(ctx, "arena")
+	require.True(t, Compare(current, taken.Locs).IsEmpty(), "Collection should match the snapshot again")
+	diff, err = Restore(ctx, ms, loaded)
+	require.NoError(t, err)
+	require.True(t, diff.IsEmpty(), "Restoring twice should change nothing")
+}
+
+func TestCompare(t *testing.T) {
+	a, _ := types.LocFromString("0.0.0")
+	b, _ := types.LocFromString("1.-1.0")
+	c, _ := types.LocFromString("2.-2.0")
+	b2 := b
+	b2.Properties = &types.Properties{Terrain: "water"}
+
+	diff := Compare([]types.Loc{a, b}, []types.Loc{c, b2})
+	require.Equal(t, []types.Loc{c}, diff.Added)
+	require.Equal(t, []types.Loc{a}, diff.Removed)
+	require.Equal(t, []Change{{Before: &b, After: &b2}}, diff.Changed)
+	require.Len(t, diff.Changes(), 3)
+
+	require.True(t, Compare([]types.Loc{a, b}, []types.Loc{b, a}).IsEmpty(), "Order should not matter")
+	empty := Compare(nil, nil)
+	require.NotNil(t, empty.Added, "Lists should be empty rather than nil so they serve as []")
+}
+
+// failingStore fails every update of one loc
+type failingStore struct {
+	*memStore
+	id string
+}
+
+func (fs failingStore) UpdateCollection(ctx context.Context, coll string, obj types.Loc) error {
+	if obj.ID == fs.id {
+		return fmt.Errorf("write failed")
+	}
+	return fs.memStore.UpdateCollection(ctx, coll, obj)
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	origin, _ := types.LocFromString("0.0.0")
+	claimed := origin
+	claimed.Status = "claimed"
+	added, _ := types.LocFromString("2.-2.0")
+
+	t.Run("Missing loc", func(t *testing.T) {
+		ms := newMemStore("0.0.0")
+		missing, _ := types.LocFromString("5.-5.0")
+		err := Apply(ctx, ms, "arena", []Change{{Before: &missing}})
+		require.ErrorIs(t, err, ErrConflict)
+		require.Contains(t, err.Error(), "5.-5.0")
+	})
+	t.Run("Changed since", func(t *testing.T) {
+		ms := newMemStore("0.0.0")
+		water := origin
+		water.Status = "water"
+		err := Apply(ctx, ms, "arena", []Change{{After: &added}, {Before: &water, After: &claimed}})
+		require.ErrorIs(t, err, ErrConflict)
+		require.NotContains(t, ms.locs, "2.-2.0", "Nothing should be written when a loc doesn't match")
+	})
+	t.Run("Same loc twice", func(t *testing.T) {
+		ms := newMemStore()
+		require.NoError(t, Apply(ctx, ms, "arena", []Change{{After: &origin}, {Before: &origin, After: &claimed}}))
+		require.Equal(t, "claimed", ms.locs["0.0.0"].Status)
+	})
+	t.Run("Failed write is taken back", func(t *testing.T) {
+		ms := newMemStore("0.0.0", "1.-1.0")
+		moved, _ := types.LocFromString("1.-1.0")
+		movedClaimed := moved
+		movedClaimed.Status = "claimed"
+		changes := []Change{{After: &added}, {Before: &origin, After: &claimed}, {Before: &moved, After: &movedClaimed}}
+		err := Apply(ctx, failingStore{memStore: ms, id: "1.-1.0"}, "arena", changes)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "1.-1.0")
+		require.NotContains(t, ms.locs, "2.-2.0", "The insert should be taken back")
+		require.Equal(t, origin.Status, ms.locs["0.0.0"].Status, "The update should be taken back")
+	})
+}
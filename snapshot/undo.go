@@ -0,0 +1,156 @@
+package snapshot
+
+import (
+	"errors"
+	"sync"
+
+	per "webstuff/persistence"
+)
+
+// Errors returned by Stack when there is nothing to step through
+var (
+	ErrNothingToUndo = errors.New("nothing to undo")
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+// Edit is the set of changes one request made to a collection, undone and redone as a unit
+type Edit struct {
+	Collection string   `json:"collection"`
+	Changes    []Change `json:"changes"`
+}
+
+// Record adds the change from an audit event to the edit. It is meant to be passed to Audited.Observe.
+func (e *Edit) Record(event per.Event) {
+	e.Collection = event.Collection
+	e.Changes = append(e.Changes, Change{Before: event.Before, After: event.After})
+}
+
+// Inverse returns the edit that takes the collection back to how it was before this one
+func (e Edit) Inverse() Edit {
+	result := Edit{Collection: e.Collection, Changes: make([]Change, len(e.Changes))}
+	for i, c := range e.Changes {
+		result.Changes[len(e.Changes)-1-i] = Change{Before: c.After, After: c.Before}
+	}
+	return result
+}
+
+// Stack holds the most recent edits of one editing session for undo and redo. Once it is full the oldest edit is
+// dropped, and pushing a new edit clears what could be redone.
+type Stack struct {
+	mu    sync.Mutex
+	limit int
+	undo  []Edit
+	redo  []Edit
+}
+
+// NewStack returns an empty stack keeping up to limit edits
+func NewStack(limit int) *Stack {
+	return &Stack{limit: limit}
+}
+
+// Push records a new edit
+func (s *Stack) Push(e Edit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.undo = append(s.undo, e)
+	if len(s.undo) > s.limit {
+		s.undo = s.undo[len(s.undo)-s.limit:]
+	}
+	s.redo = nil
+}
+
+// Undo passes the inverse of the latest edit to apply and, if that succeeds, moves the edit to the redo list. The
+// result is the inverse that was applied. Apply refuses an inverse whose locs were written since the edit, with an
+// ErrConflict, and the edit then stays where it is.
+func (s *Stack) Undo(apply func(Edit) error) (Edit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.undo) == 0 {
+		return Edit{}, ErrNothingToUndo
+	}
+	e := s.undo[len(s.undo)-1]
+	inverse := e.Inverse()
+	if err := apply(inverse); err != nil {
+		return Edit{}, err
+	}
+	s.undo = s.undo[:len(s.undo)-1]
+	s.redo = append(s.redo, e)
+	return inverse, nil
+}
+
+// Redo passes the latest undone edit to apply and, if that succeeds, moves it back to the undo list
+func (s *Stack) Redo(apply func(Edit) error) (Edit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.redo) == 0 {
+		return Edit{}, ErrNothingToRedo
+	}
+	e := s.redo[len(s.redo)-1]
+	if err := apply(e); err != nil {
+		return Edit{}, err
+	}
+	s.redo = s.redo[:len(s.redo)-1]
+	s.undo = append(s.undo, e)
+	return e, nil
+}
+
+// Depth returns how many edits can be undone and redone
+func (s *Stack) Depth() (undo int, redo int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.undo), len(s.redo)
+}
+
+// Sessions keeps a Stack for each editing session, created on first use. Stacks live in memory only and there are at
+// most max of them: starting a session beyond that drops the one used least recently.
+type Sessions struct {
+	mu     sync.Mutex
+	limit  int
+	max    int
+	uses   uint64
+	stacks map[string]*session
+}
+
+type session struct {
+	stack   *Stack
+	lastUse uint64
+}
+
+// NewSessions returns an empty set of up to max sessions whose stacks keep up to limit edits each
+func NewSessions(limit int, max int) *Sessions {
+	return &Sessions{limit: limit, max: max, stacks: map[string]*session{}}
+}
+
+// Stack returns the stack for the session with the specified ID
+func (s *Sessions) Stack(id string) *Stack {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uses++
+	ss, ok := s.stacks[id]
+	if !ok {
+		if len(s.stacks) >= s.max {
+			s.dropOldest()
+		}
+		ss = &session{stack: NewStack(s.limit)}
+		s.stacks[id] = ss
+	}
+	ss.lastUse = s.uses
+	return ss.stack
+}
+
+// Len returns how many sessions are kept
+func (s *Sessions) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.stacks)
+}
+
+func (s *Sessions) dropOldest() {
+	oldest := ""
+	for id, ss := range s.stacks {
+		if oldest == "" || ss.lastUse < s.stacks[oldest].lastUse {
+			oldest = id
+		}
+	}
+	delete(s.stacks, oldest)
+}
@@ -0,0 +1,92 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	per "webstuff/persistence"
+	"webstuff/types"
+)
+
+func TestEditInverse(t *testing.T) {
+	loc, _ := types.LocFromString("0.0.0")
+	claimed := loc
+	claimed.Status = "claimed"
+	e := Edit{Collection: "arena"}
+	e.Record(per.Event{Collection: "arena", After: &loc})
+	e.Record(per.Event{Collection: "arena", Before: &loc, After: &claimed})
+
+	inverse := e.Inverse()
+	require.Equal(t, []Change{{Before: &claimed, After: &loc}, {Before: &loc}}, inverse.Changes)
+	require.Equal(t, e, inverse.Inverse())
+}
+
+func TestStack(t *testing.T) {
+	ctx := context.Background()
+	ms := newMemStore()
+	apply := func(e Edit) error { return Apply(ctx, ms, e.Collection, e.Changes) }
+	stack := NewStack(2)
+	edit := func(id string) Edit {
+		loc, _ := types.LocFromString(id)
+		require.NoError(t, ms.WriteCollection(ctx, "arena", loc))
+		return Edit{Collection: "arena", Changes: []Change{{After: &loc}}}
+	}
+	stack.Push(edit("0.0.0"))
+	stack.Push(edit("1.-1.0"))
+	stack.Push(edit("2.-2.0"))
+	undo, redo := stack.Depth()
+	require.Equal(t, 2, undo, "The oldest edit should be dropped once the stack is full")
+	require.Equal(t, 0, redo)
+
+	t.Run("Undo", func(t *testing.T) {
+		_, err := stack.Undo(apply)
+		require.NoError(t, err)
+		require.NotContains(t, ms.locs, "2.-2.0")
+		_, err = stack.Undo(apply)
+		require.NoError(t, err)
+		_, err = stack.Undo(apply)
+		require.Equal(t, ErrNothingToUndo, err)
+		require.Contains(t, ms.locs, "0.0.0", "Dropped edits can't be undone")
+	})
+	t.Run("Redo", func(t *testing.T) {
+		redone, err := stack.Redo(apply)
+		require.NoError(t, err)
+		require.Equal(t, "1.-1.0", redone.Changes[0].After.ID)
+		require.Contains(t, ms.locs, "1.-1.0")
+		stack.Push(edit("3.-3.0"))
+		_, err = stack.Redo(apply)
+		require.Equal(t, ErrNothingToRedo, err, "A new edit should clear the redo list")
+	})
+	t.Run("Changed since", func(t *testing.T) {
+		loc, _ := types.LocFromString("3.-3.0")
+		loc.Status = "claimed"
+		require.NoError(t, ms.UpdateCollection(ctx, "arena", loc))
+		_, err := stack.Undo(apply)
+		require.ErrorIs(t, err, ErrConflict, "Undo should not revert a loc written since the edit")
+		require.Equal(t, "claimed", ms.locs["3.-3.0"].Status)
+		undo, _ := stack.Depth()
+		require.Equal(t, 2, undo)
+	})
+	t.Run("Failed apply keeps the edit", func(t *testing.T) {
+		_, err := stack.Undo(func(Edit) error { return fmt.Errorf("write failed") })
+		require.Error(t, err)
+		undo, _ := stack.Depth()
+		require.Equal(t, 2, undo)
+	})
+}
+
+func TestSessions(t *testing.T) {
+	sessions := NewSessions(5, 2)
+	a := sessions.Stack("a")
+	require.True(t, a == sessions.Stack("a"), "A session should keep its stack")
+	b := sessions.Stack("b")
+	require.False(t, a == b, "Sessions should not share stacks")
+
+	sessions.Stack("a")
+	sessions.Stack("c")
+	require.Equal(t, 2, sessions.Len(), "Sessions should be capped")
+	require.True(t, a == sessions.Stack("a"), "The session used most recently should be kept")
+	require.False(t, b == sessions.Stack("b"), "The session used least recently should be dropped")
+}
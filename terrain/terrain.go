@@ -0,0 +1,129 @@
+// Package terrain fills a types.Grid with terrain using seeded fractal value noise, so that a given seed always
+// produces the same map.
+package terrain
+
+import (
+	"fmt"
+	"math"
+
+	"webstuff/types"
+)
+
+// Terrain types written to Loc.Properties.Terrain, from lowest to highest noise value
+const (
+	Water    string = "water"
+	Plains   string = "plains"
+	Hills    string = "hills"
+	Mountain string = "mountain"
+)
+
+// Thresholds are the noise values, in [0,1), where each terrain type ends. Anything at or above Hills is Mountain.
+type Thresholds struct {
+	Water  float64 `json:"water"`
+	Plains float64 `json:"plains"`
+	Hills  float64 `json:"hills"`
+}
+
+// DefaultThresholds give a typical map of mostly plains and hills, with a few lakes and mountain ranges
+var DefaultThresholds = Thresholds{Water: 0.4, Plains: 0.55, Hills: 0.65}
+
+// Generator holds the settings for a noise based terrain fill. The zero value other than Seed uses the defaults.
+type Generator struct {
+	Seed       int64
+	Scale      float64 // approximate size, in hexes, of the largest terrain features. Defaults to 8.
+	Octaves    int     // number of layers of finer detail. Defaults to 3.
+	Thresholds Thresholds
+}
+
+// Validate checks that the thresholds are in order and within [0,1]
+func (t Thresholds) Validate() error {
+	if t.Water < 0 || t.Water > t.Plains || t.Plains > t.Hills || t.Hills > 1 {
+		return fmt.Errorf("thresholds must satisfy 0 <= water <= plains <= hills <= 1. Got: %+v", t)
+	}
+	return nil
+}
+
+// Classify returns the terrain type for a noise value
+func (t Thresholds) Classify(n float64) string {
+	switch {
+	case n < t.Water:
+		return Water
+	case n < t.Plains:
+		return Plains
+	case n < t.Hills:
+		return Hills
+	}
+	return Mountain
+}
+
+// Apply sets the terrain property of every loc in the grid to its terrain type. Statuses and the other properties are
+// left alone.
+func (gen Generator) Apply(g *types.Grid) error {
+	th := gen.Thresholds
+	if th == (Thresholds{}) {
+		th = DefaultThresholds
+	}
+	if err := th.Validate(); err != nil {
+		return err
+	}
+	*g = g.Transform(func(l types.Loc) types.Loc {
+		props := types.Properties{}
+		if l.Properties != nil {
+			props = *l.Properties
+		}
+		props.Terrain = th.Classify(gen.Noise(l))
+		l.Properties = &props
+		return l
+	})
+	return nil
+}
+
+// noiseLayout projects hexes onto the plane for sampling, so features come out round rather than skewed along an axis
+var noiseLayout = types.Layout{Orientation: types.PointyTop, Size: 1}
+
+// Noise returns the fractal value noise at the loc, in [0,1)
+func (gen Generator) Noise(loc types.Loc) float64 {
+	scale, octaves := gen.Scale, gen.Octaves
+	if scale <= 0 {
+		scale = 8
+	}
+	if octaves <= 0 {
+		octaves = 3
+	}
+	p := types.HexToPixel(noiseLayout, loc)
+	// pixel distance between neighboring hex centers is sqrt(3) with a size 1 layout
+	fx, fy := p.X/(scale*math.Sqrt(3)), p.Y/(scale*math.Sqrt(3))
+	total, amplitude, norm := 0.0, 1.0, 0.0
+	for o := 0; o < octaves; o++ {
+		total += amplitude * valueNoise(gen.Seed+int64(o), fx, fy)
+		norm += amplitude
+		amplitude /= 2
+		fx, fy = fx*2, fy*2
+	}
+	return total / norm
+}
+
+// valueNoise interpolates random lattice values around the point with a smoothstep falloff
+func valueNoise(seed int64, x float64, y float64) float64 {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	tx, ty := smooth(x-x0), smooth(y-y0)
+	ix, iy := int64(x0), int64(y0)
+	top := lerp(lattice(seed, ix, iy), lattice(seed, ix+1, iy), tx)
+	bottom := lerp(lattice(seed, ix, iy+1), lattice(seed, ix+1, iy+1), tx)
+	return lerp(top, bottom, ty)
+}
+
+func smooth(t float64) float64 { return t * t * (3 - 2*t) }
+
+func lerp(a float64, b float64, t float64) float64 { return a + (b-a)*t }
+
+// lattice returns a stable pseudo random value in [0,1) for an integer lattice point, using the splitmix64 mixer
+func lattice(seed int64, x int64, y int64) float64 {
+	h := uint64(seed)*0x9e3779b97f4a7c15 ^ uint64(x)*0xbf58476d1ce4e5b9 ^ uint64(y)*0x94d049bb133111eb
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return float64(h>>11) / float64(1<<53)
+}
@@ -0,0 +1,63 @@
+package terrain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"webstuff/types"
+)
+
+func TestApplyDeterministic(t *testing.T) {
+	first, second, other := types.Grid{}, types.Grid{}, types.Grid{}
+	first.BuildHex(12)
+	second.BuildHex(12)
+	other.BuildHex(12)
+
+	require.NoError(t, Generator{Seed: 123}.Apply(&first))
+	require.NoError(t, Generator{Seed: 123}.Apply(&second))
+	require.NoError(t, Generator{Seed: 124}.Apply(&other))
+	require.Equal(t, first.Locs(), second.Locs(), "Same seed should generate the same map")
+	require.NotEqual(t, first.Locs(), other.Locs(), "Different seeds should generate different maps")
+}
+
+func TestApplyCoversEveryTerrain(t *testing.T) {
+	g := types.Grid{}
+	g.BuildHex(20)
+	require.NoError(t, Generator{Seed: 7}.Apply(&g))
+	counts := map[string]int{}
+	for _, loc := range g.Locs() {
+		counts[loc.Properties.TerrainName()]++
+		require.Equal(t, types.DefaultStatus, loc.Status, "Generating terrain should leave the status alone")
+	}
+	require.Equal(t, g.Len(), counts[Water]+counts[Plains]+counts[Hills]+counts[Mountain], "Every loc should get a terrain type")
+	for _, terrain := range []string{Water, Plains, Hills, Mountain} {
+		require.NotZerof(t, counts[terrain], "A radius 20 map should have some %s", terrain)
+	}
+}
+
+func TestNoiseIsSmooth(t *testing.T) {
+	gen := Generator{Seed: 99, Scale: 10, Octaves: 1}
+	g := types.Grid{}
+	g.BuildHex(10)
+	for _, loc := range g.Locs() {
+		n := gen.Noise(loc)
+		require.True(t, n >= 0 && n < 1, "Noise should be in [0,1). Got %f", n)
+		for _, neighbor := range g.Neighbors(loc) {
+			require.InDelta(t, n, gen.Noise(neighbor), 0.35, "Neighboring hexes should have similar noise")
+		}
+	}
+}
+
+func TestThresholds(t *testing.T) {
+	th := Thresholds{Water: 0.2, Plains: 0.5, Hills: 0.9}
+	require.NoError(t, th.Validate())
+	require.Equal(t, Water, th.Classify(0.1))
+	require.Equal(t, Plains, th.Classify(0.2))
+	require.Equal(t, Hills, th.Classify(0.89))
+	require.Equal(t, Mountain, th.Classify(0.9))
+
+	require.Error(t, Thresholds{Water: 0.6, Plains: 0.5, Hills: 0.9}.Validate())
+	g := types.Grid{}
+	g.BuildHex(1)
+	require.Error(t, Generator{Thresholds: Thresholds{Hills: 2}}.Apply(&g))
+}
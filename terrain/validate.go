@@ -0,0 +1,36 @@
+package terrain
+
+import (
+	"fmt"
+
+	"webstuff/types"
+)
+
+// Passable reports whether units can walk over the loc's terrain. Water and mountains block movement.
+func Passable(l types.Loc) bool {
+	t := l.Properties.TerrainName()
+	return t != Water && t != Mountain
+}
+
+// ValidateSpawns rejects a map where any spawn point is missing, impassable or can't reach every other spawn point
+func ValidateSpawns(g *types.Grid, spawns []types.Loc) error {
+	if len(spawns) == 0 {
+		return nil
+	}
+	for _, spawn := range spawns {
+		stored, ok := g.Lookup(spawn.GetID())
+		if !ok {
+			return fmt.Errorf("spawn %s is not on the map", spawn.GetID())
+		}
+		if !Passable(stored) {
+			return fmt.Errorf("spawn %s is on impassable %s", spawn.GetID(), stored.Properties.TerrainName())
+		}
+	}
+	region := g.FloodFill(spawns[0], Passable)
+	for _, spawn := range spawns[1:] {
+		if _, ok := region[spawn.Key()]; !ok {
+			return fmt.Errorf("spawn %s can't reach spawn %s", spawn.GetID(), spawns[0].GetID())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package terrain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"webstuff/types"
+)
+
+func TestValidateSpawns(t *testing.T) {
+	spawn := func(id string) types.Loc {
+		loc, _ := types.LocFromString(id)
+		return loc
+	}
+	build := func(terrains map[string]string) types.Grid {
+		g := types.Grid{}
+		g.BuildHex(3)
+		return g.Transform(func(l types.Loc) types.Loc {
+			if t, ok := terrains[l.ID]; ok {
+				l.Properties = &types.Properties{Terrain: t}
+			}
+			return l
+		})
+	}
+
+	t.Run("Reachable", func(t *testing.T) {
+		g := build(nil)
+		require.NoError(t, ValidateSpawns(&g, []types.Loc{spawn("-3.0.3"), spawn("3.0.-3"), spawn("0.3.-3")}))
+		require.NoError(t, ValidateSpawns(&g, nil))
+	})
+	t.Run("Cut off by water", func(t *testing.T) {
+		river := map[string]string{}
+		for y := -3; y <= 3; y++ {
+			loc, _ := types.LocFromCoords(0, y, -y)
+			river[loc.ID] = Water
+		}
+		g := build(river)
+		err := ValidateSpawns(&g, []types.Loc{spawn("-3.0.3"), spawn("3.0.-3")})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "can't reach")
+	})
+	t.Run("Spawn on a mountain", func(t *testing.T) {
+		g := build(map[string]string{"0.0.0": Mountain})
+		err := ValidateSpawns(&g, []types.Loc{spawn("0.0.0")})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "impassable")
+	})
+	t.Run("Spawn off the map", func(t *testing.T) {
+		g := build(nil)
+		err := ValidateSpawns(&g, []types.Loc{spawn("9.-9.0")})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "not on the map")
+	})
+}
@@ -0,0 +1,336 @@
+package types
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+)
+
+// ChunkSize is the number of hexes along each side of a chunk. Chunks are parallelograms in axial space, so a chunk
+// holds every loc whose q (X) and r (Z) fall inside a ChunkSize by ChunkSize square.
+const ChunkSize = 32
+
+// maxStatuses caps the distinct statuses a ChunkedGrid can hold, since cells store a one byte palette index
+const maxStatuses = 255
+
+// ChunkKey identifies a chunk by its integer chunk coords
+type ChunkKey struct {
+	Q int
+	R int
+}
+
+// ChunkFor returns the key of the chunk holding the hex at x,y,z
+func ChunkFor(x int, y int, z int) ChunkKey {
+	return ChunkKey{Q: floorDiv(x, ChunkSize), R: floorDiv(z, ChunkSize)}
+}
+
+// Bounds returns the inclusive range of x and z values covered by the chunk
+func (k ChunkKey) Bounds() (xmin int, xmax int, zmin int, zmax int) {
+	xmin, zmin = k.Q*ChunkSize, k.R*ChunkSize
+	return xmin, xmin + ChunkSize - 1, zmin, zmin + ChunkSize - 1
+}
+
+func (k ChunkKey) String() string {
+	return fmt.Sprintf("%d,%d", k.Q, k.R)
+}
+
+// ChunkSource lazily supplies the locs of a chunk that isn't in memory. A source that also implements ChunkSaver
+// gets changed chunks written back before they are evicted and on Flush.
+type ChunkSource interface {
+	LoadChunk(ctx context.Context, key ChunkKey) ([]Loc, error)
+}
+
+// ChunkSaver persists the locs of a chunk that was changed with Set or Delete
+type ChunkSaver interface {
+	SaveChunk(ctx context.Context, key ChunkKey, locs []Loc) error
+}
+
+// chunk stores one byte per hex: 0 for a hole, otherwise 1 + the status's index in the grid's palette. The few hexes
+// that carry Properties or Attributes keep them in extras, by cell index.
+type chunk struct {
+	key    ChunkKey
+	cells  [ChunkSize * ChunkSize]uint8
+	extras map[int]extra
+	dirty  bool
+}
+
+// extra holds the parts of a Loc beyond its status
+type extra struct {
+	properties *Properties
+	attributes map[string]interface{}
+}
+
+// ChunkedGrid is a sparse hex grid for maps too large to hold as a Grid. Hexes are grouped into fixed size chunks,
+// each cell costs a single byte plus whatever Properties and Attributes the hex has, and status lookups by x,y,z
+// don't allocate. With a ChunkSource, chunks are loaded on first use and the least recently used ones are evicted once
+// more than capacity chunks are in memory. Changes only reach the source if it is also a ChunkSaver; call Flush to
+// save them before dropping the grid. The context of each call bounds any loading and saving it does.
+type ChunkedGrid struct {
+	source   ChunkSource
+	capacity int
+	chunks   map[ChunkKey]*list.Element
+	lru      *list.List
+	palette  []string
+	statuses map[string]uint8
+}
+
+// NewChunkedGrid creates an empty chunked grid. A nil source keeps every chunk in memory. A capacity of 0 or less
+// never evicts.
+func NewChunkedGrid(source ChunkSource, capacity int) *ChunkedGrid {
+	return &ChunkedGrid{
+		source:   source,
+		capacity: capacity,
+		chunks:   map[ChunkKey]*list.Element{},
+		lru:      list.New(),
+		statuses: map[string]uint8{},
+	}
+}
+
+// Build fills the grid with "new" locs spanning a size of x by y centered on 0,0,0, like Grid.Build
+func (g *ChunkedGrid) Build(ctx context.Context, xSize int, ySize int) error {
+	xmax, ymax := xSize/2, ySize/2
+	for x := -xmax; x <= xmax; x++ {
+		for y := -ymax; y <= ymax; y++ {
+			if err := g.set(ctx, Loc{X: x, Y: y, Z: -x - y, Status: DefaultStatus}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Status returns the status of the hex at x,y,z and whether the grid holds it
+func (g *ChunkedGrid) Status(ctx context.Context, x int, y int, z int) (status string, ok bool, err error) {
+	c, err := g.chunk(ctx, ChunkFor(x, y, z), false)
+	if c == nil || err != nil {
+		return "", false, err
+	}
+	cell := c.cells[cellIndex(x, z)]
+	if cell == 0 {
+		return "", false, nil
+	}
+	return g.palette[cell-1], true, nil
+}
+
+// Has reports whether the grid holds the hex at x,y,z
+func (g *ChunkedGrid) Has(ctx context.Context, x int, y int, z int) (bool, error) {
+	_, ok, err := g.Status(ctx, x, y, z)
+	return ok, err
+}
+
+// At returns the hex at x,y,z as a Loc, with its Properties and Attributes. Unlike Status, this builds the Loc's ID
+// and so allocates.
+func (g *ChunkedGrid) At(ctx context.Context, x int, y int, z int) (result Loc, ok bool, err error) {
+	c, err := g.chunk(ctx, ChunkFor(x, y, z), false)
+	if c == nil || err != nil {
+		return result, false, err
+	}
+	i := cellIndex(x, z)
+	if c.cells[i] == 0 {
+		return result, false, nil
+	}
+	return g.loc(c, i), true, nil
+}
+
+// Set adds the loc to the grid or replaces the hex already there
+func (g *ChunkedGrid) Set(ctx context.Context, loc Loc) error {
+	if loc.X+loc.Y+loc.Z != 0 {
+		return fmt.Errorf("coords must sum to 0. Got: %d.%d.%d", loc.X, loc.Y, loc.Z)
+	}
+	return g.set(ctx, loc)
+}
+
+// Delete removes the hex at x,y,z from the grid, if present
+func (g *ChunkedGrid) Delete(ctx context.Context, x int, y int, z int) error {
+	c, err := g.chunk(ctx, ChunkFor(x, y, z), false)
+	if c == nil || err != nil {
+		return err
+	}
+	if i := cellIndex(x, z); c.cells[i] != 0 {
+		c.cells[i] = 0
+		delete(c.extras, i)
+		c.dirty = true
+	}
+	return nil
+}
+
+// Flush saves every changed chunk in memory, if the source is a ChunkSaver. Without one it does nothing, and changes
+// live only as long as the grid.
+func (g *ChunkedGrid) Flush(ctx context.Context) error {
+	for e := g.lru.Front(); e != nil; e = e.Next() {
+		if err := g.save(ctx, e.Value.(*chunk)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadedChunks returns the number of chunks currently held in memory
+func (g *ChunkedGrid) LoadedChunks() int { return g.lru.Len() }
+
+// ChunkLocs returns the locs of one chunk, ordered by x then z. The chunk is loaded if needed.
+func (g *ChunkedGrid) ChunkLocs(ctx context.Context, key ChunkKey) ([]Loc, error) {
+	c, err := g.chunk(ctx, key, false)
+	if c == nil || err != nil {
+		return nil, err
+	}
+	return g.locs(c), nil
+}
+
+func (g *ChunkedGrid) set(ctx context.Context, loc Loc) error {
+	cell, err := g.cellFor(loc.Status)
+	if err != nil {
+		return err
+	}
+	c, err := g.chunk(ctx, ChunkFor(loc.X, loc.Y, loc.Z), true)
+	if err != nil {
+		return err
+	}
+	i := cellIndex(loc.X, loc.Z)
+	if c.cells[i] != cell {
+		c.cells[i] = cell
+		c.dirty = true
+	}
+	if c.setExtra(i, loc) {
+		c.dirty = true
+	}
+	return nil
+}
+
+// setExtra keeps the loc's Properties and Attributes for cell i, and reports whether the cell had or now has any
+func (c *chunk) setExtra(i int, loc Loc) bool {
+	_, had := c.extras[i]
+	if loc.Properties == nil && len(loc.Attributes) == 0 {
+		delete(c.extras, i)
+		return had
+	}
+	if c.extras == nil {
+		c.extras = map[int]extra{}
+	}
+	c.extras[i] = extra{properties: loc.Properties, attributes: loc.Attributes}
+	return true
+}
+
+// cellFor returns the cell value for a status, adding it to the palette if it's new
+func (g *ChunkedGrid) cellFor(status string) (uint8, error) {
+	if cell, ok := g.statuses[status]; ok {
+		return cell, nil
+	}
+	if len(g.palette) == maxStatuses {
+		return 0, fmt.Errorf("chunked grid holds at most %d distinct statuses", maxStatuses)
+	}
+	g.palette = append(g.palette, status)
+	cell := uint8(len(g.palette))
+	g.statuses[status] = cell
+	return cell, nil
+}
+
+// chunk returns the chunk for the key, loading it from the source if it isn't in memory. Chunks from a source are
+// kept even when empty, so misses aren't fetched again. Without a source the result is nil unless create is set.
+func (g *ChunkedGrid) chunk(ctx context.Context, key ChunkKey, create bool) (*chunk, error) {
+	if e, ok := g.chunks[key]; ok {
+		g.lru.MoveToFront(e)
+		return e.Value.(*chunk), nil
+	}
+	var locs []Loc
+	if g.source != nil {
+		var err error
+		if locs, err = g.source.LoadChunk(ctx, key); err != nil {
+			return nil, fmt.Errorf("could not load chunk %s: %s", key, err)
+		}
+	}
+	if g.source == nil && !create {
+		return nil, nil
+	}
+	c := &chunk{key: key}
+	for _, loc := range locs {
+		if ChunkFor(loc.X, loc.Y, loc.Z) != key {
+			return nil, fmt.Errorf("chunk %s was loaded with loc %s from outside it", key, loc.GetID())
+		}
+		cell, err := g.cellFor(loc.Status)
+		if err != nil {
+			return nil, err
+		}
+		i := cellIndex(loc.X, loc.Z)
+		c.cells[i] = cell
+		c.setExtra(i, loc)
+	}
+	g.chunks[key] = g.lru.PushFront(c)
+	return c, g.evict(ctx)
+}
+
+// evict drops least recently used chunks until the grid is back within capacity. Changed chunks are saved first, or
+// kept in memory if the source can't save them.
+func (g *ChunkedGrid) evict(ctx context.Context) error {
+	if g.capacity <= 0 {
+		return nil
+	}
+	_, canSave := g.source.(ChunkSaver)
+	// the front chunk was just asked for, so it always stays
+	for e := g.lru.Back(); e != g.lru.Front() && g.lru.Len() > g.capacity; {
+		c := e.Value.(*chunk)
+		prev := e.Prev()
+		if c.dirty && !canSave {
+			e = prev
+			continue
+		}
+		if err := g.save(ctx, c); err != nil {
+			return err
+		}
+		g.lru.Remove(e)
+		delete(g.chunks, c.key)
+		e = prev
+	}
+	return nil
+}
+
+func (g *ChunkedGrid) save(ctx context.Context, c *chunk) error {
+	saver, ok := g.source.(ChunkSaver)
+	if !ok || !c.dirty {
+		return nil
+	}
+	if err := saver.SaveChunk(ctx, c.key, g.locs(c)); err != nil {
+		return fmt.Errorf("could not save chunk %s: %s", c.key, err)
+	}
+	c.dirty = false
+	return nil
+}
+
+func (g *ChunkedGrid) locs(c *chunk) []Loc {
+	result := []Loc{}
+	for i, cell := range c.cells {
+		if cell != 0 {
+			result = append(result, g.loc(c, i))
+		}
+	}
+	return result
+}
+
+// loc rebuilds the Loc held in cell i of the chunk
+func (g *ChunkedGrid) loc(c *chunk, i int) Loc {
+	xmin, _, zmin, _ := c.key.Bounds()
+	x, z := xmin+i/ChunkSize, zmin+i%ChunkSize
+	loc, _ := LocFromCoords(x, -x-z, z)
+	loc.Status = g.palette[c.cells[i]-1]
+	if e, ok := c.extras[i]; ok {
+		loc.Properties, loc.Attributes = e.properties, e.attributes
+	}
+	return loc
+}
+
+// cellIndex returns the position of x,z within its chunk's cells
+func cellIndex(x int, z int) int {
+	return floorMod(x, ChunkSize)*ChunkSize + floorMod(z, ChunkSize)
+}
+
+func floorDiv(a int, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+func floorMod(a int, b int) int {
+	return a - floorDiv(a, b)*b
+}
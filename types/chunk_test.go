@@ -0,0 +1,219 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memChunks is a ChunkSource and ChunkSaver backed by a map, counting loads and saves
+type memChunks struct {
+	chunks map[ChunkKey][]Loc
+	loads  int
+	saves  int
+}
+
+func (mc *memChunks) LoadChunk(ctx context.Context, key ChunkKey) ([]Loc, error) {
+	mc.loads++
+	return mc.chunks[key], nil
+}
+
+func (mc *memChunks) SaveChunk(ctx context.Context, key ChunkKey, locs []Loc) error {
+	mc.saves++
+	mc.chunks[key] = locs
+	return nil
+}
+
+// loadOnly wraps a memChunks as a read only source
+type loadOnly struct {
+	source *memChunks
+}
+
+func (lo loadOnly) LoadChunk(ctx context.Context, key ChunkKey) ([]Loc, error) {
+	return lo.source.LoadChunk(ctx, key)
+}
+
+func TestChunkFor(t *testing.T) {
+	var cases = []struct {
+		x, z     int
+		expected ChunkKey
+	}{
+		{0, 0, ChunkKey{0, 0}},
+		{ChunkSize - 1, ChunkSize - 1, ChunkKey{0, 0}},
+		{ChunkSize, 0, ChunkKey{1, 0}},
+		{-1, 0, ChunkKey{-1, 0}},
+		{-ChunkSize, -ChunkSize - 1, ChunkKey{-1, -2}},
+	}
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%d,%d", c.x, c.z), func(t *testing.T) {
+			key := ChunkFor(c.x, -c.x-c.z, c.z)
+			require.Equal(t, c.expected, key)
+			xmin, xmax, zmin, zmax := key.Bounds()
+			require.True(t, xmin <= c.x && c.x <= xmax && zmin <= c.z && c.z <= zmax, "Bounds should cover the hex")
+		})
+	}
+}
+
+func TestChunkedGridSetAndStatus(t *testing.T) {
+	ctx := context.Background()
+	g := NewChunkedGrid(nil, 0)
+	require.NoError(t, g.Set(ctx, newLoc(-40, 45, -5)))
+	wall := newLoc(3, -1, -2)
+	wall.Status = "wall"
+	require.NoError(t, g.Set(ctx, wall))
+
+	status, ok, err := g.Status(ctx, -40, 45, -5)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "new", status)
+
+	loc, ok, err := g.At(ctx, 3, -1, -2)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, wall, loc)
+
+	ok, err = g.Has(ctx, 3, -2, -1)
+	require.NoError(t, err)
+	require.False(t, ok, "Hole in a loaded chunk should not be found")
+	ok, err = g.Has(ctx, 500, -500, 0)
+	require.NoError(t, err)
+	require.False(t, ok, "Hex in a missing chunk should not be found")
+
+	require.NoError(t, g.Delete(ctx, 3, -1, -2))
+	ok, _ = g.Has(ctx, 3, -1, -2)
+	require.False(t, ok)
+
+	require.Error(t, g.Set(ctx, Loc{X: 1, Y: 1, Z: 1}), "Coords off the cube plane should be rejected")
+	require.Equal(t, 2, g.LoadedChunks())
+}
+
+func TestChunkedGridBuild(t *testing.T) {
+	ctx := context.Background()
+	g := NewChunkedGrid(nil, 0)
+	require.NoError(t, g.Build(ctx, 1000, 1000))
+	for _, xyz := range [][3]int{{0, 0, 0}, {500, -500, 0}, {-500, 500, 0}, {500, 500, -1000}} {
+		ok, err := g.Has(ctx, xyz[0], xyz[1], xyz[2])
+		require.NoError(t, err)
+		require.Truef(t, ok, "Built grid should hold %v", xyz)
+	}
+	ok, _ := g.Has(ctx, 501, -501, 0)
+	require.False(t, ok)
+}
+
+func TestChunkedGridStatusDoesNotAllocate(t *testing.T) {
+	ctx := context.Background()
+	g := NewChunkedGrid(nil, 0)
+	require.NoError(t, g.Build(ctx, 200, 200))
+	allocs := testing.AllocsPerRun(100, func() {
+		g.Status(ctx, 37, -20, -17)
+		g.Status(ctx, -99, 5, 94)
+	})
+	require.Zero(t, allocs)
+}
+
+func TestChunkedGridLazyLoad(t *testing.T) {
+	ctx := context.Background()
+	far := newLoc(ChunkSize*10, -ChunkSize*10, 0)
+	source := &memChunks{chunks: map[ChunkKey][]Loc{
+		ChunkFor(0, 0, 0):             {newLoc(0, 0, 0), newLoc(1, -1, 0)},
+		ChunkFor(far.X, far.Y, far.Z): {far},
+	}}
+
+	t.Run("Loads on first use", func(t *testing.T) {
+		g := NewChunkedGrid(source, 0)
+		require.Zero(t, g.LoadedChunks())
+		ok, err := g.Has(ctx, 1, -1, 0)
+		require.NoError(t, err)
+		require.True(t, ok)
+		ok, _ = g.Has(ctx, 0, 0, 0)
+		require.True(t, ok)
+		require.Equal(t, 1, source.loads, "Chunk should be loaded once")
+		g.Has(ctx, -1, 1, 0)
+		ok, _ = g.Has(ctx, -2, 2, 0)
+		require.False(t, ok)
+		require.Equal(t, 2, source.loads, "Empty chunks should be cached too")
+	})
+	t.Run("Evicts least recently used", func(t *testing.T) {
+		source.loads = 0
+		g := NewChunkedGrid(source, 1)
+		g.Has(ctx, 0, 0, 0)
+		g.Has(ctx, far.X, far.Y, far.Z)
+		require.Equal(t, 1, g.LoadedChunks())
+		g.Has(ctx, 0, 0, 0)
+		require.Equal(t, 3, source.loads, "Evicted chunk should be loaded again")
+	})
+	t.Run("Saves changed chunks on eviction", func(t *testing.T) {
+		source.saves = 0
+		g := NewChunkedGrid(source, 1)
+		wall := newLoc(2, -2, 0)
+		wall.Status = "wall"
+		require.NoError(t, g.Set(ctx, wall))
+		g.Has(ctx, far.X, far.Y, far.Z)
+		require.Equal(t, 1, source.saves)
+		require.Equal(t, 1, g.LoadedChunks())
+		require.Len(t, source.chunks[ChunkFor(0, 0, 0)], 3)
+
+		status, ok, _ := NewChunkedGrid(source, 1).Status(ctx, 2, -2, 0)
+		require.True(t, ok)
+		require.Equal(t, "wall", status)
+	})
+	t.Run("Keeps changed chunks it can't save", func(t *testing.T) {
+		g := NewChunkedGrid(loadOnly{source}, 1)
+		require.NoError(t, g.Delete(ctx, 0, 0, 0))
+		g.Has(ctx, far.X, far.Y, far.Z)
+		require.Equal(t, 2, g.LoadedChunks(), "Changed chunk should stay in memory")
+		ok, _ := g.Has(ctx, 0, 0, 0)
+		require.False(t, ok)
+	})
+	t.Run("Keeps properties and attributes", func(t *testing.T) {
+		g := NewChunkedGrid(source, 1)
+		ford := newLoc(3, -3, 0)
+		ford.Properties = &Properties{Terrain: "water", Tags: []string{"ford"}}
+		ford.Attributes = map[string]interface{}{"depth": 2}
+		require.NoError(t, g.Set(ctx, ford))
+		g.Has(ctx, far.X, far.Y, far.Z)
+
+		loc, ok, err := NewChunkedGrid(source, 1).At(ctx, 3, -3, 0)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, ford, loc, "Properties and attributes should survive a save and reload")
+	})
+	t.Run("Flush saves changed chunks", func(t *testing.T) {
+		source.saves = 0
+		g := NewChunkedGrid(source, 0)
+		require.NoError(t, g.Delete(ctx, 2, -2, 0))
+		g.Has(ctx, far.X, far.Y, far.Z)
+		require.NoError(t, g.Flush(ctx))
+		require.Equal(t, 1, source.saves, "Only the changed chunk should be saved")
+		require.NoError(t, g.Flush(ctx))
+		require.Equal(t, 1, source.saves, "A saved chunk is no longer changed")
+		ok, _ := NewChunkedGrid(source, 0).Has(ctx, 2, -2, 0)
+		require.False(t, ok)
+	})
+}
+
+func TestChunkLocs(t *testing.T) {
+	ctx := context.Background()
+	g := NewChunkedGrid(nil, 0)
+	g.Set(ctx, newLoc(1, 2, -3))
+	g.Set(ctx, newLoc(0, 5, -5))
+	locs, err := g.ChunkLocs(ctx, ChunkFor(0, 0, -1))
+	require.NoError(t, err)
+	require.Equal(t, []Loc{newLoc(0, 5, -5), newLoc(1, 2, -3)}, locs)
+	locs, err = g.ChunkLocs(ctx, ChunkKey{7, 7})
+	require.NoError(t, err)
+	require.Nil(t, locs)
+}
+
+func BenchmarkChunkedGridStatus(b *testing.B) {
+	ctx := context.Background()
+	g := NewChunkedGrid(nil, 0)
+	g.Build(ctx, 1000, 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x := i%1000 - 500
+		g.Status(ctx, x, 0, -x)
+	}
+}
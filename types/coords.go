@@ -0,0 +1,162 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// OffsetKind names one of the four offset coordinate layouts. The "r" kinds shove every other row sideways and go
+// with pointy-top hexes; the "q" kinds shove every other column and go with flat-top hexes.
+type OffsetKind string
+
+// Supported offset layouts
+const (
+	OddR  OffsetKind = "odd-r"
+	EvenR OffsetKind = "even-r"
+	OddQ  OffsetKind = "odd-q"
+	EvenQ OffsetKind = "even-q"
+)
+
+// DoubledKind names one of the two doubled coordinate layouts
+type DoubledKind string
+
+// Supported doubled layouts. DoubledWidth goes with pointy-top hexes and DoubledHeight with flat-top hexes.
+const (
+	DoubledWidth  DoubledKind = "width"
+	DoubledHeight DoubledKind = "height"
+)
+
+// OffsetCoord is a col,row position in one of the offset layouts
+type OffsetCoord struct {
+	Col  int        `json:"col"`
+	Row  int        `json:"row"`
+	Kind OffsetKind `json:"kind"`
+}
+
+// DoubledCoord is a col,row position in one of the doubled layouts. Only positions where col+row is even are valid.
+type DoubledCoord struct {
+	Col  int         `json:"col"`
+	Row  int         `json:"row"`
+	Kind DoubledKind `json:"kind"`
+}
+
+// OffsetFromLoc converts a loc into the specified offset layout
+func OffsetFromLoc(loc Loc, kind OffsetKind) (OffsetCoord, error) {
+	q, r := loc.X, loc.Z
+	result := OffsetCoord{Kind: kind}
+	switch kind {
+	case OddR:
+		result.Col, result.Row = q+(r-(r&1))/2, r
+	case EvenR:
+		result.Col, result.Row = q+(r+(r&1))/2, r
+	case OddQ:
+		result.Col, result.Row = q, r+(q-(q&1))/2
+	case EvenQ:
+		result.Col, result.Row = q, r+(q+(q&1))/2
+	default:
+		return result, fmt.Errorf("unknown offset kind: %s", kind)
+	}
+	return result, nil
+}
+
+// ToLoc converts the offset coordinate back to a loc
+func (o OffsetCoord) ToLoc() (Loc, error) {
+	var q, r int
+	switch o.Kind {
+	case OddR:
+		q, r = o.Col-(o.Row-(o.Row&1))/2, o.Row
+	case EvenR:
+		q, r = o.Col-(o.Row+(o.Row&1))/2, o.Row
+	case OddQ:
+		q, r = o.Col, o.Row-(o.Col-(o.Col&1))/2
+	case EvenQ:
+		q, r = o.Col, o.Row-(o.Col+(o.Col&1))/2
+	default:
+		return Loc{}, fmt.Errorf("unknown offset kind: %s", o.Kind)
+	}
+	return LocFromCoords(q, -q-r, r)
+}
+
+// DoubledFromLoc converts a loc into the specified doubled layout
+func DoubledFromLoc(loc Loc, kind DoubledKind) (DoubledCoord, error) {
+	q, r := loc.X, loc.Z
+	result := DoubledCoord{Kind: kind}
+	switch kind {
+	case DoubledWidth:
+		result.Col, result.Row = 2*q+r, r
+	case DoubledHeight:
+		result.Col, result.Row = q, 2*r+q
+	default:
+		return result, fmt.Errorf("unknown doubled kind: %s", kind)
+	}
+	return result, nil
+}
+
+// ToLoc converts the doubled coordinate back to a loc
+func (d DoubledCoord) ToLoc() (Loc, error) {
+	if (d.Col+d.Row)&1 != 0 {
+		return Loc{}, fmt.Errorf("doubled coordinates must have an even col+row sum. Got: %d,%d", d.Col, d.Row)
+	}
+	var q, r int
+	switch d.Kind {
+	case DoubledWidth:
+		q, r = (d.Col-d.Row)/2, d.Row
+	case DoubledHeight:
+		q, r = d.Col, (d.Row-d.Col)/2
+	default:
+		return Loc{}, fmt.Errorf("unknown doubled kind: %s", d.Kind)
+	}
+	return LocFromCoords(q, -q-r, r)
+}
+
+// convertAlternate parses the alternate string forms accepted by LocConvert:
+//
+//	a:q,r              axial, where q is x and r is z
+//	o:col,row          odd-r offset
+//	o:kind:col,row     offset of the named kind (odd-r, even-r, odd-q, even-q)
+//	d:col,row          doubled width
+//	d:kind:col,row     doubled of the named kind (width, height)
+func convertAlternate(loc string) (x int, y int, z int, err error) {
+	parts := strings.Split(loc, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return x, y, z, fmt.Errorf("alternate coords must be of the format 'prefix:a,b' or 'prefix:kind:a,b'. Got: %s", loc)
+	}
+	kind := ""
+	if len(parts) == 3 {
+		kind = parts[1]
+	}
+	ab := strings.Split(parts[len(parts)-1], ",")
+	if len(ab) != 2 {
+		return x, y, z, fmt.Errorf("alternate coords must be a pair of the format 'a,b'. Got: %s", loc)
+	}
+	var a, b int
+	if a, err = strconv.Atoi(ab[0]); err == nil {
+		b, err = strconv.Atoi(ab[1])
+	}
+	if err != nil {
+		return x, y, z, fmt.Errorf("could not parse alternate coords as integers. Got: %s", loc)
+	}
+
+	var result Loc
+	switch parts[0] {
+	case "a":
+		if kind != "" {
+			return x, y, z, fmt.Errorf("axial coords take no kind. Got: %s", loc)
+		}
+		return a, -a - b, b, nil
+	case "o":
+		if kind == "" {
+			kind = string(OddR)
+		}
+		result, err = OffsetCoord{Col: a, Row: b, Kind: OffsetKind(kind)}.ToLoc()
+	case "d":
+		if kind == "" {
+			kind = string(DoubledWidth)
+		}
+		result, err = DoubledCoord{Col: a, Row: b, Kind: DoubledKind(kind)}.ToLoc()
+	default:
+		return x, y, z, fmt.Errorf("unknown coords prefix %q. Expected one of a, o or d. Got: %s", parts[0], loc)
+	}
+	return result.X, result.Y, result.Z, err
+}
@@ -0,0 +1,107 @@
+package types
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffsetRoundTrip(t *testing.T) {
+	g := Grid{}
+	g.BuildHex(5)
+	for _, kind := range []OffsetKind{OddR, EvenR, OddQ, EvenQ} {
+		t.Run(string(kind), func(t *testing.T) {
+			seen := map[OffsetCoord]bool{}
+			for _, loc := range g.Locs() {
+				o, err := OffsetFromLoc(loc, kind)
+				require.NoError(t, err)
+				require.False(t, seen[o], "Offset coords should be unique per loc. Got a repeat of %v", o)
+				seen[o] = true
+				back, err := o.ToLoc()
+				require.NoError(t, err)
+				require.Equal(t, loc, back)
+			}
+		})
+	}
+}
+
+func TestOffsetKnownValues(t *testing.T) {
+	var cases = []struct {
+		loc      Loc
+		expected OffsetCoord
+	}{
+		{newLoc(0, 0, 0), OffsetCoord{0, 0, OddR}},
+		{newLoc(0, -1, 1), OffsetCoord{0, 1, OddR}},
+		{newLoc(0, -1, 1), OffsetCoord{1, 1, EvenR}},
+		{newLoc(-1, 2, -1), OffsetCoord{-2, -1, OddR}},
+		{newLoc(1, -1, 0), OffsetCoord{1, 0, OddQ}},
+		{newLoc(1, -1, 0), OffsetCoord{1, 1, EvenQ}},
+	}
+	for num, c := range cases {
+		t.Run(fmt.Sprintf("case#%d", num), func(t *testing.T) {
+			actual, err := OffsetFromLoc(c.loc, c.expected.Kind)
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, actual)
+		})
+	}
+}
+
+func TestDoubledRoundTrip(t *testing.T) {
+	g := Grid{}
+	g.BuildHex(5)
+	for _, kind := range []DoubledKind{DoubledWidth, DoubledHeight} {
+		t.Run(string(kind), func(t *testing.T) {
+			for _, loc := range g.Locs() {
+				d, err := DoubledFromLoc(loc, kind)
+				require.NoError(t, err)
+				require.Equal(t, 0, (d.Col+d.Row)&1, "Doubled coords always have an even sum")
+				back, err := d.ToLoc()
+				require.NoError(t, err)
+				require.Equal(t, loc, back)
+			}
+		})
+	}
+	_, err := DoubledCoord{Col: 1, Row: 2, Kind: DoubledWidth}.ToLoc()
+	require.Error(t, err, "Odd col+row sum isn't a hex")
+	_, err = DoubledCoord{Col: 1, Row: 1, Kind: "diagonal"}.ToLoc()
+	require.Error(t, err)
+}
+
+func TestLocConvertAlternateForms(t *testing.T) {
+	var cases = []struct {
+		input    string
+		expected string
+	}{
+		{"a:2,-1", "2.-1.-1"},
+		{"o:3,4", "1.-5.4"},
+		{"o:odd-r:3,4", "1.-5.4"},
+		{"o:even-q:1,1", "1.-1.0"},
+		{"d:4,0", "2.-2.0"},
+		{"d:height:1,3", "1.-2.1"},
+	}
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			loc, err := LocFromString(c.input)
+			require.NoErrorf(t, err, "Didn't want an error converting %s. Got: %s", c.input, err)
+			assert.Equal(t, c.expected, loc.ID)
+		})
+	}
+}
+
+func TestLocConvertAlternateFormsNegative(t *testing.T) {
+	testCases := []string{
+		"a:2",
+		"a:2,x",
+		"a:odd-r:2,1",
+		"o:sideways:1,2",
+		"d:1,2",
+		"q:1,2",
+		"o:a:b:1,2",
+	}
+	for _, test := range testCases {
+		_, _, _, err := LocConvert(test)
+		require.Errorf(t, err, "Malformed alternate coords %s should throw an error", test)
+	}
+}
@@ -0,0 +1,70 @@
+package types
+
+// CubeKey identifies a hex by its x, y and z coords. It is cheap to build, compare and hash, so it is used in place of
+// the "x.y.z" string ID everywhere except persistence and HTTP. All three coords are kept, at full width, since locs
+// are not required to sum to 0 and two locs differing only in z must not share a key.
+type CubeKey struct {
+	x, y, z int
+}
+
+// NewCubeKey returns the key for the hex at x,y,z
+func NewCubeKey(x int, y int, z int) CubeKey {
+	return CubeKey{x: x, y: y, z: z}
+}
+
+// KeyFromString returns the key for a loc string in any form accepted by LocConvert
+func KeyFromString(loc string) (CubeKey, error) {
+	x, y, z, err := LocConvert(loc)
+	return NewCubeKey(x, y, z), err
+}
+
+// Key returns the CubeKey for the loc's coords
+func (l Loc) Key() CubeKey {
+	return NewCubeKey(l.X, l.Y, l.Z)
+}
+
+// Coords returns the key's x,y,z
+func (k CubeKey) Coords() (x int, y int, z int) {
+	return k.x, k.y, k.z
+}
+
+// Loc returns a "new" Loc at the key's coords
+func (k CubeKey) Loc() Loc {
+	result, _ := LocFromCoords(k.Coords())
+	return result
+}
+
+// String returns the key in the "x.y.z" form used for Loc IDs
+func (k CubeKey) String() string {
+	x, y, z := k.Coords()
+	return formatID(x, y, z)
+}
+
+// Distance returns the number of hex steps between the two keys
+func (k CubeKey) Distance(other CubeKey) int {
+	x1, y1, z1 := k.Coords()
+	x2, y2, z2 := other.Coords()
+	return cubeDistance(x1-x2, y1-y2, z1-z2)
+}
+
+// cubeDistance returns the hex distance covered by a cube coordinate delta
+func cubeDistance(dx int, dy int, dz int) int {
+	return max3(abs(dx), abs(dy), abs(dz))
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func max3(a int, b int, c int) int {
+	if b > a {
+		a = b
+	}
+	if c > a {
+		a = c
+	}
+	return a
+}
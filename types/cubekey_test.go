@@ -0,0 +1,133 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCubeKey(t *testing.T) {
+	for _, xyz := range [][3]int{{0, 0, 0}, {1, -1, 0}, {-7, 3, 4}, {5, -9, 4}, {math.MaxInt32, math.MinInt32 + 1, 0}, {-1 << 20, 1 << 19, 1 << 19}} {
+		t.Run(fmt.Sprint(xyz), func(t *testing.T) {
+			key := NewCubeKey(xyz[0], xyz[1], xyz[2])
+			x, y, z := key.Coords()
+			require.Equal(t, xyz, [3]int{x, y, z}, "Coords should survive the key")
+			require.Equal(t, newLoc(x, y, z).ID, key.String())
+			require.Equal(t, key, newLoc(x, y, z).Key())
+		})
+	}
+	require.NotEqual(t, NewCubeKey(0, -1, 1), NewCubeKey(-1, 0, 1), "Negative y must not bleed into x")
+	require.NotEqual(t, NewCubeKey(1<<32, 0, 0), NewCubeKey(0, 0, 0), "Coords beyond 32 bits must not wrap")
+}
+
+func TestCubeKeyCollision(t *testing.T) {
+	first, err := LocFromString("5.6.7")
+	require.NoError(t, err)
+	second, err := LocFromString("5.6.-11")
+	require.NoError(t, err)
+	require.NotEqual(t, first.Key(), second.Key(), "Locs differing only in z must not share a key")
+
+	g := GridFromLocs([]Loc{first, second})
+	require.Equal(t, 2, g.Len())
+	require.Equal(t, first, g.GetLoc("5.6.7"))
+	require.Equal(t, second, g.GetLoc("5.6.-11"))
+}
+
+func TestKeyFromString(t *testing.T) {
+	key, err := KeyFromString("3.-5.2")
+	require.NoError(t, err)
+	require.Equal(t, NewCubeKey(3, -5, 2), key)
+	key, err = KeyFromString("a:3,2")
+	require.NoError(t, err)
+	require.Equal(t, NewCubeKey(3, -5, 2), key, "Alternate forms should be accepted")
+	_, err = KeyFromString("3.-5")
+	require.Error(t, err)
+}
+
+func TestCubeKeyDistance(t *testing.T) {
+	a, b := newLoc(-2, 5, -3), newLoc(4, -1, -3)
+	require.Equal(t, 6, a.Key().Distance(b.Key()))
+	require.Equal(t, a.DistanceFrom(b), a.Key().Distance(b.Key()))
+	require.Equal(t, 0, a.Key().Distance(a.Key()))
+}
+
+func TestGridAt(t *testing.T) {
+	g := Grid{}
+	g.BuildHex(2)
+	loc, ok := g.At(2, -1, -1)
+	require.True(t, ok)
+	require.Equal(t, "2.-1.-1", loc.ID)
+	_, ok = g.At(3, -1, -2)
+	require.False(t, ok)
+	loc, ok = g.Get(NewCubeKey(-1, 2, -1))
+	require.True(t, ok)
+	require.Equal(t, "-1.2.-1", loc.ID)
+	require.Equal(t, Loc{}, g.GetLoc("not.a.loc"), "Bad IDs should find nothing")
+}
+
+/*** Benchmarks. Each pair compares the old string or float approach with its replacement ***/
+
+func BenchmarkLookupBySprintfID(b *testing.B) {
+	g := Grid{}
+	g.BuildHex(50)
+	byID := map[string]Loc{}
+	for _, loc := range g.Locs() {
+		byID[loc.ID] = loc
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x := i%101 - 50
+		_ = byID[fmt.Sprintf("%d.%d.%d", x, 0, -x)]
+	}
+}
+
+func BenchmarkGridAt(b *testing.B) {
+	g := Grid{}
+	g.BuildHex(50)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x := i%101 - 50
+		g.At(x, 0, -x)
+	}
+}
+
+func BenchmarkDistanceFloat(b *testing.B) {
+	l, target := newLoc(-20, 7, 13), newLoc(31, -40, 9)
+	for i := 0; i < b.N; i++ {
+		dx := math.Abs(float64(l.X) - float64(target.X))
+		dy := math.Abs(float64(l.Y) - float64(target.Y))
+		dz := math.Abs(float64(l.Z) - float64(target.Z))
+		_ = int(math.Max(math.Max(dx, dy), dz))
+	}
+}
+
+func BenchmarkDistanceFrom(b *testing.B) {
+	l, target := newLoc(-20, 7, 13), newLoc(31, -40, 9)
+	for i := 0; i < b.N; i++ {
+		l.DistanceFrom(target)
+	}
+}
+
+func BenchmarkSprintfID(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_ = fmt.Sprintf("%d.%d.%d", i, -i-3, 3)
+	}
+}
+
+func BenchmarkLocFromCoords(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		LocFromCoords(i, -i-3, 3)
+	}
+}
+
+func BenchmarkGridNeighbors(b *testing.B) {
+	g := Grid{}
+	g.BuildHex(50)
+	locs := g.Locs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.Neighbors(locs[i%len(locs)])
+	}
+}
@@ -0,0 +1,95 @@
+package types
+
+import (
+	"sort"
+)
+
+// arc is a span of angle around the FOV origin, measured in whole turns so a full circle is 0 to 1
+type arc struct {
+	lo, hi float64
+}
+
+// shadows is a sorted list of non-overlapping arcs that are blocked from view
+type shadows []arc
+
+// FieldOfView returns every loc of the grid within radius of origin that can be seen from it, keyed by ID. Opaque
+// locs block the view of whatever is behind them, but are themselves visible. The origin is always visible.
+//
+// The view is computed with ring based shadowcasting: each ring around the origin is walked in angle order, where
+// loc i of the 6 * k locs in ring k covers the arc from (i - 0.5) / 6k to (i + 0.5) / 6k. A loc is visible if the
+// center of its arc is not in the shadow of a nearer ring, and a visible opaque loc adds its arc to the shadows for
+// the rings beyond it. Centers exactly on the edge of a shadow are visible. Locs that are not in the grid are never visible and never block.
+func (g *Grid) FieldOfView(origin Loc, radius int, opaque func(Loc) bool) map[string]Loc {
+	result := map[string]Loc{}
+	if stored, ok := g.locs[origin.Key()]; ok {
+		result[stored.GetID()] = stored
+	}
+	var blocked shadows
+	for k := 1; k <= radius; k++ {
+		ring := Ring(origin, k)
+		size := float64(len(ring))
+		var cast []arc
+		for i, loc := range ring {
+			key := loc.Key()
+			stored, ok := g.locs[key]
+			if !ok {
+				continue
+			}
+			if blocked.covers(float64(i) / size) {
+				continue
+			}
+			result[stored.GetID()] = stored
+			if opaque(stored) {
+				cast = append(cast, arc{(float64(i) - 0.5) / size, (float64(i) + 0.5) / size})
+			}
+		}
+		if len(cast) == 0 {
+			continue
+		}
+		blocked = blocked.add(cast)
+		if blocked.full() {
+			break
+		}
+	}
+	return result
+}
+
+// covers reports whether the angle lies strictly inside one of the shadows. Angles exactly on the edge of a shadow
+// are left visible, so a loc peeking out from behind a corner can be seen.
+func (s shadows) covers(angle float64) bool {
+	i := sort.Search(len(s), func(i int) bool { return s[i].hi > angle+1e-9 })
+	return i < len(s) && s[i].lo < angle-1e-9
+}
+
+// full reports whether the shadows block the whole circle
+func (s shadows) full() bool {
+	return len(s) == 1 && s[0].lo <= 0 && s[0].hi >= 1
+}
+
+// add merges the new arcs into the shadows. Arcs that cross angle 0 are split in two.
+func (s shadows) add(arcs []arc) shadows {
+	all := append(shadows{}, s...)
+	for _, a := range arcs {
+		switch {
+		case a.lo < 0:
+			all = append(all, arc{0, a.hi}, arc{a.lo + 1, 1})
+		case a.hi > 1:
+			all = append(all, arc{a.lo, 1}, arc{0, a.hi - 1})
+		default:
+			all = append(all, a)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].lo < all[j].lo })
+	merged := all[:1]
+	for _, a := range all[1:] {
+		last := &merged[len(merged)-1]
+		if a.lo <= last.hi+1e-9 {
+			if a.hi > last.hi {
+				last.hi = a.hi
+			}
+			continue
+		}
+		merged = append(merged, a)
+	}
+	return merged
+}
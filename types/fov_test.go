@@ -0,0 +1,104 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldOfView(t *testing.T) {
+	isWall := func(l Loc) bool { return l.Status == "wall" }
+
+	t.Run("Open field", func(t *testing.T) {
+		g := Grid{}
+		g.BuildHex(5)
+		result := g.FieldOfView(newLoc(0, 0, 0), 3, isWall)
+		require.Len(t, result, 37, "Everything within radius 3 should be visible with nothing blocking")
+		_, ok := result["4.-4.0"]
+		require.False(t, ok, "Locs beyond the radius should not be visible")
+	})
+	t.Run("Wall casts a shadow", func(t *testing.T) {
+		g := Grid{}
+		g.BuildHex(5)
+		SetStatus(&g, "wall", "1.-1.0")
+		result := g.FieldOfView(newLoc(0, 0, 0), 5, isWall)
+		require.Contains(t, result, "1.-1.0", "The wall itself is visible")
+		for _, hidden := range []string{"2.-2.0", "3.-3.0", "5.-5.0"} {
+			require.NotContains(t, result, hidden, "Straight behind the wall should be hidden")
+		}
+		for _, seen := range []string{"2.-1.-1", "1.0.-1", "-2.2.0"} {
+			require.Contains(t, result, seen, "Off to the side of the wall should be visible")
+		}
+	})
+	t.Run("Walled in", func(t *testing.T) {
+		g := Grid{}
+		g.BuildHex(5)
+		for _, n := range newLoc(0, 0, 0).Neighbors() {
+			SetStatus(&g, "wall", n.ID)
+		}
+		result := g.FieldOfView(newLoc(0, 0, 0), 5, isWall)
+		require.Len(t, result, 7, "Only the origin and the surrounding walls should be visible")
+	})
+	t.Run("Missing locs", func(t *testing.T) {
+		g := GridFromLocs([]Loc{newLoc(0, 0, 0), newLoc(2, -2, 0)})
+		result := g.FieldOfView(newLoc(0, 0, 0), 3, isWall)
+		require.Len(t, result, 2, "Holes in the grid neither show nor block")
+	})
+	t.Run("Radius zero", func(t *testing.T) {
+		g := Grid{}
+		g.BuildHex(2)
+		result := g.FieldOfView(newLoc(0, 0, 0), 0, isWall)
+		require.Len(t, result, 1)
+	})
+}
+
+func TestShadows(t *testing.T) {
+	var s shadows
+	s = s.add([]arc{{0.1, 0.2}, {0.2, 0.3}})
+	require.Equal(t, shadows{{0.1, 0.3}}, s, "Touching arcs should merge")
+	s = s.add([]arc{{-0.05, 0.05}})
+	require.Equal(t, shadows{{0, 0.05}, {0.1, 0.3}, {0.95, 1}}, s, "Arcs across 0 should split")
+	require.True(t, s.covers(0.97))
+	require.False(t, s.covers(0.5))
+	require.False(t, s.full())
+	s = s.add([]arc{{0.05, 0.95}})
+	require.True(t, s.full())
+}
+
+func BenchmarkFieldOfView(b *testing.B) {
+	g := Grid{}
+	g.BuildHex(57) // just under 10k hexes
+	for i, loc := range g.Locs() {
+		if i%7 == 0 {
+			SetStatus(&g, "wall", loc.ID)
+		}
+	}
+	isWall := func(l Loc) bool { return l.Status == "wall" }
+	origin := newLoc(0, 0, 0)
+	SetStatus(&g, "new", origin.ID)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.FieldOfView(origin, 20, isWall)
+	}
+}
+
+/*** Helper functions ***/
+
+// SetStatus changes the status of each of the listed locs in the grid
+func SetStatus(g *Grid, status string, ids ...string) {
+	for _, id := range ids {
+		key := mustKey(id)
+		loc := g.locs[key]
+		loc.Status = status
+		g.locs[key] = loc
+	}
+}
+
+// mustKey converts a loc string to its CubeKey, panicking on a malformed string
+func mustKey(id string) CubeKey {
+	key, err := KeyFromString(id)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
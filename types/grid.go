@@ -1,12 +1,12 @@
 package types
 
 import (
-//	"webstuff/types"
+	"sort"
 )
 
 // Grid is a collection of Locs and helper functions to work with them
 type Grid struct {
-	locs map[string]Loc
+	locs map[CubeKey]Loc
 	xmin, xmax int
 	ymin, ymax int
 	zmin, zmax int
@@ -15,7 +15,7 @@ type Grid struct {
 // Build creates a grid of Loc objects spanning a size of x by y. the z axis will be calculated as a funciton 
 // of x and y. The center of the grid will be 0,0,0.
 func (g *Grid) Build(xSize int, ySize int) {
-	g.locs = map[string]Loc{}
+	g.locs = map[CubeKey]Loc{}
 
 	g.xmax = xSize/2
 	g.xmin = g.xmax * -1
@@ -28,15 +28,84 @@ func (g *Grid) Build(xSize int, ySize int) {
 			if z < g.zmin {g.zmin = z}
 			if z > g.zmax {g.zmax = z}
 			if loc, err := LocFromCoords(x,y,z); err == nil {
-				g.locs[loc.ID] = loc
+				g.locs[loc.Key()] = loc
 			}
 		}
 	}
 }
 
-// GetLoc returns the loc with the specified ID
+// BuildHex creates a hexagon shaped grid of Loc objects with the specified radius around 0,0,0. A radius of 0
+// yields the single center Loc.
+func (g *Grid) BuildHex(radius int) {
+	g.locs = map[CubeKey]Loc{}
+
+	g.xmin, g.xmax = -radius, radius
+	g.ymin, g.ymax = -radius, radius
+	g.zmin, g.zmax = -radius, radius
+
+	for x := -radius; x <= radius; x++ {
+		for y := -radius; y <= radius; y++ {
+			z := (x + y) * -1
+			if z < -radius || z > radius {
+				continue
+			}
+			if loc, err := LocFromCoords(x, y, z); err == nil {
+				g.locs[loc.Key()] = loc
+			}
+		}
+	}
+}
+
+// GridFromLocs creates a grid holding the specified locs, with bounds spanning all of them
+func GridFromLocs(locs []Loc) Grid {
+	g := Grid{locs: make(map[CubeKey]Loc, len(locs))}
+	for i, loc := range locs {
+		if i == 0 {
+			g.xmin, g.xmax = loc.X, loc.X
+			g.ymin, g.ymax = loc.Y, loc.Y
+			g.zmin, g.zmax = loc.Z, loc.Z
+		}
+		g.include(loc)
+	}
+	return g
+}
+
+// Put adds the loc to the grid, replacing any loc already at the same position, and widens the bounds to cover it
+func (g *Grid) Put(loc Loc) {
+	if g.locs == nil {
+		*g = GridFromLocs([]Loc{loc})
+		return
+	}
+	g.include(loc)
+}
+
+// include adds the loc to the grid and widens the bounds to cover it
+func (g *Grid) include(loc Loc) {
+	g.locs[loc.Key()] = loc
+	if loc.X < g.xmin {g.xmin = loc.X}
+	if loc.X > g.xmax {g.xmax = loc.X}
+	if loc.Y < g.ymin {g.ymin = loc.Y}
+	if loc.Y > g.ymax {g.ymax = loc.Y}
+	if loc.Z < g.zmin {g.zmin = loc.Z}
+	if loc.Z > g.zmax {g.zmax = loc.Z}
+}
+
+// GetLoc returns the loc with the specified ID, or the zero Loc if the grid doesn't hold it
 func (g *Grid) GetLoc(id string) Loc {
-	return g.locs[id]
+	loc, _ := g.Lookup(id)
+	return loc
+}
+
+// At returns the loc at x,y,z and whether the grid holds it
+func (g *Grid) At(x int, y int, z int) (Loc, bool) {
+	loc, ok := g.locs[NewCubeKey(x, y, z)]
+	return loc, ok
+}
+
+// Get returns the loc with the specified key and whether the grid holds it
+func (g *Grid) Get(key CubeKey) (Loc, bool) {
+	loc, ok := g.locs[key]
+	return loc, ok
 }
 
 // XMin getter
@@ -56,3 +125,21 @@ func (g *Grid) ZMin() int { return g.zmin }
 
 // ZMax getter
 func (g *Grid) ZMax() int { return g.zmax }
+
+// Len returns the number of Locs in the grid
+func (g *Grid) Len() int { return len(g.locs) }
+
+// Locs returns every Loc in the grid, ordered by x then y
+func (g *Grid) Locs() []Loc {
+	result := make([]Loc, 0, len(g.locs))
+	for _, loc := range g.locs {
+		result = append(result, loc)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].X != result[j].X {
+			return result[i].X < result[j].X
+		}
+		return result[i].Y < result[j].Y
+	})
+	return result
+}
@@ -19,4 +19,41 @@ func TestBuildPositive(t *testing.T) {
 	require.Equal(t,  2, target.YMax())
 	require.Equal(t, -4, target.ZMin())
 	require.Equal(t,  4, target.ZMax())
-}
\ No newline at end of file
+}
+
+func TestBuildHex(t *testing.T) {
+	target := Grid{}
+	target.BuildHex( 2 )
+	require.Equal(t, 19, target.Len())
+	require.Equal(t, "2.-2.0", target.GetLoc("2.-2.0").GetID())
+	require.Equal(t, "", target.GetLoc("2.2.-4").GetID(), "Corners outside the radius should not be built")
+	require.Equal(t, -2, target.ZMin())
+	require.Equal(t,  2, target.ZMax())
+
+	target.BuildHex( 0 )
+	require.Equal(t, 1, target.Len())
+}
+
+func TestLocsOrdered(t *testing.T) {
+	target := Grid{}
+	target.BuildHex( 1 )
+	locs := target.Locs()
+	require.Len(t, locs, 7)
+	require.Equal(t, "-1.0.1", locs[0].GetID())
+	require.Equal(t, "1.0.-1", locs[6].GetID())
+}
+
+func TestGridFromLocs(t *testing.T) {
+	target := GridFromLocs([]Loc{ newLoc(3, -1, -2), newLoc(-2, 5, -3), newLoc(1, 1, -2) })
+	require.Equal(t, 3, target.Len())
+	require.Equal(t, -2, target.XMin())
+	require.Equal(t,  3, target.XMax())
+	require.Equal(t, -1, target.YMin())
+	require.Equal(t,  5, target.YMax())
+	require.Equal(t, -3, target.ZMin())
+	require.Equal(t, -2, target.ZMax())
+
+	empty := GridFromLocs(nil)
+	require.Equal(t, 0, empty.Len())
+	require.Equal(t, 0, empty.XMax())
+}
@@ -0,0 +1,104 @@
+package types
+
+import (
+	"fmt"
+	"math"
+)
+
+// Orientation picks which way the hexes of a Layout point
+type Orientation string
+
+// Supported orientations
+const (
+	PointyTop Orientation = "pointy"
+	FlatTop   Orientation = "flat"
+)
+
+// Point is a position in pixel space
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Layout maps between Locs and pixels. Size is the distance from a hex center to any corner and Origin is the pixel
+// position of the center of 0,0,0. The axial coordinates used for the math are q = X and r = Z.
+type Layout struct {
+	Orientation Orientation
+	Size        float64
+	Origin      Point
+}
+
+var sqrt3 = math.Sqrt(3)
+
+// ParseOrientation converts an orientation name into an Orientation, defaulting to PointyTop when empty
+func ParseOrientation(name string) (Orientation, error) {
+	switch o := Orientation(name); o {
+	case PointyTop, FlatTop:
+		return o, nil
+	case "":
+		return PointyTop, nil
+	}
+	return "", fmt.Errorf("unknown orientation: %s", name)
+}
+
+// HexToPixel returns the pixel center of the loc
+func HexToPixel(layout Layout, loc Loc) Point {
+	q, r := float64(loc.X), float64(loc.Z)
+	var px, py float64
+	if layout.Orientation == FlatTop {
+		px = 1.5 * q
+		py = sqrt3/2*q + sqrt3*r
+	} else {
+		px = sqrt3*q + sqrt3/2*r
+		py = 1.5 * r
+	}
+	return Point{X: px*layout.Size + layout.Origin.X, Y: py*layout.Size + layout.Origin.Y}
+}
+
+// PixelToHex returns the loc whose hex contains the pixel
+func PixelToHex(layout Layout, px float64, py float64) Loc {
+	px = (px - layout.Origin.X) / layout.Size
+	py = (py - layout.Origin.Y) / layout.Size
+	var q, r float64
+	if layout.Orientation == FlatTop {
+		q = 2.0 / 3 * px
+		r = -1.0/3*px + sqrt3/3*py
+	} else {
+		q = sqrt3/3*px - 1.0/3*py
+		r = 2.0 / 3 * py
+	}
+	x, y, z := CubeRound(q, -q-r, r)
+	result, _ := LocFromCoords(x, y, z)
+	return result
+}
+
+// CubeRound rounds fractional cube coordinates to the containing hex. Each axis is rounded, then the axis that moved
+// furthest is recomputed from the other two so the result still sums to zero.
+func CubeRound(fx float64, fy float64, fz float64) (x int, y int, z int) {
+	rx, ry, rz := math.Round(fx), math.Round(fy), math.Round(fz)
+	dx, dy, dz := math.Abs(rx-fx), math.Abs(ry-fy), math.Abs(rz-fz)
+	switch {
+	case dx > dy && dx > dz:
+		rx = -ry - rz
+	case dy > dz:
+		ry = -rx - rz
+	default:
+		rz = -rx - ry
+	}
+	return int(rx), int(ry), int(rz)
+}
+
+// Corners returns the six pixel corners of the loc's hex, clockwise in screen space
+func Corners(layout Layout, loc Loc) [6]Point {
+	c := HexToPixel(layout, loc)
+	offset := -30.0
+	if layout.Orientation == FlatTop {
+		offset = 0
+	}
+	var result [6]Point
+	for i := range result {
+		angle := (60*float64(i) + offset) * math.Pi / 180
+		result[i] = Point{X: c.X + layout.Size*math.Cos(angle), Y: c.Y + layout.Size*math.Sin(angle)}
+	}
+	return result
+}
@@ -0,0 +1,94 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHexToPixel(t *testing.T) {
+	var cases = []struct {
+		orientation Orientation
+		loc         Loc
+		expected    Point
+	}{
+		{PointyTop, newLoc(0, 0, 0), Point{100, 50}},
+		{PointyTop, newLoc(1, -1, 0), Point{100 + 10*sqrt3, 50}},
+		{PointyTop, newLoc(0, -1, 1), Point{100 + 5*sqrt3, 65}},
+		{FlatTop, newLoc(1, -1, 0), Point{115, 50 + 5*sqrt3}},
+		{FlatTop, newLoc(0, -1, 1), Point{100, 50 + 10*sqrt3}},
+	}
+	for num, c := range cases {
+		t.Run(fmt.Sprintf("case#%d", num), func(t *testing.T) {
+			layout := Layout{Orientation: c.orientation, Size: 10, Origin: Point{100, 50}}
+			actual := HexToPixel(layout, c.loc)
+			assert.InDelta(t, c.expected.X, actual.X, 1e-9)
+			assert.InDelta(t, c.expected.Y, actual.Y, 1e-9)
+		})
+	}
+}
+
+func TestPixelToHex(t *testing.T) {
+	for _, o := range []Orientation{PointyTop, FlatTop} {
+		layout := Layout{Orientation: o, Size: 7.5, Origin: Point{-20, 33}}
+		g := Grid{}
+		g.BuildHex(4)
+		t.Run(string(o)+" centers", func(t *testing.T) {
+			for _, loc := range g.Locs() {
+				c := HexToPixel(layout, loc)
+				require.Equal(t, loc, PixelToHex(layout, c.X, c.Y))
+			}
+		})
+		t.Run(string(o)+" near corners", func(t *testing.T) {
+			for _, loc := range g.Locs() {
+				c := HexToPixel(layout, loc)
+				for _, corner := range Corners(layout, loc) {
+					// a point 90% of the way to a corner is still inside the hex
+					px := c.X + 0.9*(corner.X-c.X)
+					py := c.Y + 0.9*(corner.Y-c.Y)
+					require.Equal(t, loc.ID, PixelToHex(layout, px, py).ID)
+				}
+			}
+		})
+	}
+}
+
+func TestCubeRound(t *testing.T) {
+	x, y, z := CubeRound(0.4, 0.4, -0.8)
+	assert.Equal(t, []int{0, 1, -1}, []int{x, y, z}, "Axis furthest from an integer should be recomputed")
+	x, y, z = CubeRound(-1.1, 2.2, -1.1)
+	assert.Equal(t, []int{-1, 2, -1}, []int{x, y, z})
+	assert.Equal(t, 0, x+y+z)
+}
+
+func TestCorners(t *testing.T) {
+	for _, o := range []Orientation{PointyTop, FlatTop} {
+		t.Run(string(o), func(t *testing.T) {
+			layout := Layout{Orientation: o, Size: 10}
+			shared := 0
+			for _, a := range Corners(layout, newLoc(0, 0, 0)) {
+				assert.InDelta(t, 10, math.Hypot(a.X, a.Y), 1e-9, "Every corner is Size from the center")
+				for _, b := range Corners(layout, newLoc(1, -1, 0)) {
+					if math.Hypot(a.X-b.X, a.Y-b.Y) < 1e-9 {
+						shared++
+					}
+				}
+			}
+			assert.Equal(t, 2, shared, "Neighboring hexes should share an edge")
+		})
+	}
+}
+
+func TestParseOrientation(t *testing.T) {
+	o, err := ParseOrientation("")
+	require.NoError(t, err)
+	require.Equal(t, PointyTop, o)
+	o, err = ParseOrientation("flat")
+	require.NoError(t, err)
+	require.Equal(t, FlatTop, o)
+	_, err = ParseOrientation("sideways")
+	require.Error(t, err)
+}
@@ -2,7 +2,6 @@ package types
 
 import (
 	"bytes"
-	"math"
 	"fmt"
 	"strconv"
 	"strings"
@@ -14,15 +13,22 @@ type Location interface {
 	GetID() string
 }
 
-// Loc contains the coords and methods to handle a 3 axis location on a hex map
+// Loc contains the coords and methods to handle a 3 axis location on a hex map.
+// Properties and Attributes are optional hex data: typed fields every game feature can rely on, and free form values
+// for everything else.
 type Loc struct {
-	ID     string  `json:"id" bson:"_id"`
-	X      int     `json:"x"`
-	Y      int     `json:"y"`
-	Z      int     `json:"z"`
-	Status string  `json:"status"` // TODO: default to "new"
+	ID         string                 `json:"id" bson:"_id"`
+	X          int                    `json:"x"`
+	Y          int                    `json:"y"`
+	Z          int                    `json:"z"`
+	Status     string                 `json:"status"` // DefaultStatus unless set
+	Properties *Properties            `json:"properties,omitempty" bson:"properties,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty" bson:"attributes,omitempty"`
 }
 
+// DefaultStatus is the status of a freshly made Loc
+const DefaultStatus = "new"
+
 // GetID getter for ID field
 func(l Loc) GetID() string {
 	return l.ID
@@ -31,12 +37,24 @@ func(l Loc) GetID() string {
 // LocFromCoords generates a Loc instance from x, y and z coordinates.
 // Should enforce uniqueness at some point?
 func LocFromCoords( x int, y int, z int ) (result Loc, err error) {
-	id := fmt.Sprintf( "%d.%d.%d", x, y, z )
-	result = Loc{ id, x, y, z, "new" }
+	id := formatID( x, y, z )
+	result = Loc{ ID: id, X: x, Y: y, Z: z, Status: DefaultStatus }
 	return result, err
 }
 
-// LocFromString generates a Loc instance from a string containing the coords in the format 'x.y.z'
+// formatID builds the "x.y.z" ID string. Appending into a stack buffer keeps it to the one allocation for the string.
+func formatID(x int, y int, z int) string {
+	var buf [64]byte
+	b := strconv.AppendInt(buf[:0], int64(x), 10)
+	b = append(b, '.')
+	b = strconv.AppendInt(b, int64(y), 10)
+	b = append(b, '.')
+	b = strconv.AppendInt(b, int64(z), 10)
+	return string(b)
+}
+
+// LocFromString generates a Loc instance from a string containing the coords in the format 'x.y.z', or in one of the
+// alternate forms accepted by LocConvert
 func LocFromString(loc string) (result Loc, err error) {
 	x,y,z,err := LocConvert(loc)
 	if err == nil {
@@ -62,8 +80,12 @@ func LocFromJSON(jsonIn []byte) (Loc, error) {
 	return result, nil
 }
 
-// LocConvert parses a string of the format 'x.y.z' into the individual elements
+// LocConvert parses a string of the format 'x.y.z' into the individual elements. Axial, offset and doubled coords are
+// also accepted with a prefix, such as 'a:2,-1', 'o:3,4' or 'd:height:1,3'. See convertAlternate for the full list.
 func LocConvert(loc string) (x int, y int, z int, err error) {
+	if strings.Contains(loc, ":") {
+		return convertAlternate(loc)
+	}
 	xyz := strings.Split(loc, ".")
 	if len(xyz) != 3 {
 		return x,y,z,fmt.Errorf("XYZ param must be of the format 'x.y.z'. Got: %s", loc )
@@ -90,7 +112,7 @@ func LocConvert(loc string) (x int, y int, z int, err error) {
 
 // StringForm provides the location in the "x.y.z" format
 func (l Loc) StringForm() string {
-	return fmt.Sprintf( "%d.%d.%d", l.X, l.Y, l.Z )
+	return formatID( l.X, l.Y, l.Z )
 }
 
 // JSONForm provides the location in JSON
@@ -106,9 +128,18 @@ func (l Loc) JSONForm() []byte {
 
 // DistanceFrom returns the distance from this Loc to the specified Loc
 func (l Loc) DistanceFrom(target Loc) int {
-	dx := math.Abs( float64(l.X) - float64(target.X) ) 
-	dy := math.Abs( float64(l.Y) - float64(target.Y) ) 
-	dz := math.Abs( float64(l.Z) - float64(target.Z) ) 
-	max := int( math.Max( math.Max( dx, dy ), dz ) )
-	return max
-}
\ No newline at end of file
+	return cubeDistance( l.X - target.X, l.Y - target.Y, l.Z - target.Z )
+}
+
+// Patched returns the stored loc l with the status of update, and update's properties and attributes where it has
+// any. Writers that only know some of a loc's fields use it so the rest of the stored loc survives the write.
+func (l Loc) Patched(update Loc) Loc {
+	l.Status = update.Status
+	if update.Properties != nil {
+		l.Properties = update.Properties
+	}
+	if len(update.Attributes) > 0 {
+		l.Attributes = update.Attributes
+	}
+	return l
+}
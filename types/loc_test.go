@@ -9,7 +9,7 @@ import (
 )
 
 func TestLocCtor(t* testing.T) {
-	result := Loc{ "3.6.9", 3, 6, 9, "new" } // TODO: remove the hard coded "new"
+	result := Loc{ ID: "3.6.9", X: 3, Y: 6, Z: 9, Status: "new" } // TODO: remove the hard coded "new"
 	assert.IsType(t, Loc{}, result )
 	assert.True( t,
 		result.ID == "3.6.9" && result.X == 3 && result.Y == 6 && result.Z == 9,
@@ -154,8 +154,22 @@ func TestDistanceFrom(t *testing.T) {
 	}
 }
 
-/* func TestFindNeighbors(t *testing.T) {
-	t.Run("PositiveFromOrigin", func(t *testing.T){
-		t.Error(t, "Not implemented")
+func TestPatched(t *testing.T) {
+	stored := Loc{ ID: "1.2.3", X: 1, Y: 2, Z: 3, Status: "new",
+		Properties: &Properties{ Terrain: "forest" }, Attributes: map[string]interface{}{ "owner": "red" } }
+	t.Run("Status only", func(t *testing.T){
+		update, _ := LocFromString("1.2.3")
+		update.Status = "claimed"
+		result := stored.Patched(update)
+		require.Equal(t, "claimed", result.Status)
+		require.Equal(t, stored.Properties, result.Properties, "Properties should survive a status update")
+		require.Equal(t, stored.Attributes, result.Attributes, "Attributes should survive a status update")
 	})
-} */
+	t.Run("Properties replaced", func(t *testing.T){
+		update := Loc{ ID: "1.2.3", X: 1, Y: 2, Z: 3, Status: "new", Properties: &Properties{ Terrain: "water" } }
+		result := stored.Patched(update)
+		require.Equal(t, "water", result.Properties.Terrain)
+		require.Equal(t, stored.Attributes, result.Attributes)
+	})
+}
+
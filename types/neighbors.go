@@ -0,0 +1,65 @@
+package types
+
+// Directions holds the six unit vectors to a hex's neighbors. Walking them in order goes around a hex, so the
+// direction opposite to Directions[i] is Directions[(i+3)%6].
+var Directions = [6]Loc{
+	{ID: "1.-1.0", X: 1, Y: -1, Z: 0},
+	{ID: "1.0.-1", X: 1, Y: 0, Z: -1},
+	{ID: "0.1.-1", X: 0, Y: 1, Z: -1},
+	{ID: "-1.1.0", X: -1, Y: 1, Z: 0},
+	{ID: "-1.0.1", X: -1, Y: 0, Z: 1},
+	{ID: "0.-1.1", X: 0, Y: -1, Z: 1},
+}
+
+// Neighbor returns the adjacent loc in the specified direction, an index into Directions
+func (l Loc) Neighbor(direction int) Loc {
+	return l.Add(Directions[((direction%6)+6)%6])
+}
+
+// Neighbors returns all six adjacent locs, in Directions order
+func (l Loc) Neighbors() [6]Loc {
+	var result [6]Loc
+	for i := range result {
+		result[i] = l.Neighbor(i)
+	}
+	return result
+}
+
+// Ring returns the 6 * radius locs at exactly radius from center. The ring starts at center + radius steps in
+// direction 4 and walks around in Directions order, so the index of each loc grows steadily with its angle around
+// the center. A radius of 0 yields just the center.
+func Ring(center Loc, radius int) []Loc {
+	if radius <= 0 {
+		return []Loc{center}
+	}
+	result := make([]Loc, 0, 6*radius)
+	d := Directions[4]
+	loc := center.withCoords(center.X+d.X*radius, center.Y+d.Y*radius, center.Z+d.Z*radius)
+	for i := 0; i < 6; i++ {
+		for j := 0; j < radius; j++ {
+			result = append(result, loc)
+			loc = loc.Neighbor(i)
+		}
+	}
+	return result
+}
+
+// Lookup returns the loc with the specified ID and whether the grid holds it
+func (g *Grid) Lookup(id string) (Loc, bool) {
+	key, err := KeyFromString(id)
+	if err != nil {
+		return Loc{}, false
+	}
+	return g.Get(key)
+}
+
+// Neighbors returns the locs adjacent to loc that are part of the grid, as stored in the grid
+func (g *Grid) Neighbors(loc Loc) []Loc {
+	result := make([]Loc, 0, 6)
+	for _, d := range Directions {
+		if stored, ok := g.At(loc.X+d.X, loc.Y+d.Y, loc.Z+d.Z); ok {
+			result = append(result, stored)
+		}
+	}
+	return result
+}
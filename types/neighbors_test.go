@@ -0,0 +1,53 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindNeighbors(t *testing.T) {
+	t.Run("PositiveFromOrigin", func(t *testing.T) {
+		origin := newLoc(0, 0, 0)
+		for i, n := range origin.Neighbors() {
+			assert.Equal(t, Directions[i].ID, n.ID)
+			assert.Equal(t, 1, origin.DistanceFrom(n))
+			assert.Equal(t, origin.ID, n.Neighbor(i+3).ID, "Opposite direction should lead back")
+		}
+	})
+	t.Run("InGrid", func(t *testing.T) {
+		g := Grid{}
+		g.BuildHex(2)
+		require.Len(t, g.Neighbors(newLoc(0, 0, 0)), 6)
+		require.Len(t, g.Neighbors(newLoc(2, -2, 0)), 3, "Corner hex only has 3 neighbors inside the grid")
+		require.Len(t, g.Neighbors(newLoc(2, -1, -1)), 4, "Edge hex only has 4 neighbors inside the grid")
+	})
+}
+
+func TestRing(t *testing.T) {
+	center := newLoc(2, -3, 1)
+	require.Equal(t, []Loc{center}, Ring(center, 0))
+	for radius := 1; radius <= 4; radius++ {
+		ring := Ring(center, radius)
+		require.Len(t, ring, 6*radius)
+		seen := map[string]bool{}
+		for i, loc := range ring {
+			require.Equal(t, radius, center.DistanceFrom(loc))
+			require.False(t, seen[loc.ID], "Ring should not repeat a loc")
+			seen[loc.ID] = true
+			next := ring[(i+1)%len(ring)]
+			require.Equal(t, 1, loc.DistanceFrom(next), "Consecutive ring locs should be adjacent")
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	g := Grid{}
+	g.BuildHex(1)
+	loc, ok := g.Lookup("1.-1.0")
+	require.True(t, ok)
+	require.Equal(t, 1, loc.X)
+	_, ok = g.Lookup("5.-5.0")
+	require.False(t, ok)
+}
@@ -0,0 +1,31 @@
+package types
+
+// Properties holds the typed game data of a hex. Zero values are left out of JSON and BSON, so a loc without
+// properties stores exactly as it did before they existed.
+type Properties struct {
+	Terrain   string   `json:"terrain,omitempty" bson:"terrain,omitempty"`
+	Elevation int      `json:"elevation,omitempty" bson:"elevation,omitempty"`
+	MoveCost  int      `json:"moveCost,omitempty" bson:"moveCost,omitempty"`
+	Tags      []string `json:"tags,omitempty" bson:"tags,omitempty"`
+}
+
+// HasTag reports whether the tag is in the list
+func (p *Properties) HasTag(tag string) bool {
+	if p == nil {
+		return false
+	}
+	for _, t := range p.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// TerrainName returns the terrain type, or "" for a nil Properties
+func (p *Properties) TerrainName() string {
+	if p == nil {
+		return ""
+	}
+	return p.Terrain
+}
@@ -0,0 +1,84 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	driverbson "go.mongodb.org/mongo-driver/bson"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func richLoc() Loc {
+	loc := newLoc(2, -1, -1)
+	loc.Properties = &Properties{Terrain: "forest", Elevation: 3, MoveCost: 2, Tags: []string{"forest", "road"}}
+	loc.Attributes = map[string]interface{}{"owner": "red", "gold": 5}
+	return loc
+}
+
+func TestPropertiesJSON(t *testing.T) {
+	plain := newLoc(1, 2, -3)
+	require.JSONEq(t, `{"id":"1.2.-3","x":1,"y":2,"z":-3,"status":"new"}`, string(plain.JSONForm()),
+		"Locs without properties should marshal as they always have")
+
+	loc := richLoc()
+	result, err := LocFromJSON(loc.JSONForm())
+	require.NoError(t, err)
+	require.Equal(t, loc.Properties, result.Properties)
+	require.Equal(t, "red", result.Attributes["owner"])
+	require.Equal(t, float64(5), result.Attributes["gold"], "JSON numbers come back as float64")
+}
+
+func TestPropertiesBSON(t *testing.T) {
+	loc := richLoc()
+	data, err := bson.Marshal(loc)
+	require.NoError(t, err)
+	var result Loc
+	require.NoError(t, bson.Unmarshal(data, &result))
+	require.Equal(t, loc.Properties, result.Properties)
+	require.Equal(t, "red", result.Attributes["owner"])
+	require.Equal(t, 5, result.Attributes["gold"])
+
+	fields := bson.M{}
+	require.NoError(t, bson.Unmarshal(data, fields))
+	require.Equal(t, "forest", fields["properties"].(bson.M)["terrain"], "Terrain should be queryable as properties.terrain")
+
+	data, err = bson.Marshal(newLoc(0, 0, 0))
+	require.NoError(t, err)
+	fields = bson.M{}
+	require.NoError(t, bson.Unmarshal(data, fields))
+	require.NotContains(t, fields, "properties")
+	require.NotContains(t, fields, "attributes")
+}
+
+func TestPropertiesDriverBSON(t *testing.T) {
+	loc := richLoc()
+	data, err := driverbson.Marshal(loc)
+	require.NoError(t, err)
+	var result Loc
+	require.NoError(t, driverbson.Unmarshal(data, &result))
+	require.Equal(t, loc.ID, result.ID)
+	require.Equal(t, loc.Properties, result.Properties)
+	require.EqualValues(t, 5, result.Attributes["gold"])
+
+	fields := driverbson.M{}
+	require.NoError(t, driverbson.Unmarshal(data, &fields))
+	require.Equal(t, loc.ID, fields["_id"], "The ID should be stored as _id")
+	require.Equal(t, "forest", fields["properties"].(driverbson.M)["terrain"], "Terrain should be queryable as properties.terrain")
+}
+
+func TestPropertiesHelpers(t *testing.T) {
+	var none *Properties
+	require.False(t, none.HasTag("forest"))
+	require.Equal(t, "", none.TerrainName())
+	loc := richLoc()
+	require.True(t, loc.Properties.HasTag("road"))
+	require.False(t, loc.Properties.HasTag("river"))
+	require.Equal(t, "forest", loc.Properties.TerrainName())
+}
+
+func TestTransformKeepsProperties(t *testing.T) {
+	moved := richLoc().Rotate(newLoc(0, 0, 0), 1)
+	require.Equal(t, "forest", moved.Properties.Terrain)
+	require.Equal(t, "red", moved.Attributes["owner"])
+	require.NotEqual(t, richLoc().ID, moved.ID)
+}
@@ -0,0 +1,128 @@
+package types
+
+// FloodFill returns every loc reachable from start by stepping between adjacent passable locs. The result
+// is empty if start is not in the grid or is not passable itself.
+func (g *Grid) FloodFill(start Loc, passable func(Loc) bool) map[CubeKey]Loc {
+	result := map[CubeKey]Loc{}
+	first, ok := g.locs[start.Key()]
+	if !ok || !passable(first) {
+		return result
+	}
+	result[first.Key()] = first
+	queue := []Loc{first}
+	for len(queue) > 0 {
+		loc := queue[0]
+		queue = queue[1:]
+		for _, n := range g.Neighbors(loc) {
+			key := n.Key()
+			if _, seen := result[key]; seen || !passable(n) {
+				continue
+			}
+			result[key] = n
+			queue = append(queue, n)
+		}
+	}
+	return result
+}
+
+// ConnectedComponents splits the passable locs of the grid into regions that can't reach each other. Regions are
+// ordered by their first loc in Locs order, so the result is stable for a given grid.
+func (g *Grid) ConnectedComponents(passable func(Loc) bool) []map[CubeKey]Loc {
+	var result []map[CubeKey]Loc
+	seen := map[CubeKey]bool{}
+	for _, loc := range g.Locs() {
+		if seen[loc.Key()] || !passable(loc) {
+			continue
+		}
+		region := g.FloodFill(loc, passable)
+		for key := range region {
+			seen[key] = true
+		}
+		result = append(result, region)
+	}
+	return result
+}
+
+// ArticulationHexes returns the chokepoints of the passable locs: locs whose removal would split the region they are
+// in. The result is in Locs order.
+//
+// This is Tarjan's articulation point algorithm, run with an explicit stack so large regions can't overflow the
+// goroutine stack.
+func (g *Grid) ArticulationHexes(passable func(Loc) bool) []Loc {
+	type frame struct {
+		loc       Loc
+		key       CubeKey
+		parent    CubeKey
+		neighbors []Loc
+		next      int
+		children  int
+	}
+	order := map[CubeKey]int{} // discovery order of each visited loc
+	low := map[CubeKey]int{}   // lowest discovery order reachable from the loc's subtree through one back edge
+	isCut := map[CubeKey]bool{}
+	counter := 0
+
+	for _, root := range g.Locs() {
+		rootKey := root.Key()
+		if _, visited := order[rootKey]; visited || !passable(root) {
+			continue
+		}
+		order[rootKey], low[rootKey] = counter, counter
+		counter++
+		// the root has no parent, and its own key can never be a neighbor
+		stack := []*frame{{loc: root, key: rootKey, parent: rootKey, neighbors: g.passableNeighbors(root, passable)}}
+		for len(stack) > 0 {
+			top := stack[len(stack)-1]
+			if top.next < len(top.neighbors) {
+				n := top.neighbors[top.next]
+				nKey := n.Key()
+				top.next++
+				if _, visited := order[nKey]; visited {
+					if nKey != top.parent && order[nKey] < low[top.key] {
+						low[top.key] = order[nKey]
+					}
+					continue
+				}
+				order[nKey], low[nKey] = counter, counter
+				counter++
+				top.children++
+				stack = append(stack, &frame{loc: n, key: nKey, parent: top.key, neighbors: g.passableNeighbors(n, passable)})
+				continue
+			}
+			// all of top's neighbors are done, so fold its low value into its parent
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				if top.children > 1 {
+					isCut[top.key] = true
+				}
+				continue
+			}
+			parent := stack[len(stack)-1]
+			if low[top.key] < low[parent.key] {
+				low[parent.key] = low[top.key]
+			}
+			if len(stack) > 1 && low[top.key] >= order[parent.key] {
+				isCut[parent.key] = true
+			}
+		}
+	}
+
+	result := []Loc{}
+	for _, loc := range g.Locs() {
+		if isCut[loc.Key()] {
+			result = append(result, loc)
+		}
+	}
+	return result
+}
+
+func (g *Grid) passableNeighbors(loc Loc, passable func(Loc) bool) []Loc {
+	all := g.Neighbors(loc)
+	result := all[:0]
+	for _, n := range all {
+		if passable(n) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
@@ -0,0 +1,104 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFloodFill(t *testing.T) {
+	open := func(l Loc) bool { return l.Status != "wall" }
+
+	t.Run("Open grid", func(t *testing.T) {
+		g := Grid{}
+		g.BuildHex(3)
+		require.Len(t, g.FloodFill(newLoc(0, 0, 0), open), g.Len())
+	})
+	t.Run("Wall splits the grid", func(t *testing.T) {
+		g := Grid{}
+		g.BuildHex(3)
+		// a wall along x = 0 cuts the hexagon in two
+		for y := -3; y <= 3; y++ {
+			SetStatus(&g, "wall", newLoc(0, y, -y).ID)
+		}
+		region := g.FloodFill(newLoc(-1, 0, 1), open)
+		require.Len(t, region, 15)
+		require.NotContains(t, region, NewCubeKey(1, 0, -1))
+	})
+	t.Run("Start blocked or missing", func(t *testing.T) {
+		g := Grid{}
+		g.BuildHex(1)
+		SetStatus(&g, "wall", "0.0.0")
+		require.Len(t, g.FloodFill(newLoc(0, 0, 0), open), 0)
+		require.Len(t, g.FloodFill(newLoc(5, -5, 0), open), 0)
+	})
+}
+
+func TestConnectedComponents(t *testing.T) {
+	open := func(l Loc) bool { return l.Status != "wall" }
+	g := Grid{}
+	g.BuildHex(3)
+	for y := -3; y <= 3; y++ {
+		SetStatus(&g, "wall", newLoc(0, y, -y).ID)
+	}
+	regions := g.ConnectedComponents(open)
+	require.Len(t, regions, 2)
+	require.Contains(t, regions[0], NewCubeKey(-3, 0, 3), "Regions should be ordered by their first loc")
+	require.Len(t, regions[1], 15)
+
+	none := g.ConnectedComponents(func(Loc) bool { return false })
+	require.Len(t, none, 0)
+}
+
+func TestArticulationHexes(t *testing.T) {
+	open := func(l Loc) bool { return l.Status != "wall" }
+
+	t.Run("Line", func(t *testing.T) {
+		g := GridFromLocs([]Loc{newLoc(0, 0, 0), newLoc(1, -1, 0), newLoc(2, -2, 0), newLoc(3, -3, 0)})
+		cuts := g.ArticulationHexes(open)
+		require.Equal(t, []string{"1.-1.0", "2.-2.0"}, ids(cuts), "Every inner hex of a line is a chokepoint")
+	})
+	t.Run("Open hexagon has none", func(t *testing.T) {
+		g := Grid{}
+		g.BuildHex(3)
+		require.Len(t, g.ArticulationHexes(open), 0)
+	})
+	t.Run("Two rooms and a door", func(t *testing.T) {
+		g := Grid{}
+		g.BuildHex(3)
+		for y := -3; y <= 3; y++ {
+			if y != 0 {
+				SetStatus(&g, "wall", newLoc(0, y, -y).ID)
+			}
+		}
+		cuts := g.ArticulationHexes(open)
+		require.Equal(t, []string{"0.0.0"}, ids(cuts), "The gap in the wall is the only chokepoint")
+	})
+	t.Run("Agrees with removing each hex", func(t *testing.T) {
+		g := Grid{}
+		g.BuildHex(4)
+		SetStatus(&g, "wall", "0.0.0", "1.-1.0", "-1.2.-1", "2.1.-3", "-2.-1.3", "0.-3.3", "3.-3.0", "-3.3.0", "1.2.-3")
+		expected := []string{}
+		before := len(g.ConnectedComponents(open))
+		for _, loc := range g.Locs() {
+			if !open(loc) {
+				continue
+			}
+			without := func(l Loc) bool { return open(l) && l.ID != loc.ID }
+			if len(g.ConnectedComponents(without)) > before {
+				expected = append(expected, loc.ID)
+			}
+		}
+		require.Equal(t, expected, ids(g.ArticulationHexes(open)))
+	})
+}
+
+/*** Helper functions ***/
+
+func ids(locs []Loc) []string {
+	result := []string{}
+	for _, loc := range locs {
+		result = append(result, loc.ID)
+	}
+	return result
+}
@@ -0,0 +1,80 @@
+package types
+
+import (
+	"fmt"
+)
+
+// Axis names one of the three cube axes for reflections. AxisQ is X, AxisR is Z and AxisS is Y, matching the axial
+// q = X, r = Z convention used by Layout.
+type Axis string
+
+// Supported reflection axes
+const (
+	AxisQ Axis = "q"
+	AxisR Axis = "r"
+	AxisS Axis = "s"
+)
+
+// withCoords returns a copy of the loc moved to x, y, z. Everything but the coordinates and ID is kept.
+func (l Loc) withCoords(x int, y int, z int) Loc {
+	result := l
+	result.ID, result.X, result.Y, result.Z = formatID(x, y, z), x, y, z
+	return result
+}
+
+// Add returns the loc offset by the vector v
+func (l Loc) Add(v Loc) Loc {
+	return l.withCoords(l.X+v.X, l.Y+v.Y, l.Z+v.Z)
+}
+
+// Sub returns the vector from v to the loc
+func (l Loc) Sub(v Loc) Loc {
+	return l.withCoords(l.X-v.X, l.Y-v.Y, l.Z-v.Z)
+}
+
+// Rotate turns the loc around center by steps of 60°. Positive steps turn clockwise on screen and negative steps
+// counter clockwise.
+func (l Loc) Rotate(center Loc, steps int) Loc {
+	v := l.Sub(center)
+	x, y, z := v.X, v.Y, v.Z
+	for i := ((steps % 6) + 6) % 6; i > 0; i-- {
+		x, y, z = -z, -x, -y
+	}
+	return l.withCoords(center.X+x, center.Y+y, center.Z+z)
+}
+
+// Reflect mirrors the loc across the specified axis through 0,0,0. The coordinate on that axis is kept and the other
+// two are swapped. An unknown axis returns the loc unchanged with an error.
+func (l Loc) Reflect(axis Axis) (Loc, error) {
+	switch axis {
+	case AxisQ:
+		return l.withCoords(l.X, l.Z, l.Y), nil
+	case AxisR:
+		return l.withCoords(l.Y, l.X, l.Z), nil
+	case AxisS:
+		return l.withCoords(l.Z, l.Y, l.X), nil
+	}
+	return l, fmt.Errorf("unknown axis: %q", axis)
+}
+
+// Transform returns a new grid with fn applied to every loc and bounds recomputed to fit. If fn maps two locs onto
+// the same position only one of them is kept.
+func (g *Grid) Transform(fn func(Loc) Loc) Grid {
+	locs := g.Locs()
+	for i, loc := range locs {
+		locs[i] = fn(loc)
+	}
+	return GridFromLocs(locs)
+}
+
+// Stamp copies every loc of piece into the grid, replacing any loc already at the same position, and widens the
+// bounds to cover them. Typically piece is a prefab that has been rotated and translated with Transform.
+func (g *Grid) Stamp(piece Grid) {
+	if len(g.locs) == 0 {
+		*g = GridFromLocs(piece.Locs())
+		return
+	}
+	for _, loc := range piece.Locs() {
+		g.include(loc)
+	}
+}
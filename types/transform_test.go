@@ -0,0 +1,95 @@
+package types
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddSub(t *testing.T) {
+	a := newLoc(1, -3, 2)
+	a.Status = "claimed"
+	b := newLoc(-2, 1, 1)
+	sum := a.Add(b)
+	assert.Equal(t, "-1.-2.3", sum.ID)
+	assert.Equal(t, "claimed", sum.Status, "Arithmetic should keep the status of the receiver")
+	assert.Equal(t, a.ID, sum.Sub(b).ID)
+}
+
+func TestRotate(t *testing.T) {
+	origin := newLoc(0, 0, 0)
+	var cases = []struct {
+		loc      Loc
+		center   Loc
+		steps    int
+		expected string
+	}{
+		{newLoc(1, -1, 0), origin, 1, "0.-1.1"},
+		{newLoc(1, -1, 0), origin, 2, "-1.0.1"},
+		{newLoc(1, -1, 0), origin, 3, "-1.1.0"},
+		{newLoc(1, -1, 0), origin, -1, "1.0.-1"},
+		{newLoc(1, -1, 0), origin, 6, "1.-1.0"},
+		{newLoc(1, -1, 0), origin, -7, "1.0.-1"},
+		{newLoc(3, -2, -1), newLoc(2, -2, 0), 3, "1.-2.1"},
+	}
+	for num, c := range cases {
+		t.Run(fmt.Sprintf("case#%d", num), func(t *testing.T) {
+			actual := c.loc.Rotate(c.center, c.steps)
+			assert.Equal(t, c.expected, actual.ID)
+			assert.Equal(t, c.loc.DistanceFrom(c.center), actual.DistanceFrom(c.center), "Rotation keeps distance from the center")
+		})
+	}
+}
+
+func TestReflect(t *testing.T) {
+	loc := newLoc(3, -1, -2)
+	reflect := func(l Loc, axis Axis) Loc {
+		result, err := l.Reflect(axis)
+		require.NoError(t, err)
+		return result
+	}
+	assert.Equal(t, "3.-2.-1", reflect(loc, AxisQ).ID)
+	assert.Equal(t, "-1.3.-2", reflect(loc, AxisR).ID)
+	assert.Equal(t, "-2.-1.3", reflect(loc, AxisS).ID)
+	assert.Equal(t, loc, reflect(reflect(loc, AxisQ), AxisQ), "Reflecting twice is a no-op")
+
+	result, err := loc.Reflect("w")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown axis")
+	assert.Equal(t, loc, result, "An unknown axis should leave the loc alone")
+}
+
+func TestTransform(t *testing.T) {
+	piece := GridFromLocs([]Loc{newLoc(0, 0, 0), newLoc(1, -1, 0), newLoc(2, -2, 0)})
+	offset := newLoc(10, -5, -5)
+	moved := piece.Transform(func(l Loc) Loc {
+		return l.Rotate(newLoc(0, 0, 0), 2).Add(offset)
+	})
+	require.Equal(t, 3, moved.Len())
+	require.Equal(t, "8.-5.-3", moved.GetLoc("8.-5.-3").ID)
+	require.Equal(t, 8, moved.XMin())
+	require.Equal(t, 10, moved.XMax())
+	require.Equal(t, -5, moved.ZMin())
+	require.Equal(t, -3, moved.ZMax())
+	require.Equal(t, 0, piece.XMin(), "Transform should leave the source grid alone")
+}
+
+func TestStamp(t *testing.T) {
+	g := Grid{}
+	g.BuildHex(2)
+	wall := newLoc(0, 0, 0)
+	wall.Status = "wall"
+	room := GridFromLocs([]Loc{wall, wall.Add(newLoc(3, -3, 0))})
+
+	g.Stamp(room)
+	require.Equal(t, 20, g.Len(), "One loc replaced and one added outside the original grid")
+	require.Equal(t, "wall", g.GetLoc("0.0.0").Status)
+	require.Equal(t, 3, g.XMax())
+
+	empty := Grid{}
+	empty.Stamp(room)
+	require.Equal(t, 2, empty.Len())
+	require.Equal(t, 0, empty.XMin())
+}
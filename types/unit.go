@@ -0,0 +1,87 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Unit is an entity standing on a Loc. Position holds the Loc ID. MovePoints is the budget a unit gets each turn and
+// MovesLeft is what remains of it.
+type Unit struct {
+	ID         string `json:"id" bson:"_id"`
+	Owner      string `json:"owner" bson:"owner"`
+	Position   string `json:"position" bson:"position"`
+	MovePoints int    `json:"movePoints" bson:"movePoints"`
+	MovesLeft  int    `json:"movesLeft" bson:"movesLeft"`
+	HP         int    `json:"hp" bson:"hp"`
+}
+
+// GetID getter for ID field
+func (u Unit) GetID() string {
+	return u.ID
+}
+
+// NewUnit creates a unit at the specified loc with a full movement budget
+func NewUnit(id string, owner string, position Loc, movePoints int, hp int) (result Unit, err error) {
+	result = Unit{ID: id, Owner: owner, Position: position.StringForm(), MovePoints: movePoints, MovesLeft: movePoints, HP: hp}
+	return result, result.Validate()
+}
+
+// UnitFromJSON generates a Unit from JSON. A missing movesLeft defaults to a full budget and the position is
+// normalized to the 'x.y.z' form.
+func UnitFromJSON(jsonIn []byte) (result Unit, err error) {
+	result.MovesLeft = -1
+	if err = json.Unmarshal(jsonIn, &result); err != nil {
+		return result, err
+	}
+	if result.MovesLeft == -1 {
+		result.MovesLeft = result.MovePoints
+	}
+	var pos Loc
+	if pos, err = LocFromString(result.Position); err != nil {
+		return result, fmt.Errorf("bad unit position: %s", err)
+	}
+	result.Position = pos.StringForm()
+	return result, result.Validate()
+}
+
+// Validate checks that the unit has an ID, a position and sane movement and HP values
+func (u Unit) Validate() error {
+	if u.ID == "" {
+		return fmt.Errorf("unit ID must not be empty")
+	}
+	if _, _, _, err := LocConvert(u.Position); err != nil {
+		return fmt.Errorf("bad unit position: %s", err)
+	}
+	if u.MovePoints < 0 || u.MovesLeft < 0 || u.MovesLeft > u.MovePoints {
+		return fmt.Errorf("unit movesLeft must be from 0 to movePoints. Got: %d of %d", u.MovesLeft, u.MovePoints)
+	}
+	if u.HP < 0 {
+		return fmt.Errorf("unit HP must not be negative. Got: %d", u.HP)
+	}
+	return nil
+}
+
+// MoveTo moves the unit to the target, spending one movement point per hex of distance. Units with no HP left can't
+// move.
+func (u *Unit) MoveTo(target Loc) error {
+	if u.HP == 0 {
+		return fmt.Errorf("unit %s has no HP left and can't move", u.ID)
+	}
+	from, err := LocFromString(u.Position)
+	if err != nil {
+		return err
+	}
+	distance := from.DistanceFrom(target)
+	if distance > u.MovesLeft {
+		return fmt.Errorf("unit %s needs %d moves to reach %s but has %d left", u.ID, distance, target.StringForm(), u.MovesLeft)
+	}
+	u.MovesLeft -= distance
+	u.Position = target.StringForm()
+	return nil
+}
+
+// Refresh restores the unit's full movement budget, typically at the start of a turn
+func (u *Unit) Refresh() {
+	u.MovesLeft = u.MovePoints
+}
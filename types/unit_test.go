@@ -0,0 +1,58 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUnit(t *testing.T) {
+	u, err := NewUnit("scout", "red", newLoc(1, -1, 0), 3, 10)
+	require.NoError(t, err)
+	require.Equal(t, Unit{ID: "scout", Owner: "red", Position: "1.-1.0", MovePoints: 3, MovesLeft: 3, HP: 10}, u)
+
+	_, err = NewUnit("", "red", newLoc(0, 0, 0), 3, 10)
+	require.Error(t, err, "Empty ID should be rejected")
+	_, err = NewUnit("scout", "red", newLoc(0, 0, 0), -1, 10)
+	require.Error(t, err, "Negative move points should be rejected")
+	_, err = NewUnit("scout", "red", newLoc(0, 0, 0), 3, -5)
+	require.Error(t, err, "Negative HP should be rejected")
+}
+
+func TestUnitFromJSON(t *testing.T) {
+	u, err := UnitFromJSON([]byte(`{"id": "scout", "owner": "red", "position": "a:2,-1", "movePoints": 4, "hp": 7}`))
+	require.NoError(t, err)
+	require.Equal(t, "2.-1.-1", u.Position, "Position should be normalized")
+	require.Equal(t, 4, u.MovesLeft, "Missing movesLeft should default to a full budget")
+
+	u, err = UnitFromJSON([]byte(`{"id": "scout", "position": "0.0.0", "movePoints": 4, "movesLeft": 0, "hp": 7}`))
+	require.NoError(t, err)
+	require.Equal(t, 0, u.MovesLeft)
+
+	for _, bad := range []string{
+		`{"id": "scout", "position": "0.0", "movePoints": 4}`,
+		`{"id": "scout", "position": "0.0.0", "movePoints": 4, "movesLeft": 5}`,
+		`{"id": "scout"`,
+	} {
+		_, err = UnitFromJSON([]byte(bad))
+		require.Errorf(t, err, "Should reject %s", bad)
+	}
+}
+
+func TestUnitMoveTo(t *testing.T) {
+	u, _ := NewUnit("scout", "red", newLoc(0, 0, 0), 3, 10)
+	require.NoError(t, u.MoveTo(newLoc(2, -1, -1)))
+	require.Equal(t, "2.-1.-1", u.Position)
+	require.Equal(t, 1, u.MovesLeft)
+
+	err := u.MoveTo(newLoc(0, 0, 0))
+	require.Error(t, err, "Moving further than the budget should fail")
+	require.Equal(t, "2.-1.-1", u.Position, "Failed move should leave the unit in place")
+
+	u.Refresh()
+	require.NoError(t, u.MoveTo(newLoc(0, 0, 0)))
+
+	u.HP = 0
+	u.Refresh()
+	require.Error(t, u.MoveTo(newLoc(1, -1, 0)), "Units with no HP should not move")
+}